@@ -11,8 +11,11 @@ import (
 	"chatserver-api/internal/dao/query"
 	"chatserver-api/internal/handler/v1/admin"
 	"chatserver-api/internal/handler/v1/chat"
+	"chatserver-api/internal/handler/v1/gateway"
+	"chatserver-api/internal/handler/v1/kb"
 	"chatserver-api/internal/handler/v1/preset"
 	"chatserver-api/internal/handler/v1/user"
+	"chatserver-api/internal/middleware"
 	"chatserver-api/internal/router"
 	"chatserver-api/internal/service"
 	"chatserver-api/pkg/db"
@@ -23,16 +26,36 @@ func InitRouter(ds db.IDataSource) Router {
 	tk := tokenize.NewTokenizer("./dict")
 	userDao := query.NewUserDao(ds)
 	cdkeyDao := query.NewCDkeyDao(ds)
-	userService := service.NewUserService(userDao, cdkeyDao)
-	userhandler := user.NewUserHandler(userService)
+	sessionService := service.NewSessionService(userDao)
+	loginGuardService := service.NewLoginGuardService(userDao)
+	twoFAService := service.NewTwoFAService(userDao, sessionService, loginGuardService)
+	userService := service.NewUserService(userDao, cdkeyDao, sessionService, twoFAService, loginGuardService)
+	oidcService := service.NewOidcService(userDao, twoFAService, loginGuardService)
+	apiKeyDao := query.NewApiKeyDao(ds)
+	apiKeyService := service.NewApiKeyService(apiKeyDao, userDao)
+	middleware.SetApiKeyAuth(apiKeyService.ApiKeyAuth)
+	middleware.SetRoleLoad(userDao.UserGetRole)
+	accountDao := query.NewAccountDao(ds)
+	accountService := service.NewAccountService(accountDao, sessionService)
+	go accountService.AccountPurgeRun()
+	orderDao := query.NewOrderDao(ds)
+	orderService := service.NewOrderService(orderDao, cdkeyDao)
+	userhandler := user.NewUserHandler(userService, oidcService, sessionService, twoFAService, apiKeyService, accountService, loginGuardService, orderService)
+	kbDao := query.NewKbDao(ds)
+	kbService := service.NewKbService(kbDao, userDao)
+	kbHandler := kb.NewKbHandler(kbService)
 	chatDao := query.NewChatDao(ds)
-	chatService := service.NewChatService(chatDao, userService, tk)
-	chathandler := chat.NewChatHandler(chatService)
+	reportDao := query.NewReportDao(ds)
+	reportService := service.NewReportService(reportDao)
+	chatService := service.NewChatService(chatDao, userService, kbService, reportService, tk)
+	chathandler := chat.NewChatHandler(chatService, kbService)
 	presetDao := query.NewPresetsDao(ds)
 	presetService := service.NewPresetService(presetDao)
 	presetHandler := preset.NewPresetHandler(presetService)
-	adminService := service.NewAdminService(cdkeyDao, userDao)
-	adminHandler := admin.NewAdminHandler(adminService)
-	apiRouter := router.NewApiRouter(userhandler, chathandler, presetHandler, adminHandler)
+	adminService := service.NewAdminService(cdkeyDao, userDao, apiKeyDao, userService, sessionService, tk)
+	adminHandler := admin.NewAdminHandler(adminService, orderService, reportService)
+	gatewayService := service.NewGatewayService(userService, chatService, reportService)
+	gatewayHandler := gateway.NewGatewayHandler(gatewayService)
+	apiRouter := router.NewApiRouter(userhandler, chathandler, presetHandler, adminHandler, kbHandler, gatewayHandler)
 	return apiRouter
 }
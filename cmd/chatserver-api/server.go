@@ -50,6 +50,10 @@ func (s *HttpServer) Run(rs ...Router) {
 	// 设置gin启动模式，必须在创建gin实例之前
 	gin.SetMode(s.config.Mode)
 	g := gin.New()
+	// 只采信可信代理转发的客户端地址，未配置时使用连接地址
+	if err := g.SetTrustedProxies(s.config.TrustedProxies); err != nil {
+		logger.Fatalf("trustedproxies 配置错误:%v", err)
+	}
 	s.routerLoad(g, rs...)
 	// gin validator替换
 	validator.LazyInitGinValidator(s.config.Language)
@@ -17,15 +17,27 @@ const (
 	BalanceCtx    = "balance_ctx"
 	CostTokenCtx  = "cost_token_ctx"
 	JWTTokenCtx   = "token_ctx"
+	SessionIDCtx  = "session_id_ctx"
+	ApiKeyIDCtx   = "api_key_id_ctx"
+	OperatorIDCtx = "operator_id_ctx"
 	PriceRatioCtx = "priceratio_ctx"
+	ModelCtx      = "model_ctx"
+	PresetIDCtx   = "preset_id_ctx"
+	CitationCtx   = "citation_ctx"
+	ProgressCtx   = "progress_ctx"
 
 	InviteReward   = 3
 	RegisterReward = 3
 
+	// CBCKEY 旧版前端密码传输密钥，仅用于兼容，新前端通过 HTTPS 提交明文密码
 	CBCKEY     = "ABCDABCDABCDABCD"
 	CDKEYBASE  = "E8S2DZX9WYLTN6BQA7CP5IK3MJUFR4HV"
 	InviteBase = "E8uvS2pqDZXbcde9WYfiLTNrs6BxQA7CPmn5IyzK3MwJUktFghR4HVaj"
 
+	// PasswordTransportHeader 新版前端提交明文密码时携带 X-Password-Transport: plain
+	PasswordTransportHeader = "X-Password-Transport"
+	PasswordTransportPlain  = "plain"
+
 	// TimeLayout 时间格式
 	DateLayout   = "2006-01-02"
 	TimeLayout   = "2006-01-02 15:04:05"
@@ -44,18 +56,34 @@ const (
 	APITypeAzure   APIType = "AZURE"
 	APITypeAzureAD APIType = "AZURE_AD"
 
-	UserInvitePrefix     = "User_Invite_relation_list:"
-	UserAvatarPrefix     = "User_Avatar_url_list:"
-	UserInviteLinkPrefix = "User_Invite_Link_list:"
-	UserInfoPrefix       = "User_Info_list:"
-	UserBalancePrefix    = "User_Balance_list:"
-	CaptchaPrefix        = "Captchat_list:"
-	PresetPrefix         = "Preset_list:"
-	GiftcardPrefix       = "GiftCard_list:"
-	UserChatIDPrefix     = "User_ChatId_set:"
-	ChatRecordIDPrefix   = "Chat_RecordId_set:"
-	ChatSearchPrefix     = "Chat_Search_list:"
-	QuerySearchPrefix    = "Query_Search_list:"
+	UserInvitePrefix       = "User_Invite_relation_list:"
+	UserAvatarPrefix       = "User_Avatar_url_list:"
+	UserInviteLinkPrefix   = "User_Invite_Link_list:"
+	UserInfoPrefix         = "User_Info_list:"
+	UserBalancePrefix      = "User_Balance_list:"
+	CaptchaPrefix          = "Captchat_list:"
+	OidcStatePrefix        = "Oidc_State_list:"
+	RefreshUsedPrefix      = "Refresh_Used_list:"
+	TwoFALoginPrefix       = "TwoFA_Login_list:"
+	TwoFAPendingPrefix     = "TwoFA_Pending_list:"
+	ApiKeyPrefix           = "Api_Key_list:"
+	AccountDeletePrefix    = "Account_Delete_list:"
+	LoginFailPrefix        = "Login_Fail_list:"
+	LoginLockPrefix        = "Login_Lock_list:"
+	LoginLockCountPrefix   = "Login_LockCount_list:"
+	PresetPrefix           = "Preset_list:"
+	GiftcardPrefix         = "GiftCard_list:"
+	UserChatIDPrefix       = "User_ChatId_set:"
+	ChatRecordIDPrefix     = "Chat_RecordId_set:"
+	ChatSearchPrefix       = "Chat_Search_list:"
+	QuerySearchPrefix      = "Query_Search_list:"
+	QuerySearchIndexPrefix = "Query_Search_index:"
+	CrawlETagPrefix        = "Crawl_ETag_list:"
+	CrawlPagePrefix        = "Crawl_Page_list:"
+	EmbeddingCachePrefix   = "Embedding_Cache_list:"
+	KbQuotaLockPrefix      = "Kb_QuotaLock_list:"
+	GatewayRatePrefix      = "Gateway_Rate_list:"
+	EmbeddingStatKey       = "Embedding_Cache_stat"
 )
 
 var AzureToModel = map[string]string{
@@ -68,6 +96,15 @@ var ModelMaxToken = map[string]int{
 	"gpt-3.5-turbo": 4096,
 }
 
+// ModelUpstreamPrice 上游模型价格（元/千令牌），按 1 美元约 7 元估算，用于报表估算成本，可在配置 report.pricing 中覆盖
+var ModelUpstreamPrice = map[string]float64{
+	"gpt-3.5-turbo":          0.014,
+	"gpt-3.5-turbo-16k":      0.028,
+	"gpt-4":                  0.42,
+	"gpt-4-32k":              0.84,
+	"text-embedding-ada-002": 0.0007,
+}
+
 const (
 	StandardUser = iota + 1
 	RegularMembers
@@ -85,3 +122,125 @@ var RoleToString = map[int]string{
 	Enterprise:     "企业订阅",
 	Administrator:  "管理员",
 }
+
+// 知识库归属类型
+const (
+	KbOwnerUser = "user"
+	KbOwnerTeam = "team"
+)
+
+// 知识库可见性
+const (
+	KbPrivate = iota + 1 // 仅所有者(团队成员)可见
+	KbShared             // 所有者及被共享的成员可见
+	KbPublic             // 所有用户可见，订阅后参与检索
+)
+
+// 知识库访问权限，KbPermManage 不落库，仅由所有者身份推导
+const (
+	KbPermNone = iota
+	KbPermRead
+	KbPermWrite
+	KbPermManage
+)
+
+// KbGlobalId 历史文档所在的全局知识库，所有用户可读，仅管理员可写
+const KbGlobalId = 0
+
+// KbTokenQuota 各用户等级的知识库存储配额(token)，团队知识库按团队所有者等级计算，-1 表示不限
+var KbTokenQuota = map[int]int64{
+	StandardUser:   20000,
+	RegularMembers: 200000,
+	SeniorMember:   1000000,
+	InfiniteMember: 5000000,
+	Enterprise:     20000000,
+	Administrator:  -1,
+}
+
+// 卡密状态，过期由 expired_at 判断
+const (
+	CdKeyUnused = iota
+	CdKeyRedeemed
+	CdKeyRevoked
+)
+
+var CdKeyStatusToString = map[int]string{
+	CdKeyUnused:   "未使用",
+	CdKeyRedeemed: "已兑换",
+	CdKeyRevoked:  "已作废",
+}
+
+// 在线支付订单状态
+const (
+	OrderPending = iota
+	OrderPaid
+	OrderRefunded
+	OrderRefunding
+)
+
+var OrderStatusToString = map[int]string{
+	OrderPending:   "待支付",
+	OrderPaid:      "已支付",
+	OrderRefunded:  "已退款",
+	OrderRefunding: "退款中",
+}
+
+// 订单商品类型
+const OrderItemGiftCard = "giftcard"
+
+// 报表统计来源
+const (
+	ReportSourceChat   = "chat"   // 网页会话消费
+	ReportSourceApi    = "api"    // API Key 调用消费
+	ReportSourceCdKey  = "cdkey"  // 卡密充值，按面额计入
+	ReportSourceOrder  = "order"  // 在线支付
+	ReportSourceRefund = "refund" // 在线支付退款
+)
+
+// ApiKeyTokenPrefix 用户 API Key 的前缀，与 JWT 区分
+const ApiKeyTokenPrefix = "sk-"
+
+// API Key 授权范围
+const (
+	ApiScopeChat      = "chat"
+	ApiScopeEmbedding = "embedding"
+	ApiScopeHistory   = "read-history"
+)
+
+var ApiScopes = []string{ApiScopeChat, ApiScopeEmbedding, ApiScopeHistory}
+
+// 权限标识，格式为 资源:操作
+const (
+	PermPresetWrite = "preset:write"
+	PermKbWrite     = "kb:write"
+	PermAdminCdkey  = "admin:cdkey"
+	PermAdminSystem = "admin:system"
+	PermUserManage  = "user:manage"
+	PermAdminOrder  = "admin:order"
+	PermAdminReport = "admin:report"
+)
+
+var memberPermissions = []string{PermKbWrite}
+
+// RolePermissions 各用户等级拥有的权限
+var RolePermissions = map[int][]string{
+	StandardUser:   memberPermissions,
+	RegularMembers: memberPermissions,
+	SeniorMember:   memberPermissions,
+	InfiniteMember: memberPermissions,
+	Enterprise:     memberPermissions,
+	Administrator:  {PermPresetWrite, PermKbWrite, PermAdminCdkey, PermAdminSystem, PermUserManage, PermAdminOrder, PermAdminReport},
+}
+
+// 登录日志
+const (
+	LogBusinessLogin = "login"
+
+	LoginPassword = "password"
+	LoginOidc     = "oidc"
+	Login2FA      = "2fa"
+
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+	LoginLocked  = "locked"
+)
@@ -0,0 +1,27 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 10:20:44
+ * @LastEditTime: 2023-06-25 10:20:44
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/dao/account.go
+ */
+package dao
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"context"
+	"time"
+)
+
+type AccountDao interface {
+	AccountUserGet(ctx context.Context, userId int64) (entity.User, error)
+	AccountChatsGet(ctx context.Context, userId int64) ([]entity.Chat, error)
+	AccountBillsGet(ctx context.Context, userId int64) ([]entity.Bill, error)
+	AccountDocumentsGet(ctx context.Context, userId int64) ([]model.AccountDocument, error)
+	AccountIdentityIs(ctx context.Context, userId int64) (bool, error)
+	AccountDeleteSchedule(ctx context.Context, userId int64, deleteAt *time.Time) error
+	AccountDeleteDueGet(ctx context.Context, now time.Time) ([]int64, error)
+	AccountErase(ctx context.Context, userId int64) (chatIds []int64, keyHashes []string, err error)
+	AccountPurge(ctx context.Context, before time.Time) (userIds, chatIds []int64, err error)
+}
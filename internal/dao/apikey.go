@@ -0,0 +1,22 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 09:31:52
+ * @LastEditTime: 2023-06-24 09:31:52
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/dao/apikey.go
+ */
+package dao
+
+import (
+	"chatserver-api/internal/model/entity"
+	"context"
+)
+
+type ApiKeyDao interface {
+	ApiKeyCreate(ctx context.Context, key *entity.ApiKey) error
+	ApiKeyGetByHash(ctx context.Context, hash string) (entity.ApiKey, error)
+	ApiKeyList(ctx context.Context, userId int64) ([]entity.ApiKey, error)
+	ApiKeyRevoke(ctx context.Context, userId, keyId int64) (entity.ApiKey, error)
+	ApiKeyTouch(ctx context.Context, keyId int64) error
+	ApiKeyUsage(ctx context.Context, userId int64) (map[int64]float64, error)
+}
@@ -11,13 +11,19 @@ import (
 	"chatserver-api/internal/model"
 	"chatserver-api/internal/model/entity"
 	"context"
+	"time"
 )
 
 type CDkeyDao interface {
 	CdKeyGenerate(ctx context.Context, Cdkeylist []entity.CdKey) (err error)
-	CdKeyQuery(ctx context.Context, cdkeyId int64) (model.CdKeyAmount, error)
-	CdKeyDelete(ctx context.Context, cdkeyId int64) (err error)
+	CdKeyGet(ctx context.Context, cdkeyId int64) (entity.CdKey, error)
+	CdKeyRedeem(ctx context.Context, redemption *entity.CdKeyRedemption, bill *entity.Bill) error
+	CdKeyList(ctx context.Context, cardId, batchId int64, status string, now time.Time, page, pagesize int) ([]entity.CdKey, int64, error)
+	CdKeyBatchGet(ctx context.Context, batchId int64) ([]entity.CdKey, error)
+	CdKeyRevoke(ctx context.Context, keyIds []int64, batchId int64) (int64, error)
+	CdKeyRedemptionList(ctx context.Context, userId, cardId int64, page, pagesize int) ([]entity.CdKeyRedemption, int64, error)
 	GiftCardCreate(ctx context.Context, giftcard *entity.GiftCard) error
+	GiftCardGet(ctx context.Context, cardId int64) (entity.GiftCard, error)
 	GiftCardListGet(ctx context.Context) ([]model.GiftCardOne, error)
 	GiftCardUpdate(ctx context.Context, giftcard *entity.GiftCard) error
 }
@@ -20,6 +20,9 @@ type ChatDao interface {
 	ChatRecordSave(ctx context.Context, record *entity.Record) error
 	ChatRecordClear(ctx context.Context, chatId int64) error
 	DocEmbeddingSave(ctx context.Context, docs *entity.Documents) error
+	DocHashListGet(ctx context.Context, kbId int64, hashes []string) ([]string, error)
+	EmbeddingCacheGet(ctx context.Context, hashes []string) ([]entity.EmbeddingCache, error)
+	EmbeddingCacheSave(ctx context.Context, caches []entity.EmbeddingCache) error
 	ChatRecordUpdate(ctx context.Context, record *entity.Record) error
 	ChatRecordGet(ctx context.Context, chatId int64, memory int16) ([]model.RecordOne, error)
 	ChatRecordIdGet(ctx context.Context, chatId int64) ([]int64, error)
@@ -29,8 +32,9 @@ type ChatDao interface {
 	ChatDeleteOne(ctx context.Context, userId, chatId int64) error
 	ChatDeleteAll(ctx context.Context, userId int64) error
 	ChatUserVerify(ctx context.Context, userId, chatId int64) (int64, error)
+	ChatPresetPrivilegeGet(ctx context.Context, presetId int64) (int, error)
 	ChatCostUpdate(ctx context.Context, userId int64, balance float64) error
 	ChatBalanceGet(ctx context.Context, userId int64) (model.UserBalance, error)
 	ChatRecordVerify(ctx context.Context, recordid int64) (int64, error)
-	ChatEmbeddingCompare(ctx context.Context, question pgvector.Vector, classify string) ([]model.DocsCompare, error)
+	ChatEmbeddingCompare(ctx context.Context, question pgvector.Vector, classify string, kbIds []int64, limit int) ([]model.DocsCompare, error)
 }
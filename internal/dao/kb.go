@@ -0,0 +1,33 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-14 11:02:45
+ * @LastEditTime: 2023-06-14 17:32:10
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/dao/kb.go
+ */
+package dao
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"context"
+)
+
+type KbDao interface {
+	KbCreateNew(ctx context.Context, kb *entity.KnowledgeBase) error
+	KbUpdate(ctx context.Context, kb *entity.KnowledgeBase) error
+	KbDelete(ctx context.Context, kbId int64) error
+	KbGet(ctx context.Context, kbId int64) (entity.KnowledgeBase, error)
+	KbListGet(ctx context.Context, userId int64) ([]model.KbOne, error)
+	KbReadableIds(ctx context.Context, userId int64) ([]int64, error)
+	KbTokenUsageByUser(ctx context.Context, userId int64) (int64, error)
+	KbMemberGet(ctx context.Context, kbId, userId int64) (entity.KbMember, error)
+	KbMemberSave(ctx context.Context, member *entity.KbMember) error
+	KbMemberDelete(ctx context.Context, kbId, userId int64) error
+	TeamCreateNew(ctx context.Context, team *entity.Team, owner *entity.TeamMember) error
+	TeamGet(ctx context.Context, teamId int64) (entity.Team, error)
+	TeamListGet(ctx context.Context, userId int64) ([]entity.Team, error)
+	TeamMemberIs(ctx context.Context, teamId, userId int64) (bool, error)
+	TeamMemberAdd(ctx context.Context, member *entity.TeamMember) error
+	TeamMemberDelete(ctx context.Context, teamId, userId int64) error
+}
@@ -0,0 +1,27 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 11:24:52
+ * @LastEditTime: 2023-06-26 11:24:52
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/dao/order.go
+ */
+package dao
+
+import (
+	"chatserver-api/internal/model/entity"
+	"context"
+	"errors"
+)
+
+// ErrBalanceInsufficient 扣减余额时余额不足
+var ErrBalanceInsufficient = errors.New("balance insufficient")
+
+type OrderDao interface {
+	OrderCreate(ctx context.Context, order *entity.Order) error
+	OrderGet(ctx context.Context, orderId int64) (entity.Order, error)
+	OrderList(ctx context.Context, userId int64, status string, page, pagesize int) ([]entity.Order, int64, error)
+	OrderPaid(ctx context.Context, order *entity.Order, bill *entity.Bill) error
+	OrderRefundBegin(ctx context.Context, order *entity.Order, bill *entity.Bill) error
+	OrderRefundFinish(ctx context.Context, order *entity.Order) error
+	OrderRefundCancel(ctx context.Context, order *entity.Order, bill *entity.Bill) error
+}
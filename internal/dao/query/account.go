@@ -0,0 +1,177 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 10:31:09
+ * @LastEditTime: 2023-06-25 10:31:09
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/dao/query/account.go
+ */
+package query
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/db"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var _ dao.AccountDao = (*accountDao)(nil)
+
+type accountDao struct {
+	ds db.IDataSource
+}
+
+func NewAccountDao(_ds db.IDataSource) *accountDao {
+	return &accountDao{
+		ds: _ds,
+	}
+}
+
+func (ad *accountDao) AccountUserGet(ctx context.Context, userId int64) (entity.User, error) {
+	var user entity.User
+	err := ad.ds.Master().Where("id = ?", userId).First(&user).Error
+	return user, err
+}
+
+func (ad *accountDao) AccountChatsGet(ctx context.Context, userId int64) ([]entity.Chat, error) {
+	var chats []entity.Chat
+	err := ad.ds.Master().Where("user_id = ?", userId).Order("id").
+		Preload("Records", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).Find(&chats).Error
+	return chats, err
+}
+
+func (ad *accountDao) AccountBillsGet(ctx context.Context, userId int64) ([]entity.Bill, error) {
+	var bills []entity.Bill
+	err := ad.ds.Master().Where("user_id = ?", userId).Order("id").Find(&bills).Error
+	return bills, err
+}
+
+func (ad *accountDao) AccountDocumentsGet(ctx context.Context, userId int64) ([]model.AccountDocument, error) {
+	var docs []model.AccountDocument
+	err := ad.ds.Master().Model(&entity.Documents{}).
+		Select("embed.documents.kb_id, kb.kb_name, embed.documents.title, embed.documents.page, embed.documents.body, embed.documents.created_at").
+		Joins("JOIN embed.knowledge_base kb ON kb.id = embed.documents.kb_id AND kb.is_del = 0").
+		Where("kb.owner_type = ? AND kb.owner_id = ?", consts.KbOwnerUser, userId).
+		Order("embed.documents.kb_id, embed.documents.id").Find(&docs).Error
+	return docs, err
+}
+
+// AccountIdentityIs 用户是否绑定了单点登录身份
+func (ad *accountDao) AccountIdentityIs(ctx context.Context, userId int64) (bool, error) {
+	var count int64
+	err := ad.ds.Master().Model(&entity.UserIdentity{}).Where("user_id = ?", userId).Count(&count).Error
+	return count > 0, err
+}
+
+func (ad *accountDao) AccountDeleteSchedule(ctx context.Context, userId int64, deleteAt *time.Time) error {
+	return ad.ds.Master().Model(&entity.User{}).Where("id = ?", userId).Update("delete_at", deleteAt).Error
+}
+
+func (ad *accountDao) AccountDeleteDueGet(ctx context.Context, now time.Time) ([]int64, error) {
+	var userIds []int64
+	err := ad.ds.Master().Model(&entity.User{}).Where("delete_at IS NOT NULL AND delete_at <= ?", now).Pluck("id", &userIds).Error
+	return userIds, err
+}
+
+// AccountErase 软删除用户及其会话、个人知识库和所拥有的团队，登录凭据直接删除
+func (ad *accountDao) AccountErase(ctx context.Context, userId int64) (chatIds []int64, keyHashes []string, err error) {
+	err = ad.ds.Master().Transaction(func(tx *gorm.DB) error {
+		var teamIds []int64
+		if err := tx.Model(&entity.Chat{}).Where("user_id = ?", userId).Pluck("id", &chatIds).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.ApiKey{}).Where("user_id = ?", userId).Pluck("key_hash", &keyHashes).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.Team{}).Where("owner_id = ?", userId).Pluck("id", &teamIds).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("chat_id IN ?", chatIds).Delete(&entity.Record{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", chatIds).Delete(&entity.Chat{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("(owner_type = ? AND owner_id = ?) OR (owner_type = ? AND owner_id IN ?)",
+			consts.KbOwnerUser, userId, consts.KbOwnerTeam, teamIds).Delete(&entity.KnowledgeBase{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", teamIds).Delete(&entity.Team{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR team_id IN ?", userId, teamIds).Delete(&entity.TeamMember{}).Error; err != nil {
+			return err
+		}
+		for _, m := range []interface{}{
+			&entity.KbMember{}, &entity.UserSession{}, &entity.ApiKey{},
+			&entity.UserTotp{}, &entity.UserRecoveryCode{}, &entity.UserIdentity{},
+		} {
+			if err := tx.Where("user_id = ?", userId).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&entity.User{Id: userId}).Error
+	})
+	return
+}
+
+// AccountPurge 彻底删除 before 之前软删除的会话、知识库和团队及其关联数据；
+// 软删除的用户只清除个人资料和日志，用户行保留为匿名记录，账单、订单、兑换记录和报表作为财务记录保留
+func (ad *accountDao) AccountPurge(ctx context.Context, before time.Time) (userIds, chatIds []int64, err error) {
+	const expired = "is_del = 1 AND deleted_at < ?"
+	err = ad.ds.Master().Transaction(func(tx *gorm.DB) error {
+		var kbIds, teamIds []int64
+		// 已匿名的用户密码为空，不再重复处理
+		if err := tx.Unscoped().Model(&entity.User{}).Where(expired, before).Where("password <> ''").Pluck("id", &userIds).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&entity.Chat{}).Where(expired, before).Or("user_id IN ?", userIds).Pluck("id", &chatIds).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&entity.KnowledgeBase{}).Where(expired, before).Pluck("id", &kbIds).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&entity.Team{}).Where(expired, before).Pluck("id", &teamIds).Error; err != nil {
+			return err
+		}
+		steps := []struct {
+			model interface{}
+			query string
+			args  []interface{}
+		}{
+			{&entity.Record{}, "(" + expired + ") OR chat_id IN ?", []interface{}{before, chatIds}},
+			{&entity.Chat{}, "id IN ?", []interface{}{chatIds}},
+			{&entity.Documents{}, "kb_id IN ?", []interface{}{kbIds}},
+			{&entity.KbMember{}, "kb_id IN ?", []interface{}{kbIds}},
+			{&entity.KnowledgeBase{}, "id IN ?", []interface{}{kbIds}},
+			{&entity.TeamMember{}, "team_id IN ?", []interface{}{teamIds}},
+			{&entity.Team{}, "id IN ?", []interface{}{teamIds}},
+			{&entity.Invite{}, "user_id IN ?", []interface{}{userIds}},
+			{&entity.UserLog{}, "user_id IN ?", []interface{}{userIds}},
+		}
+		for _, s := range steps {
+			if err := tx.Unscoped().Where(s.query, s.args...).Delete(s.model).Error; err != nil {
+				return err
+			}
+		}
+		if len(userIds) == 0 {
+			return nil
+		}
+		return tx.Unscoped().Model(&entity.User{}).Where("id IN ?", userIds).Updates(map[string]interface{}{
+			"username":      gorm.Expr("'deleted_' || id"),
+			"nickname":      "已注销用户",
+			"email":         "",
+			"phone":         nil,
+			"avatar_url":    "",
+			"password":      "",
+			"registered_ip": "",
+			"ban_reason":    "",
+			"delete_at":     nil,
+		}).Error
+	})
+	return
+}
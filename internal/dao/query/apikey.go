@@ -0,0 +1,80 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 09:38:05
+ * @LastEditTime: 2023-06-24 09:38:05
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/dao/query/apikey.go
+ */
+package query
+
+import (
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/db"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var _ dao.ApiKeyDao = (*apiKeyDao)(nil)
+
+type apiKeyDao struct {
+	ds db.IDataSource
+}
+
+func NewApiKeyDao(_ds db.IDataSource) *apiKeyDao {
+	return &apiKeyDao{
+		ds: _ds,
+	}
+}
+
+func (ad *apiKeyDao) ApiKeyCreate(ctx context.Context, key *entity.ApiKey) error {
+	return ad.ds.Master().Create(key).Error
+}
+
+func (ad *apiKeyDao) ApiKeyGetByHash(ctx context.Context, hash string) (entity.ApiKey, error) {
+	var key entity.ApiKey
+	err := ad.ds.Master().Where("key_hash = ?", hash).First(&key).Error
+	return key, err
+}
+
+func (ad *apiKeyDao) ApiKeyList(ctx context.Context, userId int64) ([]entity.ApiKey, error) {
+	var keys []entity.ApiKey
+	err := ad.ds.Master().Where("user_id = ? AND is_revoked = ?", userId, false).Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// ApiKeyRevoke 注销 API Key，返回注销前的记录用于清理缓存
+func (ad *apiKeyDao) ApiKeyRevoke(ctx context.Context, userId, keyId int64) (entity.ApiKey, error) {
+	var key entity.ApiKey
+	res := ad.ds.Master().Model(&key).Clauses(clause.Returning{}).
+		Where("id = ? AND user_id = ? AND is_revoked = ?", keyId, userId, false).
+		Update("is_revoked", true)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return key, gorm.ErrRecordNotFound
+	}
+	return key, res.Error
+}
+
+func (ad *apiKeyDao) ApiKeyTouch(ctx context.Context, keyId int64) error {
+	return ad.ds.Master().Model(&entity.ApiKey{}).Where("id = ?", keyId).Update("last_used_at", time.Now()).Error
+}
+
+// ApiKeyUsage 按 API Key 汇总用户的消费
+func (ad *apiKeyDao) ApiKeyUsage(ctx context.Context, userId int64) (map[int64]float64, error) {
+	var rows []struct {
+		ApiKeyId int64
+		Cost     float64
+	}
+	err := ad.ds.Master().Model(&entity.Bill{}).
+		Select("api_key_id, -SUM(cost_change) AS cost").
+		Where("user_id = ? AND api_key_id <> 0 AND cost_change < 0", userId).
+		Group("api_key_id").Scan(&rows).Error
+	usage := make(map[int64]float64, len(rows))
+	for _, r := range rows {
+		usage[r.ApiKeyId] = r.Cost
+	}
+	return usage, err
+}
@@ -8,11 +8,15 @@
 package query
 
 import (
+	"chatserver-api/internal/consts"
 	"chatserver-api/internal/dao"
 	"chatserver-api/internal/model"
 	"chatserver-api/internal/model/entity"
 	"chatserver-api/pkg/db"
 	"context"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 var _ dao.CDkeyDao = (*cdkeyDao)(nil)
@@ -26,14 +30,107 @@ func NewCDkeyDao(_ds db.IDataSource) *cdkeyDao {
 		ds: _ds,
 	}
 }
-func (cd *cdkeyDao) CdKeyDelete(ctx context.Context, cdkeyId int64) (err error) {
-	return cd.ds.Master().Delete(&entity.CdKey{Id: cdkeyId}).Error
+func (cd *cdkeyDao) CdKeyGet(ctx context.Context, cdkeyId int64) (entity.CdKey, error) {
+	var cdkey entity.CdKey
+	err := cd.ds.Master().Where("id = ?", cdkeyId).First(&cdkey).Error
+	return cdkey, err
 }
 
-func (cd *cdkeyDao) CdKeyQuery(ctx context.Context, cdkeyId int64) (model.CdKeyAmount, error) {
-	var cdkey model.CdKeyAmount
-	err := cd.ds.Master().InnerJoins("CdKeys", cd.ds.Master().Where(&entity.CdKey{Id: cdkeyId})).Model(&entity.GiftCard{}).Find(&cdkey).Error
-	return cdkey, err
+// CdKeyRedeem 在同一事务中核销卡密、增加余额并写入账单和兑换记录；
+// 卡密仅在未使用且未过期时可被核销，并发兑换同一卡密时只有一个成功，其余返回 gorm.ErrRecordNotFound
+func (cd *cdkeyDao) CdKeyRedeem(ctx context.Context, redemption *entity.CdKeyRedemption, bill *entity.Bill) error {
+	return cd.ds.Master().Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&entity.CdKey{}).
+			Where("id = ? AND code_key = ? AND status = ?", redemption.CdKeyId, redemption.CodeKey, consts.CdKeyUnused).
+			Where("expired_at IS NULL OR expired_at > ?", now).
+			Updates(map[string]interface{}{"status": consts.CdKeyRedeemed, "redeemed_by": redemption.UserId, "redeemed_at": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		var card entity.GiftCard
+		if err := tx.Unscoped().Where("id = ?", redemption.GiftCardId).First(&card).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.User{}).Where("id = ?", redemption.UserId).
+			Update("balance", gorm.Expr("balance + ?", card.CardAmount)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.User{}).Where("id = ?", redemption.UserId).Select("balance").Scan(&bill.Balance).Error; err != nil {
+			return err
+		}
+		bill.CostChange = card.CardAmount
+		if err := tx.Create(bill).Error; err != nil {
+			return err
+		}
+		redemption.Amount = card.CardAmount
+		if err := tx.Create(redemption).Error; err != nil {
+			return err
+		}
+		return reportRevenueAdd(tx, consts.ReportSourceCdKey, card.CardAmount)
+	})
+}
+
+// CdKeyList 分页查询卡密，cardId、batchId 为 0 时不过滤
+func (cd *cdkeyDao) CdKeyList(ctx context.Context, cardId, batchId int64, status string, now time.Time, page, pagesize int) (keys []entity.CdKey, total int64, err error) {
+	tx := cd.ds.Master().Model(&entity.CdKey{})
+	if cardId != 0 {
+		tx = tx.Where("giftcard_id = ?", cardId)
+	}
+	if batchId != 0 {
+		tx = tx.Where("batch_id = ?", batchId)
+	}
+	switch status {
+	case "unused":
+		tx = tx.Where("status = ? AND (expired_at IS NULL OR expired_at > ?)", consts.CdKeyUnused, now)
+	case "expired":
+		tx = tx.Where("status = ? AND expired_at <= ?", consts.CdKeyUnused, now)
+	case "redeemed":
+		tx = tx.Where("status = ?", consts.CdKeyRedeemed)
+	case "revoked":
+		tx = tx.Where("status = ?", consts.CdKeyRevoked)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return
+	}
+	err = tx.Order("id desc").Offset((page - 1) * pagesize).Limit(pagesize).Find(&keys).Error
+	return
+}
+
+func (cd *cdkeyDao) CdKeyBatchGet(ctx context.Context, batchId int64) ([]entity.CdKey, error) {
+	var keys []entity.CdKey
+	err := cd.ds.Master().Where("batch_id = ?", batchId).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// CdKeyRevoke 作废未使用的卡密，返回作废数量
+func (cd *cdkeyDao) CdKeyRevoke(ctx context.Context, keyIds []int64, batchId int64) (int64, error) {
+	tx := cd.ds.Master().Model(&entity.CdKey{}).Where("status = ?", consts.CdKeyUnused)
+	if batchId != 0 {
+		tx = tx.Where("id IN ? OR batch_id = ?", keyIds, batchId)
+	} else {
+		tx = tx.Where("id IN ?", keyIds)
+	}
+	res := tx.Update("status", consts.CdKeyRevoked)
+	return res.RowsAffected, res.Error
+}
+
+func (cd *cdkeyDao) CdKeyRedemptionList(ctx context.Context, userId, cardId int64, page, pagesize int) (list []entity.CdKeyRedemption, total int64, err error) {
+	tx := cd.ds.Master().Model(&entity.CdKeyRedemption{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if cardId != 0 {
+		tx = tx.Where("giftcard_id = ?", cardId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return
+	}
+	err = tx.Order("id desc").Offset((page - 1) * pagesize).Limit(pagesize).Find(&list).Error
+	return
 }
 
 func (cd *cdkeyDao) CdKeyGenerate(ctx context.Context, Cdkeylist []entity.CdKey) error {
@@ -48,6 +145,12 @@ func (cd *cdkeyDao) GiftCardUpdate(ctx context.Context, giftcard *entity.GiftCar
 	return cd.ds.Master().Updates(giftcard).Error
 }
 
+func (cd *cdkeyDao) GiftCardGet(ctx context.Context, cardId int64) (entity.GiftCard, error) {
+	var card entity.GiftCard
+	err := cd.ds.Master().Where("id = ?", cardId).First(&card).Error
+	return card, err
+}
+
 func (cd *cdkeyDao) GiftCardListGet(ctx context.Context) ([]model.GiftCardOne, error) {
 	var cardlist []model.GiftCardOne
 	err := cd.ds.Master().Model(&entity.GiftCard{}).Find(&cardlist).Error
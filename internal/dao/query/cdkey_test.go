@@ -0,0 +1,109 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-29 17:05:26
+ * @LastEditTime: 2023-06-29 17:05:26
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/dao/query/cdkey_test.go
+ */
+package query
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/db"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/utils/uuid"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// testDataSource 连接 configs/config.yml 中配置的数据库，没有配置文件时跳过
+func testDataSource(t *testing.T) db.IDataSource {
+	t.Helper()
+	const path = "../../../configs/config.yml"
+	if _, err := os.Stat(path); err != nil {
+		t.Skip("configs/config.yml not found, skipping database test")
+	}
+	c := config.Load(path)
+	logger.InitLogger(&c.LogConfig, c.AppName)
+	ds := db.NewDefaultPostGre(c.DBConfig)
+	t.Cleanup(ds.Close)
+	return ds
+}
+
+func Test_cdkeyDao_CdKeyRedeem_concurrent(t *testing.T) {
+	ds := testDataSource(t)
+	node := uuid.NewNode(11)
+	tx := ds.Master()
+	card := entity.GiftCard{Id: node.GenSnowID(), CardName: "test", CardAmount: 10}
+	key := entity.CdKey{Id: node.GenSnowID(), GiftCardId: card.Id, CodeKey: "test-cdkey", Status: consts.CdKeyUnused}
+	users := []entity.User{
+		{Id: node.GenSnowID(), Username: "cdkey_test_a", Nickname: "a", Email: "cdkey_test_a@example.com", Role: consts.StandardUser},
+		{Id: node.GenSnowID(), Username: "cdkey_test_b", Nickname: "b", Email: "cdkey_test_b@example.com", Role: consts.StandardUser},
+	}
+	if err := tx.Create(&card).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Create(&key).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	userIds := []int64{users[0].Id, users[1].Id}
+	t.Cleanup(func() {
+		tx.Unscoped().Where("cdkey_id = ?", key.Id).Delete(&entity.CdKeyRedemption{})
+		tx.Unscoped().Where("user_id IN ?", userIds).Delete(&entity.Bill{})
+		tx.Unscoped().Delete(&key)
+		tx.Unscoped().Delete(&card)
+		tx.Unscoped().Delete(&users)
+	})
+
+	// 两个用户同时兑换同一张卡密，只有一个成功
+	cd := NewCDkeyDao(ds)
+	errs := make([]error, len(users))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, u := range users {
+		wg.Add(1)
+		go func(i int, userId int64) {
+			defer wg.Done()
+			<-start
+			redemption := entity.CdKeyRedemption{Id: node.GenSnowID(), CdKeyId: key.Id, CodeKey: key.CodeKey, GiftCardId: card.Id, UserId: userId}
+			bill := entity.Bill{Id: node.GenSnowID(), UserId: userId, CostComment: fmt.Sprintf("test-%d", i)}
+			errs[i] = cd.CdKeyRedeem(context.Background(), &redemption, &bill)
+		}(i, u.Id)
+	}
+	close(start)
+	wg.Wait()
+
+	succeeded := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			t.Errorf("CdKeyRedeem() user %d error = %v", i, err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("CdKeyRedeem() succeeded %d times, want 1: %v", succeeded, errs)
+	}
+	reportRevenueAdd(tx, consts.ReportSourceCdKey, -card.CardAmount)
+
+	var balance float64
+	tx.Model(&entity.User{}).Where("id IN ?", userIds).Select("COALESCE(SUM(balance), 0)").Scan(&balance)
+	var redemptions, bills int64
+	tx.Model(&entity.CdKeyRedemption{}).Where("cdkey_id = ?", key.Id).Count(&redemptions)
+	tx.Model(&entity.Bill{}).Where("user_id IN ?", userIds).Count(&bills)
+	if balance != card.CardAmount || redemptions != 1 || bills != 1 {
+		t.Errorf("balance = %v, redemptions = %d, bills = %d, want %v, 1, 1", balance, redemptions, bills, card.CardAmount)
+	}
+}
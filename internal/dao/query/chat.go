@@ -56,6 +56,23 @@ func (cd *chatDao) DocEmbeddingSave(ctx context.Context, docs *entity.Documents)
 	return cd.ds.Master().Create(docs).Error
 }
 
+// DocHashListGet 返回知识库中已存在的内容哈希
+func (cd *chatDao) DocHashListGet(ctx context.Context, kbId int64, hashes []string) ([]string, error) {
+	var exists []string
+	err := cd.ds.Master().Model(&entity.Documents{}).Where("kb_id = ? AND content_hash IN ?", kbId, hashes).Distinct().Pluck("content_hash", &exists).Error
+	return exists, err
+}
+
+func (cd *chatDao) EmbeddingCacheGet(ctx context.Context, hashes []string) ([]entity.EmbeddingCache, error) {
+	var caches []entity.EmbeddingCache
+	err := cd.ds.Master().Where("content_hash IN ?", hashes).Find(&caches).Error
+	return caches, err
+}
+
+func (cd *chatDao) EmbeddingCacheSave(ctx context.Context, caches []entity.EmbeddingCache) error {
+	return cd.ds.Master().Clauses(clause.OnConflict{DoNothing: true}).Create(&caches).Error
+}
+
 func (cd *chatDao) ChatRecordVerify(ctx context.Context, recordid int64) (int64, error) {
 	var count int64
 	err := cd.ds.Master().Model(&entity.Record{}).Where("id = ? ", recordid).Count(&count).Error
@@ -119,6 +136,12 @@ func (cd *chatDao) ChatUserVerify(ctx context.Context, userId, chatId int64) (in
 	return count, err
 }
 
+func (cd *chatDao) ChatPresetPrivilegeGet(ctx context.Context, presetId int64) (int, error) {
+	var preset entity.Preset
+	err := cd.ds.Master().Select("privilege").Where("id = ?", presetId).Take(&preset).Error
+	return preset.Privilege, err
+}
+
 func (cd *chatDao) ChatCostUpdate(ctx context.Context, userId int64, balance float64) error {
 	return cd.ds.Master().Model(&entity.User{}).Where("id  = ? ", userId).UpdateColumn("balance", balance).Error
 }
@@ -129,8 +152,8 @@ func (cd *chatDao) ChatBalanceGet(ctx context.Context, userId int64) (model.User
 	return userbalance, err
 }
 
-func (cd *chatDao) ChatEmbeddingCompare(ctx context.Context, question pgvector.Vector, classify string) ([]model.DocsCompare, error) {
+func (cd *chatDao) ChatEmbeddingCompare(ctx context.Context, question pgvector.Vector, classify string, kbIds []int64, limit int) ([]model.DocsCompare, error) {
 	var docsbody []model.DocsCompare
-	err := cd.ds.Master().Model(&entity.Documents{}).Clauses(clause.OrderBy{Expression: clause.Expr{SQL: "Embedding <=> ? ", Vars: []interface{}{question}}}).Limit(5).Where("classify = ?", classify).Find(&docsbody).Error
+	err := cd.ds.Master().Model(&entity.Documents{}).Select("id, title, page, body, tokens, embedding, embedding <=> ? AS distance", question).Clauses(clause.OrderBy{Expression: clause.Expr{SQL: "Embedding <=> ? ", Vars: []interface{}{question}}}).Limit(limit).Where("classify = ? AND kb_id IN ?", classify, kbIds).Find(&docsbody).Error
 	return docsbody, err
 }
@@ -168,7 +168,7 @@ func Test_chatDao_ChatEmbeddingCompare(t *testing.T) {
 			cd := &chatDao{
 				ds: ds,
 			}
-			got, err := cd.ChatEmbeddingCompare(tt.args.ctx, tt.args.question, tt.args.classify)
+			got, err := cd.ChatEmbeddingCompare(tt.args.ctx, tt.args.question, tt.args.classify, []int64{0}, 5)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("chatDao.ChatEmbeddingCompare() error = %v, wantErr %v", err, tt.wantErr)
 				return
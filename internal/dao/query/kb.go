@@ -0,0 +1,147 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-14 11:15:20
+ * @LastEditTime: 2023-06-14 17:32:10
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/dao/query/kb.go
+ */
+package query
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/db"
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var _ dao.KbDao = (*kbDao)(nil)
+
+type kbDao struct {
+	ds db.IDataSource
+}
+
+func NewKbDao(_ds db.IDataSource) *kbDao {
+	return &kbDao{
+		ds: _ds,
+	}
+}
+
+func (kd *kbDao) KbCreateNew(ctx context.Context, kb *entity.KnowledgeBase) error {
+	return kd.ds.Master().Create(kb).Error
+}
+
+func (kd *kbDao) KbUpdate(ctx context.Context, kb *entity.KnowledgeBase) error {
+	return kd.ds.Master().Updates(kb).Error
+}
+
+// KbDelete 删除知识库及其下全部文档和共享成员
+func (kd *kbDao) KbDelete(ctx context.Context, kbId int64) error {
+	return kd.ds.Master().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("kb_id = ?", kbId).Delete(&entity.Documents{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("kb_id = ?", kbId).Delete(&entity.KbMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&entity.KnowledgeBase{Id: kbId}).Error
+	})
+}
+
+func (kd *kbDao) KbGet(ctx context.Context, kbId int64) (entity.KnowledgeBase, error) {
+	var kb entity.KnowledgeBase
+	err := kd.ds.Master().Where("id = ?", kbId).First(&kb).Error
+	return kb, err
+}
+
+// KbListGet 用户可见的知识库：自己的、所在团队的、共享给自己的以及公开的
+func (kd *kbDao) KbListGet(ctx context.Context, userId int64) ([]model.KbOne, error) {
+	var kblist []model.KbOne
+	err := kd.ds.Master().Model(&entity.KnowledgeBase{}).Where(kd.readableCond(userId)).
+		Or("visibility = ?", consts.KbPublic).Order("created_at desc").Find(&kblist).Error
+	return kblist, err
+}
+
+// KbReadableIds 参与检索的知识库：自己的、所在团队的以及共享或订阅的，不包含未订阅的公开知识库
+func (kd *kbDao) KbReadableIds(ctx context.Context, userId int64) ([]int64, error) {
+	var ids []int64
+	err := kd.ds.Master().Model(&entity.KnowledgeBase{}).Where(kd.readableCond(userId)).Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (kd *kbDao) readableCond(userId int64) *gorm.DB {
+	master := kd.ds.Master()
+	teams := master.Model(&entity.TeamMember{}).Select("team_id").Where("user_id = ?", userId)
+	shared := master.Model(&entity.KbMember{}).Select("kb_id").Where("user_id = ?", userId)
+	return master.Where("owner_type = ? AND owner_id = ?", consts.KbOwnerUser, userId).
+		Or("owner_type = ? AND owner_id IN (?)", consts.KbOwnerTeam, teams).
+		Or("visibility <> ? AND id IN (?)", consts.KbPrivate, shared)
+}
+
+// KbTokenUsageByUser 统计用户个人知识库和其拥有的团队知识库已存储的token数，两者共用一份配额
+func (kd *kbDao) KbTokenUsageByUser(ctx context.Context, userId int64) (int64, error) {
+	var used int64
+	teams := kd.ds.Master().Model(&entity.Team{}).Select("id").Where("owner_id = ?", userId)
+	kbs := kd.ds.Master().Model(&entity.KnowledgeBase{}).Select("id").
+		Where("(owner_type = ? AND owner_id = ?) OR (owner_type = ? AND owner_id IN (?))", consts.KbOwnerUser, userId, consts.KbOwnerTeam, teams)
+	err := kd.ds.Master().Model(&entity.Documents{}).Select("COALESCE(SUM(tokens), 0)").Where("kb_id IN (?)", kbs).Scan(&used).Error
+	return used, err
+}
+
+func (kd *kbDao) KbMemberGet(ctx context.Context, kbId, userId int64) (entity.KbMember, error) {
+	var member entity.KbMember
+	err := kd.ds.Master().Where("kb_id = ? AND user_id = ?", kbId, userId).Find(&member).Error
+	return member, err
+}
+
+// KbMemberSave 新增共享成员，已存在时更新权限
+func (kd *kbDao) KbMemberSave(ctx context.Context, member *entity.KbMember) error {
+	return kd.ds.Master().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kb_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"permission", "updated_at"}),
+	}).Create(member).Error
+}
+
+func (kd *kbDao) KbMemberDelete(ctx context.Context, kbId, userId int64) error {
+	return kd.ds.Master().Where("kb_id = ? AND user_id = ?", kbId, userId).Delete(&entity.KbMember{}).Error
+}
+
+func (kd *kbDao) TeamCreateNew(ctx context.Context, team *entity.Team, owner *entity.TeamMember) error {
+	return kd.ds.Master().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(team).Error; err != nil {
+			return err
+		}
+		return tx.Create(owner).Error
+	})
+}
+
+func (kd *kbDao) TeamGet(ctx context.Context, teamId int64) (entity.Team, error) {
+	var team entity.Team
+	err := kd.ds.Master().Where("id = ?", teamId).First(&team).Error
+	return team, err
+}
+
+func (kd *kbDao) TeamListGet(ctx context.Context, userId int64) ([]entity.Team, error) {
+	var teams []entity.Team
+	members := kd.ds.Master().Model(&entity.TeamMember{}).Select("team_id").Where("user_id = ?", userId)
+	err := kd.ds.Master().Where("id IN (?)", members).Find(&teams).Error
+	return teams, err
+}
+
+func (kd *kbDao) TeamMemberIs(ctx context.Context, teamId, userId int64) (bool, error) {
+	var count int64
+	err := kd.ds.Master().Model(&entity.TeamMember{}).Where("team_id = ? AND user_id = ?", teamId, userId).Count(&count).Error
+	return count > 0, err
+}
+
+func (kd *kbDao) TeamMemberAdd(ctx context.Context, member *entity.TeamMember) error {
+	return kd.ds.Master().Clauses(clause.OnConflict{DoNothing: true}).Create(member).Error
+}
+
+func (kd *kbDao) TeamMemberDelete(ctx context.Context, teamId, userId int64) error {
+	return kd.ds.Master().Where("team_id = ? AND user_id = ?", teamId, userId).Delete(&entity.TeamMember{}).Error
+}
@@ -0,0 +1,108 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-27 16:40:27
+ * @LastEditTime: 2023-06-27 16:40:27
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/dao/query/kb_test.go
+ */
+package query
+
+import (
+	"chatserver-api/pkg/pgvector"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dryRunSource 只生成 SQL 不连接数据库，生成的语句记录在 sqls 中
+type dryRunSource struct {
+	db   *gorm.DB
+	sqls *[]string
+}
+
+func (d dryRunSource) Master() *gorm.DB { return d.db }
+func (d dryRunSource) Close()           {}
+
+type sqlRecorder struct {
+	logger.Interface
+	sqls *[]string
+}
+
+func (r sqlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	*r.sqls = append(*r.sqls, sql)
+}
+
+func newDryRunSource(t *testing.T) dryRunSource {
+	t.Helper()
+	sqls := &[]string{}
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 dbname=dryrun"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               sqlRecorder{Interface: logger.Discard, sqls: sqls},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dryRunSource{db: db, sqls: sqls}
+}
+
+func (d dryRunSource) lastSQL() string {
+	if len(*d.sqls) == 0 {
+		return ""
+	}
+	return (*d.sqls)[len(*d.sqls)-1]
+}
+
+func Test_kbDao_KbReadableIds(t *testing.T) {
+	ds := newDryRunSource(t)
+	kd := NewKbDao(ds)
+	if _, err := kd.KbReadableIds(context.Background(), 42); err != nil {
+		t.Fatal(err)
+	}
+	sql := ds.lastSQL()
+	wants := []string{
+		`FROM "embed"."knowledge_base"`,
+		// 三个条件作为整体与软删除条件组合，避免 OR 绕过软删除
+		`WHERE ((owner_type = 'user' AND owner_id = 42)`,
+		`OR (owner_type = 'team' AND owner_id IN (SELECT "team_id" FROM "public"."team_member" WHERE user_id = 42))`,
+		`OR (visibility <> 1 AND id IN (SELECT "kb_id" FROM "embed"."kb_member" WHERE user_id = 42)))`,
+		`AND "knowledge_base"."is_del" = 0`,
+	}
+	for _, want := range wants {
+		if !strings.Contains(sql, want) {
+			t.Errorf("KbReadableIds() sql = %s\nmissing %s", sql, want)
+		}
+	}
+}
+
+func Test_kbDao_KbListGet(t *testing.T) {
+	ds := newDryRunSource(t)
+	kd := NewKbDao(ds)
+	if _, err := kd.KbListGet(context.Background(), 42); err != nil {
+		t.Fatal(err)
+	}
+	sql := ds.lastSQL()
+	if !strings.Contains(sql, `OR visibility = 3) AND "knowledge_base"."is_del" = 0`) {
+		t.Errorf("KbListGet() sql = %s", sql)
+	}
+}
+
+func Test_chatDao_ChatEmbeddingCompare_kbScope(t *testing.T) {
+	ds := newDryRunSource(t)
+	cd := NewChatDao(ds)
+	if _, err := cd.ChatEmbeddingCompare(context.Background(), pgvector.NewVector([]float32{0.1, 0.2}), "manual", []int64{7, 0}, 5); err != nil {
+		t.Fatal(err)
+	}
+	sql := ds.lastSQL()
+	for _, want := range []string{"SELECT id, title, page, body", "classify = 'manual' AND kb_id IN (7,0)", "LIMIT 5"} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("ChatEmbeddingCompare() sql = %s\nmissing %s", sql, want)
+		}
+	}
+}
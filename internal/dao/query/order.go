@@ -0,0 +1,153 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 11:31:08
+ * @LastEditTime: 2023-06-26 11:31:08
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/dao/query/order.go
+ */
+package query
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/db"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var _ dao.OrderDao = (*orderDao)(nil)
+
+type orderDao struct {
+	ds db.IDataSource
+}
+
+func NewOrderDao(_ds db.IDataSource) *orderDao {
+	return &orderDao{
+		ds: _ds,
+	}
+}
+
+func (od *orderDao) OrderCreate(ctx context.Context, order *entity.Order) error {
+	return od.ds.Master().Create(order).Error
+}
+
+func (od *orderDao) OrderGet(ctx context.Context, orderId int64) (entity.Order, error) {
+	var order entity.Order
+	err := od.ds.Master().Where("id = ?", orderId).First(&order).Error
+	return order, err
+}
+
+// OrderList 分页查询订单，userId 为 0 时不过滤
+func (od *orderDao) OrderList(ctx context.Context, userId int64, status string, page, pagesize int) (orders []entity.Order, total int64, err error) {
+	tx := od.ds.Master().Model(&entity.Order{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	switch status {
+	case "pending":
+		tx = tx.Where("status = ?", consts.OrderPending)
+	case "paid":
+		tx = tx.Where("status = ?", consts.OrderPaid)
+	case "refunding":
+		tx = tx.Where("status = ?", consts.OrderRefunding)
+	case "refunded":
+		tx = tx.Where("status = ?", consts.OrderRefunded)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return
+	}
+	err = tx.Order("id desc").Offset((page - 1) * pagesize).Limit(pagesize).Find(&orders).Error
+	return
+}
+
+// OrderPaid 在同一事务中将待支付订单置为已支付、增加余额并写入账单；
+// 订单已处理过时返回 gorm.ErrRecordNotFound，重复的支付通知不会重复入账
+func (od *orderDao) OrderPaid(ctx context.Context, order *entity.Order, bill *entity.Bill) error {
+	return od.ds.Master().Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&entity.Order{}).Where("id = ? AND status = ?", order.Id, consts.OrderPending).
+			Updates(map[string]interface{}{"status": consts.OrderPaid, "trade_no": order.TradeNo, "paid_at": time.Now()})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := od.billCreate(tx, order.UserId, order.Credit, bill); err != nil {
+			return err
+		}
+		return reportRevenueAdd(tx, consts.ReportSourceOrder, order.Amount)
+	})
+}
+
+// OrderRefundBegin 在同一事务中将已支付订单置为退款中、扣回到账余额并写入账单，
+// 提交后再调用支付平台退款；订单不是已支付状态时返回 gorm.ErrRecordNotFound，
+// 余额不足时返回 dao.ErrBalanceInsufficient
+func (od *orderDao) OrderRefundBegin(ctx context.Context, order *entity.Order, bill *entity.Bill) error {
+	return od.ds.Master().Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&entity.Order{}).Where("id = ? AND status = ?", order.Id, consts.OrderPaid).
+			Update("status", consts.OrderRefunding)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return od.billCreate(tx, order.UserId, -order.Credit, bill)
+	})
+}
+
+// OrderRefundFinish 支付平台退款成功后将退款中订单置为已退款并计入退款报表
+func (od *orderDao) OrderRefundFinish(ctx context.Context, order *entity.Order) error {
+	return od.ds.Master().Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&entity.Order{}).Where("id = ? AND status = ?", order.Id, consts.OrderRefunding).
+			Updates(map[string]interface{}{"status": consts.OrderRefunded, "refunded_at": time.Now()})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return reportRevenueAdd(tx, consts.ReportSourceRefund, order.Amount)
+	})
+}
+
+// OrderRefundCancel 支付平台退款失败后将退款中订单恢复为已支付，返还扣回的余额并写入账单
+func (od *orderDao) OrderRefundCancel(ctx context.Context, order *entity.Order, bill *entity.Bill) error {
+	return od.ds.Master().Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&entity.Order{}).Where("id = ? AND status = ?", order.Id, consts.OrderRefunding).
+			Update("status", consts.OrderPaid)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return od.billCreate(tx, order.UserId, order.Credit, bill)
+	})
+}
+
+// billCreate 原子增减余额并写入账单，扣减时余额不足返回 dao.ErrBalanceInsufficient
+func (od *orderDao) billCreate(tx *gorm.DB, userId int64, amount float64, bill *entity.Bill) error {
+	sql := `UPDATE public."user" SET balance = balance + ?, updated_at = now() WHERE id = ?`
+	args := []interface{}{amount, userId}
+	if amount < 0 {
+		sql += " AND balance >= ?"
+		args = append(args, -amount)
+	}
+	res := tx.Raw(sql+" RETURNING balance", args...).Scan(&bill.Balance)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if amount < 0 {
+			return dao.ErrBalanceInsufficient
+		}
+		return gorm.ErrRecordNotFound
+	}
+	bill.UserId = userId
+	bill.CostChange = amount
+	return tx.Create(bill).Error
+}
@@ -0,0 +1,108 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 16:08:55
+ * @LastEditTime: 2023-06-26 16:08:55
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/dao/query/report.go
+ */
+package query
+
+import (
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/db"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var _ dao.ReportDao = (*reportDao)(nil)
+
+// reportGroups 报表分组对应的维度字段和名称字段
+var reportGroups = map[string][2]string{
+	"day":    {"to_char(r.day, 'YYYY-MM-DD')", "''"},
+	"model":  {"r.model", "''"},
+	"source": {"r.source", "''"},
+	"preset": {"CAST(r.preset_id AS text)", "COALESCE(p.preset_name, '')"},
+	"user":   {"CAST(r.user_id AS text)", "COALESCE(u.username, '')"},
+}
+
+type reportDao struct {
+	ds db.IDataSource
+}
+
+func NewReportDao(_ds db.IDataSource) *reportDao {
+	return &reportDao{
+		ds: _ds,
+	}
+}
+
+// reportDay 汇总表按本地日期统计
+func reportDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// ReportUsageAdd 将一次扣费累加到当天的消费汇总
+func (rd *reportDao) ReportUsageAdd(ctx context.Context, usage *entity.ReportUsageDaily) error {
+	usage.Day = reportDay(time.Now())
+	return rd.ds.Master().Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "day"}, {Name: "user_id"}, {Name: "preset_id"}, {Name: "model"}, {Name: "source"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"requests": gorm.Expr("report_usage_daily.requests + EXCLUDED.requests"),
+			"tokens":   gorm.Expr("report_usage_daily.tokens + EXCLUDED.tokens"),
+			"charge":   gorm.Expr("report_usage_daily.charge + EXCLUDED.charge"),
+			"cost":     gorm.Expr("report_usage_daily.cost + EXCLUDED.cost"),
+		}),
+	}).Create(usage).Error
+}
+
+// reportRevenueAdd 在入账事务中累加当天的收入汇总
+func reportRevenueAdd(tx *gorm.DB, source string, amount float64) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "day"}, {Name: "source"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":  gorm.Expr("report_revenue_daily.count + EXCLUDED.count"),
+			"amount": gorm.Expr("report_revenue_daily.amount + EXCLUDED.amount"),
+		}),
+	}).Create(&entity.ReportRevenueDaily{Day: reportDay(time.Now()), Source: source, Count: 1, Amount: amount}).Error
+}
+
+// ReportUsageGroup 按维度汇总消费，按天分组时按日期排序，其余按收费从高到低排序，limit 为 0 时不限制
+func (rd *reportDao) ReportUsageGroup(ctx context.Context, group string, start, end time.Time, limit int) (rows []model.ReportUsageRow, err error) {
+	g, ok := reportGroups[group]
+	if !ok {
+		g = reportGroups["day"]
+	}
+	tx := rd.ds.Master().Table("public.report_usage_daily AS r").
+		Select(g[0]+" AS dim_key, "+g[1]+" AS dim_name, SUM(r.requests) AS requests, SUM(r.tokens) AS tokens, SUM(r.charge) AS charge, SUM(r.cost) AS cost").
+		Where("r.day BETWEEN ? AND ?", start, end)
+	switch group {
+	case "preset":
+		tx = tx.Joins("LEFT JOIN public.preset p ON p.id = r.preset_id")
+	case "user":
+		tx = tx.Joins(`LEFT JOIN public."user" u ON u.id = r.user_id`)
+	}
+	tx = tx.Group(g[0] + ", " + g[1])
+	if group == "day" || !ok {
+		tx = tx.Order("dim_key")
+	} else {
+		tx = tx.Order("charge DESC")
+	}
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+	err = tx.Scan(&rows).Error
+	return
+}
+
+func (rd *reportDao) ReportRevenueGet(ctx context.Context, start, end time.Time) (items []model.ReportRevenueItem, err error) {
+	err = rd.ds.Master().Model(&entity.ReportRevenueDaily{}).
+		Select("to_char(day, 'YYYY-MM-DD') AS day, source, SUM(count) AS count, SUM(amount) AS amount").
+		Where("day BETWEEN ? AND ?", start, end).
+		Group("day, source").Order("day").Scan(&items).Error
+	return
+}
@@ -8,11 +8,15 @@
 package query
 
 import (
+	"chatserver-api/internal/consts"
 	"chatserver-api/internal/dao"
 	"chatserver-api/internal/model"
 	"chatserver-api/internal/model/entity"
 	"chatserver-api/pkg/db"
 	"context"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 var _ dao.UserDao = (*userDao)(nil)
@@ -39,8 +43,19 @@ func (ud *userDao) UserDelete(ctx context.Context, userId int64) error {
 	return ud.ds.Master().Unscoped().Delete(&entity.User{Id: userId}).Error
 }
 
-func (ud *userDao) UserBillCreate(ctx context.Context, bill *entity.Bill) error {
-	return ud.ds.Master().Create(bill).Error
+// UserBalanceChange 在同一事务中按 bill.CostChange 原子增减余额并写入账单，bill.Balance 回填为变动后的余额
+func (ud *userDao) UserBalanceChange(ctx context.Context, bill *entity.Bill) error {
+	return ud.ds.Master().Transaction(func(tx *gorm.DB) error {
+		res := tx.Raw(`UPDATE public."user" SET balance = balance + ?, updated_at = now() WHERE id = ? AND is_del = 0 RETURNING balance`,
+			bill.CostChange, bill.UserId).Scan(&bill.Balance)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(bill).Error
+	})
 }
 
 func (ud *userDao) UserBillGet(ctx context.Context, userId int64, page, pagesize int, start, end string) ([]model.UserBillRes, error) {
@@ -49,6 +64,29 @@ func (ud *userDao) UserBillGet(ctx context.Context, userId int64, page, pagesize
 	return bills, err
 }
 
+func (ud *userDao) UserLogCreate(ctx context.Context, log *entity.UserLog) error {
+	return ud.ds.Master().Create(log).Error
+}
+
+func (ud *userDao) UserLogList(ctx context.Context, userId int64, business string, limit int) ([]entity.UserLog, error) {
+	var logs []entity.UserLog
+	err := ud.ds.Master().Where("user_id = ? AND business = ?", userId, business).Order("id desc").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+// UserLogDeviceCount 返回用户成功登录的总次数及使用该设备成功登录的次数
+func (ud *userDao) UserLogDeviceCount(ctx context.Context, userId int64, device string) (total, seen int64, err error) {
+	var counts struct {
+		Total int64
+		Seen  int64
+	}
+	err = ud.ds.Master().Model(&entity.UserLog{}).
+		Select("COUNT(*) AS total, COUNT(*) FILTER (WHERE device = ?) AS seen", device).
+		Where("user_id = ? AND business = ? AND result = ?", userId, consts.LogBusinessLogin, consts.LoginSuccess).
+		Scan(&counts).Error
+	return counts.Total, counts.Seen, err
+}
+
 func (ud *userDao) UserGetRole(ctx context.Context, userId int64) (int, error) {
 	var role int
 	err := ud.ds.Master().Model(&entity.User{}).Where("id = ?", userId).Select("role").Find(&role).Error
@@ -118,3 +156,164 @@ func (ud *userDao) UserVerifyUserName(ctx context.Context, username string) (cou
 func (ud *userDao) UserUpdateNickName(ctx context.Context, userId int64, nickname string) error {
 	return ud.ds.Master().Model(&entity.User{}).Where("id = ?", userId).Update("nickname", nickname).Error
 }
+
+func (ud *userDao) UserIdentityGet(ctx context.Context, issuer, subject string) (entity.UserIdentity, error) {
+	var identity entity.UserIdentity
+	err := ud.ds.Master().Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+	return identity, err
+}
+
+func (ud *userDao) UserIdentityCreate(ctx context.Context, identity *entity.UserIdentity) error {
+	return ud.ds.Master().Create(identity).Error
+}
+
+// UserCreateWithIdentity 首次通过身份提供方登录时同时创建用户和身份
+func (ud *userDao) UserCreateWithIdentity(ctx context.Context, user *entity.User, identity *entity.UserIdentity) error {
+	return ud.ds.Master().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return tx.Create(identity).Error
+	})
+}
+
+func (ud *userDao) UserSessionCreate(ctx context.Context, session *entity.UserSession) error {
+	return ud.ds.Master().Create(session).Error
+}
+
+func (ud *userDao) UserSessionGetByHash(ctx context.Context, hash string) (entity.UserSession, error) {
+	var session entity.UserSession
+	err := ud.ds.Master().Where("refresh_hash = ?", hash).First(&session).Error
+	return session, err
+}
+
+// UserSessionRotate 仅当刷新 token 仍为 oldHash 且会话未注销时更换，并发刷新时只有一个请求成功
+func (ud *userDao) UserSessionRotate(ctx context.Context, session *entity.UserSession, oldHash string) (bool, error) {
+	res := ud.ds.Master().Model(&entity.UserSession{}).
+		Where("id = ? AND refresh_hash = ? AND is_revoked = ?", session.Id, oldHash, false).
+		Updates(map[string]interface{}{
+			"refresh_hash": session.RefreshHash,
+			"ip":           session.Ip,
+			"user_agent":   session.UserAgent,
+			"device":       session.Device,
+			"last_used_at": session.LastUsedAt,
+			"expired_at":   session.ExpiredAt,
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// UserSessionList 返回用户未注销且未过期的会话，最近使用的在前
+func (ud *userDao) UserSessionList(ctx context.Context, userId int64) ([]entity.UserSession, error) {
+	var sessions []entity.UserSession
+	err := ud.ds.Master().Where("user_id = ? AND is_revoked = ? AND expired_at > ?", userId, false, time.Now()).
+		Order("last_used_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// UserSessionRevoke 注销属于该用户的会话，返回实际注销的会话ID
+func (ud *userDao) UserSessionRevoke(ctx context.Context, userId int64, sessionIds []int64) ([]int64, error) {
+	var revoked []int64
+	err := ud.ds.Master().Raw(`UPDATE public.user_session SET is_revoked = true, updated_at = now() WHERE user_id = ? AND id IN ? RETURNING id`,
+		userId, sessionIds).Scan(&revoked).Error
+	return revoked, err
+}
+
+func (ud *userDao) UserTotpGet(ctx context.Context, userId int64) (entity.UserTotp, error) {
+	var totp entity.UserTotp
+	err := ud.ds.Master().Where("user_id = ?", userId).First(&totp).Error
+	return totp, err
+}
+
+// UserTotpCreate 开启两步验证，同时保存恢复码
+func (ud *userDao) UserTotpCreate(ctx context.Context, totp *entity.UserTotp, codes []entity.UserRecoveryCode) error {
+	return ud.ds.Master().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", totp.UserId).Delete(&entity.UserRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(totp).Error; err != nil {
+			return err
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (ud *userDao) UserTotpDelete(ctx context.Context, userId int64) error {
+	return ud.ds.Master().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&entity.UserRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userId).Delete(&entity.UserTotp{}).Error
+	})
+}
+
+// UserTotpUse 记录已使用的时间步，时间步不大于上次使用的时返回 false
+func (ud *userDao) UserTotpUse(ctx context.Context, userId, counter int64) (bool, error) {
+	res := ud.ds.Master().Model(&entity.UserTotp{}).
+		Where("user_id = ? AND last_counter < ?", userId, counter).
+		Update("last_counter", counter)
+	return res.RowsAffected == 1, res.Error
+}
+
+// UserRecoveryCodeUse 使用恢复码，恢复码不存在或已使用时返回 false
+func (ud *userDao) UserRecoveryCodeUse(ctx context.Context, userId int64, hash string) (bool, error) {
+	res := ud.ds.Master().Model(&entity.UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND is_used = ?", userId, hash, false).
+		Update("is_used", true)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (ud *userDao) UserRecoveryCodeReset(ctx context.Context, userId int64, codes []entity.UserRecoveryCode) error {
+	return ud.ds.Master().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&entity.UserRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (ud *userDao) UserRecoveryCodeCount(ctx context.Context, userId int64) (count int64, err error) {
+	err = ud.ds.Master().Model(&entity.UserRecoveryCode{}).Where("user_id = ? AND is_used = ?", userId, false).Count(&count).Error
+	return
+}
+
+// UserSearch 按条件分页查询用户，包括已计划注销的用户
+func (ud *userDao) UserSearch(ctx context.Context, req model.AdminUserListReq) (users []entity.User, total int64, err error) {
+	tx := ud.ds.Master().Model(&entity.User{})
+	if req.Username != "" {
+		tx = tx.Where("username LIKE ?", "%"+req.Username+"%")
+	}
+	if req.Email != "" {
+		tx = tx.Where("email LIKE ?", "%"+req.Email+"%")
+	}
+	if req.RegisteredIp != "" {
+		tx = tx.Where("registered_ip LIKE ?", req.RegisteredIp+"%")
+	}
+	if req.Role != 0 {
+		tx = tx.Where("role = ?", req.Role)
+	}
+	if req.Start != 0 {
+		tx = tx.Where("created_at >= ?", time.UnixMilli(req.Start))
+	}
+	if req.End != 0 {
+		tx = tx.Where("created_at < ?", time.UnixMilli(req.End))
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return
+	}
+	err = tx.Order("id desc").Offset((req.Page - 1) * req.PageSize).Limit(req.PageSize).Find(&users).Error
+	return
+}
+
+func (ud *userDao) UserBillPage(ctx context.Context, userId int64, page, pagesize int) (bills []entity.Bill, total int64, err error) {
+	tx := ud.ds.Master().Model(&entity.Bill{}).Where("user_id = ?", userId)
+	if err = tx.Count(&total).Error; err != nil {
+		return
+	}
+	err = tx.Order("id desc").Offset((page - 1) * pagesize).Limit(pagesize).Find(&bills).Error
+	return
+}
+
+func (ud *userDao) UserBanUpdate(ctx context.Context, userId int64, banned bool, reason string) error {
+	return ud.ds.Master().Model(&entity.User{}).Where("id = ?", userId).
+		Updates(map[string]interface{}{"is_banned": banned, "ban_reason": reason}).Error
+}
@@ -0,0 +1,21 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 16:01:09
+ * @LastEditTime: 2023-06-26 16:01:09
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/dao/report.go
+ */
+package dao
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"context"
+	"time"
+)
+
+type ReportDao interface {
+	ReportUsageAdd(ctx context.Context, usage *entity.ReportUsageDaily) error
+	ReportUsageGroup(ctx context.Context, group string, start, end time.Time, limit int) ([]model.ReportUsageRow, error)
+	ReportRevenueGet(ctx context.Context, start, end time.Time) ([]model.ReportRevenueItem, error)
+}
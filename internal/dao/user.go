@@ -29,6 +29,28 @@ type UserDao interface {
 	UserInviteGetByUser(ctx context.Context, userId int64) (entity.Invite, error)
 	UserInviteGetByCode(ctx context.Context, code string) (entity.Invite, error)
 	UserInviteUpdate(ctx context.Context, invite *entity.Invite) error
-	UserBillCreate(ctx context.Context, bill *entity.Bill) error
+	UserBalanceChange(ctx context.Context, bill *entity.Bill) error
+	UserLogCreate(ctx context.Context, log *entity.UserLog) error
+	UserLogList(ctx context.Context, userId int64, business string, limit int) ([]entity.UserLog, error)
+	UserLogDeviceCount(ctx context.Context, userId int64, device string) (total, seen int64, err error)
 	UserBillGet(ctx context.Context, userId int64, page, pagesize int, start, end string) ([]model.UserBillRes, error)
+	UserGetByEmail(ctx context.Context, email string) (entity.User, error)
+	UserIdentityGet(ctx context.Context, issuer, subject string) (entity.UserIdentity, error)
+	UserIdentityCreate(ctx context.Context, identity *entity.UserIdentity) error
+	UserCreateWithIdentity(ctx context.Context, user *entity.User, identity *entity.UserIdentity) error
+	UserSessionCreate(ctx context.Context, session *entity.UserSession) error
+	UserSessionGetByHash(ctx context.Context, hash string) (entity.UserSession, error)
+	UserSessionRotate(ctx context.Context, session *entity.UserSession, oldHash string) (bool, error)
+	UserSessionList(ctx context.Context, userId int64) ([]entity.UserSession, error)
+	UserSessionRevoke(ctx context.Context, userId int64, sessionIds []int64) ([]int64, error)
+	UserTotpGet(ctx context.Context, userId int64) (entity.UserTotp, error)
+	UserTotpCreate(ctx context.Context, totp *entity.UserTotp, codes []entity.UserRecoveryCode) error
+	UserTotpDelete(ctx context.Context, userId int64) error
+	UserTotpUse(ctx context.Context, userId, counter int64) (bool, error)
+	UserRecoveryCodeUse(ctx context.Context, userId int64, hash string) (bool, error)
+	UserRecoveryCodeReset(ctx context.Context, userId int64, codes []entity.UserRecoveryCode) error
+	UserRecoveryCodeCount(ctx context.Context, userId int64) (int64, error)
+	UserSearch(ctx context.Context, req model.AdminUserListReq) ([]entity.User, int64, error)
+	UserBillPage(ctx context.Context, userId int64, page, pagesize int) ([]entity.Bill, int64, error)
+	UserBanUpdate(ctx context.Context, userId int64, banned bool, reason string) error
 }
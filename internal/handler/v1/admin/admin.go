@@ -19,13 +19,17 @@ import (
 )
 
 type AdminHandler struct {
-	aSrv service.AdminService
+	aSrv  service.AdminService
+	odSrv service.OrderService
+	rSrv  service.ReportService
 }
 
-func NewAdminHandler(_aSrv service.AdminService) *AdminHandler {
+func NewAdminHandler(_aSrv service.AdminService, _odSrv service.OrderService, _rSrv service.ReportService) *AdminHandler {
 
 	ah := &AdminHandler{
-		aSrv: _aSrv,
+		aSrv:  _aSrv,
+		odSrv: _odSrv,
+		rSrv:  _rSrv,
 	}
 	return ah
 }
@@ -37,16 +41,12 @@ func (ah *AdminHandler) AdminGenNewCDkey() gin.HandlerFunc {
 			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
 			return
 		}
-		if !ah.aSrv.AdminVerify(ctx) {
-			response.JSON(ctx, errors.WithCode(ecode.PermissionErr, "权限错误"), nil)
-			return
-		}
 		cardId, err := strconv.ParseInt(req.GiftCardId, 10, 64)
 		if err != nil {
 			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
 			return
 		}
-		res, err := ah.aSrv.CdKeyGenerate(ctx, req.KeyNumber, cardId)
+		res, err := ah.aSrv.CdKeyGenerate(ctx, req.KeyNumber, cardId, req.ExpireDays)
 		if err != nil {
 			response.JSON(ctx, errors.WithCode(ecode.CreatErr, "错误"), nil)
 			return
@@ -62,10 +62,6 @@ func (ah *AdminHandler) AdminCreateGiftCard() gin.HandlerFunc {
 			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
 			return
 		}
-		if !ah.aSrv.AdminVerify(ctx) {
-			response.JSON(ctx, errors.WithCode(ecode.PermissionErr, "权限错误"), nil)
-			return
-		}
 		if err := ah.aSrv.GiftCardCreate(ctx, req); err != nil {
 			response.JSON(ctx, errors.WithCode(ecode.CreatErr, "错误"), nil)
 			return
@@ -81,10 +77,6 @@ func (ah *AdminHandler) AdminUpdateGiftCard() gin.HandlerFunc {
 			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
 			return
 		}
-		if !ah.aSrv.AdminVerify(ctx) {
-			response.JSON(ctx, errors.WithCode(ecode.PermissionErr, "权限错误"), nil)
-			return
-		}
 		if err := ah.aSrv.GiftCardUpdate(ctx, req); err != nil {
 			response.JSON(ctx, errors.WithCode(ecode.CreatErr, "错误"), nil)
 			return
@@ -92,3 +84,30 @@ func (ah *AdminHandler) AdminUpdateGiftCard() gin.HandlerFunc {
 		response.JSON(ctx, nil, nil)
 	}
 }
+
+func (ah *AdminHandler) AdminEmbeddingStats() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := ah.aSrv.EmbeddingStatsGet(ctx)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "查询失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (ah *AdminHandler) AdminSearchCacheClear() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.SearchCacheClearReq{}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := ah.aSrv.SearchCacheClear(ctx, req.Query)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "清除失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 19:12:40
+ * @LastEditTime: 2023-06-25 19:12:40
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/handler/v1/admin/cdkey.go
+ */
+package admin
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/pkg/errors"
+	"chatserver-api/pkg/errors/ecode"
+	"chatserver-api/pkg/response"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (ah *AdminHandler) AdminCdKeyList() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.CdKeyListReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := ah.aSrv.CdKeyList(ctx, req)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "查询失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (ah *AdminHandler) AdminCdKeyExport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.CdKeyExportReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		batchId, err := strconv.ParseInt(req.BatchId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		data, err := ah.aSrv.CdKeyExport(ctx, batchId)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.NotFoundErr, err.Error()), nil)
+			return
+		}
+		filename := "cdkey-" + req.BatchId + ".csv"
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		ctx.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	}
+}
+
+func (ah *AdminHandler) AdminCdKeyRevoke() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.CdKeyRevokeReq{}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		var batchId int64
+		var err error
+		if req.BatchId != "" {
+			if batchId, err = strconv.ParseInt(req.BatchId, 10, 64); err != nil {
+				response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+				return
+			}
+		}
+		keyIds := make([]int64, 0, len(req.KeyIds))
+		for _, k := range req.KeyIds {
+			keyId, err := strconv.ParseInt(k, 10, 64)
+			if err != nil {
+				response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+				return
+			}
+			keyIds = append(keyIds, keyId)
+		}
+		res, err := ah.aSrv.CdKeyRevoke(ctx, keyIds, batchId)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.CdKeyErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (ah *AdminHandler) AdminCdKeyRedemptionList() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.CdKeyRedemptionListReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		var userId, cardId int64
+		var err error
+		if req.UserId != "" {
+			if userId, err = strconv.ParseInt(req.UserId, 10, 64); err != nil {
+				response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+				return
+			}
+		}
+		if req.CardId != "" {
+			if cardId, err = strconv.ParseInt(req.CardId, 10, 64); err != nil {
+				response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+				return
+			}
+		}
+		res, err := ah.aSrv.CdKeyRedemptionList(ctx, userId, cardId, req.Page, req.PageSize)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "查询失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
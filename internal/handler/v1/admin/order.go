@@ -0,0 +1,83 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 14:20:37
+ * @LastEditTime: 2023-06-26 14:20:37
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/handler/v1/admin/order.go
+ */
+package admin
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/pkg/errors"
+	"chatserver-api/pkg/errors/ecode"
+	"chatserver-api/pkg/response"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (ah *AdminHandler) AdminOrderList() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.OrderListReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		var userId int64
+		if req.UserId != "" {
+			var err error
+			if userId, err = strconv.ParseInt(req.UserId, 10, 64); err != nil {
+				response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+				return
+			}
+		}
+		res, err := ah.odSrv.OrderList(ctx, userId, req)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "查询失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (ah *AdminHandler) AdminOrderGet() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.OrderIdReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		orderId, err := strconv.ParseInt(req.OrderId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := ah.odSrv.OrderGet(ctx, 0, orderId)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.NotFoundErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (ah *AdminHandler) AdminOrderRefund() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.OrderRefundReq{}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		orderId, err := strconv.ParseInt(req.OrderId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		if err := ah.odSrv.OrderRefund(ctx, orderId, req.Reason); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.Unknown, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
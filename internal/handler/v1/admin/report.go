@@ -0,0 +1,84 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 17:05:32
+ * @LastEditTime: 2023-06-26 17:05:32
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/handler/v1/admin/report.go
+ */
+package admin
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/pkg/errors"
+	"chatserver-api/pkg/errors/ecode"
+	"chatserver-api/pkg/response"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (ah *AdminHandler) AdminReportUsage() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.ReportReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := ah.rSrv.ReportUsage(ctx, req)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (ah *AdminHandler) AdminReportTopUsers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.ReportReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := ah.rSrv.ReportTopUsers(ctx, req)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (ah *AdminHandler) AdminReportRevenue() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.ReportReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := ah.rSrv.ReportRevenue(ctx, req)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (ah *AdminHandler) AdminReportExport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.ReportReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		data, err := ah.rSrv.ReportExport(ctx, req)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		filename := "report-" + req.Type + ".csv"
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		ctx.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	}
+}
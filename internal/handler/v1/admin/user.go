@@ -0,0 +1,143 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 18:40:13
+ * @LastEditTime: 2023-06-25 18:40:13
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/handler/v1/admin/user.go
+ */
+package admin
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/pkg/errors"
+	"chatserver-api/pkg/errors/ecode"
+	"chatserver-api/pkg/response"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (ah *AdminHandler) AdminUserList() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.AdminUserListReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := ah.aSrv.AdminUserList(ctx, req)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "查询失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (ah *AdminHandler) AdminUserBill() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.AdminUserBillReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		userId, err := strconv.ParseInt(req.UserId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := ah.aSrv.AdminUserBill(ctx, userId, req.Page, req.PageSize)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "查询失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (ah *AdminHandler) AdminUserBalance() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.AdminUserBalanceReq{}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		userId, err := strconv.ParseInt(req.UserId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		if err := ah.aSrv.AdminUserBalance(ctx, userId, req.Amount, req.Comment); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.Unknown, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
+
+func (ah *AdminHandler) AdminUserRole() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.AdminUserRoleReq{}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		userId, err := strconv.ParseInt(req.UserId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		if err := ah.aSrv.AdminUserRole(ctx, userId, req.Role); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.Unknown, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
+
+func (ah *AdminHandler) AdminUserBan() gin.HandlerFunc {
+	return ah.adminUserBan(true)
+}
+
+func (ah *AdminHandler) AdminUserUnban() gin.HandlerFunc {
+	return ah.adminUserBan(false)
+}
+
+func (ah *AdminHandler) adminUserBan(banned bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.AdminUserBanReq{}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		userId, err := strconv.ParseInt(req.UserId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		if err := ah.aSrv.AdminUserBan(ctx, userId, banned, req.Reason); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.Unknown, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
+
+func (ah *AdminHandler) AdminUserActiveResend() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.AdminUserIdReq{}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		userId, err := strconv.ParseInt(req.UserId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		if err := ah.aSrv.AdminUserActiveResend(ctx, userId); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ActiveErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
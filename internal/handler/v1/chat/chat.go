@@ -25,12 +25,14 @@ import (
 
 type ChatHandler struct {
 	cSrv service.ChatService
+	kSrv service.KbService
 }
 
-func NewChatHandler(_cSrv service.ChatService) *ChatHandler {
+func NewChatHandler(_cSrv service.ChatService, _kSrv service.KbService) *ChatHandler {
 
 	ch := &ChatHandler{
 		cSrv: _cSrv,
+		kSrv: _kSrv,
 	}
 	return ch
 }
@@ -184,6 +186,10 @@ func (ch *ChatHandler) ChatCreateNew() gin.HandlerFunc {
 			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, "会话预设ID转换错误"), nil)
 			return
 		}
+		if err := ch.cSrv.ChatPresetVerify(ctx, PresetId); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.PermissionErr, err.Error()), nil)
+			return
+		}
 		chatCreateNewRes, err := ch.cSrv.ChatCreateNew(ctx, userId, PresetId, req.ChatName)
 		if err != nil {
 			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
@@ -348,6 +354,12 @@ func (ch *ChatHandler) ChatUpdate() gin.HandlerFunc {
 			response.JSON(ctx, errors.WithCode(ecode.NotFoundErr, "会话ID不存在"), nil)
 			return
 		}
+		if presetId != 0 {
+			if err := ch.cSrv.ChatPresetVerify(ctx, presetId); err != nil {
+				response.JSON(ctx, errors.WithCode(ecode.PermissionErr, err.Error()), nil)
+				return
+			}
+		}
 		err = ch.cSrv.ChatUpdate(ctx, req.ChatName, presetId)
 		if err != nil {
 			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "会话更新失败"), nil)
@@ -366,7 +378,37 @@ func (ch *ChatHandler) ChatEmbeddingString() gin.HandlerFunc {
 			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
 			return
 		}
-		textlist := req.BatchList
+		kbId, err := strconv.ParseInt(req.KbId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, "ID转换错误"), nil)
+			return
+		}
+		if err := ch.kbWriteVerify(ctx, kbId); err != nil {
+			response.JSON(ctx, err, nil)
+			return
+		}
+		pages := make(map[string]int, len(req.Pages))
+		for i, v := range req.BatchList {
+			if _, ok := pages[v]; !ok && i < len(req.Pages) {
+				pages[v] = req.Pages[i]
+			}
+		}
+		// 跳过已存在于知识库中的相同内容
+		textlist, err := ch.cSrv.ChatEmbeddingDedup(ctx, kbId, req.BatchList)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "写入失败"), nil)
+			return
+		}
+		var tokens int
+		for _, v := range textlist {
+			tokens += tiktoken.NumTokensSingleString(v)
+		}
+		release, err := ch.kSrv.KbQuotaAcquire(ctx, kbId, tokens)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.OversizeErr, "写入失败"), nil)
+			return
+		}
+		defer release()
 		textlen := len(textlist)
 		for i := 0; i < textlen; i += 10 {
 			end := i + 10
@@ -374,20 +416,20 @@ func (ch *ChatHandler) ChatEmbeddingString() gin.HandlerFunc {
 				end = textlen
 			}
 			batchlist := textlist[i:end]
-			embeddinglist, err := ch.cSrv.ChatEmbeddingGenerate(batchlist)
+			embeddinglist, err := ch.cSrv.ChatEmbeddingGenerate(ctx, batchlist)
 			if err != nil {
 				response.JSON(ctx, nil, nil)
 				return
 			}
 			for j := 0; j < len(batchlist); j++ {
-				err = ch.cSrv.ChatEmbeddingSave(ctx, req.BatchTitle, batchlist[j], req.Classify, embeddinglist[j])
+				err = ch.cSrv.ChatEmbeddingSave(ctx, kbId, req.BatchTitle, batchlist[j], req.Classify, pages[batchlist[j]], embeddinglist[j])
 				if err != nil {
 					response.JSON(ctx, nil, nil)
 					return
 				}
 			}
 		}
-		response.JSON(ctx, nil, nil)
+		response.JSON(ctx, nil, map[string]interface{}{"saved": textlen, "skipped": len(req.BatchList) - textlen})
 
 	}
 }
@@ -415,6 +457,15 @@ func (ch *ChatHandler) ChatEmbeddingFile() gin.HandlerFunc {
 			title = file.Filename
 		}
 
+		kbId, err := strconv.ParseInt(ctx.PostForm("kb_id"), 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, "ID转换错误"), nil)
+			return
+		}
+		if err := ch.kbWriteVerify(ctx, kbId); err != nil {
+			response.JSON(ctx, err, nil)
+			return
+		}
 		// 获取类别参数
 		// classify := ctx.PostForm("classify")
 		// 保存文件到本地
@@ -425,13 +476,18 @@ func (ch *ChatHandler) ChatEmbeddingFile() gin.HandlerFunc {
 			return
 		}
 		var textlist []string
+		var pages []int
 		if fileHeader == "application/pdf" {
-			textlist, err = tika.ReadPd3f(title, file.Filename)
+			chunks, err := tika.ReadPd3f(title, file.Filename)
 			if err != nil {
 				// ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				response.JSON(ctx, errors.WithCode(ecode.Unknown, err.Error()), nil)
 				return
 			}
+			for _, v := range chunks {
+				textlist = append(textlist, v.Body)
+				pages = append(pages, v.Page)
+			}
 		}
 		if fileHeader == "text/markdown" {
 			textlist, err = tika.ProcessMarkDown(file.Filename)
@@ -448,14 +504,14 @@ func (ch *ChatHandler) ChatEmbeddingFile() gin.HandlerFunc {
 		// 		end = textlen
 		// 	}
 		// 	batchlist := textlist[i:end]
-		// 	embeddinglist, err := ch.cSrv.ChatEmbeddingGenerate(batchlist)
+		// 	embeddinglist, err := ch.cSrv.ChatEmbeddingGenerate(ctx, batchlist)
 		// 	if err != nil {
 		// 		// ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		// 		response.JSON(ctx, err, nil)
 		// 		return
 		// 	}
 		// 	for j := 0; j < len(batchlist); j++ {
-		// 		err = ch.cSrv.ChatEmbeddingSave(ctx, title, batchlist[j], classify, embeddinglist[j])
+		// 		err = ch.cSrv.ChatEmbeddingSave(ctx, kbId, title, batchlist[j], classify, pages[i+j], embeddinglist[j])
 		// 		if err != nil {
 		// 			// ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		// 			response.JSON(ctx, err, nil)
@@ -463,6 +519,19 @@ func (ch *ChatHandler) ChatEmbeddingFile() gin.HandlerFunc {
 		// 		}
 		// 	}
 		// }
-		response.JSON(ctx, nil, map[string]interface{}{"list": textlist})
+		// pages 与 list 一一对应，随 list 一并提交到批量写入接口以记录引用页码
+		response.JSON(ctx, nil, map[string]interface{}{"list": textlist, "pages": pages})
+	}
+}
+
+// kbWriteVerify 校验当前用户对知识库的写入权限
+func (ch *ChatHandler) kbWriteVerify(ctx *gin.Context, kbId int64) error {
+	perm, err := ch.kSrv.KbPermissionGet(ctx, ctx.GetInt64(consts.UserID), kbId)
+	if err != nil {
+		return errors.Wrap(err, ecode.NotFoundErr, "知识库不存在")
+	}
+	if perm < consts.KbPermWrite {
+		return errors.WithCode(ecode.PermissionErr, "知识库权限不足")
 	}
+	return nil
 }
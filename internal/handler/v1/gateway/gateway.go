@@ -0,0 +1,162 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 15:10:06
+ * @LastEditTime: 2023-06-24 15:10:06
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/handler/v1/gateway/gateway.go
+ */
+package gateway
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/service"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/openai"
+	"chatserver-api/pkg/tiktoken"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GatewayHandler struct {
+	gSrv service.GatewayService
+}
+
+func NewGatewayHandler(_gSrv service.GatewayService) *GatewayHandler {
+	return &GatewayHandler{
+		gSrv: _gSrv,
+	}
+}
+
+func (gh *GatewayHandler) Models() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gh.gSrv.GatewayModels())
+	}
+}
+
+// ChatCompletions 兼容 /v1/chat/completions，流式响应按 OpenAI 的 SSE 格式透传
+func (gh *GatewayHandler) ChatCompletions() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := openai.ChatCompletionRequest{}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			gatewayError(ctx, service.ErrGatewayParam)
+			return
+		}
+		promptTokens, err := gh.gSrv.GatewayChatVerify(ctx, &req)
+		if err != nil {
+			gatewayError(ctx, err)
+			return
+		}
+		if !req.Stream {
+			res, err := gh.gSrv.GatewayChat(ctx, req)
+			if err != nil {
+				gatewayError(ctx, err)
+				return
+			}
+			gh.bill(ctx, res.Usage.TotalTokens)
+			ctx.JSON(http.StatusOK, res)
+			return
+		}
+		stream, err := gh.gSrv.GatewayChatStream(ctx, req)
+		if err != nil {
+			gatewayError(ctx, err)
+			return
+		}
+		defer stream.Close()
+		var content string
+		ctx.Header("Content-Type", "text/event-stream")
+		ctx.Header("Cache-Control", "no-cache")
+		ctx.Header("Connection", "keep-alive")
+		ctx.Stream(func(w io.Writer) bool {
+			res, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				fmt.Fprint(w, "data: [DONE]\n\n")
+				return false
+			}
+			if err != nil {
+				logger.Errorf("ChatCompletionStream error: %v", err)
+				return false
+			}
+			for _, choice := range res.Choices {
+				content += choice.Delta.Content
+			}
+			data, _ := json.Marshal(res)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			return true
+		})
+		// 客户端中途断开时按已生成的内容计费
+		completion := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleAssistant, Content: content}}
+		gh.bill(ctx, promptTokens+tiktoken.NumTokensFromMessages(completion, req.Model))
+	}
+}
+
+// Embeddings 兼容 /v1/embeddings，仅支持 text-embedding-ada-002
+func (gh *GatewayHandler) Embeddings() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.GatewayEmbeddingReq{}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			gatewayError(ctx, service.ErrGatewayParam)
+			return
+		}
+		input, err := req.Inputs()
+		if err != nil {
+			gatewayError(ctx, service.ErrGatewayParam)
+			return
+		}
+		tokens, err := gh.gSrv.GatewayEmbeddingVerify(ctx, req.Model, input)
+		if err != nil {
+			gatewayError(ctx, err)
+			return
+		}
+		res, err := gh.gSrv.GatewayEmbeddings(ctx, input)
+		if err != nil {
+			gatewayError(ctx, err)
+			return
+		}
+		res.Usage = openai.Usage{PromptTokens: tokens, TotalTokens: tokens}
+		gh.bill(ctx, tokens)
+		ctx.JSON(http.StatusOK, res)
+	}
+}
+
+func (gh *GatewayHandler) bill(ctx *gin.Context, tokens int) {
+	if err := gh.gSrv.GatewayBill(ctx, tokens); err != nil {
+		logger.Errorf("API调用扣费失败:%v", err)
+	}
+}
+
+// gatewayError 将服务错误转换为 OpenAI 错误格式，上游错误保留原状态码
+func gatewayError(ctx *gin.Context, err error) {
+	status, code, errType := http.StatusInternalServerError, "server_error", "server_error"
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.Is(err, service.ErrGatewayModel):
+		status, code, errType = http.StatusNotFound, "model_not_found", "invalid_request_error"
+	case errors.Is(err, service.ErrGatewayParam):
+		status, code, errType = http.StatusBadRequest, "invalid_request", "invalid_request_error"
+	case errors.Is(err, service.ErrGatewayContext):
+		status, code, errType = http.StatusBadRequest, "context_length_exceeded", "invalid_request_error"
+	case errors.Is(err, service.ErrGatewayFlagged):
+		status, code, errType = http.StatusBadRequest, "content_policy_violation", "invalid_request_error"
+	case errors.Is(err, service.ErrGatewayBalance):
+		status, code, errType = http.StatusTooManyRequests, "insufficient_quota", "insufficient_quota"
+	case errors.As(err, &apiErr):
+		if apiErr.HTTPStatusCode > 0 {
+			status = apiErr.HTTPStatusCode
+		}
+		ctx.AbortWithStatusJSON(status, openai.ErrorResponse{Error: apiErr})
+		return
+	case errors.As(err, &reqErr):
+		status, code = http.StatusBadGateway, "upstream_error"
+	}
+	ctx.AbortWithStatusJSON(status, openai.ErrorResponse{Error: &openai.APIError{
+		Code:    code,
+		Message: err.Error(),
+		Type:    errType,
+	}})
+}
@@ -0,0 +1,211 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-14 15:26:33
+ * @LastEditTime: 2023-06-14 17:32:10
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/handler/v1/kb/kb.go
+ */
+package kb
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/service"
+	"chatserver-api/pkg/errors"
+	"chatserver-api/pkg/errors/ecode"
+	"chatserver-api/pkg/response"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KbHandler struct {
+	kSrv service.KbService
+}
+
+func NewKbHandler(_kSrv service.KbService) *KbHandler {
+
+	kh := &KbHandler{
+		kSrv: _kSrv,
+	}
+	return kh
+}
+
+func (kh *KbHandler) KbCreateNew() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.KbCreateNewReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := kh.kSrv.KbCreateNew(ctx, req)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.CreatErr, "创建失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (kh *KbHandler) KbUpdate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.KbUpdateReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		if err := kh.kSrv.KbUpdate(ctx, req); err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.PermissionErr, "更新失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
+
+func (kh *KbHandler) KbDelete() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.KbIdReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		kbId, err := strconv.ParseInt(req.KbId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, "ID转换错误"), nil)
+			return
+		}
+		if err := kh.kSrv.KbDelete(ctx, kbId); err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.PermissionErr, "删除失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
+
+func (kh *KbHandler) KbListGet() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := kh.kSrv.KbListGet(ctx)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "查询失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (kh *KbHandler) KbMemberSave() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.KbMemberReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		if err := kh.kSrv.KbMemberSave(ctx, req); err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.PermissionErr, "共享失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
+
+func (kh *KbHandler) KbMemberDelete() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.KbMemberReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		if err := kh.kSrv.KbMemberDelete(ctx, req); err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.PermissionErr, "移除失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
+
+func (kh *KbHandler) KbSubscribe() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.KbIdReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		kbId, err := strconv.ParseInt(req.KbId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, "ID转换错误"), nil)
+			return
+		}
+		if err := kh.kSrv.KbSubscribe(ctx, kbId); err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.PermissionErr, "订阅失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
+
+func (kh *KbHandler) KbUsageGet() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := kh.kSrv.KbUsageGet(ctx)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "查询失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (kh *KbHandler) TeamCreateNew() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.TeamCreateNewReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := kh.kSrv.TeamCreateNew(ctx, req)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.CreatErr, "创建失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (kh *KbHandler) TeamListGet() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := kh.kSrv.TeamListGet(ctx)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "查询失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (kh *KbHandler) TeamMemberAdd() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.TeamMemberReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		if err := kh.kSrv.TeamMemberAdd(ctx, req); err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.PermissionErr, "添加失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
+
+func (kh *KbHandler) TeamMemberDelete() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.TeamMemberReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		if err := kh.kSrv.TeamMemberDelete(ctx, req); err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.PermissionErr, "移除失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 11:48:20
+ * @LastEditTime: 2023-06-25 11:48:20
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/handler/v1/user/account.go
+ */
+package user
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/pkg/errors"
+	"chatserver-api/pkg/errors/ecode"
+	"chatserver-api/pkg/response"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (uh *UserHandler) AccountExport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		data, err := uh.acSrv.AccountExport(ctx)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "数据导出失败"), nil)
+			return
+		}
+		filename := "chatserver-export-" + time.Now().Format("20060102") + ".zip"
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		ctx.Data(http.StatusOK, "application/zip", data)
+	}
+}
+
+func (uh *UserHandler) AccountDelete() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.AccountDeleteReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		if err := uh.acSrv.AccountDeleteRequest(ctx, req.Password); err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.PasswordErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, errors.WithCode(ecode.Success, "注销确认邮件已发送，请查收"), nil)
+	}
+}
+
+func (uh *UserHandler) AccountDeleteConfirm() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.AccountDeleteConfirmReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := uh.acSrv.AccountDeleteConfirm(ctx, req.Code)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (uh *UserHandler) AccountDeleteCancel() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if err := uh.acSrv.AccountDeleteCancel(ctx); err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "撤销注销失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
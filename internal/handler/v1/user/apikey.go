@@ -0,0 +1,65 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 11:02:55
+ * @LastEditTime: 2023-06-24 11:02:55
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/handler/v1/user/apikey.go
+ */
+package user
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/pkg/errors"
+	"chatserver-api/pkg/errors/ecode"
+	"chatserver-api/pkg/response"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (uh *UserHandler) ApiKeyCreate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.ApiKeyCreateReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := uh.aSrv.ApiKeyCreate(ctx, req)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.RecordCreateErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (uh *UserHandler) ApiKeyList() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := uh.aSrv.ApiKeyList(ctx)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "接口调用失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (uh *UserHandler) ApiKeyDelete() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.ApiKeyDeleteReq
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		keyId, err := strconv.ParseInt(req.KeyId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, "Key ID转换错误"), nil)
+			return
+		}
+		if err := uh.aSrv.ApiKeyDelete(ctx, keyId); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.NotFoundErr, "API Key不存在"), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
@@ -0,0 +1,44 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-22 15:02:37
+ * @LastEditTime: 2023-06-22 18:21:05
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/handler/v1/user/oidc.go
+ */
+package user
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/pkg/errors"
+	"chatserver-api/pkg/errors/ecode"
+	"chatserver-api/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (uh *UserHandler) OidcAuthURL() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := uh.oSrv.OidcAuthURL(ctx)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.NotFoundErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (uh *UserHandler) OidcLogin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.OidcLoginReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := uh.oSrv.OidcLogin(ctx, req.Code, req.State)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.UserLoginErr, "登录失败；"+err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, errors.Wrap(err, ecode.Success, "登录成功"), res)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 14:02:15
+ * @LastEditTime: 2023-06-26 14:02:15
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/handler/v1/user/order.go
+ */
+package user
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/service"
+	"chatserver-api/pkg/errors"
+	"chatserver-api/pkg/errors/ecode"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/response"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (uh *UserHandler) OrderCreate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.OrderCreateReq{}
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := uh.odSrv.OrderCreate(ctx, req)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.CreatErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (uh *UserHandler) OrderGet() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.OrderIdReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		orderId, err := strconv.ParseInt(req.OrderId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := uh.odSrv.OrderGet(ctx, ctx.GetInt64(consts.UserID), orderId)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.NotFoundErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (uh *UserHandler) OrderList() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := model.OrderListReq{}
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := uh.odSrv.OrderList(ctx, ctx.GetInt64(consts.UserID), req)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "查询失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+// PaymentNotify 支付平台异步通知，验签失败返回 400，处理失败返回 500 由支付平台重试
+func (uh *UserHandler) PaymentNotify() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		body, err := ctx.GetRawData()
+		if err != nil {
+			ctx.String(http.StatusBadRequest, "bad request")
+			return
+		}
+		err = uh.odSrv.OrderNotify(ctx, ctx.Request.Header, body)
+		if service.IsPaymentSignature(err) {
+			logger.Warnf("支付通知验签失败:%s", ctx.ClientIP())
+			ctx.String(http.StatusBadRequest, "invalid signature")
+			return
+		}
+		if err != nil {
+			logger.Errorf("支付通知处理失败:%v", err.Error())
+			ctx.String(http.StatusInternalServerError, "error")
+			return
+		}
+		ctx.String(http.StatusOK, "success")
+	}
+}
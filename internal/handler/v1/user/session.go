@@ -0,0 +1,66 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-23 11:20:08
+ * @LastEditTime: 2023-06-23 11:20:08
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/handler/v1/user/session.go
+ */
+package user
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/pkg/errors"
+	"chatserver-api/pkg/errors/ecode"
+	"chatserver-api/pkg/response"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (uh *UserHandler) UserRefresh() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.UserRefreshReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := uh.sSrv.SessionRefresh(ctx, req.RefreshToken)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.RequireAuthErr, "Token刷新失败"), nil)
+		} else {
+			response.JSON(ctx, errors.Wrap(err, ecode.Success, "Token刷新成功"), res)
+		}
+	}
+}
+
+func (uh *UserHandler) UserSessionList() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := uh.sSrv.SessionList(ctx)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "接口调用失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+// UserSessionDelete 注销指定会话，session_id 为 -1 时注销全部会话
+func (uh *UserHandler) UserSessionDelete() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.UserSessionDeleteReq
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		sessionId, err := strconv.ParseInt(req.SessionId, 10, 64)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, "会话ID转换错误"), nil)
+			return
+		}
+		if err := uh.sSrv.SessionRevoke(ctx, sessionId); err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "接口调用失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
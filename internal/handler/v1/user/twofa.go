@@ -0,0 +1,118 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-23 16:35:19
+ * @LastEditTime: 2023-06-23 16:35:19
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/handler/v1/user/twofa.go
+ */
+package user
+
+import (
+	"chatserver-api/internal/model"
+	"chatserver-api/pkg/errors"
+	"chatserver-api/pkg/errors/ecode"
+	"chatserver-api/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (uh *UserHandler) UserLogin2FA() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.UserLogin2FAReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := uh.tSrv.TwoFALogin(ctx, req.MfaToken, req.Code)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.UserLoginErr, "登录失败；"+err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, errors.Wrap(err, ecode.Success, "登录成功"), res)
+	}
+}
+
+func (uh *UserHandler) UserLogin2FAEnroll() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.UserLogin2FAEnrollReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := uh.tSrv.TwoFALoginEnroll(ctx, req.MfaToken)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.UserLoginErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (uh *UserHandler) TwoFAStatus() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := uh.tSrv.TwoFAStatus(ctx)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, "接口调用失败"), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (uh *UserHandler) TwoFAEnroll() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := uh.tSrv.TwoFAEnroll(ctx)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.Unknown, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (uh *UserHandler) TwoFAEnable() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.TwoFACodeReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := uh.tSrv.TwoFAEnable(ctx, req.Code)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
+
+func (uh *UserHandler) TwoFADisable() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.TwoFACodeReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		if err := uh.tSrv.TwoFADisable(ctx, req.Code); err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, nil)
+	}
+}
+
+func (uh *UserHandler) TwoFARecoveryReset() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req model.TwoFACodeReq
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		res, err := uh.tSrv.TwoFARecoveryReset(ctx, req.Code)
+		if err != nil {
+			response.JSON(ctx, errors.Wrap(err, ecode.ValidateErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
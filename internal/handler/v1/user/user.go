@@ -21,12 +21,26 @@ import (
 )
 
 type UserHandler struct {
-	uSrv service.UserService
+	uSrv  service.UserService
+	oSrv  service.OidcService
+	sSrv  service.SessionService
+	tSrv  service.TwoFAService
+	aSrv  service.ApiKeyService
+	acSrv service.AccountService
+	lSrv  service.LoginGuardService
+	odSrv service.OrderService
 }
 
-func NewUserHandler(_uSrv service.UserService) *UserHandler {
+func NewUserHandler(_uSrv service.UserService, _oSrv service.OidcService, _sSrv service.SessionService, _tSrv service.TwoFAService, _aSrv service.ApiKeyService, _acSrv service.AccountService, _lSrv service.LoginGuardService, _odSrv service.OrderService) *UserHandler {
 	return &UserHandler{
-		uSrv: _uSrv,
+		uSrv:  _uSrv,
+		oSrv:  _oSrv,
+		sSrv:  _sSrv,
+		tSrv:  _tSrv,
+		aSrv:  _aSrv,
+		acSrv: _acSrv,
+		lSrv:  _lSrv,
+		odSrv: _odSrv,
 	}
 }
 
@@ -73,7 +87,7 @@ func (uh *UserHandler) UserRegister() gin.HandlerFunc {
 			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
 			return
 		}
-		iscode := uh.uSrv.CaptchaVerify(ctx, req.Captcha)
+		iscode := uh.uSrv.CaptchaVerify(ctx, req.CaptchaId, req.Captcha)
 		if !iscode {
 			response.JSON(ctx, errors.WithCode(ecode.CaptchaErr, "验证码错误"), nil)
 			return
@@ -116,13 +130,14 @@ func (uh *UserHandler) UserLogin() gin.HandlerFunc {
 			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
 			return
 		}
-		iscode := uh.uSrv.CaptchaVerify(ctx, req.Captcha)
-		if !iscode {
+		if uh.uSrv.CaptchaRequired(ctx, req.Username) && !uh.uSrv.CaptchaVerify(ctx, req.CaptchaId, req.Captcha) {
 			response.JSON(ctx, errors.WithCode(ecode.CaptchaErr, "验证码错误"), nil)
 			return
 		}
 		res, err := uh.uSrv.UserLogin(ctx, req.Username, req.Password)
-		if err != nil {
+		if service.IsLoginLocked(err) || service.IsUserBanned(err) {
+			response.JSON(ctx, errors.WithCode(ecode.UserLoginErr, err.Error()), nil)
+		} else if err != nil {
 			response.JSON(ctx, errors.Wrap(err, ecode.UserLoginErr, "登录失败；账户或密码错误"), nil)
 		} else {
 			response.JSON(ctx, errors.Wrap(err, ecode.Success, "登录成功"), res)
@@ -142,17 +157,6 @@ func (uh *UserHandler) UserLogout() gin.HandlerFunc {
 	}
 }
 
-func (uh *UserHandler) UserRefresh() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		res, err := uh.uSrv.UserRefresh(ctx)
-		if err != nil {
-			response.JSON(ctx, errors.Wrap(err, ecode.UserLoginErr, "Token刷新失败"), nil)
-		} else {
-			response.JSON(ctx, errors.Wrap(err, ecode.Success, "Token刷新成功"), res)
-		}
-	}
-}
-
 func (uh *UserHandler) UserVerifyEmail() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var req model.UserVerifyEmailReq
@@ -267,7 +271,7 @@ func (uh *UserHandler) UserPasswordForget() gin.HandlerFunc {
 			response.JSON(ctx, errors.WithCode(ecode.ValidateErr, err.Error()), nil)
 			return
 		}
-		iscode := uh.uSrv.CaptchaVerify(ctx, req.Captcha)
+		iscode := uh.uSrv.CaptchaVerify(ctx, req.CaptchaId, req.Captcha)
 		if !iscode {
 			response.JSON(ctx, errors.WithCode(ecode.CaptchaErr, "验证码错误"), nil)
 			return
@@ -312,7 +316,7 @@ func (uh *UserHandler) UserCDkeyPay() gin.HandlerFunc {
 			return
 		}
 		if err := uh.uSrv.UserCDkeyPay(ctx, req.CodeKey); err != nil {
-			response.JSON(ctx, errors.Wrap(err, ecode.CdKeyErr, "卡密错误"), nil)
+			response.JSON(ctx, errors.WithCode(ecode.CdKeyErr, err.Error()), nil)
 			return
 		}
 		response.JSON(ctx, nil, nil)
@@ -353,3 +357,14 @@ func (uh *UserHandler) CaptchaGen() gin.HandlerFunc {
 		response.JSON(ctx, nil, res)
 	}
 }
+
+func (uh *UserHandler) UserLoginHistory() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		res, err := uh.lSrv.LoginHistory(ctx)
+		if err != nil {
+			response.JSON(ctx, errors.WithCode(ecode.NotFoundErr, err.Error()), nil)
+			return
+		}
+		response.JSON(ctx, nil, res)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 14:05:21
+ * @LastEditTime: 2023-06-24 14:05:21
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/middleware/gateway.go
+ */
+package middleware
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/openai"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gatewayRateWindow 限流统计窗口
+const gatewayRateWindow = time.Minute
+
+// GatewayAuth OpenAI 兼容接口鉴权，只接受包含任一授权范围的 API Key，错误按 OpenAI 格式返回
+func GatewayAuth(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(strings.TrimPrefix(c.GetHeader(authorizationHeader), "Bearer "))
+		if !strings.HasPrefix(key, consts.ApiKeyTokenPrefix) || apiKeyAuth == nil {
+			gatewayAbort(c, http.StatusUnauthorized, "invalid_api_key", "Incorrect API key provided.")
+			return
+		}
+		auth, err := apiKeyAuth(c, key)
+		if err != nil {
+			gatewayAbort(c, http.StatusUnauthorized, "invalid_api_key", err.Error())
+			return
+		}
+		if !scopeAllowed(auth.Scopes, scopes) {
+			gatewayAbort(c, http.StatusForbidden, "insufficient_scope", "This API key is not allowed to access this endpoint.")
+			return
+		}
+		c.Set(consts.UserID, auth.UserId)
+		c.Set(consts.RoleID, auth.Role)
+		c.Set(consts.ApiKeyIDCtx, auth.KeyId)
+		c.Next()
+	}
+}
+
+// GatewayRateLimit 按用户限制 OpenAI 兼容接口的请求频率，同一用户的所有 API Key 共用配额，需在 GatewayAuth 之后使用
+func GatewayRateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := config.AppConfig.GatewayConfig.RateLimit
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+		now := time.Now()
+		window := now.Truncate(gatewayRateWindow)
+		key := fmt.Sprintf("%s%d:%d", consts.GatewayRatePrefix, c.GetInt64(consts.UserID), window.Unix())
+		rc := cache.GetRedisClient()
+		n, err := rc.Incr(c, key).Result()
+		if err != nil {
+			// redis 不可用时不限流，避免接口整体不可用
+			logger.Errorf("Redis连接异常:%v", err.Error())
+			c.Next()
+			return
+		}
+		if n == 1 {
+			rc.Expire(c, key, 2*gatewayRateWindow)
+		}
+		if n > int64(limit) {
+			retry := window.Add(gatewayRateWindow).Sub(now)
+			c.Header("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+			gatewayAbort(c, http.StatusTooManyRequests, "rate_limit_exceeded", "Rate limit reached, please try again later.")
+			return
+		}
+		c.Next()
+	}
+}
+
+func gatewayAbort(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, openai.ErrorResponse{Error: &openai.APIError{
+		Code:    code,
+		Message: message,
+		Type:    "invalid_request_error",
+	}})
+}
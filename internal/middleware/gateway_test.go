@@ -0,0 +1,60 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-29 15:02:33
+ * @LastEditTime: 2023-06-29 15:02:33
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/middleware/gateway_test.go
+ */
+package middleware
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGatewayRateLimit(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	gin.SetMode(gin.TestMode)
+	old := config.AppConfig
+	defer func() { config.AppConfig = old }()
+	mr := miniredis.RunT(t)
+	cache.InitRedis(config.RedisConfig{Addr: mr.Addr()})
+	defer cache.CloseRedis()
+
+	request := func(userId int64) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		ctx.Set(consts.UserID, userId)
+		GatewayRateLimit()(ctx)
+		return w
+	}
+
+	config.AppConfig = &config.Config{GatewayConfig: config.GatewayConfig{RateLimit: 2}}
+	for i := 0; i < 2; i++ {
+		if w := request(100); w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want %d", i, w.Code, http.StatusOK)
+		}
+	}
+	w := request(100)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("over limit status = %d, Retry-After = %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	// 限流按用户统计
+	if w := request(200); w.Code != http.StatusOK {
+		t.Errorf("other user status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	config.AppConfig = &config.Config{}
+	if w := request(100); w.Code != http.StatusOK {
+		t.Errorf("disabled limit status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
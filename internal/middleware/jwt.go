@@ -14,6 +14,7 @@ package middleware
 
 import (
 	"chatserver-api/internal/consts"
+	"chatserver-api/internal/model"
 	"chatserver-api/pkg/config"
 	"chatserver-api/pkg/errors"
 	"chatserver-api/pkg/errors/ecode"
@@ -28,8 +29,18 @@ import (
 // 请求头的形式为 Authorization: Bearer token
 const authorizationHeader = "Authorization"
 
-// AuthToken 鉴权，验证用户token是否有效
-func AuthToken() gin.HandlerFunc {
+// ApiKeyAuthFunc 校验用户 API Key
+type ApiKeyAuthFunc func(ctx *gin.Context, key string) (model.ApiKeyAuth, error)
+
+var apiKeyAuth ApiKeyAuthFunc
+
+// SetApiKeyAuth 设置 API Key 校验方法，未设置时只接受 JWT
+func SetApiKeyAuth(fn ApiKeyAuthFunc) {
+	apiKeyAuth = fn
+}
+
+// AuthToken 鉴权，验证用户token是否有效；scopes 不为空时也接受包含其中任一授权范围的 API Key
+func AuthToken(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenstr, err := getJwtFromHeader(c)
 		if err != nil {
@@ -37,6 +48,10 @@ func AuthToken() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if strings.HasPrefix(tokenstr, consts.ApiKeyTokenPrefix) {
+			authApiKey(c, tokenstr, scopes)
+			return
+		}
 		if jwt.IsInBlackList(c, tokenstr) {
 			response.JSON(c, errors.WithCode(ecode.RequireAuthErr, "invalid token"), nil)
 			c.Abort()
@@ -49,13 +64,59 @@ func AuthToken() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if claims.SessionId != 0 && jwt.IsSessionRevoked(c, claims.SessionId) {
+			response.JSON(c, errors.WithCode(ecode.RequireAuthErr, "session revoked"), nil)
+			c.Abort()
+			return
+		}
+		// 会话功能上线前签发的 token 没有会话ID，用户全部会话被注销(封禁、改密等)后一并失效
+		if claims.SessionId == 0 && jwt.IsUserRevoked(c, claims.UserId, claims.IssuedAt) {
+			response.JSON(c, errors.WithCode(ecode.RequireAuthErr, "session revoked"), nil)
+			c.Abort()
+			return
+		}
 		c.Set(consts.UserID, claims.UserId)
 		c.Set(consts.RoleID, claims.RoleId)
+		c.Set(consts.SessionIDCtx, claims.SessionId)
 		c.Set(consts.JWTTokenCtx, tokenstr)
 		c.Next()
 	}
 }
 
+func authApiKey(c *gin.Context, key string, scopes []string) {
+	if apiKeyAuth == nil || len(scopes) == 0 {
+		response.JSON(c, errors.WithCode(ecode.PermissionErr, "该接口不支持 API Key"), nil)
+		c.Abort()
+		return
+	}
+	auth, err := apiKeyAuth(c, key)
+	if err != nil {
+		response.JSON(c, errors.Wrap(err, ecode.RequireAuthErr, err.Error()), nil)
+		c.Abort()
+		return
+	}
+	if !scopeAllowed(auth.Scopes, scopes) {
+		response.JSON(c, errors.WithCode(ecode.PermissionErr, "API Key 未授权访问该接口"), nil)
+		c.Abort()
+		return
+	}
+	c.Set(consts.UserID, auth.UserId)
+	c.Set(consts.RoleID, auth.Role)
+	c.Set(consts.ApiKeyIDCtx, auth.KeyId)
+	c.Next()
+}
+
+func scopeAllowed(granted, required []string) bool {
+	for _, g := range granted {
+		for _, r := range required {
+			if g == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func getJwtFromHeader(c *gin.Context) (string, error) {
 	aHeader := c.Request.Header.Get(authorizationHeader)
 	if len(aHeader) == 0 {
@@ -0,0 +1,134 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-29 13:48:10
+ * @LastEditTime: 2023-06-29 13:48:10
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/middleware/jwt_test.go
+ */
+package middleware
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/model"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/jwt"
+	"chatserver-api/pkg/logger"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func Test_scopeAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  []string
+		required []string
+		want     bool
+	}{
+		{"granted", []string{consts.ApiScopeChat}, []string{consts.ApiScopeChat}, true},
+		{"any of required", []string{consts.ApiScopeHistory}, []string{consts.ApiScopeChat, consts.ApiScopeHistory}, true},
+		{"not granted", []string{consts.ApiScopeChat}, []string{consts.ApiScopeEmbedding}, false},
+		{"no granted scopes", nil, []string{consts.ApiScopeChat}, false},
+		{"no required scopes", []string{consts.ApiScopeChat}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scopeAllowed(tt.granted, tt.required); got != tt.want {
+				t.Errorf("scopeAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_authApiKey(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	gin.SetMode(gin.TestMode)
+	defer SetApiKeyAuth(nil)
+	valid := func(*gin.Context, string) (model.ApiKeyAuth, error) {
+		return model.ApiKeyAuth{KeyId: 7, UserId: 100, Role: consts.StandardUser, Scopes: []string{consts.ApiScopeChat}}, nil
+	}
+	tests := []struct {
+		name     string
+		auth     ApiKeyAuthFunc
+		scopes   []string
+		wantNext bool
+	}{
+		{"scope granted", valid, []string{consts.ApiScopeChat}, true},
+		{"route without scopes", valid, nil, false},
+		{"scope not granted", valid, []string{consts.ApiScopeEmbedding}, false},
+		{"api key disabled", nil, []string{consts.ApiScopeChat}, false},
+		{"invalid key", func(*gin.Context, string) (model.ApiKeyAuth, error) {
+			return model.ApiKeyAuth{}, errors.New("API Key 无效")
+		}, []string{consts.ApiScopeChat}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetApiKeyAuth(tt.auth)
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest("POST", "/", nil)
+			ctx.Request.Header.Set(authorizationHeader, "Bearer "+consts.ApiKeyTokenPrefix+"test")
+			AuthToken(tt.scopes...)(ctx)
+			if ctx.IsAborted() == tt.wantNext {
+				t.Errorf("AuthToken() aborted = %v, want next %v", ctx.IsAborted(), tt.wantNext)
+			}
+			if tt.wantNext && (ctx.GetInt64(consts.UserID) != 100 || ctx.GetInt64(consts.ApiKeyIDCtx) != 7) {
+				t.Errorf("AuthToken() user = %d, key = %d", ctx.GetInt64(consts.UserID), ctx.GetInt64(consts.ApiKeyIDCtx))
+			}
+		})
+	}
+}
+
+func TestAuthToken_revokedUser(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	gin.SetMode(gin.TestMode)
+	old := config.AppConfig
+	defer func() { config.AppConfig = old }()
+	config.AppConfig = &config.Config{JwtConfig: config.JwtConfig{Secret: "secret", JwtTtl: 3600}}
+	mr := miniredis.RunT(t)
+	cache.InitRedis(config.RedisConfig{Addr: mr.Addr()})
+	defer cache.CloseRedis()
+
+	token := func(uid, sid int64, issued time.Time) string {
+		claims := jwt.BuildClaims(issued.Add(time.Hour), uid, consts.StandardUser, sid)
+		claims.IssuedAt.Time = issued
+		s, err := jwt.GenToken(claims, config.AppConfig.JwtConfig.Secret)
+		if err != nil {
+			t.Fatalf("GenToken() error = %v", err)
+		}
+		return s
+	}
+	if err := jwt.RevokeUser(context.Background(), 100, time.Hour); err != nil {
+		t.Fatalf("RevokeUser() error = %v", err)
+	}
+	// 把注销时间提前，以便签发注销之后的 token
+	revokedAt := time.Now().Add(-10 * time.Minute)
+	mr.Set("jwt_user_revoked:100", strconv.FormatInt(revokedAt.Unix(), 10))
+	tests := []struct {
+		name     string
+		token    string
+		wantNext bool
+	}{
+		{"legacy token before revoke", token(100, 0, revokedAt.Add(-time.Minute)), false},
+		{"legacy token after revoke", token(100, 0, revokedAt.Add(time.Minute)), true},
+		{"legacy token of other user", token(200, 0, revokedAt.Add(-time.Minute)), true},
+		{"session token", token(100, 42, revokedAt.Add(-time.Minute)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest("GET", "/", nil)
+			ctx.Request.Header.Set(authorizationHeader, "Bearer "+tt.token)
+			AuthToken()(ctx)
+			if ctx.IsAborted() == tt.wantNext {
+				t.Errorf("AuthToken() aborted = %v, want next %v", ctx.IsAborted(), tt.wantNext)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 16:08:53
+ * @LastEditTime: 2023-06-28 14:12:05
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/middleware/permission.go
+ */
+package middleware
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/pkg/errors"
+	"chatserver-api/pkg/errors/ecode"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/rbac"
+	"chatserver-api/pkg/response"
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleLoadFunc 读取用户当前等级
+type RoleLoadFunc func(ctx context.Context, userId int64) (int, error)
+
+var roleLoad RoleLoadFunc
+
+// SetRoleLoad 设置用户等级读取方法；未设置时使用 token 中的等级，等级变更要到下次刷新 token 后才生效
+func SetRoleLoad(fn RoleLoadFunc) {
+	roleLoad = fn
+}
+
+// Permission 校验当前用户等级是否拥有指定权限，需在 AuthToken 之后使用
+// 设置了 SetRoleLoad 时重新读取用户等级，管理员调整的等级立即生效，不必等待 token 过期
+func Permission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetInt(consts.RoleID)
+		if roleLoad != nil {
+			var err error
+			if role, err = roleLoad(c, c.GetInt64(consts.UserID)); err != nil {
+				logger.Errorf("读取用户等级失败:%v", err)
+				response.JSON(c, errors.Wrap(err, ecode.PermissionErr, "权限错误"), nil)
+				c.Abort()
+				return
+			}
+			c.Set(consts.RoleID, role)
+		}
+		if !rbac.HasPermission(role, perm) {
+			response.JSON(c, errors.WithCode(ecode.PermissionErr, "权限错误"), nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-28 14:12:05
+ * @LastEditTime: 2023-06-28 14:12:05
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/middleware/permission_test.go
+ */
+package middleware
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPermission(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	gin.SetMode(gin.TestMode)
+	defer SetRoleLoad(nil)
+	tests := []struct {
+		name      string
+		tokenRole int
+		load      RoleLoadFunc
+		wantNext  bool
+	}{
+		{"token role without loader", consts.Administrator, nil, true},
+		{"token role lacks permission", consts.StandardUser, nil, false},
+		{"demoted administrator", consts.Administrator, func(context.Context, int64) (int, error) { return consts.StandardUser, nil }, false},
+		{"promoted user", consts.StandardUser, func(context.Context, int64) (int, error) { return consts.Administrator, nil }, true},
+		{"loader error", consts.Administrator, func(context.Context, int64) (int, error) { return 0, errors.New("db down") }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetRoleLoad(tt.load)
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest("GET", "/", nil)
+			ctx.Set(consts.UserID, int64(1))
+			ctx.Set(consts.RoleID, tt.tokenRole)
+			Permission(consts.PermAdminSystem)(ctx)
+			if ctx.IsAborted() == tt.wantNext {
+				t.Errorf("Permission() aborted = %v, want next %v", ctx.IsAborted(), tt.wantNext)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 10:02:15
+ * @LastEditTime: 2023-06-25 10:02:15
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/account.go
+ */
+package model
+
+import "chatserver-api/pkg/jtime"
+
+type AccountDeleteReq struct {
+	Password string `json:"password" label:"密码"` // 单点登录用户可不填，仅凭邮件确认
+}
+
+type AccountDeleteConfirmReq struct {
+	Code string `json:"code" validate:"required" label:"确认码"`
+}
+
+type AccountDeleteRes struct {
+	DeleteAt jtime.JsonTime `json:"delete_at"`
+}
+
+// 用户数据导出
+type AccountExportProfile struct {
+	UserId    string         `json:"user_id"`
+	Username  string         `json:"username"`
+	Nickname  string         `json:"nickname"`
+	Email     string         `json:"email"`
+	Phone     string         `json:"phone"`
+	Role      string         `json:"role"`
+	Balance   float64        `json:"balance"`
+	CreatedAt jtime.JsonTime `json:"created_at"`
+}
+
+type AccountExportChat struct {
+	ChatId    string                `json:"chat_id"`
+	ChatName  string                `json:"chat_name"`
+	PresetId  string                `json:"preset_id"`
+	CreatedAt jtime.JsonTime        `json:"created_at"`
+	Records   []AccountExportRecord `json:"records"`
+}
+
+type AccountExportRecord struct {
+	RecordId  string         `json:"record_id"`
+	Sender    string         `json:"sender"`
+	Message   string         `json:"message"`
+	CreatedAt jtime.JsonTime `json:"created_at"`
+}
+
+type AccountExportBill struct {
+	BillId      string         `json:"bill_id"`
+	CostChange  float64        `json:"cost_change"`
+	Balance     float64        `json:"balance"`
+	CostComment string         `json:"cost_comment"`
+	ApiKeyId    string         `json:"api_key_id,omitempty"`
+	CreatedAt   jtime.JsonTime `json:"created_at"`
+}
+
+// AccountDocument 用户个人知识库中的文档，不含向量
+type AccountDocument struct {
+	KbId      int64          `gorm:"column:kb_id" json:"kb_id,string"`
+	KbName    string         `gorm:"column:kb_name" json:"kb_name"`
+	Title     string         `gorm:"column:title" json:"title"`
+	Page      int            `gorm:"column:page" json:"page"`
+	Body      string         `gorm:"column:body" json:"body"`
+	CreatedAt jtime.JsonTime `gorm:"column:created_at" json:"created_at"`
+}
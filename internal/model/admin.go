@@ -0,0 +1,85 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 18:02:36
+ * @LastEditTime: 2023-06-25 18:02:36
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/admin.go
+ */
+package model
+
+import "chatserver-api/pkg/jtime"
+
+// AdminUserListReq 用户搜索条件，字符串条件为模糊匹配，时间为注册时间的毫秒时间戳
+type AdminUserListReq struct {
+	Username     string `form:"username"`
+	Email        string `form:"email"`
+	RegisteredIp string `form:"registered_ip"`
+	Role         int    `form:"role"`
+	Start        int64  `form:"start"`
+	End          int64  `form:"end"`
+	Page         int    `form:"page"`
+	PageSize     int    `form:"pagesize"`
+}
+
+type AdminUserOneRes struct {
+	UserId       string          `json:"user_id"`
+	Username     string          `json:"username"`
+	Nickname     string          `json:"nickname"`
+	Email        string          `json:"email"`
+	RegisteredIp string          `json:"registered_ip"`
+	Role         int             `json:"role"`
+	RoleName     string          `json:"role_name"`
+	Balance      float64         `json:"balance"`
+	IsActive     bool            `json:"is_active"`
+	IsBanned     bool            `json:"is_banned"`
+	BanReason    string          `json:"ban_reason"`
+	DeleteAt     *jtime.JsonTime `json:"delete_at"`
+	CreatedAt    jtime.JsonTime  `json:"created_at"`
+}
+
+type AdminUserListRes struct {
+	Total int64             `json:"total"`
+	Users []AdminUserOneRes `json:"users"`
+}
+
+type AdminUserBillReq struct {
+	UserId   string `form:"user_id" validate:"required"`
+	Page     int    `form:"page"`
+	PageSize int    `form:"pagesize"`
+}
+
+type AdminUserBillOneRes struct {
+	BillId      string         `json:"bill_id"`
+	CostChange  float64        `json:"change"`
+	Balance     float64        `json:"balance"`
+	CostComment string         `json:"comment"`
+	ApiKeyId    string         `json:"api_key_id,omitempty"`
+	OperatorId  string         `json:"operator_id,omitempty"`
+	CreatedAt   jtime.JsonTime `json:"change_time"`
+}
+
+type AdminUserBillRes struct {
+	Total    int64                 `json:"total"`
+	BillList []AdminUserBillOneRes `json:"bill_list"`
+}
+
+// AdminUserBalanceReq 手动调整余额，Amount 为正数增加、负数扣减
+type AdminUserBalanceReq struct {
+	UserId  string  `json:"user_id" validate:"required"`
+	Amount  float64 `json:"amount" validate:"required"`
+	Comment string  `json:"comment" validate:"required"`
+}
+
+type AdminUserRoleReq struct {
+	UserId string `json:"user_id" validate:"required"`
+	Role   int    `json:"role" validate:"required"`
+}
+
+type AdminUserBanReq struct {
+	UserId string `json:"user_id" validate:"required"`
+	Reason string `json:"reason" validate:"max=255" label:"封禁原因"`
+}
+
+type AdminUserIdReq struct {
+	UserId string `json:"user_id" validate:"required"`
+}
@@ -0,0 +1,52 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 09:50:13
+ * @LastEditTime: 2023-06-24 09:50:13
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/apikey.go
+ */
+package model
+
+import "chatserver-api/pkg/jtime"
+
+type ApiKeyCreateReq struct {
+	Name        string   `json:"name" validate:"required,max=32" label:"名称"`
+	Scopes      []string `json:"scopes" validate:"required,min=1,dive,oneof=chat embedding read-history" label:"授权范围"`
+	ExpireDays  int      `json:"expire_days" validate:"min=0,max=3650" label:"有效天数"`
+	IpAllowlist []string `json:"ip_allowlist" validate:"max=20" label:"IP白名单"`
+}
+
+type ApiKeyCreateRes struct {
+	KeyId string `json:"key_id"`
+	Key   string `json:"key"` // 完整的 Key 只在创建时返回一次
+}
+
+type ApiKeyOneRes struct {
+	KeyId       string          `json:"key_id"`
+	Name        string          `json:"name"`
+	Prefix      string          `json:"prefix"`
+	Scopes      []string        `json:"scopes"`
+	IpAllowlist []string        `json:"ip_allowlist"`
+	ExpiredAt   *jtime.JsonTime `json:"expired_at"`
+	LastUsedAt  *jtime.JsonTime `json:"last_used_at"`
+	CreatedAt   jtime.JsonTime  `json:"created_at"`
+	Cost        float64         `json:"cost"`
+}
+
+type ApiKeyListRes struct {
+	KeyList []ApiKeyOneRes `json:"key_list"`
+}
+
+type ApiKeyDeleteReq struct {
+	KeyId string `form:"key_id" validate:"required"`
+}
+
+// ApiKeyAuth API Key 鉴权结果
+type ApiKeyAuth struct {
+	KeyId       int64    `json:"key_id"`
+	UserId      int64    `json:"user_id"`
+	Role        int      `json:"role"`
+	Scopes      []string `json:"scopes"`
+	IpAllowlist []string `json:"ip_allowlist"`
+	ExpiredAt   int64    `json:"expired_at"`
+}
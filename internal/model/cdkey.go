@@ -8,22 +8,87 @@
 
 package model
 
+import "chatserver-api/pkg/jtime"
+
 type CdKeyGenerateRes struct {
+	BatchId string   `json:"batch_id"`
 	CodeKey []string `json:"code_key"`
 }
 
 type CdKeyGenerateReq struct {
 	GiftCardId string `json:"card_id"  validate:"required"`
 	KeyNumber  int    `json:"key_number"  validate:"required"`
+	ExpireDays int    `json:"expire_days"` // 有效天数，0 表示永不过期
 }
 
 type CdkeyPayReq struct {
 	CodeKey string `json:"code_key"`
 }
 
-type CdKeyAmount struct {
-	CodeKey    string  `gorm:"column:CdKeys__code_key" json:"code_key"`
-	CardAmount float64 `gorm:"column:card_amount" json:"card_amount"`
+// CdKeyListReq 卡密查询条件，Status 为 unused, redeemed, revoked, expired
+type CdKeyListReq struct {
+	CardId   string `form:"card_id"`
+	BatchId  string `form:"batch_id"`
+	Status   string `form:"status"`
+	Page     int    `form:"page"`
+	PageSize int    `form:"pagesize"`
+}
+
+type CdKeyOneRes struct {
+	KeyId      string          `json:"key_id"`
+	CodeKey    string          `json:"code_key"`
+	CardId     string          `json:"card_id"`
+	CardName   string          `json:"card_name"`
+	BatchId    string          `json:"batch_id"`
+	Status     int             `json:"status"`
+	StatusName string          `json:"status_name"`
+	IsExpired  bool            `json:"is_expired"`
+	ExpiredAt  *jtime.JsonTime `json:"expired_at"`
+	RedeemedBy string          `json:"redeemed_by,omitempty"`
+	RedeemedAt *jtime.JsonTime `json:"redeemed_at"`
+	CreatedAt  jtime.JsonTime  `json:"created_at"`
+}
+
+type CdKeyListRes struct {
+	Total   int64         `json:"total"`
+	KeyList []CdKeyOneRes `json:"key_list"`
+}
+
+type CdKeyExportReq struct {
+	BatchId string `form:"batch_id" validate:"required"`
+}
+
+// CdKeyRevokeReq 作废指定卡密或整个批次中未使用的卡密
+type CdKeyRevokeReq struct {
+	KeyIds  []string `json:"key_ids"`
+	BatchId string   `json:"batch_id"`
+}
+
+type CdKeyRevokeRes struct {
+	Revoked int64 `json:"revoked"`
+}
+
+type CdKeyRedemptionListReq struct {
+	UserId   string `form:"user_id"`
+	CardId   string `form:"card_id"`
+	Page     int    `form:"page"`
+	PageSize int    `form:"pagesize"`
+}
+
+type CdKeyRedemptionOneRes struct {
+	RedemptionId string         `json:"redemption_id"`
+	KeyId        string         `json:"key_id"`
+	CodeKey      string         `json:"code_key"`
+	CardId       string         `json:"card_id"`
+	CardName     string         `json:"card_name"`
+	UserId       string         `json:"user_id"`
+	Amount       float64        `json:"amount"`
+	CreatedAt    jtime.JsonTime `json:"created_at"`
+}
+
+type CdKeyRedemptionListRes struct {
+	Total          int64                   `json:"total"`
+	RedemptionList []CdKeyRedemptionOneRes `json:"redemption_list"`
 }
 
 type GiftCardCreate struct {
@@ -54,21 +54,24 @@ type ChatOne struct {
 }
 
 type ChatDetail struct {
-	ChatName      string         `gorm:"column:Chats__chat_name" json:"chat_name"`
-	PresetName    string         `gorm:"column:preset_name" json:"preset_name"`
-	PresetContent string         `gorm:"column:preset_content" json:"preset_content"`
-	ModelName     string         `gorm:"column:model_name" json:"model_name"`
-	MaxTokens     int            `gorm:"column:max_token" json:"max_token"`
-	LogitBias     datatypes.JSON `gorm:"column:logit_bias" json:"logit_bias"`
-	Temperature   float64        `gorm:"column:temperature" json:"temperature"`
-	TopP          float64        `gorm:"column:top_p" json:"top_p"`
-	Presence      float64        `gorm:"column:presence" json:"presence"`
-	Frequency     float64        `gorm:"column:frequency" json:"frequency"`
-	WithEmbedding bool           `gorm:"column:with_embedding" json:"with_embedding"`
-	Extension     int            `gorm:"column:extension" json:"extension"`
-	Classify      string         `gorm:"column:classify" json:"classify"`
-	Privilege     int            `gorm:"column:privilege" json:"privilege"`
-	CreatedAt     jtime.JsonTime `gorm:"column:Chats__created_at" json:"created_at"`
+	PresetId        int64          `gorm:"column:id" json:"preset_id"`
+	ChatName        string         `gorm:"column:Chats__chat_name" json:"chat_name"`
+	PresetName      string         `gorm:"column:preset_name" json:"preset_name"`
+	PresetContent   string         `gorm:"column:preset_content" json:"preset_content"`
+	ModelName       string         `gorm:"column:model_name" json:"model_name"`
+	MaxTokens       int            `gorm:"column:max_token" json:"max_token"`
+	LogitBias       datatypes.JSON `gorm:"column:logit_bias" json:"logit_bias"`
+	Temperature     float64        `gorm:"column:temperature" json:"temperature"`
+	TopP            float64        `gorm:"column:top_p" json:"top_p"`
+	Presence        float64        `gorm:"column:presence" json:"presence"`
+	Frequency       float64        `gorm:"column:frequency" json:"frequency"`
+	WithEmbedding   bool           `gorm:"column:with_embedding" json:"with_embedding"`
+	Extension       int            `gorm:"column:extension" json:"extension"`
+	QueryStrategy   string         `gorm:"column:query_strategy" json:"query_strategy"`
+	SearchProviders string         `gorm:"column:search_providers" json:"search_providers"`
+	Classify        string         `gorm:"column:classify" json:"classify"`
+	Privilege       int            `gorm:"column:privilege" json:"privilege"`
+	CreatedAt       jtime.JsonTime `gorm:"column:Chats__created_at" json:"created_at"`
 }
 
 type ChatDetailReq struct {
@@ -88,3 +91,12 @@ type ChatUpdateReq struct {
 	ChatName string `json:"chat_name" label:"会话名称"`
 	PresetId string `json:"preset_id" label:"预设ID"`
 }
+
+// SearchCacheClearReq 清除搜索缓存，Query 为空时清除全部
+type SearchCacheClearReq struct {
+	Query string `json:"query"`
+}
+
+type SearchCacheClearRes struct {
+	Deleted int64 `json:"deleted"`
+}
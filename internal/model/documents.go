@@ -7,12 +7,40 @@
  */
 package model
 
+import "chatserver-api/pkg/pgvector"
+
 type DocsCompare struct {
-	Body string `gorm:"column:body" json:"body"`
+	Id        int64           `gorm:"column:id" json:"id"`
+	Title     string          `gorm:"column:title" json:"title"`
+	Page      int             `gorm:"column:page" json:"page"`
+	Body      string          `gorm:"column:body" json:"body"`
+	Tokens    int             `gorm:"column:tokens" json:"tokens"`
+	Embedding pgvector.Vector `gorm:"column:embedding" json:"-"`
+	Distance  float64         `gorm:"column:distance" json:"distance"`
 }
 
 type DocsBatchList struct {
+	KbId       string   `json:"kb_id" validate:"required"`
 	BatchTitle string   `json:"batch_title" validate:"required"`
 	Classify   string   `json:"classify" validate:"required"`
 	BatchList  []string `json:"batch_list" validate:"required"`
+	Pages      []int    `json:"pages"` // 可选，与 BatchList 一一对应的页码
+}
+
+type EmbeddingStatsRes struct {
+	RedisHits int64   `json:"redis_hits"`
+	PgHits    int64   `json:"pg_hits"`
+	Misses    int64   `json:"misses"`
+	Dedup     int64   `json:"dedup"`
+	HitRate   float64 `json:"hit_rate"`
+}
+
+// Citation 回答引用的知识库片段或网页来源
+type Citation struct {
+	Source  string `json:"source"` // kb 知识库, web 网页
+	DocId   string `json:"doc_id,omitempty"`
+	Title   string `json:"title"`
+	Page    int    `json:"page,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Snippet string `json:"snippet"`
 }
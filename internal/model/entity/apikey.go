@@ -0,0 +1,32 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 09:20:36
+ * @LastEditTime: 2023-06-24 09:20:36
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/entity/apikey.go
+ */
+package entity
+
+import (
+	"chatserver-api/pkg/jtime"
+)
+
+// ApiKey 用户 API Key，只保存哈希；Scopes、IpAllowlist 以逗号分隔，ExpiredAt 为空表示永不过期
+type ApiKey struct {
+	Id          int64           `gorm:"column:id;primary_key;" json:"id"`
+	UserId      int64           `gorm:"column:user_id;index" json:"user_id"`
+	Name        string          `gorm:"column:name" json:"name"`
+	Prefix      string          `gorm:"column:prefix" json:"prefix"`
+	KeyHash     string          `gorm:"column:key_hash;uniqueIndex" json:"-"`
+	Scopes      string          `gorm:"column:scopes" json:"scopes"`
+	IpAllowlist string          `gorm:"column:ip_allowlist" json:"ip_allowlist"`
+	ExpiredAt   *jtime.JsonTime `gorm:"column:expired_at" json:"expired_at"`
+	LastUsedAt  *jtime.JsonTime `gorm:"column:last_used_at" json:"last_used_at"`
+	IsRevoked   bool            `gorm:"column:is_revoked" json:"is_revoked"`
+	CreatedAt   jtime.JsonTime  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt   jtime.JsonTime  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (ApiKey) TableName() string {
+	return "public.api_key"
+}
@@ -17,6 +17,8 @@ type Bill struct {
 	CostChange  float64        `gorm:"column:cost_change" json:"cost_change"`
 	Balance     float64        `gorm:"column:balance" json:"balance"`
 	CostComment string         `gorm:"column:cost_comment" json:"cost_comment"`
+	ApiKeyId    int64          `gorm:"column:api_key_id" json:"api_key_id"`   // 通过 API Key 调用产生的消费
+	OperatorId  int64          `gorm:"column:operator_id" json:"operator_id"` // 管理员手动调整余额时的操作人
 	CreatedAt   jtime.JsonTime `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt   jtime.JsonTime `gorm:"column:updated_at" json:"updated_at"`
 }
@@ -17,6 +17,11 @@ type CdKey struct {
 	Id         int64                 `gorm:"column:id;primary_key;" json:"id"`
 	GiftCardId int64                 `gorm:"column:giftcard_id;" json:"giftcard_id"`
 	CodeKey    string                `gorm:"column:code_key" json:"code_key"`
+	BatchId    int64                 `gorm:"column:batch_id" json:"batch_id"`       // 同一次生成的卡密属于同一批次
+	Status     int                   `gorm:"column:status" json:"status"`           // 0 未使用 1 已兑换 2 已作废
+	ExpiredAt  *jtime.JsonTime       `gorm:"column:expired_at" json:"expired_at"`   // 为空表示永不过期
+	RedeemedBy int64                 `gorm:"column:redeemed_by" json:"redeemed_by"` // 兑换用户
+	RedeemedAt *jtime.JsonTime       `gorm:"column:redeemed_at" json:"redeemed_at"`
 	CreatedAt  jtime.JsonTime        `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt  jtime.JsonTime        `gorm:"column:updated_at" json:"updated_at"`
 	DeletedAt  jtime.JsonTime        `gorm:"column:deleted_at" json:"deleted_at" `
@@ -26,3 +31,18 @@ type CdKey struct {
 func (CdKey) TableName() string {
 	return "public.cdkey"
 }
+
+// CdKeyRedemption 卡密兑换记录
+type CdKeyRedemption struct {
+	Id         int64          `gorm:"column:id;primary_key;" json:"id"`
+	CdKeyId    int64          `gorm:"column:cdkey_id" json:"cdkey_id"`
+	CodeKey    string         `gorm:"column:code_key" json:"code_key"`
+	GiftCardId int64          `gorm:"column:giftcard_id" json:"giftcard_id"`
+	UserId     int64          `gorm:"column:user_id" json:"user_id"`
+	Amount     float64        `gorm:"column:amount" json:"amount"`
+	CreatedAt  jtime.JsonTime `gorm:"column:created_at" json:"created_at"`
+}
+
+func (CdKeyRedemption) TableName() string {
+	return "public.cdkey_redemption"
+}
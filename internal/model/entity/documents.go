@@ -13,16 +13,31 @@ import (
 )
 
 type Documents struct {
-	Id        int64           `gorm:"column:id;primary_key;" json:"id"`
-	Classify  string          `gorm:"column:classify" json:"classify"`
-	Title     string          `gorm:"column:title" json:"title"`
-	Body      string          `gorm:"column:body" json:"body"`
-	Tokens    int             `gorm:"column:tokens" json:"tokens"`
-	Embedding pgvector.Vector `gorm:"column:embedding" json:"embedding"`
-	CreatedAt jtime.JsonTime  `gorm:"column:created_at" json:"created_at"`
-	UpdatedAt jtime.JsonTime  `gorm:"column:updated_at" json:"updated_at"`
+	Id          int64           `gorm:"column:id;primary_key;" json:"id"`
+	KbId        int64           `gorm:"column:kb_id" json:"kb_id"`
+	Classify    string          `gorm:"column:classify" json:"classify"`
+	Title       string          `gorm:"column:title" json:"title"`
+	Page        int             `gorm:"column:page" json:"page"`
+	Body        string          `gorm:"column:body" json:"body"`
+	Tokens      int             `gorm:"column:tokens" json:"tokens"`
+	ContentHash string          `gorm:"column:content_hash;index" json:"content_hash"`
+	Embedding   pgvector.Vector `gorm:"column:embedding" json:"embedding"`
+	CreatedAt   jtime.JsonTime  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt   jtime.JsonTime  `gorm:"column:updated_at" json:"updated_at"`
 }
 
 func (Documents) TableName() string {
 	return "embed.documents"
 }
+
+// EmbeddingCache 以内容哈希为键的向量缓存，Redis 未命中时回查
+type EmbeddingCache struct {
+	ContentHash string          `gorm:"column:content_hash;primary_key;" json:"content_hash"`
+	Model       string          `gorm:"column:model" json:"model"`
+	Embedding   pgvector.Vector `gorm:"column:embedding" json:"embedding"`
+	CreatedAt   jtime.JsonTime  `gorm:"column:created_at" json:"created_at"`
+}
+
+func (EmbeddingCache) TableName() string {
+	return "embed.embedding_cache"
+}
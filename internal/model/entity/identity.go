@@ -0,0 +1,27 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-22 11:05:12
+ * @LastEditTime: 2023-06-22 18:21:05
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/entity/identity.go
+ */
+package entity
+
+import (
+	"chatserver-api/pkg/jtime"
+)
+
+// UserIdentity 用户在外部身份提供方(OIDC)的身份，Issuer + Subject 唯一
+type UserIdentity struct {
+	Id        int64          `gorm:"column:id;primary_key;" json:"id"`
+	UserId    int64          `gorm:"column:user_id;index" json:"user_id"`
+	Issuer    string         `gorm:"column:issuer;uniqueIndex:idx_identity_subject" json:"issuer"`
+	Subject   string         `gorm:"column:subject;uniqueIndex:idx_identity_subject" json:"subject"`
+	Email     string         `gorm:"column:email" json:"email"`
+	CreatedAt jtime.JsonTime `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt jtime.JsonTime `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (UserIdentity) TableName() string {
+	return "public.user_identity"
+}
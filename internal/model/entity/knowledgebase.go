@@ -0,0 +1,47 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-14 10:05:37
+ * @LastEditTime: 2023-06-14 17:32:10
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/entity/knowledgebase.go
+ */
+package entity
+
+import (
+	"chatserver-api/pkg/jtime"
+
+	"gorm.io/plugin/soft_delete"
+)
+
+type KnowledgeBase struct {
+	Id          int64                 `gorm:"column:id;primary_key;" json:"id"`
+	KbName      string                `gorm:"column:kb_name" json:"kb_name"`
+	Description string                `gorm:"column:description" json:"description"`
+	OwnerType   string                `gorm:"column:owner_type" json:"owner_type"` // user 个人, team 团队
+	OwnerId     int64                 `gorm:"column:owner_id" json:"owner_id"`
+	Visibility  int                   `gorm:"column:visibility" json:"visibility"` // 1 私有, 2 共享, 3 公开
+	CreatedAt   jtime.JsonTime        `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt   jtime.JsonTime        `gorm:"column:updated_at" json:"updated_at"`
+	DeletedAt   jtime.JsonTime        `gorm:"column:deleted_at" json:"deleted_at"`
+	IsDel       soft_delete.DeletedAt `gorm:"softDelete:flag,DeletedAtField:DeletedAt"`
+	Documents   []Documents           `gorm:"foreignKey:kb_id;references:id"`
+	Members     []KbMember            `gorm:"foreignKey:kb_id;references:id"`
+}
+
+func (KnowledgeBase) TableName() string {
+	return "embed.knowledge_base"
+}
+
+// KbMember 共享知识库的成员及权限
+type KbMember struct {
+	Id         int64          `gorm:"column:id;primary_key;" json:"id"`
+	KbId       int64          `gorm:"column:kb_id;uniqueIndex:idx_kb_member" json:"kb_id"`
+	UserId     int64          `gorm:"column:user_id;uniqueIndex:idx_kb_member" json:"user_id"`
+	Permission int            `gorm:"column:permission" json:"permission"` // 1 只读, 2 读写
+	CreatedAt  jtime.JsonTime `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt  jtime.JsonTime `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (KbMember) TableName() string {
+	return "embed.kb_member"
+}
@@ -0,0 +1,35 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 11:10:04
+ * @LastEditTime: 2023-06-26 11:10:04
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/entity/order.go
+ */
+package entity
+
+import (
+	"chatserver-api/pkg/jtime"
+)
+
+// Order 在线支付订单，金额单位为元
+type Order struct {
+	Id         int64           `gorm:"column:id;primary_key;" json:"id"`
+	UserId     int64           `gorm:"column:user_id" json:"user_id"`
+	ItemType   string          `gorm:"column:item_type" json:"item_type"` // 商品类型，目前仅有 giftcard
+	ItemId     int64           `gorm:"column:item_id" json:"item_id"`
+	Subject    string          `gorm:"column:subject" json:"subject"`
+	Amount     float64         `gorm:"column:amount" json:"amount"` // 支付金额
+	Credit     float64         `gorm:"column:credit" json:"credit"` // 支付成功后到账余额
+	Provider   string          `gorm:"column:provider" json:"provider"`
+	TradeNo    string          `gorm:"column:trade_no" json:"trade_no"` // 支付平台交易号
+	PayURL     string          `gorm:"column:pay_url" json:"pay_url"`
+	Status     int             `gorm:"column:status" json:"status"` // 0 待支付 1 已支付 2 已退款 3 退款中
+	PaidAt     *jtime.JsonTime `gorm:"column:paid_at" json:"paid_at"`
+	RefundedAt *jtime.JsonTime `gorm:"column:refunded_at" json:"refunded_at"`
+	CreatedAt  jtime.JsonTime  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt  jtime.JsonTime  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (Order) TableName() string {
+	return "public.payment_order"
+}
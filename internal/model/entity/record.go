@@ -10,6 +10,7 @@ package entity
 import (
 	"chatserver-api/pkg/jtime"
 
+	"gorm.io/datatypes"
 	"gorm.io/plugin/soft_delete"
 )
 
@@ -22,6 +23,7 @@ type Record struct {
 	Message      string                `gorm:"column:message" json:"message" `
 	MessageHash  string                `gorm:"column:message_hash" json:"message_hash"`
 	MessageToken int                   `gorm:"column:message_token" json:"message_token"`
+	Citations    datatypes.JSON        `gorm:"column:citations" json:"citations"`
 	CreatedAt    jtime.JsonTime        `gorm:"column:created_at" json:"created_at" `
 	UpdatedAt    jtime.JsonTime        `gorm:"column:updated_at" json:"updated_at" `
 	DeletedAt    jtime.JsonTime        `gorm:"column:deleted_at" json:"deleted_at" `
@@ -0,0 +1,39 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 15:40:18
+ * @LastEditTime: 2023-06-26 15:40:18
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/entity/report.go
+ */
+package entity
+
+import "time"
+
+// ReportUsageDaily 按天、用户、预设、模型和来源汇总的消费，每次扣费时累加
+type ReportUsageDaily struct {
+	Day      time.Time `gorm:"column:day;type:date;primaryKey" json:"day"`
+	UserId   int64     `gorm:"column:user_id;primaryKey" json:"user_id"`
+	PresetId int64     `gorm:"column:preset_id;primaryKey" json:"preset_id"` // API 调用为 0
+	Model    string    `gorm:"column:model;primaryKey" json:"model"`
+	Source   string    `gorm:"column:source;primaryKey" json:"source"` // chat, api，对话中的辅助调用为 rewrite, hyde, planner, rerank, summary
+	Requests int64     `gorm:"column:requests" json:"requests"`
+	Tokens   int64     `gorm:"column:tokens" json:"tokens"`
+	Charge   float64   `gorm:"column:charge" json:"charge"` // 向用户收取的费用
+	Cost     float64   `gorm:"column:cost" json:"cost"`     // 按上游价格估算的成本
+}
+
+func (ReportUsageDaily) TableName() string {
+	return "public.report_usage_daily"
+}
+
+// ReportRevenueDaily 按天和来源汇总的收入，与入账在同一事务中累加
+type ReportRevenueDaily struct {
+	Day    time.Time `gorm:"column:day;type:date;primaryKey" json:"day"`
+	Source string    `gorm:"column:source;primaryKey" json:"source"` // cdkey, order, refund
+	Count  int64     `gorm:"column:count" json:"count"`
+	Amount float64   `gorm:"column:amount" json:"amount"`
+}
+
+func (ReportRevenueDaily) TableName() string {
+	return "public.report_revenue_daily"
+}
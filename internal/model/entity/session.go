@@ -0,0 +1,31 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-23 09:32:17
+ * @LastEditTime: 2023-06-23 09:32:17
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/entity/session.go
+ */
+package entity
+
+import (
+	"chatserver-api/pkg/jtime"
+)
+
+// UserSession 用户登录会话，每次刷新都会更换 RefreshHash，会话 id 写入访问 token 的 sid
+type UserSession struct {
+	Id          int64          `gorm:"column:id;primary_key;" json:"id"`
+	UserId      int64          `gorm:"column:user_id;index" json:"user_id"`
+	RefreshHash string         `gorm:"column:refresh_hash;uniqueIndex" json:"-"`
+	Device      string         `gorm:"column:device" json:"device"`
+	Ip          string         `gorm:"column:ip" json:"ip"`
+	UserAgent   string         `gorm:"column:user_agent" json:"user_agent"`
+	IsRevoked   bool           `gorm:"column:is_revoked" json:"is_revoked"`
+	ExpiredAt   jtime.JsonTime `gorm:"column:expired_at" json:"expired_at"`
+	LastUsedAt  jtime.JsonTime `gorm:"column:last_used_at" json:"last_used_at"`
+	CreatedAt   jtime.JsonTime `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt   jtime.JsonTime `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (UserSession) TableName() string {
+	return "public.user_session"
+}
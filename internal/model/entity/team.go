@@ -0,0 +1,40 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-14 10:21:54
+ * @LastEditTime: 2023-06-14 17:32:10
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/entity/team.go
+ */
+package entity
+
+import (
+	"chatserver-api/pkg/jtime"
+
+	"gorm.io/plugin/soft_delete"
+)
+
+type Team struct {
+	Id        int64                 `gorm:"column:id;primary_key;" json:"id"`
+	TeamName  string                `gorm:"column:team_name" json:"team_name"`
+	OwnerId   int64                 `gorm:"column:owner_id" json:"owner_id"`
+	CreatedAt jtime.JsonTime        `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt jtime.JsonTime        `gorm:"column:updated_at" json:"updated_at"`
+	DeletedAt jtime.JsonTime        `gorm:"column:deleted_at" json:"deleted_at"`
+	IsDel     soft_delete.DeletedAt `gorm:"softDelete:flag,DeletedAtField:DeletedAt"`
+	Members   []TeamMember          `gorm:"foreignKey:team_id;references:id"`
+}
+
+func (Team) TableName() string {
+	return "public.team"
+}
+
+type TeamMember struct {
+	Id        int64          `gorm:"column:id;primary_key;" json:"id"`
+	TeamId    int64          `gorm:"column:team_id;uniqueIndex:idx_team_member" json:"team_id"`
+	UserId    int64          `gorm:"column:user_id;uniqueIndex:idx_team_member" json:"user_id"`
+	CreatedAt jtime.JsonTime `gorm:"column:created_at" json:"created_at"`
+}
+
+func (TeamMember) TableName() string {
+	return "public.team_member"
+}
@@ -0,0 +1,39 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-23 15:08:14
+ * @LastEditTime: 2023-06-23 15:08:14
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/entity/totp.go
+ */
+package entity
+
+import (
+	"chatserver-api/pkg/jtime"
+)
+
+// UserTotp 用户两步验证密钥，Secret 加密保存，LastCounter 为最近一次使用的时间步，防止验证码重复使用
+type UserTotp struct {
+	UserId      int64          `gorm:"column:user_id;primary_key;" json:"user_id"`
+	Secret      string         `gorm:"column:secret" json:"-"`
+	LastCounter int64          `gorm:"column:last_counter" json:"-"`
+	CreatedAt   jtime.JsonTime `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt   jtime.JsonTime `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (UserTotp) TableName() string {
+	return "public.user_totp"
+}
+
+// UserRecoveryCode 两步验证恢复码，只保存哈希，每个只能使用一次
+type UserRecoveryCode struct {
+	Id        int64          `gorm:"column:id;primary_key;" json:"id"`
+	UserId    int64          `gorm:"column:user_id;index" json:"user_id"`
+	CodeHash  string         `gorm:"column:code_hash" json:"-"`
+	IsUsed    bool           `gorm:"column:is_used" json:"is_used"`
+	CreatedAt jtime.JsonTime `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt jtime.JsonTime `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (UserRecoveryCode) TableName() string {
+	return "public.user_recovery_code"
+}
@@ -25,6 +25,9 @@ type User struct {
 	IsActive     bool                  `gorm:"column:is_active" json:"is_active"`
 	Balance      float64               `gorm:"column:balance" json:"balance"`
 	Role         int                   `gorm:"column:role" json:"role"`
+	IsBanned     bool                  `gorm:"column:is_banned" json:"is_banned"`   // 被管理员封禁，无法登录和调用接口
+	BanReason    string                `gorm:"column:ban_reason" json:"ban_reason"` // 封禁原因
+	DeleteAt     *jtime.JsonTime       `gorm:"column:delete_at" json:"delete_at"`   // 计划注销时间，冷静期结束后删除账户
 	CreatedAt    jtime.JsonTime        `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt    jtime.JsonTime        `gorm:"column:updated_at" json:"updated_at"`
 	DeletedAt    jtime.JsonTime        `gorm:"column:deleted_at" json:"deleted_at" `
@@ -17,6 +17,9 @@ type UserLog struct {
 	UserIP    string         `gorm:"column:user_ip" json:"user_ip"`
 	Business  string         `gorm:"column:business" json:"business"`
 	Operation string         `gorm:"column:operation" json:"operation"`
+	UserAgent string         `gorm:"column:user_agent" json:"user_agent"`
+	Device    string         `gorm:"column:device" json:"device"`
+	Result    string         `gorm:"column:result" json:"result"` // success 成功, failure 失败, locked 锁定中
 	CreatedAt jtime.JsonTime `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt jtime.JsonTime `gorm:"column:updated_at" json:"updated_at"`
 }
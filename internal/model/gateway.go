@@ -0,0 +1,39 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 14:20:37
+ * @LastEditTime: 2023-06-24 14:20:37
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/gateway.go
+ */
+package model
+
+import (
+	"chatserver-api/pkg/openai"
+	"encoding/json"
+	"errors"
+)
+
+type GatewayModelsRes struct {
+	Object string         `json:"object"`
+	Data   []openai.Model `json:"data"`
+}
+
+// GatewayEmbeddingReq input 可以是字符串或字符串数组
+type GatewayEmbeddingReq struct {
+	Input json.RawMessage `json:"input"`
+	Model string          `json:"model"`
+	User  string          `json:"user"`
+}
+
+// Inputs 解析 input，不支持 token 数组
+func (r GatewayEmbeddingReq) Inputs() ([]string, error) {
+	var s string
+	if err := json.Unmarshal(r.Input, &s); err == nil {
+		return []string{s}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(r.Input, &list); err != nil {
+		return nil, errors.New("input must be a string or an array of strings")
+	}
+	return list, nil
+}
@@ -0,0 +1,86 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-14 10:40:12
+ * @LastEditTime: 2023-06-14 17:32:10
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/kb.go
+ */
+package model
+
+import "chatserver-api/pkg/jtime"
+
+type KbCreateNewReq struct {
+	KbName      string `json:"kb_name" validate:"required" label:"知识库名称"`
+	Description string `json:"description"`
+	Visibility  int    `json:"visibility"`
+	TeamId      string `json:"team_id"`
+}
+type KbCreateNewRes struct {
+	KbId string `json:"kb_id"`
+}
+
+type KbUpdateReq struct {
+	KbId        string `json:"kb_id" validate:"required" label:"知识库ID"`
+	KbName      string `json:"kb_name"`
+	Description string `json:"description"`
+	Visibility  int    `json:"visibility"`
+}
+
+type KbIdReq struct {
+	KbId string `json:"kb_id" validate:"required" label:"知识库ID"`
+}
+
+type KbMemberReq struct {
+	KbId       string `json:"kb_id" validate:"required" label:"知识库ID"`
+	UserName   string `json:"username" validate:"required" label:"用户名"`
+	Permission int    `json:"permission"`
+}
+
+type KbListRes struct {
+	KbList []KbOneRes `json:"kb_list"`
+}
+type KbOneRes struct {
+	KbId        string         `json:"kb_id"`
+	KbName      string         `json:"kb_name"`
+	Description string         `json:"description"`
+	OwnerType   string         `json:"owner_type"`
+	Visibility  int            `json:"visibility"`
+	Permission  int            `json:"permission"`
+	CreatedAt   jtime.JsonTime `json:"created_at"`
+}
+
+type KbOne struct {
+	KbId        int64          `gorm:"column:id"`
+	KbName      string         `gorm:"column:kb_name"`
+	Description string         `gorm:"column:description"`
+	OwnerType   string         `gorm:"column:owner_type"`
+	OwnerId     int64          `gorm:"column:owner_id"`
+	Visibility  int            `gorm:"column:visibility"`
+	CreatedAt   jtime.JsonTime `gorm:"column:created_at"`
+}
+
+type KbUsageRes struct {
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+}
+
+type TeamCreateNewReq struct {
+	TeamName string `json:"team_name" validate:"required" label:"团队名称"`
+}
+type TeamCreateNewRes struct {
+	TeamId string `json:"team_id"`
+}
+
+type TeamMemberReq struct {
+	TeamId   string `json:"team_id" validate:"required" label:"团队ID"`
+	UserName string `json:"username" validate:"required" label:"用户名"`
+}
+
+type TeamListRes struct {
+	TeamList []TeamOneRes `json:"team_list"`
+}
+type TeamOneRes struct {
+	TeamId   string `json:"team_id"`
+	TeamName string `json:"team_name"`
+	IsOwner  bool   `json:"is_owner"`
+}
@@ -0,0 +1,60 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 11:16:39
+ * @LastEditTime: 2023-06-26 11:16:39
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/order.go
+ */
+package model
+
+import "chatserver-api/pkg/jtime"
+
+type OrderCreateReq struct {
+	ItemType string `json:"item_type" validate:"required,oneof=giftcard"`
+	ItemId   string `json:"item_id" validate:"required"`
+}
+
+type OrderCreateRes struct {
+	OrderId string  `json:"order_id"`
+	Amount  float64 `json:"amount"`
+	PayURL  string  `json:"pay_url"`
+}
+
+type OrderIdReq struct {
+	OrderId string `form:"order_id" json:"order_id" validate:"required"`
+}
+
+// OrderListReq 订单查询条件，Status 为 pending, paid, refunding, refunded，UserId 仅管理员查询时有效
+type OrderListReq struct {
+	UserId   string `form:"user_id"`
+	Status   string `form:"status"`
+	Page     int    `form:"page"`
+	PageSize int    `form:"pagesize"`
+}
+
+type OrderOneRes struct {
+	OrderId    string          `json:"order_id"`
+	UserId     string          `json:"user_id"`
+	ItemType   string          `json:"item_type"`
+	ItemId     string          `json:"item_id"`
+	Subject    string          `json:"subject"`
+	Amount     float64         `json:"amount"`
+	Credit     float64         `json:"credit"`
+	Provider   string          `json:"provider"`
+	PayURL     string          `json:"pay_url,omitempty"`
+	Status     int             `json:"status"`
+	StatusName string          `json:"status_name"`
+	PaidAt     *jtime.JsonTime `json:"paid_at"`
+	RefundedAt *jtime.JsonTime `json:"refunded_at"`
+	CreatedAt  jtime.JsonTime  `json:"created_at"`
+}
+
+type OrderListRes struct {
+	Total     int64         `json:"total"`
+	OrderList []OrderOneRes `json:"order_list"`
+}
+
+type OrderRefundReq struct {
+	OrderId string `json:"order_id" validate:"required"`
+	Reason  string `json:"reason"`
+}
@@ -10,20 +10,22 @@ package model
 import "gorm.io/datatypes"
 
 type PresetCreateNewReq struct {
-	PresetName    string         `json:"preset_name"  validate:"required"`
-	PresetContent string         `json:"preset_content"  validate:"required"`
-	PresetTips    string         `json:"preset_tips"  validate:"required"`
-	ModelName     string         `json:"model_name"`
-	MaxTokens     int            `json:"max_token"`
-	LogitBias     datatypes.JSON `json:"logit_bias"`
-	Temperature   float64        `json:"temperature"`
-	TopP          float64        `json:"top_p"`
-	Presence      float64        `json:"presence"`
-	Frequency     float64        `json:"frequency"`
-	WithEmbedding bool           `json:"with_embedding"`
-	Classify      string         `json:"classify"`
-	Extension     int            `json:"extension"`
-	Privilege     int            `json:"privilege"`
+	PresetName      string         `json:"preset_name"  validate:"required"`
+	PresetContent   string         `json:"preset_content"  validate:"required"`
+	PresetTips      string         `json:"preset_tips"  validate:"required"`
+	ModelName       string         `json:"model_name"`
+	MaxTokens       int            `json:"max_token"`
+	LogitBias       datatypes.JSON `json:"logit_bias"`
+	Temperature     float64        `json:"temperature"`
+	TopP            float64        `json:"top_p"`
+	Presence        float64        `json:"presence"`
+	Frequency       float64        `json:"frequency"`
+	WithEmbedding   bool           `json:"with_embedding"`
+	Classify        string         `json:"classify"`
+	Extension       int            `json:"extension"`
+	QueryStrategy   string         `json:"query_strategy"`
+	SearchProviders string         `json:"search_providers"` // 逗号分隔的搜索引擎回退顺序，为空使用默认配置
+	Privilege       int            `json:"privilege"`
 }
 type PresetCreateNewRes struct {
 	PresetId  int64 `json:"preset_id"`
@@ -31,21 +33,23 @@ type PresetCreateNewRes struct {
 }
 
 type PresetUpdateReq struct {
-	PresetId      string         `json:"preset_id"  validate:"required"`
-	PresetName    string         `json:"preset_name"`
-	PresetContent string         `json:"preset_content"`
-	PresetTips    string         `json:"preset_tips"`
-	ModelName     string         `json:"model_name"`
-	MaxTokens     int            `json:"max_token"`
-	LogitBias     datatypes.JSON `json:"logit_bias"`
-	Temperature   float64        `json:"temperature"`
-	TopP          float64        `json:"top_p"`
-	Presence      float64        `json:"presence"`
-	Frequency     float64        `json:"frequency"`
-	WithEmbedding bool           `json:"with_embedding"`
-	Classify      string         `json:"classify"`
-	Extension     int            `json:"extension"`
-	Privilege     int            `json:"privilege"`
+	PresetId        string         `json:"preset_id"  validate:"required"`
+	PresetName      string         `json:"preset_name"`
+	PresetContent   string         `json:"preset_content"`
+	PresetTips      string         `json:"preset_tips"`
+	ModelName       string         `json:"model_name"`
+	MaxTokens       int            `json:"max_token"`
+	LogitBias       datatypes.JSON `json:"logit_bias"`
+	Temperature     float64        `json:"temperature"`
+	TopP            float64        `json:"top_p"`
+	Presence        float64        `json:"presence"`
+	Frequency       float64        `json:"frequency"`
+	WithEmbedding   bool           `json:"with_embedding"`
+	Classify        string         `json:"classify"`
+	Extension       int            `json:"extension"`
+	QueryStrategy   string         `json:"query_strategy"`
+	SearchProviders string         `json:"search_providers"` // 逗号分隔的搜索引擎回退顺序，为空使用默认配置
+	Privilege       int            `json:"privilege"`
 }
 
 type PresetGetListRes struct {
@@ -7,12 +7,17 @@
  */
 package model
 
-import "chatserver-api/pkg/jtime"
+import (
+	"chatserver-api/pkg/jtime"
+
+	"gorm.io/datatypes"
+)
 
 type RecordOne struct {
 	Id        int64          `gorm:"column:id" json:"record_id"`
 	Sender    string         `gorm:"column:sender"  json:"sender"`
 	Message   string         `gorm:"column:message"  json:"message" `
+	Citations datatypes.JSON `gorm:"column:citations"  json:"citations"`
 	CreatedAt jtime.JsonTime `gorm:"column:created_at"  json:"created_at" `
 }
 
@@ -24,6 +29,7 @@ type RecordOneRes struct {
 	Id        string         `json:"record_id"`
 	Sender    string         `json:"sender"`
 	Message   string         `json:"message" `
+	Citations []Citation     `json:"citations,omitempty"`
 	CreatedAt jtime.JsonTime `json:"created_at" `
 }
 
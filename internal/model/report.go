@@ -0,0 +1,63 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 15:52:44
+ * @LastEditTime: 2023-06-26 15:52:44
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/model/report.go
+ */
+package model
+
+// ReportReq 报表查询条件，日期格式 2006-01-02，默认最近 30 天；
+// Group 为 day, model, preset, user, source，Type 仅导出时使用，为 usage 或 revenue
+type ReportReq struct {
+	Start string `form:"start"`
+	End   string `form:"end"`
+	Group string `form:"group"`
+	Limit int    `form:"limit"`
+	Type  string `form:"type"`
+}
+
+type ReportUsageRow struct {
+	Key      string  `gorm:"column:dim_key" json:"key"`
+	Name     string  `gorm:"column:dim_name" json:"name"`
+	Requests int64   `gorm:"column:requests" json:"requests"`
+	Tokens   int64   `gorm:"column:tokens" json:"tokens"`
+	Charge   float64 `gorm:"column:charge" json:"charge"`
+	Cost     float64 `gorm:"column:cost" json:"cost"`
+	Profit   float64 `gorm:"-" json:"profit"`
+}
+
+type ReportUsageRes struct {
+	Start string           `json:"start"`
+	End   string           `json:"end"`
+	Group string           `json:"group"`
+	Rows  []ReportUsageRow `json:"rows"`
+	Total ReportUsageRow   `json:"total"`
+}
+
+// ReportRevenueItem 收入汇总表按天和来源聚合的结果
+type ReportRevenueItem struct {
+	Day    string  `gorm:"column:day"`
+	Source string  `gorm:"column:source"`
+	Count  int64   `gorm:"column:count"`
+	Amount float64 `gorm:"column:amount"`
+}
+
+// ReportRevenueRow 每日收入与消费、成本对照，Revenue = CdKey + Order - Refund，Margin = Revenue - Cost
+type ReportRevenueRow struct {
+	Day     string  `json:"day"`
+	CdKey   float64 `json:"cdkey"`
+	Order   float64 `json:"order"`
+	Refund  float64 `json:"refund"`
+	Revenue float64 `json:"revenue"`
+	Charge  float64 `json:"charge"`
+	Cost    float64 `json:"cost"`
+	Margin  float64 `json:"margin"`
+}
+
+type ReportRevenueRes struct {
+	Start string             `json:"start"`
+	End   string             `json:"end"`
+	Rows  []ReportRevenueRow `json:"rows"`
+	Total ReportRevenueRow   `json:"total"`
+}
@@ -12,17 +12,73 @@ import "chatserver-api/pkg/jtime"
 type UserLoginReq struct {
 	Username string `json:"username" validate:"required"  label:"用户名"`
 	Password string `json:"password" validate:"required"  label:"密码"`
-	Captcha  string `json:"captcha" validate:"required"  label:"验证码"`
+	// 仅在出现登录失败等风险时需要验证码
+	Captcha   string `json:"captcha" label:"验证码"`
+	CaptchaId string `json:"captcha_id" label:"验证码ID"`
 }
 type UserLoginRes struct {
-	Token   string `json:"token"`
-	TimeOut int    `json:"timeout"`
+	Token         string   `json:"token"`
+	TimeOut       int      `json:"timeout"`
+	RefreshToken  string   `json:"refresh_token"`
+	TwoFactor     string   `json:"two_factor,omitempty"` // verify 需要输入验证码，enroll 需要先绑定身份验证器
+	MfaToken      string   `json:"mfa_token,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+type UserLogin2FAReq struct {
+	MfaToken string `json:"mfa_token" validate:"required" label:"登录凭证"`
+	Code     string `json:"code" validate:"required" label:"验证码"`
+}
+type UserLogin2FAEnrollReq struct {
+	MfaToken string `json:"mfa_token" validate:"required" label:"登录凭证"`
+}
+type TwoFAStatusRes struct {
+	Enabled           bool  `json:"enabled"`
+	Required          bool  `json:"required"`
+	RecoveryRemaining int64 `json:"recovery_remaining"`
+}
+type TwoFAEnrollRes struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+	QRCode string `json:"qrcode"`
+}
+type TwoFACodeReq struct {
+	Code string `json:"code" validate:"required" label:"验证码"`
+}
+type TwoFARecoveryRes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+type UserRefreshReq struct {
+	RefreshToken string `json:"refresh_token" validate:"required" label:"刷新令牌"`
+}
+type UserSessionRes struct {
+	SessionId  string         `json:"session_id"`
+	Device     string         `json:"device"`
+	Ip         string         `json:"ip"`
+	UserAgent  string         `json:"user_agent"`
+	Current    bool           `json:"current"`
+	CreatedAt  jtime.JsonTime `json:"created_at"`
+	LastUsedAt jtime.JsonTime `json:"last_used_at"`
+}
+type UserSessionListRes struct {
+	Sessions []UserSessionRes `json:"sessions"`
+}
+type UserSessionDeleteReq struct {
+	SessionId string `form:"session_id" validate:"required"`
+}
+type OidcAuthURLRes struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+type OidcLoginReq struct {
+	Code  string `json:"code" validate:"required"  label:"授权码"`
+	State string `json:"state" validate:"required"  label:"状态码"`
 }
 type UserRegisterReq struct {
 	Username   string `json:"username" validate:"required,username"  label:"用户名"`
 	Password   string `json:"password" validate:"required"  label:"密码"`
 	Email      string `json:"email" validate:"required"  label:"邮箱地址"`
 	Captcha    string `json:"captcha" validate:"required"  label:"验证码"`
+	CaptchaId  string `json:"captcha_id" label:"验证码ID"`
 	InviteCode string `json:"invite_code" label:"邀请码"`
 }
 
@@ -51,21 +107,24 @@ type UserGetAvatarRes struct {
 }
 
 type UserGetInfoRes struct {
-	Username string `json:"username"`
-	Nickname string `json:"nickname"`
-	Email    string `json:"email"`
-	Phone    string `json:"phone"`
-	Role     string `json:"role"`
+	Username string          `json:"username"`
+	Nickname string          `json:"nickname"`
+	Email    string          `json:"email"`
+	Phone    string          `json:"phone"`
+	Role     string          `json:"role"`
+	DeleteAt *jtime.JsonTime `json:"delete_at,omitempty"` // 已申请注销时的计划注销时间
 }
 
 type UserInfo struct {
-	Username string `gorm:"column:username" json:"username"`
-	Nickname string `gorm:"column:nickname" json:"nickname"`
-	Password string `gorm:"column:password" json:"password"`
-	Email    string `gorm:"column:email" json:"email"`
-	Phone    string `gorm:"column:phone" json:"phone"`
-	Role     int    `gorm:"column:role" json:"role"`
-	IsActive bool   `gorm:"column:is_active" json:"is_active"`
+	Username string          `gorm:"column:username" json:"username"`
+	Nickname string          `gorm:"column:nickname" json:"nickname"`
+	Password string          `gorm:"column:password" json:"password"`
+	Email    string          `gorm:"column:email" json:"email"`
+	Phone    string          `gorm:"column:phone" json:"phone"`
+	Role     int             `gorm:"column:role" json:"role"`
+	IsActive bool            `gorm:"column:is_active" json:"is_active"`
+	IsBanned bool            `gorm:"column:is_banned" json:"is_banned"`
+	DeleteAt *jtime.JsonTime `gorm:"column:delete_at" json:"delete_at"`
 }
 type UserAvatarRes struct {
 	Avatar string `json:"avatar"`
@@ -98,8 +157,9 @@ type UserPasswordResetReq struct {
 }
 
 type UserForgetReq struct {
-	Email   string `json:"email"`
-	Captcha string `json:"captcha" validate:"required"  label:"验证码"`
+	Email     string `json:"email"`
+	Captcha   string `json:"captcha" validate:"required"  label:"验证码"`
+	CaptchaId string `json:"captcha_id" label:"验证码ID"`
 }
 
 type UserInviteLinkRes struct {
@@ -108,8 +168,12 @@ type UserInviteLinkRes struct {
 	InviteReward float64 `json:"invite_reward"`
 }
 
+// CaptchaRes 图片验证码返回 captcha_id 和 image，hCaptcha/Turnstile 返回 site_key
 type CaptchaRes struct {
-	Image string `json:"image"`
+	Provider  string `json:"provider"`
+	CaptchaId string `json:"captcha_id,omitempty"`
+	Image     string `json:"image,omitempty"`
+	SiteKey   string `json:"site_key,omitempty"`
 }
 
 type UserBillGetReq struct {
@@ -123,8 +187,22 @@ type UserBillRes struct {
 	CostChange  float64        `gorm:"column:cost_change" json:"change"`
 	Balance     float64        `gorm:"column:balance" json:"balance"`
 	CostComment string         `gorm:"column:cost_comment" json:"comment"`
+	ApiKeyId    int64          `gorm:"column:api_key_id" json:"api_key_id,string,omitempty"`
 }
 
 type UserBillListRes struct {
 	BillList []UserBillRes `json:"bill_list"`
 }
+
+type UserLoginLogRes struct {
+	Ip        string         `json:"ip"`
+	Device    string         `json:"device"`
+	UserAgent string         `json:"user_agent"`
+	Method    string         `json:"method"`
+	Result    string         `json:"result"`
+	CreatedAt jtime.JsonTime `json:"created_at"`
+}
+
+type UserLoginHistoryRes struct {
+	History []UserLoginLogRes `json:"history"`
+}
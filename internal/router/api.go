@@ -13,8 +13,11 @@
 package router
 
 import (
+	"chatserver-api/internal/consts"
 	"chatserver-api/internal/handler/v1/admin"
 	"chatserver-api/internal/handler/v1/chat"
+	"chatserver-api/internal/handler/v1/gateway"
+	"chatserver-api/internal/handler/v1/kb"
 	"chatserver-api/internal/handler/v1/preset"
 	"chatserver-api/internal/handler/v1/user"
 	"chatserver-api/internal/middleware"
@@ -23,10 +26,12 @@ import (
 )
 
 type ApiRouter struct {
-	userHandler   *user.UserHandler
-	chatHandler   *chat.ChatHandler
-	presetHandler *preset.PresetHandler
-	adminHandler  *admin.AdminHandler
+	userHandler    *user.UserHandler
+	chatHandler    *chat.ChatHandler
+	presetHandler  *preset.PresetHandler
+	adminHandler   *admin.AdminHandler
+	kbHandler      *kb.KbHandler
+	gatewayHandler *gateway.GatewayHandler
 }
 
 func NewApiRouter(
@@ -34,12 +39,16 @@ func NewApiRouter(
 	chatHandler *chat.ChatHandler,
 	presetHandler *preset.PresetHandler,
 	adminHandler *admin.AdminHandler,
+	kbHandler *kb.KbHandler,
+	gatewayHandler *gateway.GatewayHandler,
 ) *ApiRouter {
 	return &ApiRouter{
-		userHandler:   userHandler,
-		chatHandler:   chatHandler,
-		presetHandler: presetHandler,
-		adminHandler:  adminHandler,
+		userHandler:    userHandler,
+		chatHandler:    chatHandler,
+		presetHandler:  presetHandler,
+		adminHandler:   adminHandler,
+		kbHandler:      kbHandler,
+		gatewayHandler: gatewayHandler,
 	}
 }
 
@@ -54,6 +63,13 @@ func (ar *ApiRouter) Load(g *gin.Engine) {
 	g.POST("/forget", ar.userHandler.UserPasswordForget())
 	g.POST("/resetpassword", ar.userHandler.UserPasswordReset())
 	g.GET("/captcha", ar.userHandler.CaptchaGen())
+	g.GET("/oidc/authurl", ar.userHandler.OidcAuthURL())
+	g.POST("/oidc/login", ar.userHandler.OidcLogin())
+	g.POST("/refresh", ar.userHandler.UserRefresh())
+	g.POST("/login/2fa", ar.userHandler.UserLogin2FA())
+	g.POST("/login/2fa/enroll", ar.userHandler.UserLogin2FAEnroll())
+	g.POST("/deleteconfirm", ar.userHandler.AccountDeleteConfirm())
+	g.POST("/payment/notify", ar.userHandler.PaymentNotify())
 	// g.GET("/test", ar.chatHandler.TestJieba())
 	ug := g.Group("/user", middleware.AuthToken())
 	{
@@ -62,40 +78,108 @@ func (ar *ApiRouter) Load(g *gin.Engine) {
 		ug.GET("/info", ar.userHandler.UserGetInfo())
 		ug.GET("/logout", ar.userHandler.UserLogout())
 		ug.POST("/changenickname", ar.userHandler.UserUpdateNickName())
-		ug.GET("/refresh", ar.userHandler.UserRefresh())
+		ug.GET("/sessions", ar.userHandler.UserSessionList())
+		ug.GET("/loginhistory", ar.userHandler.UserLoginHistory())
+		ug.DELETE("/sessions", ar.userHandler.UserSessionDelete())
+		ug.GET("/2fa", ar.userHandler.TwoFAStatus())
+		ug.POST("/2fa/enroll", ar.userHandler.TwoFAEnroll())
+		ug.POST("/2fa/enable", ar.userHandler.TwoFAEnable())
+		ug.POST("/2fa/disable", ar.userHandler.TwoFADisable())
+		ug.POST("/2fa/recovery", ar.userHandler.TwoFARecoveryReset())
+		ug.GET("/apikeys", ar.userHandler.ApiKeyList())
+		ug.POST("/apikeys", ar.userHandler.ApiKeyCreate())
+		ug.DELETE("/apikeys", ar.userHandler.ApiKeyDelete())
 		ug.POST("/updatepassword", ar.userHandler.UserPasswordModify())
 		ug.POST("/cdkeypay", ar.userHandler.UserCDkeyPay())
 		ug.GET("/giftcard", ar.userHandler.UserGiftCardListGet())
+		ug.POST("/orders", ar.userHandler.OrderCreate())
+		ug.GET("/orders", ar.userHandler.OrderList())
+		ug.GET("/order", ar.userHandler.OrderGet())
 		ug.GET("/invitelink", ar.userHandler.UserInviteLinkGet())
 		ug.GET("/bill", ar.userHandler.UserBillGet())
+		ug.GET("/export", ar.userHandler.AccountExport())
+		ug.POST("/delete", ar.userHandler.AccountDelete())
+		ug.POST("/delete/cancel", ar.userHandler.AccountDeleteCancel())
+	}
+	// 以下会话接口也接受对应授权范围的 API Key
+	ck := g.Group("/chat", middleware.AuthToken(consts.ApiScopeChat))
+	{
+		ck.POST("/chatting", middleware.Stream(), ar.chatHandler.ChatChatting())
+		ck.POST("/regenerate", middleware.Stream(), ar.chatHandler.ChatRegenerateg())
+		ck.POST("/new", ar.chatHandler.ChatCreateNew())
+	}
+	hk := g.Group("/chat", middleware.AuthToken(consts.ApiScopeHistory))
+	{
+		hk.GET("/list", ar.chatHandler.ChatListGet())
+		hk.POST("/detail", ar.chatHandler.ChatDetailGet())
+		hk.GET("/history", ar.chatHandler.ChatRecordHistory())
 	}
 	cg := g.Group("/chat", middleware.AuthToken())
 	{
-		cg.POST("/chatting", middleware.Stream(), ar.chatHandler.ChatChatting())
-		cg.POST("/regenerate", middleware.Stream(), ar.chatHandler.ChatRegenerateg())
-		cg.POST("/new", ar.chatHandler.ChatCreateNew())
-		cg.GET("/list", ar.chatHandler.ChatListGet())
-		cg.POST("/detail", ar.chatHandler.ChatDetailGet())
-		cg.GET("/history", ar.chatHandler.ChatRecordHistory())
 		cg.DELETE("/delete", ar.chatHandler.ChatDelete())
 		cg.DELETE("/clear", ar.chatHandler.ChatRecordClear())
 		cg.POST("/update", ar.chatHandler.ChatUpdate())
 	}
 	pg := g.Group("/preset", middleware.AuthToken())
 	{
-		pg.POST("/new", ar.presetHandler.PresetCreateNew())
+		pg.POST("/new", middleware.Permission(consts.PermPresetWrite), ar.presetHandler.PresetCreateNew())
 		pg.GET("/list", ar.presetHandler.PresetGetList())
-		pg.POST("/update", ar.presetHandler.PresetUpdate())
+		pg.POST("/update", middleware.Permission(consts.PermPresetWrite), ar.presetHandler.PresetUpdate())
 	}
-	eg := g.Group("/embedding", middleware.AuthToken())
+	eg := g.Group("/embedding", middleware.AuthToken(consts.ApiScopeEmbedding), middleware.Permission(consts.PermKbWrite))
 	{
 		eg.POST("/file", ar.chatHandler.ChatEmbeddingFile())
 		eg.POST("/string", ar.chatHandler.ChatEmbeddingString())
 	}
+	kg := g.Group("/kb", middleware.AuthToken())
+	{
+		kg.POST("/new", middleware.Permission(consts.PermKbWrite), ar.kbHandler.KbCreateNew())
+		kg.GET("/list", ar.kbHandler.KbListGet())
+		kg.POST("/update", middleware.Permission(consts.PermKbWrite), ar.kbHandler.KbUpdate())
+		kg.DELETE("/delete", middleware.Permission(consts.PermKbWrite), ar.kbHandler.KbDelete())
+		kg.POST("/member", middleware.Permission(consts.PermKbWrite), ar.kbHandler.KbMemberSave())
+		kg.DELETE("/member", middleware.Permission(consts.PermKbWrite), ar.kbHandler.KbMemberDelete())
+		kg.POST("/subscribe", ar.kbHandler.KbSubscribe())
+		kg.GET("/usage", ar.kbHandler.KbUsageGet())
+		kg.POST("/team/new", ar.kbHandler.TeamCreateNew())
+		kg.GET("/team/list", ar.kbHandler.TeamListGet())
+		kg.POST("/team/member", ar.kbHandler.TeamMemberAdd())
+		kg.DELETE("/team/member", ar.kbHandler.TeamMemberDelete())
+	}
 	ag := g.Group("/admin", middleware.AuthToken())
 	{
-		ag.POST("/cdkeygen", ar.adminHandler.AdminGenNewCDkey())
-		ag.POST("/cardcreate", ar.adminHandler.AdminCreateGiftCard())
-		ag.POST("/cardupdate", ar.adminHandler.AdminUpdateGiftCard())
+		ag.POST("/cdkeygen", middleware.Permission(consts.PermAdminCdkey), ar.adminHandler.AdminGenNewCDkey())
+		ag.POST("/cardcreate", middleware.Permission(consts.PermAdminCdkey), ar.adminHandler.AdminCreateGiftCard())
+		ag.POST("/cardupdate", middleware.Permission(consts.PermAdminCdkey), ar.adminHandler.AdminUpdateGiftCard())
+		ag.GET("/cdkey/list", middleware.Permission(consts.PermAdminCdkey), ar.adminHandler.AdminCdKeyList())
+		ag.GET("/cdkey/export", middleware.Permission(consts.PermAdminCdkey), ar.adminHandler.AdminCdKeyExport())
+		ag.POST("/cdkey/revoke", middleware.Permission(consts.PermAdminCdkey), ar.adminHandler.AdminCdKeyRevoke())
+		ag.GET("/cdkey/redemptions", middleware.Permission(consts.PermAdminCdkey), ar.adminHandler.AdminCdKeyRedemptionList())
+		ag.GET("/orders", middleware.Permission(consts.PermAdminOrder), ar.adminHandler.AdminOrderList())
+		ag.GET("/order", middleware.Permission(consts.PermAdminOrder), ar.adminHandler.AdminOrderGet())
+		ag.POST("/orders/refund", middleware.Permission(consts.PermAdminOrder), ar.adminHandler.AdminOrderRefund())
+		ag.GET("/report/usage", middleware.Permission(consts.PermAdminReport), ar.adminHandler.AdminReportUsage())
+		ag.GET("/report/topusers", middleware.Permission(consts.PermAdminReport), ar.adminHandler.AdminReportTopUsers())
+		ag.GET("/report/revenue", middleware.Permission(consts.PermAdminReport), ar.adminHandler.AdminReportRevenue())
+		ag.GET("/report/export", middleware.Permission(consts.PermAdminReport), ar.adminHandler.AdminReportExport())
+		ag.GET("/embeddingstats", middleware.Permission(consts.PermAdminSystem), ar.adminHandler.AdminEmbeddingStats())
+		ag.POST("/searchcacheclear", middleware.Permission(consts.PermAdminSystem), ar.adminHandler.AdminSearchCacheClear())
+	}
+	aug := ag.Group("/users", middleware.Permission(consts.PermUserManage))
+	{
+		aug.GET("", ar.adminHandler.AdminUserList())
+		aug.GET("/bill", ar.adminHandler.AdminUserBill())
+		aug.POST("/balance", ar.adminHandler.AdminUserBalance())
+		aug.POST("/role", ar.adminHandler.AdminUserRole())
+		aug.POST("/ban", ar.adminHandler.AdminUserBan())
+		aug.POST("/unban", ar.adminHandler.AdminUserUnban())
+		aug.POST("/activation", ar.adminHandler.AdminUserActiveResend())
+	}
+	// OpenAI 兼容接口，仅接受 API Key
+	vg := g.Group("/v1")
+	{
+		vg.GET("/models", middleware.GatewayAuth(consts.ApiScopeChat, consts.ApiScopeEmbedding), middleware.GatewayRateLimit(), ar.gatewayHandler.Models())
+		vg.POST("/chat/completions", middleware.GatewayAuth(consts.ApiScopeChat), middleware.GatewayRateLimit(), ar.gatewayHandler.ChatCompletions())
+		vg.POST("/embeddings", middleware.GatewayAuth(consts.ApiScopeEmbedding), middleware.GatewayRateLimit(), ar.gatewayHandler.Embeddings())
 	}
 }
@@ -0,0 +1,306 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 11:06:52
+ * @LastEditTime: 2023-06-25 11:06:52
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/account.go
+ */
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/jtime"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/mail"
+	"chatserver-api/utils/security"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+var _ AccountService = (*accountService)(nil)
+
+// accountDeleteCodeTTL 注销确认链接有效期
+const accountDeleteCodeTTL = 24 * time.Hour
+
+// AccountService 账户数据导出与注销：确认注销后进入冷静期，到期软删除账户，
+// 软删除的数据超过保留时间后由后台任务彻底清除
+type AccountService interface {
+	AccountExport(ctx *gin.Context) (data []byte, err error)
+	AccountDeleteRequest(ctx *gin.Context, password string) error
+	AccountDeleteConfirm(ctx *gin.Context, code string) (res model.AccountDeleteRes, err error)
+	AccountDeleteCancel(ctx *gin.Context) error
+	AccountPurge(ctx context.Context) error
+	AccountPurgeRun()
+}
+
+type accountService struct {
+	ad   dao.AccountDao
+	sSrv SessionService
+	rc   *redis.Client
+}
+
+func NewAccountService(_ad dao.AccountDao, _sSrv SessionService) *accountService {
+	return &accountService{
+		ad:   _ad,
+		sSrv: _sSrv,
+		rc:   cache.GetRedisClient(),
+	}
+}
+
+// AccountExport 导出用户资料、会话记录、账单和个人知识库文档，打包为 ZIP
+func (as *accountService) AccountExport(ctx *gin.Context) (data []byte, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	user, err := as.ad.AccountUserGet(ctx, userId)
+	if err != nil {
+		return
+	}
+	chats, err := as.ad.AccountChatsGet(ctx, userId)
+	if err != nil {
+		return
+	}
+	bills, err := as.ad.AccountBillsGet(ctx, userId)
+	if err != nil {
+		return
+	}
+	docs, err := as.ad.AccountDocumentsGet(ctx, userId)
+	if err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]interface{}{
+		"profile.json": model.AccountExportProfile{
+			UserId:    strconv.FormatInt(user.Id, 10),
+			Username:  user.Username,
+			Nickname:  user.Nickname,
+			Email:     user.Email,
+			Phone:     user.Phone,
+			Role:      consts.RoleToString[user.Role],
+			Balance:   user.Balance,
+			CreatedAt: user.CreatedAt,
+		},
+		"documents.json": docs,
+	}
+	exportChats := make([]model.AccountExportChat, 0, len(chats))
+	for _, c := range chats {
+		chat := model.AccountExportChat{
+			ChatId:    strconv.FormatInt(c.Id, 10),
+			ChatName:  c.ChatName,
+			PresetId:  strconv.FormatInt(c.PresetId, 10),
+			CreatedAt: c.CreatedAt,
+			Records:   make([]model.AccountExportRecord, 0, len(c.Records)),
+		}
+		var md bytes.Buffer
+		fmt.Fprintf(&md, "# %s\n\n", c.ChatName)
+		for _, r := range c.Records {
+			chat.Records = append(chat.Records, model.AccountExportRecord{
+				RecordId:  strconv.FormatInt(r.Id, 10),
+				Sender:    r.Sender,
+				Message:   r.Message,
+				CreatedAt: r.CreatedAt,
+			})
+			fmt.Fprintf(&md, "**%s** %s\n\n%s\n\n", r.Sender, time.Time(r.CreatedAt).Format(consts.TimeLayout), r.Message)
+		}
+		exportChats = append(exportChats, chat)
+		if err = zipWrite(zw, "chats/"+chat.ChatId+".md", md.Bytes()); err != nil {
+			return
+		}
+	}
+	files["chats.json"] = exportChats
+	exportBills := make([]model.AccountExportBill, 0, len(bills))
+	for _, b := range bills {
+		bill := model.AccountExportBill{
+			BillId:      strconv.FormatInt(b.Id, 10),
+			CostChange:  b.CostChange,
+			Balance:     b.Balance,
+			CostComment: b.CostComment,
+			CreatedAt:   b.CreatedAt,
+		}
+		if b.ApiKeyId != 0 {
+			bill.ApiKeyId = strconv.FormatInt(b.ApiKeyId, 10)
+		}
+		exportBills = append(exportBills, bill)
+	}
+	files["bills.json"] = exportBills
+	for name, v := range files {
+		content, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err = zipWrite(zw, name, content); err != nil {
+			return nil, err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return
+	}
+	return buf.Bytes(), nil
+}
+
+// AccountDeleteRequest 校验密码后发送注销确认邮件；单点登录用户可能从未设置密码，不填密码时仅凭邮件确认
+func (as *accountService) AccountDeleteRequest(ctx *gin.Context, password string) error {
+	userId := ctx.GetInt64(consts.UserID)
+	user, err := as.ad.AccountUserGet(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		sso, err := as.ad.AccountIdentityIs(ctx, userId)
+		if err != nil {
+			return err
+		}
+		if !sso {
+			return errors.New("请输入密码")
+		}
+	} else {
+		plain, err := passwordPlain(ctx, password)
+		if err != nil {
+			return err
+		}
+		if !security.PasswordVerify(plain, user.Password) {
+			return errors.New("密码错误")
+		}
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	code := base64.RawURLEncoding.EncodeToString(b)
+	if err := as.rc.Set(ctx, consts.AccountDeletePrefix+code, userId, accountDeleteCodeTTL).Err(); err != nil {
+		return err
+	}
+	return mail.SendDeleteCode(user.Email, user.Nickname, code)
+}
+
+// AccountDeleteConfirm 通过邮件链接确认注销，账户在冷静期结束后删除
+func (as *accountService) AccountDeleteConfirm(ctx *gin.Context, code string) (res model.AccountDeleteRes, err error) {
+	userId, err := as.rc.GetDel(ctx, consts.AccountDeletePrefix+code).Int64()
+	if err == redis.Nil {
+		return res, errors.New("确认链接无效或已过期")
+	}
+	if err != nil {
+		return
+	}
+	deleteAt := time.Now().AddDate(0, 0, accountDeleteGrace())
+	if err = as.ad.AccountDeleteSchedule(ctx, userId, &deleteAt); err != nil {
+		return
+	}
+	as.rc.Del(ctx, consts.UserInfoPrefix+strconv.FormatInt(userId, 10))
+	res.DeleteAt = jtime.JsonTime(deleteAt)
+	return
+}
+
+func (as *accountService) AccountDeleteCancel(ctx *gin.Context) error {
+	userId := ctx.GetInt64(consts.UserID)
+	if err := as.ad.AccountDeleteSchedule(ctx, userId, nil); err != nil {
+		return err
+	}
+	return as.rc.Del(ctx, consts.UserInfoPrefix+strconv.FormatInt(userId, 10)).Err()
+}
+
+// AccountPurge 删除冷静期已结束的账户，并彻底清除超过保留时间的软删除数据，财务记录保留
+func (as *accountService) AccountPurge(ctx context.Context) error {
+	now := time.Now()
+	due, err := as.ad.AccountDeleteDueGet(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, userId := range due {
+		if err := as.sSrv.SessionRevokeAll(ctx, userId); err != nil {
+			logger.Errorf("用户%d会话注销失败:%v", userId, err)
+		}
+		chatIds, keyHashes, err := as.ad.AccountErase(ctx, userId)
+		if err != nil {
+			return err
+		}
+		keys := accountCacheKeys([]int64{userId}, chatIds)
+		for _, hash := range keyHashes {
+			keys = append(keys, consts.ApiKeyPrefix+hash)
+		}
+		as.rc.Del(ctx, keys...)
+		logger.Infof("用户%d冷静期结束，账户已注销", userId)
+	}
+	userIds, chatIds, err := as.ad.AccountPurge(ctx, now.AddDate(0, 0, -accountRetention()))
+	if err != nil {
+		return err
+	}
+	if keys := accountCacheKeys(userIds, chatIds); len(keys) > 0 {
+		as.rc.Del(ctx, keys...)
+	}
+	if len(userIds) > 0 || len(chatIds) > 0 {
+		logger.Infof("已清除%d个用户的个人资料、%d个会话", len(userIds), len(chatIds))
+	}
+	return nil
+}
+
+// AccountPurgeRun 定时执行清理任务
+func (as *accountService) AccountPurgeRun() {
+	interval := time.Duration(config.AppConfig.AccountConfig.PurgeInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := as.AccountPurge(context.Background()); err != nil {
+			logger.Errorf("数据清理失败:%v", err)
+		}
+		<-ticker.C
+	}
+}
+
+func accountCacheKeys(userIds, chatIds []int64) (keys []string) {
+	for _, id := range userIds {
+		idStr := strconv.FormatInt(id, 10)
+		keys = append(keys,
+			consts.UserInfoPrefix+idStr,
+			consts.UserBalancePrefix+idStr,
+			consts.UserAvatarPrefix+idStr,
+			consts.UserInviteLinkPrefix+idStr,
+			consts.UserChatIDPrefix+idStr,
+		)
+	}
+	for _, id := range chatIds {
+		idStr := strconv.FormatInt(id, 10)
+		keys = append(keys, consts.ChatRecordIDPrefix+idStr, consts.ChatSearchPrefix+idStr)
+	}
+	return
+}
+
+func accountDeleteGrace() int {
+	if days := config.AppConfig.AccountConfig.DeleteGrace; days > 0 {
+		return days
+	}
+	return 7
+}
+
+func accountRetention() int {
+	if days := config.AppConfig.AccountConfig.Retention; days > 0 {
+		return days
+	}
+	return 30
+}
+
+func zipWrite(zw *zip.Writer, name string, content []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
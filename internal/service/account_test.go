@@ -0,0 +1,110 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-28 15:40:21
+ * @LastEditTime: 2023-06-28 15:40:21
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/account_test.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/config"
+	"context"
+	"crypto/tls"
+	"testing"
+)
+
+// fakeAccountDao 返回固定用户，sso 表示是否绑定了单点登录身份
+type fakeAccountDao struct {
+	dao.AccountDao
+	user entity.User
+	sso  bool
+}
+
+func (f *fakeAccountDao) AccountUserGet(ctx context.Context, userId int64) (entity.User, error) {
+	return f.user, nil
+}
+
+func (f *fakeAccountDao) AccountIdentityIs(ctx context.Context, userId int64) (bool, error) {
+	return f.sso, nil
+}
+
+func Test_accountService_AccountDeleteRequest(t *testing.T) {
+	old := config.AppConfig
+	defer func() { config.AppConfig = old }()
+	config.AppConfig = &config.Config{PasswordConfig: config.PasswordConfig{PlainOnly: true}}
+	hash, err := passwordHash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		sso      bool
+		password string
+		wantErr  string
+	}{
+		{"password required", false, "", "请输入密码"},
+		{"wrong password", false, "wrong", "密码错误"},
+		{"sso user with wrong password", true, "wrong", "密码错误"},
+		// 通过校验后写入确认码，测试环境连不上 Redis
+		{"correct password", false, "secret", "redis"},
+		{"sso user confirms by email only", true, "", "redis"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as := &accountService{ad: &fakeAccountDao{user: entity.User{Id: 1, Password: hash}, sso: tt.sso}, rc: testRedisClient()}
+			ctx, _ := testChatContext()
+			ctx.Set(consts.UserID, int64(1))
+			err := as.AccountDeleteRequest(ctx, tt.password)
+			if err == nil {
+				t.Fatalf("AccountDeleteRequest() error = nil, want %s", tt.wantErr)
+			}
+			if tt.wantErr == "redis" {
+				if err.Error() == "请输入密码" || err.Error() == "密码错误" {
+					t.Errorf("AccountDeleteRequest() error = %v, want to pass verification", err)
+				}
+				return
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("AccountDeleteRequest() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_requestSecure(t *testing.T) {
+	old := config.AppConfig
+	defer func() { config.AppConfig = old }()
+	config.AppConfig = &config.Config{TrustedProxies: []string{"10.0.0.0/8"}}
+	tests := []struct {
+		name   string
+		remote string
+		proto  string
+		tls    bool
+		want   bool
+	}{
+		{"direct tls", "203.0.113.5:443", "", true, true},
+		{"plain http", "203.0.113.5:80", "", false, false},
+		{"trusted proxy https", "10.1.2.3:80", "https", false, true},
+		{"trusted proxy http", "10.1.2.3:80", "http", false, false},
+		{"spoofed header", "203.0.113.5:80", "https", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := testChatContext()
+			ctx.Request.RemoteAddr = tt.remote
+			if tt.proto != "" {
+				ctx.Request.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.tls {
+				ctx.Request.TLS = &tls.ConnectionState{}
+			}
+			if got := requestSecure(ctx); got != tt.want {
+				t.Errorf("requestSecure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -8,14 +8,22 @@
 package service
 
 import (
+	"bytes"
 	"chatserver-api/internal/consts"
 	"chatserver-api/internal/dao"
 	"chatserver-api/internal/model"
 	"chatserver-api/internal/model/entity"
 	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/jtime"
 	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/search"
+	"chatserver-api/pkg/tokenize"
 	"chatserver-api/utils/uuid"
+	"encoding/csv"
+	"errors"
+	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
@@ -24,43 +32,58 @@ import (
 var _ AdminService = (*adminService)(nil)
 
 type AdminService interface {
-	AdminVerify(ctx *gin.Context) bool
-	CdKeyGenerate(ctx *gin.Context, number int, CardId int64) (res model.CdKeyGenerateRes, err error)
+	CdKeyGenerate(ctx *gin.Context, number int, CardId int64, expireDays int) (res model.CdKeyGenerateRes, err error)
+	CdKeyList(ctx *gin.Context, req model.CdKeyListReq) (res model.CdKeyListRes, err error)
+	CdKeyExport(ctx *gin.Context, batchId int64) (data []byte, err error)
+	CdKeyRevoke(ctx *gin.Context, keyIds []int64, batchId int64) (res model.CdKeyRevokeRes, err error)
+	CdKeyRedemptionList(ctx *gin.Context, userId, cardId int64, page, pagesize int) (res model.CdKeyRedemptionListRes, err error)
 	GiftCardUpdate(ctx *gin.Context, req model.GiftCardUpdate) error
 	GiftCardCreate(ctx *gin.Context, req model.GiftCardCreate) error
+	EmbeddingStatsGet(ctx *gin.Context) (res model.EmbeddingStatsRes, err error)
+	SearchCacheClear(ctx *gin.Context, query string) (res model.SearchCacheClearRes, err error)
+	AdminUserList(ctx *gin.Context, req model.AdminUserListReq) (res model.AdminUserListRes, err error)
+	AdminUserBill(ctx *gin.Context, userId int64, page, pagesize int) (res model.AdminUserBillRes, err error)
+	AdminUserBalance(ctx *gin.Context, userId int64, amount float64, comment string) error
+	AdminUserRole(ctx *gin.Context, userId int64, role int) error
+	AdminUserBan(ctx *gin.Context, userId int64, banned bool, reason string) error
+	AdminUserActiveResend(ctx *gin.Context, userId int64) error
 }
 
 // userService 实现UserService接口
 type adminService struct {
 	kd   dao.CDkeyDao
 	ud   dao.UserDao
+	ad   dao.ApiKeyDao
+	uSrv UserService
+	sSrv SessionService
 	aSrv uuid.SnowNode
 	rc   *redis.Client
+	sc   *search.ResultCache
 }
 
-func NewAdminService(_kd dao.CDkeyDao, _ud dao.UserDao) *adminService {
+func NewAdminService(_kd dao.CDkeyDao, _ud dao.UserDao, _ad dao.ApiKeyDao, _uSrv UserService, _sSrv SessionService, _jieba tokenize.Tokenizer) *adminService {
 	return &adminService{
 		kd:   _kd,
 		ud:   _ud,
+		ad:   _ad,
+		uSrv: _uSrv,
+		sSrv: _sSrv,
 		aSrv: *uuid.NewNode(5),
 		rc:   cache.GetRedisClient(),
+		sc:   search.NewResultCache(cache.GetRedisClient(), _jieba),
 	}
 }
 
-func (as *adminService) AdminVerify(ctx *gin.Context) bool {
-	userId := ctx.GetInt64(consts.UserID)
-	role, err := as.ud.UserGetRole(ctx, userId)
-	if err != nil || role != consts.Administrator {
-		return false
-	} else {
-		return true
-	}
-}
-
-func (as *adminService) CdKeyGenerate(ctx *gin.Context, number int, CardId int64) (res model.CdKeyGenerateRes, err error) {
+func (as *adminService) CdKeyGenerate(ctx *gin.Context, number int, CardId int64, expireDays int) (res model.CdKeyGenerateRes, err error) {
 	var cdkey entity.CdKey
 	var cdkeylist []entity.CdKey
 	var codekey []string
+	// 同一次生成的卡密共用批次号和过期时间
+	cdkey.BatchId = as.aSrv.GenSnowID()
+	if expireDays > 0 {
+		exp := jtime.JsonTime(time.Now().AddDate(0, 0, expireDays))
+		cdkey.ExpiredAt = &exp
+	}
 	for i := 0; i < number; i++ {
 		keyId := as.aSrv.GenSnowID()
 		code := uuid.IdToCode(keyId)
@@ -71,10 +94,145 @@ func (as *adminService) CdKeyGenerate(ctx *gin.Context, number int, CardId int64
 		codekey = append(codekey, code)
 	}
 	err = as.kd.CdKeyGenerate(ctx, cdkeylist)
+	res.BatchId = strconv.FormatInt(cdkey.BatchId, 10)
 	res.CodeKey = codekey
 	return
 }
 
+// CdKeyList 按礼品卡、批次和状态分页查询卡密
+func (as *adminService) CdKeyList(ctx *gin.Context, req model.CdKeyListReq) (res model.CdKeyListRes, err error) {
+	var cardId, batchId int64
+	if req.CardId != "" {
+		if cardId, err = strconv.ParseInt(req.CardId, 10, 64); err != nil {
+			return
+		}
+	}
+	if req.BatchId != "" {
+		if batchId, err = strconv.ParseInt(req.BatchId, 10, 64); err != nil {
+			return
+		}
+	}
+	page, pagesize := adminPage(req.Page, req.PageSize)
+	now := time.Now()
+	keys, total, err := as.kd.CdKeyList(ctx, cardId, batchId, req.Status, now, page, pagesize)
+	if err != nil {
+		return
+	}
+	cards, err := as.giftCardMap(ctx)
+	if err != nil {
+		return
+	}
+	res.Total = total
+	res.KeyList = make([]model.CdKeyOneRes, 0, len(keys))
+	for _, k := range keys {
+		key := model.CdKeyOneRes{
+			KeyId:      strconv.FormatInt(k.Id, 10),
+			CodeKey:    k.CodeKey,
+			CardId:     strconv.FormatInt(k.GiftCardId, 10),
+			CardName:   cards[k.GiftCardId].CardName,
+			BatchId:    strconv.FormatInt(k.BatchId, 10),
+			Status:     k.Status,
+			StatusName: consts.CdKeyStatusToString[k.Status],
+			IsExpired:  k.Status == consts.CdKeyUnused && k.ExpiredAt != nil && now.After(time.Time(*k.ExpiredAt)),
+			ExpiredAt:  k.ExpiredAt,
+			RedeemedAt: k.RedeemedAt,
+			CreatedAt:  k.CreatedAt,
+		}
+		if k.RedeemedBy != 0 {
+			key.RedeemedBy = strconv.FormatInt(k.RedeemedBy, 10)
+		}
+		res.KeyList = append(res.KeyList, key)
+	}
+	return
+}
+
+// CdKeyExport 导出一个批次的卡密为 CSV，带 BOM 以便 Excel 正确识别中文
+func (as *adminService) CdKeyExport(ctx *gin.Context, batchId int64) (data []byte, err error) {
+	keys, err := as.kd.CdKeyBatchGet(ctx, batchId)
+	if err != nil {
+		return
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("批次不存在")
+	}
+	cards, err := as.giftCardMap(ctx)
+	if err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"卡密", "礼品卡", "面额", "状态", "过期时间", "生成时间"})
+	for _, k := range keys {
+		expiredAt := ""
+		if k.ExpiredAt != nil {
+			expiredAt = time.Time(*k.ExpiredAt).Format(consts.TimeLayout)
+		}
+		w.Write([]string{
+			k.CodeKey,
+			cards[k.GiftCardId].CardName,
+			strconv.FormatFloat(cards[k.GiftCardId].CardAmount, 'f', -1, 64),
+			consts.CdKeyStatusToString[k.Status],
+			expiredAt,
+			time.Time(k.CreatedAt).Format(consts.TimeLayout),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// CdKeyRevoke 作废指定卡密及批次中未使用的卡密
+func (as *adminService) CdKeyRevoke(ctx *gin.Context, keyIds []int64, batchId int64) (res model.CdKeyRevokeRes, err error) {
+	if len(keyIds) == 0 && batchId == 0 {
+		return res, errors.New("请指定卡密或批次")
+	}
+	res.Revoked, err = as.kd.CdKeyRevoke(ctx, keyIds, batchId)
+	if err == nil {
+		logger.Infof("管理员%d作废卡密%d张", ctx.GetInt64(consts.UserID), res.Revoked)
+	}
+	return
+}
+
+// CdKeyRedemptionList 按用户和礼品卡分页查询兑换记录
+func (as *adminService) CdKeyRedemptionList(ctx *gin.Context, userId, cardId int64, page, pagesize int) (res model.CdKeyRedemptionListRes, err error) {
+	page, pagesize = adminPage(page, pagesize)
+	list, total, err := as.kd.CdKeyRedemptionList(ctx, userId, cardId, page, pagesize)
+	if err != nil {
+		return
+	}
+	cards, err := as.giftCardMap(ctx)
+	if err != nil {
+		return
+	}
+	res.Total = total
+	res.RedemptionList = make([]model.CdKeyRedemptionOneRes, 0, len(list))
+	for _, r := range list {
+		res.RedemptionList = append(res.RedemptionList, model.CdKeyRedemptionOneRes{
+			RedemptionId: strconv.FormatInt(r.Id, 10),
+			KeyId:        strconv.FormatInt(r.CdKeyId, 10),
+			CodeKey:      r.CodeKey,
+			CardId:       strconv.FormatInt(r.GiftCardId, 10),
+			CardName:     cards[r.GiftCardId].CardName,
+			UserId:       strconv.FormatInt(r.UserId, 10),
+			Amount:       r.Amount,
+			CreatedAt:    r.CreatedAt,
+		})
+	}
+	return
+}
+
+func (as *adminService) giftCardMap(ctx *gin.Context) (map[int64]model.GiftCardOne, error) {
+	cards, err := as.kd.GiftCardListGet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[int64]model.GiftCardOne, len(cards))
+	for _, c := range cards {
+		m[c.CardId] = c
+	}
+	return m, nil
+}
+
 func (as *adminService) GiftCardCreate(ctx *gin.Context, req model.GiftCardCreate) error {
 	err := as.rc.Del(ctx, consts.GiftcardPrefix+"0").Err()
 	if err != nil {
@@ -104,3 +262,191 @@ func (as *adminService) GiftCardUpdate(ctx *gin.Context, req model.GiftCardUpdat
 	giftcard.CardComment = req.CardComment
 	return as.kd.GiftCardUpdate(ctx, &giftcard)
 }
+
+// EmbeddingStatsGet 统计Embedding缓存命中率及去重数量
+func (as *adminService) EmbeddingStatsGet(ctx *gin.Context) (res model.EmbeddingStatsRes, err error) {
+	stats, err := as.rc.HGetAll(ctx, consts.EmbeddingStatKey).Result()
+	if err != nil {
+		return
+	}
+	res.RedisHits, _ = strconv.ParseInt(stats["redis_hit"], 10, 64)
+	res.PgHits, _ = strconv.ParseInt(stats["pg_hit"], 10, 64)
+	res.Misses, _ = strconv.ParseInt(stats["miss"], 10, 64)
+	res.Dedup, _ = strconv.ParseInt(stats["dedup"], 10, 64)
+	if total := res.RedisHits + res.PgHits + res.Misses; total > 0 {
+		res.HitRate = float64(res.RedisHits+res.PgHits) / float64(total)
+	}
+	return
+}
+
+// SearchCacheClear 按问题清除搜索缓存，问题按与缓存相同的规则分词规范化
+func (as *adminService) SearchCacheClear(ctx *gin.Context, query string) (res model.SearchCacheClearRes, err error) {
+	res.Deleted, err = as.sc.Invalidate(ctx, query)
+	return
+}
+
+// AdminUserList 按用户名、邮箱、注册IP、等级和注册时间分页搜索用户
+func (as *adminService) AdminUserList(ctx *gin.Context, req model.AdminUserListReq) (res model.AdminUserListRes, err error) {
+	req.Page, req.PageSize = adminPage(req.Page, req.PageSize)
+	users, total, err := as.ud.UserSearch(ctx, req)
+	if err != nil {
+		return
+	}
+	res.Total = total
+	res.Users = make([]model.AdminUserOneRes, 0, len(users))
+	for _, u := range users {
+		res.Users = append(res.Users, model.AdminUserOneRes{
+			UserId:       strconv.FormatInt(u.Id, 10),
+			Username:     u.Username,
+			Nickname:     u.Nickname,
+			Email:        u.Email,
+			RegisteredIp: u.RegisteredIp,
+			Role:         u.Role,
+			RoleName:     consts.RoleToString[u.Role],
+			Balance:      u.Balance,
+			IsActive:     u.IsActive,
+			IsBanned:     u.IsBanned,
+			BanReason:    u.BanReason,
+			DeleteAt:     u.DeleteAt,
+			CreatedAt:    u.CreatedAt,
+		})
+	}
+	return
+}
+
+// AdminUserBill 分页查询用户的余额变动记录
+func (as *adminService) AdminUserBill(ctx *gin.Context, userId int64, page, pagesize int) (res model.AdminUserBillRes, err error) {
+	page, pagesize = adminPage(page, pagesize)
+	bills, total, err := as.ud.UserBillPage(ctx, userId, page, pagesize)
+	if err != nil {
+		return
+	}
+	res.Total = total
+	res.BillList = make([]model.AdminUserBillOneRes, 0, len(bills))
+	for _, b := range bills {
+		bill := model.AdminUserBillOneRes{
+			BillId:      strconv.FormatInt(b.Id, 10),
+			CostChange:  b.CostChange,
+			Balance:     b.Balance,
+			CostComment: b.CostComment,
+			CreatedAt:   b.CreatedAt,
+		}
+		if b.ApiKeyId != 0 {
+			bill.ApiKeyId = strconv.FormatInt(b.ApiKeyId, 10)
+		}
+		if b.OperatorId != 0 {
+			bill.OperatorId = strconv.FormatInt(b.OperatorId, 10)
+		}
+		res.BillList = append(res.BillList, bill)
+	}
+	return
+}
+
+// AdminUserBalance 手动调整用户余额，账单记录操作的管理员
+func (as *adminService) AdminUserBalance(ctx *gin.Context, userId int64, amount float64, comment string) error {
+	if _, err := as.adminUserGet(ctx, userId); err != nil {
+		return err
+	}
+	balance, err := as.uSrv.UserGetBalance(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if balance+amount < 0 {
+		return errors.New("调整后余额不能小于0")
+	}
+	operatorId := ctx.GetInt64(consts.UserID)
+	ctx.Set(consts.OperatorIDCtx, operatorId)
+	logger.Infof("管理员%d调整用户%d余额%.4f:%s", operatorId, userId, amount, comment)
+	return as.uSrv.UserBalanceChange(ctx, userId, amount, "管理员调整-"+comment)
+}
+
+// AdminUserRole 修改用户等级，降级时注销其全部会话使权限立即生效
+func (as *adminService) AdminUserRole(ctx *gin.Context, userId int64, role int) error {
+	if _, ok := consts.RoleToString[role]; !ok {
+		return fmt.Errorf("用户等级%d不存在", role)
+	}
+	operatorId := ctx.GetInt64(consts.UserID)
+	if userId == operatorId {
+		return errors.New("不能修改自己的等级")
+	}
+	userInfo, err := as.adminUserGet(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if err = as.ud.UserUpdate(ctx, &entity.User{Id: userId, Role: role}); err != nil {
+		return err
+	}
+	as.adminUserCacheClear(ctx, userId)
+	logger.Infof("管理员%d将用户%d等级由%d修改为%d", operatorId, userId, userInfo.Role, role)
+	if role < userInfo.Role {
+		return as.sSrv.SessionRevokeAll(ctx, userId)
+	}
+	return nil
+}
+
+// AdminUserBan 封禁或解封用户，封禁时立即注销其全部会话并使 API Key 缓存失效
+func (as *adminService) AdminUserBan(ctx *gin.Context, userId int64, banned bool, reason string) error {
+	operatorId := ctx.GetInt64(consts.UserID)
+	if userId == operatorId {
+		return errors.New("不能封禁自己")
+	}
+	if _, err := as.adminUserGet(ctx, userId); err != nil {
+		return err
+	}
+	if !banned {
+		reason = ""
+	}
+	if err := as.ud.UserBanUpdate(ctx, userId, banned, reason); err != nil {
+		return err
+	}
+	as.adminUserCacheClear(ctx, userId)
+	logger.Infof("管理员%d修改用户%d封禁状态为%v:%s", operatorId, userId, banned, reason)
+	if !banned {
+		return nil
+	}
+	return as.sSrv.SessionRevokeAll(ctx, userId)
+}
+
+func (as *adminService) AdminUserActiveResend(ctx *gin.Context, userId int64) error {
+	return as.uSrv.UserActiveResend(ctx, userId)
+}
+
+func (as *adminService) adminUserGet(ctx *gin.Context, userId int64) (model.UserInfo, error) {
+	userInfo, err := as.ud.UserGetById(ctx, userId)
+	if err != nil {
+		return userInfo, err
+	}
+	if userInfo.Username == "" {
+		return userInfo, errors.New("用户不存在")
+	}
+	return userInfo, nil
+}
+
+// adminUserCacheClear 清除用户信息及其 API Key 的鉴权缓存
+func (as *adminService) adminUserCacheClear(ctx *gin.Context, userId int64) {
+	keys := []string{consts.UserInfoPrefix + strconv.FormatInt(userId, 10)}
+	apiKeys, err := as.ad.ApiKeyList(ctx, userId)
+	if err != nil {
+		logger.Errorf("API Key查询失败:%v", err.Error())
+	}
+	for _, k := range apiKeys {
+		keys = append(keys, consts.ApiKeyPrefix+k.KeyHash)
+	}
+	if err := as.rc.Del(ctx, keys...).Err(); err != nil {
+		logger.Errorf("Redis连接异常:%v", err.Error())
+	}
+}
+
+// adminPage 分页参数默认每页 20 条，最多 100 条
+func adminPage(page, pagesize int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pagesize < 1 {
+		pagesize = 20
+	}
+	if pagesize > 100 {
+		pagesize = 100
+	}
+	return page, pagesize
+}
@@ -0,0 +1,237 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 10:12:47
+ * @LastEditTime: 2023-06-24 10:12:47
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/apikey.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/jtime"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/utils/uuid"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+var _ ApiKeyService = (*apiKeyService)(nil)
+
+// apiKeyCacheTTL 鉴权结果缓存时间，注销时会主动清除
+const apiKeyCacheTTL = 5 * time.Minute
+
+// apiKeyLimit 每个用户可创建的 API Key 数量
+const apiKeyLimit = 20
+
+var errApiKeyInvalid = errors.New("API Key 无效")
+
+type ApiKeyService interface {
+	ApiKeyCreate(ctx *gin.Context, req model.ApiKeyCreateReq) (res model.ApiKeyCreateRes, err error)
+	ApiKeyList(ctx *gin.Context) (res model.ApiKeyListRes, err error)
+	ApiKeyDelete(ctx *gin.Context, keyId int64) error
+	ApiKeyAuth(ctx *gin.Context, key string) (auth model.ApiKeyAuth, err error)
+}
+
+type apiKeyService struct {
+	ad   dao.ApiKeyDao
+	ud   dao.UserDao
+	iSrv uuid.SnowNode
+	rc   *redis.Client
+}
+
+func NewApiKeyService(_ad dao.ApiKeyDao, _ud dao.UserDao) *apiKeyService {
+	return &apiKeyService{
+		ad:   _ad,
+		ud:   _ud,
+		iSrv: *uuid.NewNode(8),
+		rc:   cache.GetRedisClient(),
+	}
+}
+
+// ApiKeyCreate 创建 API Key，完整的 Key 只返回这一次
+func (as *apiKeyService) ApiKeyCreate(ctx *gin.Context, req model.ApiKeyCreateReq) (res model.ApiKeyCreateRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	keys, err := as.ad.ApiKeyList(ctx, userId)
+	if err != nil {
+		return
+	}
+	if len(keys) >= apiKeyLimit {
+		return res, errors.New("API Key 数量已达上限")
+	}
+	for _, ip := range req.IpAllowlist {
+		if _, _, err := net.ParseCIDR(ip); err != nil && net.ParseIP(ip) == nil {
+			return res, errors.New("IP白名单格式错误:" + ip)
+		}
+	}
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	key := consts.ApiKeyTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	record := entity.ApiKey{
+		Id:          as.iSrv.GenSnowID(),
+		UserId:      userId,
+		Name:        req.Name,
+		Prefix:      key[:len(consts.ApiKeyTokenPrefix)+6],
+		KeyHash:     apiKeyHash(key),
+		Scopes:      strings.Join(req.Scopes, ","),
+		IpAllowlist: strings.Join(req.IpAllowlist, ","),
+	}
+	if req.ExpireDays > 0 {
+		exp := jtime.JsonTime(time.Now().AddDate(0, 0, req.ExpireDays))
+		record.ExpiredAt = &exp
+	}
+	if err = as.ad.ApiKeyCreate(ctx, &record); err != nil {
+		return
+	}
+	res.KeyId = strconv.FormatInt(record.Id, 10)
+	res.Key = key
+	return
+}
+
+// ApiKeyList 返回用户的 API Key 及各自的累计消费
+func (as *apiKeyService) ApiKeyList(ctx *gin.Context) (res model.ApiKeyListRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	keys, err := as.ad.ApiKeyList(ctx, userId)
+	if err != nil {
+		return
+	}
+	usage, err := as.ad.ApiKeyUsage(ctx, userId)
+	if err != nil {
+		return
+	}
+	res.KeyList = make([]model.ApiKeyOneRes, 0, len(keys))
+	for _, k := range keys {
+		res.KeyList = append(res.KeyList, model.ApiKeyOneRes{
+			KeyId:       strconv.FormatInt(k.Id, 10),
+			Name:        k.Name,
+			Prefix:      k.Prefix,
+			Scopes:      splitList(k.Scopes),
+			IpAllowlist: splitList(k.IpAllowlist),
+			ExpiredAt:   k.ExpiredAt,
+			LastUsedAt:  k.LastUsedAt,
+			CreatedAt:   k.CreatedAt,
+			Cost:        usage[k.Id],
+		})
+	}
+	return
+}
+
+func (as *apiKeyService) ApiKeyDelete(ctx *gin.Context, keyId int64) error {
+	userId := ctx.GetInt64(consts.UserID)
+	key, err := as.ad.ApiKeyRevoke(ctx, userId, keyId)
+	if err != nil {
+		return err
+	}
+	return as.rc.Del(ctx, consts.ApiKeyPrefix+key.KeyHash).Err()
+}
+
+// ApiKeyAuth 校验 API Key 的有效期和 IP 白名单，结果缓存在 redis
+func (as *apiKeyService) ApiKeyAuth(ctx *gin.Context, key string) (auth model.ApiKeyAuth, err error) {
+	hash := apiKeyHash(key)
+	cacheKey := consts.ApiKeyPrefix + hash
+	data, err := as.rc.Get(ctx, cacheKey).Bytes()
+	if err == nil {
+		err = json.Unmarshal(data, &auth)
+	}
+	if err != nil {
+		if err != redis.Nil {
+			logger.Errorf("Redis连接异常:%v", err.Error())
+		}
+		if auth, err = as.apiKeyLoad(ctx, hash); err != nil {
+			return
+		}
+		if data, err := json.Marshal(auth); err == nil {
+			as.rc.Set(ctx, cacheKey, data, apiKeyCacheTTL)
+		}
+		// 最近使用时间随缓存刷新更新，避免每个请求写库
+		if err := as.ad.ApiKeyTouch(ctx, auth.KeyId); err != nil {
+			logger.Errorf("API Key使用时间更新失败:%v", err.Error())
+		}
+	}
+	if auth.ExpiredAt != 0 && time.Now().Unix() > auth.ExpiredAt {
+		return auth, errors.New("API Key 已过期")
+	}
+	if len(auth.IpAllowlist) > 0 && !ipAllowed(ctx.ClientIP(), auth.IpAllowlist) {
+		return auth, errors.New("IP 不在 API Key 白名单中")
+	}
+	return auth, nil
+}
+
+func (as *apiKeyService) apiKeyLoad(ctx *gin.Context, hash string) (auth model.ApiKeyAuth, err error) {
+	key, err := as.ad.ApiKeyGetByHash(ctx, hash)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return auth, errApiKeyInvalid
+	}
+	if err != nil {
+		return
+	}
+	if key.IsRevoked {
+		return auth, errApiKeyInvalid
+	}
+	userInfo, err := as.ud.UserGetById(ctx, key.UserId)
+	if err != nil {
+		return
+	}
+	if userInfo.Username == "" || !userInfo.IsActive || userInfo.IsBanned {
+		return auth, errApiKeyInvalid
+	}
+	auth = model.ApiKeyAuth{
+		KeyId:       key.Id,
+		UserId:      key.UserId,
+		Role:        userInfo.Role,
+		Scopes:      splitList(key.Scopes),
+		IpAllowlist: splitList(key.IpAllowlist),
+	}
+	if key.ExpiredAt != nil {
+		auth.ExpiredAt = time.Time(*key.ExpiredAt).Unix()
+	}
+	return auth, nil
+}
+
+func apiKeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ipAllowed 白名单支持单个 IP 和 CIDR
+func ipAllowed(clientIP string, allowlist []string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, item := range allowlist {
+		if _, ipnet, err := net.ParseCIDR(item); err == nil {
+			if ipnet.Contains(ip) {
+				return true
+			}
+		} else if allowed := net.ParseIP(item); allowed != nil && allowed.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,143 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-29 13:20:41
+ * @LastEditTime: 2023-06-29 13:20:41
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/apikey_test.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/jtime"
+	"chatserver-api/pkg/logger"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+func Test_ipAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		ip        string
+		allowlist []string
+		want      bool
+	}{
+		{"exact ipv4", "203.0.113.7", []string{"203.0.113.7"}, true},
+		{"other ipv4", "203.0.113.8", []string{"203.0.113.7"}, false},
+		{"ipv4 cidr", "10.1.2.3", []string{"192.168.0.0/16", "10.0.0.0/8"}, true},
+		{"outside cidr", "11.1.2.3", []string{"10.0.0.0/8"}, false},
+		{"exact ipv6", "2001:db8::1", []string{"2001:db8:0:0::1"}, true},
+		{"ipv6 cidr", "2001:db8:1::5", []string{"2001:db8::/32"}, true},
+		{"ipv6 outside cidr", "2001:db9::5", []string{"2001:db8::/32"}, false},
+		{"ipv4 in ipv6 list", "10.1.2.3", []string{"2001:db8::/32"}, false},
+		{"invalid client ip", "unknown", []string{"0.0.0.0/0"}, false},
+		{"invalid entry", "10.1.2.3", []string{"10.1.2.x"}, false},
+		{"empty list", "10.1.2.3", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ipAllowed(tt.ip, tt.allowlist); got != tt.want {
+				t.Errorf("ipAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeApiKeyDao 按哈希返回 API Key 并记录使用时间更新次数
+type fakeApiKeyDao struct {
+	dao.ApiKeyDao
+	keys    map[string]entity.ApiKey
+	touched int
+}
+
+func (f *fakeApiKeyDao) ApiKeyGetByHash(ctx context.Context, hash string) (entity.ApiKey, error) {
+	key, ok := f.keys[hash]
+	if !ok {
+		return key, gorm.ErrRecordNotFound
+	}
+	return key, nil
+}
+
+func (f *fakeApiKeyDao) ApiKeyTouch(ctx context.Context, keyId int64) error {
+	f.touched++
+	return nil
+}
+
+type fakeApiKeyUserDao struct {
+	dao.UserDao
+	users map[int64]model.UserInfo
+}
+
+func (f *fakeApiKeyUserDao) UserGetById(ctx context.Context, userId int64) (model.UserInfo, error) {
+	return f.users[userId], nil
+}
+
+func Test_apiKeyService_ApiKeyAuth(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	past := jtime.JsonTime(time.Now().Add(-time.Hour))
+	future := jtime.JsonTime(time.Now().Add(time.Hour))
+	keys := map[string]entity.ApiKey{
+		apiKeyHash("sk-valid"):   {Id: 1, UserId: 100, Scopes: "chat"},
+		apiKeyHash("sk-future"):  {Id: 2, UserId: 100, Scopes: "chat", ExpiredAt: &future},
+		apiKeyHash("sk-expired"): {Id: 3, UserId: 100, Scopes: "chat", ExpiredAt: &past},
+		apiKeyHash("sk-revoked"): {Id: 4, UserId: 100, Scopes: "chat", IsRevoked: true},
+		apiKeyHash("sk-banned"):  {Id: 5, UserId: 200, Scopes: "chat"},
+		apiKeyHash("sk-pending"): {Id: 6, UserId: 300, Scopes: "chat"},
+		apiKeyHash("sk-deleted"): {Id: 7, UserId: 400, Scopes: "chat"},
+		apiKeyHash("sk-ip"):      {Id: 8, UserId: 100, Scopes: "chat", IpAllowlist: "198.51.100.0/24,2001:db8::/32"},
+	}
+	users := map[int64]model.UserInfo{
+		100: {Username: "alice", Role: 1, IsActive: true},
+		200: {Username: "bob", Role: 1, IsActive: true, IsBanned: true},
+		300: {Username: "carol", Role: 1},
+	}
+	tests := []struct {
+		name     string
+		key      string
+		remoteIP string
+		wantErr  bool
+	}{
+		{"valid", "sk-valid", "203.0.113.1", false},
+		{"not expired", "sk-future", "203.0.113.1", false},
+		{"expired", "sk-expired", "203.0.113.1", true},
+		{"revoked", "sk-revoked", "203.0.113.1", true},
+		{"banned user", "sk-banned", "203.0.113.1", true},
+		{"inactive user", "sk-pending", "203.0.113.1", true},
+		{"deleted user", "sk-deleted", "203.0.113.1", true},
+		{"unknown key", "sk-unknown", "203.0.113.1", true},
+		{"ip allowed", "sk-ip", "198.51.100.9", false},
+		{"ipv6 allowed", "sk-ip", "2001:db8::9", false},
+		{"ip denied", "sk-ip", "203.0.113.1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			ad := &fakeApiKeyDao{keys: keys}
+			as := &apiKeyService{ad: ad, ud: &fakeApiKeyUserDao{users: users}, rc: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+			for i := 0; i < 2; i++ {
+				ctx, _ := testChatContext()
+				ctx.Request.RemoteAddr = net.JoinHostPort(tt.remoteIP, "40000")
+				auth, err := as.ApiKeyAuth(ctx, tt.key)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("ApiKeyAuth() call %d error = %v, wantErr %v", i, err, tt.wantErr)
+				}
+				if !tt.wantErr && (auth.UserId != 100 || len(auth.Scopes) != 1) {
+					t.Errorf("ApiKeyAuth() = %+v", auth)
+				}
+			}
+			// 第二次校验命中缓存，不再更新使用时间
+			if !tt.wantErr && ad.touched != 1 {
+				t.Errorf("ApiKeyTouch() called %d times, want 1", ad.touched)
+			}
+		})
+	}
+}
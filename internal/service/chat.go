@@ -20,12 +20,18 @@ import (
 	"chatserver-api/internal/model"
 	"chatserver-api/internal/model/entity"
 	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/embedhash"
 	"chatserver-api/pkg/logger"
 	"chatserver-api/pkg/openai"
 	"chatserver-api/pkg/pgvector"
+	"chatserver-api/pkg/rbac"
+	"chatserver-api/pkg/rerank"
+	"chatserver-api/pkg/rewrite"
 	"chatserver-api/pkg/search"
 	"chatserver-api/pkg/tiktoken"
 	"chatserver-api/pkg/tokenize"
+	"chatserver-api/pkg/usage"
 	"chatserver-api/utils/security"
 	"chatserver-api/utils/uuid"
 	"fmt"
@@ -40,6 +46,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
 )
 
 var _ ChatService = (*chatService)(nil)
@@ -56,15 +63,17 @@ type ChatService interface {
 	ChatMessageSave(ctx *gin.Context, role, message string, msgid int64) (err error)
 	ChatDetailGet(ctx *gin.Context) (res model.ChatDetailRes, err error)
 	ChatUserVerify(ctx *gin.Context) (err error)
+	ChatPresetVerify(ctx *gin.Context, presetId int64) (err error)
 	ChatRegenerategReqProcess(ctx *gin.Context, msgid int64, memoryLevel int16) (answerid int64, req openai.ChatCompletionRequest, err error)
 	ChatChattingReqProcess(ctx *gin.Context, lastquestion string, memoryLevel int16) (questionId int64, req openai.ChatCompletionRequest, err error)
 	ChatStremResGenerate(ctx *gin.Context, req openai.ChatCompletionRequest, chanStream chan<- string)
 	ChatStreamResProcess(ctx *gin.Context, chanStream <-chan string, questionId, answerid int64) (msgid int64, messages string)
-	ChatEmbeddingSave(ctx context.Context, title, body, classify string, embeddata openai.Embedding) error
-	ChatEmbeddingGenerate(str []string) (embedVectors []openai.Embedding, err error)
-	ChatEmbeddingCompare(ctx context.Context, question, classify string) (contextStr string, err error)
+	ChatEmbeddingSave(ctx context.Context, kbId int64, title, body, classify string, page int, embeddata openai.Embedding) error
+	ChatEmbeddingGenerate(ctx context.Context, str []string) (embedVectors []openai.Embedding, err error)
+	ChatEmbeddingDedup(ctx context.Context, kbId int64, texts []string) (unique []string, err error)
+	ChatEmbeddingCompare(ctx context.Context, userId int64, question, classify string) (contextStr string, citations []model.Citation, err error)
 	ChatCostCalculate(ctx *gin.Context, promptMsgs []openai.ChatCompletionMessage, model string)
-	ChatSearchExtension(ctx *gin.Context, question string) (result string)
+	ChatSearchExtension(ctx *gin.Context, records []model.RecordOne, question, providers string) (result string, citations []model.Citation)
 	// ChatTest(ctx context.Context, text string) (keyword string)
 }
 
@@ -72,18 +81,34 @@ type ChatService interface {
 type chatService struct {
 	cd    dao.ChatDao
 	uSrv  UserService
+	kSrv  KbService
 	rc    *redis.Client
 	jieba tokenize.Tokenizer
 	iSrv  uuid.SnowNode
+	rr    rerank.Reranker
+	ner   search.EntityDetector
+	plan  search.Planner
+	sc    *search.ResultCache
+	rSrv  ReportService
 }
 
-func NewChatService(_cd dao.ChatDao, _uSrv UserService, _jieba tokenize.Tokenizer) *chatService {
+func NewChatService(_cd dao.ChatDao, _uSrv UserService, _kSrv KbService, _rSrv ReportService, _jieba tokenize.Tokenizer) *chatService {
+	var plan search.Planner
+	if config.AppConfig.SearchConfig.Planner {
+		plan = search.NewPlanner(config.AppConfig.SearchConfig.PlannerModel)
+	}
 	return &chatService{
 		cd:    _cd,
 		uSrv:  _uSrv,
+		kSrv:  _kSrv,
 		iSrv:  *uuid.NewNode(1),
 		rc:    cache.GetRedisClient(),
 		jieba: _jieba,
+		rr:    rerank.NewReranker(config.AppConfig.RerankConfig),
+		ner:   search.NewDetector(config.AppConfig.SearchConfig.Ner, _jieba),
+		plan:  plan,
+		sc:    search.NewResultCache(cache.GetRedisClient(), _jieba),
+		rSrv:  _rSrv,
 	}
 }
 
@@ -135,6 +160,21 @@ func (cs *chatService) ChatDelete(ctx *gin.Context) error {
 	}
 }
 
+// ChatPresetVerify 校验用户等级是否满足会话预设的使用权限
+func (cs *chatService) ChatPresetVerify(ctx *gin.Context, presetId int64) (err error) {
+	privilege, err := cs.cd.ChatPresetPrivilegeGet(ctx, presetId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("会话预设不存在")
+	}
+	if err != nil {
+		return err
+	}
+	if !rbac.PresetAllowed(ctx.GetInt(consts.RoleID), privilege) {
+		return errors.New("当前用户等级无法使用该会话预设")
+	}
+	return nil
+}
+
 // 验证会话用户归属
 func (cs *chatService) ChatUserVerify(ctx *gin.Context) (err error) {
 	userId := ctx.GetInt64(consts.UserID)
@@ -209,6 +249,12 @@ func (cs *chatService) ChatRecordGet(ctx *gin.Context) (res model.RecordHistoryR
 		recordOne.Message = recordlist[i].Message
 		recordOne.CreatedAt = recordlist[i].CreatedAt
 		recordOne.Sender = recordlist[i].Sender
+		recordOne.Citations = nil
+		if len(recordlist[i].Citations) > 0 {
+			if err := json.Unmarshal(recordlist[i].Citations, &recordOne.Citations); err != nil {
+				logger.Warnf("引用来源反序列化失败:%v", err)
+			}
+		}
 		cs.rc.SAdd(ctx, consts.ChatRecordIDPrefix+strconv.FormatInt(chatId, 10), recordlist[i].Id)
 		recordListRes = append(recordListRes, recordOne)
 	}
@@ -237,12 +283,26 @@ func (cs *chatService) ChatBalanceVerify(ctx *gin.Context) (err error) {
 
 func (cs *chatService) ChatBalanceUpdate(ctx *gin.Context) (err error) {
 	userId := ctx.GetInt64(consts.UserID)
-	balance := ctx.GetFloat64(consts.BalanceCtx)
 	token := ctx.GetInt(consts.CostTokenCtx)
 	priceratio := ctx.GetInt(consts.PriceRatioCtx)
 	cost := float64(token) * consts.TokenPrice * float64(priceratio)
 	comment := fmt.Sprintf("消费-会话消耗令牌数:%d", token)
-	return cs.uSrv.UserBalanceChange(ctx, userId, balance, -cost, comment)
+	// 辅助调用按基础单价计费，不乘以联网搜索的价格倍率
+	auxRecords := usage.FromContext(ctx).Records()
+	var auxToken int
+	for _, r := range auxRecords {
+		auxToken += r.Tokens
+	}
+	auxCost := float64(auxToken) * consts.TokenPrice
+	if auxToken > 0 {
+		comment += fmt.Sprintf(",检索辅助令牌数:%d", auxToken)
+	}
+	if err = cs.uSrv.UserBalanceChange(ctx, userId, -(cost + auxCost), comment); err != nil {
+		return err
+	}
+	cs.rSrv.ReportUsageAdd(ctx, consts.ReportSourceChat, token, cost)
+	cs.rSrv.ReportUsageAuxAdd(ctx, auxRecords)
+	return nil
 }
 
 func (cs *chatService) ChatCostCalculate(ctx *gin.Context, promptMsgs []openai.ChatCompletionMessage, model string) {
@@ -283,6 +343,12 @@ func (cs *chatService) ChatMessageSave(ctx *gin.Context, role, message string, m
 	record.Message = message
 	record.MessageHash = security.Md5(message)
 	record.MessageToken = tiktoken.NumTokensSingleString(message)
+	if role == openai.ChatMessageRoleAssistant {
+		record.Citations, err = json.Marshal(chatCitationsGet(ctx))
+		if err != nil {
+			return err
+		}
+	}
 	if !exist {
 		logger.Debugf("聊天消息记录新建")
 		cs.rc.SAdd(ctx, consts.ChatRecordIDPrefix+strconv.FormatInt(chatId, 10), msgid)
@@ -299,7 +365,7 @@ func (cs *chatService) ChatRegenerategReqProcess(ctx *gin.Context, msgid int64,
 	var chatMessages []openai.ChatCompletionMessage
 	var systemPreset, historyMessage, lastMessage openai.ChatCompletionMessage
 	var logitbia map[string]int
-	var emquestion, embedcontexts string
+	var embedcontexts string
 	userId := ctx.GetInt64(consts.UserID)
 	chatId := ctx.GetInt64(consts.ChatID)
 	preset, err := cs.cd.ChatDetailGet(ctx, userId, chatId)
@@ -307,6 +373,10 @@ func (cs *chatService) ChatRegenerategReqProcess(ctx *gin.Context, msgid int64,
 		logger.Errorf("获取会话详情失败: %v\n", err)
 		return
 	}
+	ctx.Set(consts.ModelCtx, preset.ModelName)
+	ctx.Set(consts.PresetIDCtx, preset.PresetId)
+	// 记录检索改写、搜索规划等辅助调用的用量，在 ChatBalanceUpdate 中一并扣费
+	ctx.Set(usage.MeterCtx, &usage.Meter{})
 	data, err := preset.LogitBias.MarshalJSON()
 	if err != nil {
 		logger.Errorf("序列化LogitBias失败: %v\n", err)
@@ -337,7 +407,8 @@ func (cs *chatService) ChatRegenerategReqProcess(ctx *gin.Context, msgid int64,
 		{
 			// lastquestion 查询拼接
 			ctx.Set(consts.PriceRatioCtx, 5)
-			searchContext := cs.ChatSearchExtension(ctx, lastquestion)
+			searchContext, citations := cs.ChatSearchExtension(ctx, records[:len(records)-1], lastquestion, preset.SearchProviders)
+			ctx.Set(consts.CitationCtx, citations)
 			content := strings.Replace(preset.PresetContent, "{{ current_date }}", time.Now().Format(consts.DateLayout), -1)
 			systemPreset.Content = strings.Replace(content, "{{ context }}", searchContext, -1)
 		}
@@ -349,21 +420,16 @@ func (cs *chatService) ChatRegenerategReqProcess(ctx *gin.Context, msgid int64,
 	//embedding 数据
 	case 3:
 		{
-			if len(records) != 0 {
-				for _, v := range records {
-					if v.Sender == "user" {
-						emquestion += v.Message
-					}
-				}
-			}
-			//将用户问题进行关键词提取
-			emkeyword := cs.jieba.GetKeyword(emquestion) + lastquestion
-			//通过用户问题 lastquestion + records（User历史）获取Context信息
-			embedcontexts, err = cs.ChatEmbeddingCompare(ctx, emkeyword, preset.Classify)
+			//根据预设的检索策略将 records（历史）+ lastquestion 改写为检索语句
+			emquestion := cs.chatRetrievalQuery(ctx, preset.QueryStrategy, records[:len(records)-1], lastquestion)
+			//通过检索语句获取Context信息
+			var citations []model.Citation
+			embedcontexts, citations, err = cs.ChatEmbeddingCompare(ctx, userId, emquestion, preset.Classify)
 			if err != nil {
 				logger.Errorf("获取embedding上下文失败: %v\n", err)
 				return
 			}
+			ctx.Set(consts.CitationCtx, citations)
 			//替换拼接PresetContent
 			systemPreset.Content = strings.Replace(preset.PresetContent, "{{ context }}", embedcontexts, -1)
 		}
@@ -400,7 +466,7 @@ func (cs *chatService) ChatChattingReqProcess(ctx *gin.Context, lastquestion str
 	var chatMessages []openai.ChatCompletionMessage
 	var systemPreset, historyMessage, lastMessage openai.ChatCompletionMessage
 	var logitbia map[string]int
-	var emquestion, embedcontexts string
+	var embedcontexts string
 	userId := ctx.GetInt64(consts.UserID)
 	chatId := ctx.GetInt64(consts.ChatID)
 	preset, err := cs.cd.ChatDetailGet(ctx, userId, chatId)
@@ -408,6 +474,10 @@ func (cs *chatService) ChatChattingReqProcess(ctx *gin.Context, lastquestion str
 		logger.Errorf("获取会话详情失败: %v\n", err)
 		return
 	}
+	ctx.Set(consts.ModelCtx, preset.ModelName)
+	ctx.Set(consts.PresetIDCtx, preset.PresetId)
+	// 记录检索改写、搜索规划等辅助调用的用量，在 ChatBalanceUpdate 中一并扣费
+	ctx.Set(usage.MeterCtx, &usage.Meter{})
 	data, err := preset.LogitBias.MarshalJSON()
 	if err != nil {
 		logger.Errorf("序列化LogitBias失败: %v\n", err)
@@ -436,7 +506,8 @@ func (cs *chatService) ChatChattingReqProcess(ctx *gin.Context, lastquestion str
 		{
 			// lastquestion 查询拼接
 			ctx.Set(consts.PriceRatioCtx, 5)
-			searchContext := cs.ChatSearchExtension(ctx, lastquestion)
+			searchContext, citations := cs.ChatSearchExtension(ctx, records, lastquestion, preset.SearchProviders)
+			ctx.Set(consts.CitationCtx, citations)
 			content := strings.Replace(preset.PresetContent, "{{ current_date }}", time.Now().Format(consts.DateLayout), -1)
 			systemPreset.Content = strings.Replace(content, "{{ context }}", searchContext, -1)
 		}
@@ -448,23 +519,16 @@ func (cs *chatService) ChatChattingReqProcess(ctx *gin.Context, lastquestion str
 	//embedding 数据
 	case 3:
 		{
-			if len(records) != 0 {
-				for _, v := range records {
-					if v.Sender == "user" {
-						emquestion += v.Message
-					}
-				}
-			}
-
-			emquestion += lastquestion
-			//将用户问题进行关键词提取
-			emkeyword := cs.jieba.GetKeyword(emquestion) + lastquestion
-			//通过用户问题 lastquestion + records（User历史）获取Context信息
-			embedcontexts, err = cs.ChatEmbeddingCompare(ctx, emkeyword, preset.Classify)
+			//根据预设的检索策略将 records（历史）+ lastquestion 改写为检索语句
+			emquestion := cs.chatRetrievalQuery(ctx, preset.QueryStrategy, records, lastquestion)
+			//通过检索语句获取Context信息
+			var citations []model.Citation
+			embedcontexts, citations, err = cs.ChatEmbeddingCompare(ctx, userId, emquestion, preset.Classify)
 			if err != nil {
 				logger.Errorf("获取embedding上下文失败: %v\n", err)
 				return
 			}
+			ctx.Set(consts.CitationCtx, citations)
 			//替换拼接PresetContent
 			systemPreset.Content = strings.Replace(preset.PresetContent, "{{ context }}", embedcontexts, -1)
 		}
@@ -503,6 +567,9 @@ func (cs *chatService) ChatStreamResProcess(ctx *gin.Context, chanStream <-chan
 	} else {
 		msgid = cs.iSrv.GenSnowID()
 	}
+	if ctx.GetBool(consts.ProgressCtx) {
+		chatProgressSend(ctx, search.Progress{Stage: search.StageAnswering})
+	}
 	ctx.Stream(func(w io.Writer) bool {
 		if msg, ok := <-chanStream; ok {
 			if msg == "[content_filter]" {
@@ -521,13 +588,20 @@ func (cs *chatService) ChatStreamResProcess(ctx *gin.Context, chanStream <-chan
 			return true
 		}
 
-		ctx.SSEvent("chatting", map[string]string{"question_id": strconv.FormatInt(questionId, 10), "msgid": strconv.FormatInt(msgid, 10), "time": msgtime, "text": messages})
+		ctx.SSEvent("chatting", map[string]interface{}{"question_id": strconv.FormatInt(questionId, 10), "msgid": strconv.FormatInt(msgid, 10), "time": msgtime, "text": messages, "citations": chatCitationsGet(ctx)})
 		return false
 	})
 	logger.Debugf("Stream-message:%s", messages)
 	return
 }
 
+// chatProgressSend 在回答开始前推送搜索进度事件
+func chatProgressSend(ctx *gin.Context, ev search.Progress) {
+	ctx.Set(consts.ProgressCtx, true)
+	ctx.SSEvent("progress", ev)
+	ctx.Writer.Flush()
+}
+
 func (cs *chatService) ChatStremResGenerate(ctx *gin.Context, req openai.ChatCompletionRequest, chanStream chan<- string) {
 	var chatMessages []openai.ChatCompletionMessage
 	var lastMessage, blankMessage openai.ChatCompletionMessage
@@ -631,10 +705,73 @@ func (cs *chatService) ChatStremResGenerate(ctx *gin.Context, req openai.ChatCom
 	}
 }
 
-func (cs *chatService) ChatEmbeddingGenerate(str []string) (embedVectors []openai.Embedding, err error) {
+// ChatEmbeddingGenerate 生成文本向量，依次查询 Redis 缓存、Postgres 缓存，均未命中的文本才调用接口
+func (cs *chatService) ChatEmbeddingGenerate(ctx context.Context, str []string) (embedVectors []openai.Embedding, err error) {
+	embedModel := openai.AdaEmbeddingV2
+	embedVectors = make([]openai.Embedding, len(str))
+	// 内容哈希 -> 需要该向量的下标，相同文本只请求一次
+	pending := make(map[string][]int)
+	var hashes []string
+	keys := make([]string, len(str))
+	for i, s := range str {
+		hash := embedhash.Hash(embedModel.String(), s)
+		embedVectors[i] = openai.Embedding{Object: "embedding", Index: i}
+		keys[i] = consts.EmbeddingCachePrefix + hash
+		if _, ok := pending[hash]; !ok {
+			hashes = append(hashes, hash)
+		}
+		pending[hash] = append(pending[hash], i)
+	}
+	var redisHits, pgHits, misses int64
+	vals, rerr := cs.rc.MGet(ctx, keys...).Result()
+	if rerr != nil {
+		logger.Errorf("Redis连接异常:%v", rerr.Error())
+	}
+	for i, v := range vals {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		vec, derr := embedhash.Decode([]byte(raw))
+		if derr != nil {
+			continue
+		}
+		embedVectors[i].Embedding = vec
+		redisHits++
+	}
+	hashes = cs.embeddingPendingFilter(embedVectors, pending, hashes)
+	if len(hashes) != 0 {
+		caches, perr := cs.cd.EmbeddingCacheGet(ctx, hashes)
+		if perr != nil {
+			logger.Errorf("查询Embedding缓存失败:%v", perr)
+		}
+		for _, c := range caches {
+			vec := c.Embedding.Slice()
+			for _, i := range pending[c.ContentHash] {
+				embedVectors[i].Embedding = vec
+				pgHits++
+			}
+			cs.embeddingRedisSave(ctx, c.ContentHash, vec)
+		}
+		hashes = cs.embeddingPendingFilter(embedVectors, pending, hashes)
+	}
+	defer func() {
+		pipe := cs.rc.Pipeline()
+		pipe.HIncrBy(ctx, consts.EmbeddingStatKey, "redis_hit", redisHits)
+		pipe.HIncrBy(ctx, consts.EmbeddingStatKey, "pg_hit", pgHits)
+		pipe.HIncrBy(ctx, consts.EmbeddingStatKey, "miss", misses)
+		if _, serr := pipe.Exec(ctx); serr != nil {
+			logger.Errorf("记录Embedding缓存统计失败:%v", serr)
+		}
+	}()
+	if len(hashes) == 0 {
+		return
+	}
 	var req openai.EmbeddingRequest
-	req.Model = openai.AdaEmbeddingV2
-	req.Input = str
+	req.Model = embedModel
+	for _, hash := range hashes {
+		req.Input = append(req.Input, str[pending[hash][0]])
+	}
 	client, err := openai.NewClient()
 	if err != nil {
 		return
@@ -644,53 +781,225 @@ func (cs *chatService) ChatEmbeddingGenerate(str []string) (embedVectors []opena
 		logger.Errorf("Embeddings error: %v\n", err)
 		return
 	}
-	// tokens = resp.Usage.TotalTokens
-	embedVectors = resp.Data
+	var caches []entity.EmbeddingCache
+	for _, d := range resp.Data {
+		if d.Index >= len(hashes) {
+			continue
+		}
+		hash := hashes[d.Index]
+		for _, i := range pending[hash] {
+			embedVectors[i].Embedding = d.Embedding
+			misses++
+		}
+		cs.embeddingRedisSave(ctx, hash, d.Embedding)
+		caches = append(caches, entity.EmbeddingCache{ContentHash: hash, Model: embedModel.String(), Embedding: pgvector.NewVector(d.Embedding)})
+	}
+	if err = cs.cd.EmbeddingCacheSave(ctx, caches); err != nil {
+		logger.Errorf("保存Embedding缓存失败:%v", err)
+		err = nil
+	}
+	if len(resp.Data) != len(hashes) {
+		err = errors.New("embedding response size mismatch")
+	}
 	return
 }
 
-func (cs *chatService) ChatEmbeddingSave(ctx context.Context, title, body, classify string, embeddata openai.Embedding) error {
+// ChatEmbeddingDedup 去除批次内重复以及知识库中已存在的文本
+func (cs *chatService) ChatEmbeddingDedup(ctx context.Context, kbId int64, texts []string) (unique []string, err error) {
+	seen := make(map[string]bool, len(texts))
+	var hashes []string
+	for _, t := range texts {
+		hash := embedhash.Hash(openai.AdaEmbeddingV2.String(), t)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		hashes = append(hashes, hash)
+		unique = append(unique, t)
+	}
+	if len(hashes) == 0 {
+		return
+	}
+	exists, err := cs.cd.DocHashListGet(ctx, kbId, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if len(exists) != 0 {
+		existSet := make(map[string]bool, len(exists))
+		for _, h := range exists {
+			existSet[h] = true
+		}
+		filtered := unique[:0]
+		for i, t := range unique {
+			if !existSet[hashes[i]] {
+				filtered = append(filtered, t)
+			}
+		}
+		unique = filtered
+	}
+	if skipped := len(texts) - len(unique); skipped > 0 {
+		if err := cs.rc.HIncrBy(ctx, consts.EmbeddingStatKey, "dedup", int64(skipped)).Err(); err != nil {
+			logger.Errorf("记录Embedding去重统计失败:%v", err)
+		}
+	}
+	return
+}
+
+// embeddingPendingFilter 返回仍未获取到向量的内容哈希
+func (cs *chatService) embeddingPendingFilter(embedVectors []openai.Embedding, pending map[string][]int, hashes []string) []string {
+	var remain []string
+	for _, hash := range hashes {
+		if embedVectors[pending[hash][0]].Embedding == nil {
+			remain = append(remain, hash)
+		}
+	}
+	return remain
+}
+
+func (cs *chatService) embeddingRedisSave(ctx context.Context, hash string, vec []float32) {
+	if err := cs.rc.Set(ctx, consts.EmbeddingCachePrefix+hash, embedhash.Encode(vec), 7*24*time.Hour).Err(); err != nil {
+		logger.Errorf("写入Embedding缓存失败:%v", err)
+	}
+}
+
+func (cs *chatService) ChatEmbeddingSave(ctx context.Context, kbId int64, title, body, classify string, page int, embeddata openai.Embedding) error {
 	docs := entity.Documents{}
 	docs.Id = cs.iSrv.GenSnowID()
+	docs.KbId = kbId
 	docs.Title = title
 	docs.Classify = classify
+	docs.Page = page
 	// docs.Subsection = sub
 	docs.Body = body
 	docs.Tokens = tiktoken.NumTokensSingleString(body)
+	docs.ContentHash = embedhash.Hash(openai.AdaEmbeddingV2.String(), body)
 	docs.Embedding = pgvector.NewVector(embeddata.Embedding)
 	return cs.cd.DocEmbeddingSave(ctx, &docs)
 }
 
-func (cs *chatService) ChatEmbeddingCompare(ctx context.Context, question, classify string) (contextStr string, err error) {
+func (cs *chatService) ChatEmbeddingCompare(ctx context.Context, userId int64, question, classify string) (contextStr string, citations []model.Citation, err error) {
 	//获取question Embedding信息
-	embedvectors, err := cs.ChatEmbeddingGenerate([]string{question})
+	embedvectors, err := cs.ChatEmbeddingGenerate(ctx, []string{question})
 	if err != nil {
 		return
 	}
-	textbody, err := cs.cd.ChatEmbeddingCompare(ctx, pgvector.NewVector(embedvectors[0].Embedding), classify)
-	if len(textbody) != 0 {
-		for _, v := range textbody {
-			contextStr += v.Body
-			logger.Debugf(v.Body)
-		}
+	//检索范围限定为会话所有者可读的知识库
+	kbIds, err := cs.kSrv.KbReadableIds(ctx, userId)
+	if err != nil {
+		return
+	}
+	rcfg := config.AppConfig.RerankConfig
+	queryVec := embedvectors[0].Embedding
+	textbody, err := cs.cd.ChatEmbeddingCompare(ctx, pgvector.NewVector(queryVec), classify, kbIds, rerank.Candidates(rcfg))
+	if err != nil || len(textbody) == 0 {
 		return
 	}
+	docs := make([]rerank.Document, 0, len(textbody))
+	for _, v := range textbody {
+		docs = append(docs, rerank.Document{
+			Id:        v.Id,
+			Title:     v.Title,
+			Body:      v.Body,
+			Tokens:    v.Tokens,
+			Embedding: v.Embedding.Slice(),
+			Score:     1 - v.Distance,
+		})
+	}
+	// 重排失败时退回向量距离排序
+	reranked, rerr := cs.rr.Rerank(ctx, question, queryVec, docs)
+	if rerr != nil {
+		logger.Warnf("知识库召回重排失败:%v", rerr)
+	} else {
+		docs = reranked
+	}
+	pages := make(map[int64]int, len(textbody))
+	for _, v := range textbody {
+		pages[v.Id] = v.Page
+	}
+	for i, v := range rerank.Select(rcfg, docs) {
+		contextStr += fmt.Sprintf("[%d] ", i+1) + v.Body + "\n"
+		citations = append(citations, model.Citation{
+			Source:  "kb",
+			DocId:   strconv.FormatInt(v.Id, 10),
+			Title:   v.Title,
+			Page:    pages[v.Id],
+			Snippet: citationSnippet(v.Body),
+		})
+		logger.Debugf(v.Body)
+	}
 	return
 }
 
-func (cs *chatService) ChatSearchExtension(ctx *gin.Context, question string) (result string) {
+// chatRetrievalQuery 按预设的检索策略生成向量检索语句，改写失败时回退为关键词提取
+func (cs *chatService) chatRetrievalQuery(ctx context.Context, strategy string, records []model.RecordOne, lastquestion string) string {
+	var history []openai.ChatCompletionMessage
+	var userHistory string
+	for _, v := range records {
+		history = append(history, openai.ChatCompletionMessage{Role: v.Sender, Content: v.Message})
+		if v.Sender == openai.ChatMessageRoleUser {
+			userHistory += v.Message
+		}
+	}
+	if len(history) != 0 {
+		switch strategy {
+		case rewrite.StrategyRewrite:
+			query, err := rewrite.Rewrite(ctx, history, lastquestion)
+			if err == nil && query != "" {
+				logger.Debugf("检索问题改写: %s -> %s", lastquestion, query)
+				return query
+			}
+			logger.Warnf("检索问题改写失败，回退关键词提取: %v", err)
+		case rewrite.StrategyHyde:
+			query, err := rewrite.Hyde(ctx, history, lastquestion)
+			if err == nil {
+				return query
+			}
+			logger.Warnf("HyDE生成失败，回退关键词提取: %v", err)
+		}
+	}
+	//将用户问题进行关键词提取
+	return cs.jieba.GetKeyword(userHistory+lastquestion) + lastquestion
+}
+
+// chatCitationsGet 获取本次回答引用的来源，没有引用时返回空列表
+func chatCitationsGet(ctx *gin.Context) []model.Citation {
+	if citations, ok := ctx.Value(consts.CitationCtx).([]model.Citation); ok && citations != nil {
+		return citations
+	}
+	return []model.Citation{}
+}
+
+// citationSnippet 截取引用片段的开头部分用于展示
+func citationSnippet(body string) string {
+	runes := []rune(strings.TrimSpace(body))
+	if len(runes) > 120 {
+		return string(runes[:120]) + "..."
+	}
+	return string(runes)
+}
+
+func (cs *chatService) ChatSearchExtension(ctx *gin.Context, records []model.RecordOne, question, providers string) (result string, citations []model.Citation) {
 	chatId := ctx.GetInt64(consts.ChatID)
 
-	result, err := search.CustomSearch(ctx, question)
+	var history []openai.ChatCompletionMessage
+	for _, v := range records {
+		history = append(history, openai.ChatCompletionMessage{Role: v.Sender, Content: v.Message})
+	}
+	searcher := search.NewSearcherByName(providers)
+	searcher.SetDetector(cs.ner)
+	searcher.SetPlanner(cs.plan)
+	searcher.SetCache(cs.sc)
+	searcher.SetProgress(func(ev search.Progress) {
+		chatProgressSend(ctx, ev)
+	})
+	res, err := searcher.CustomSearch(ctx, question, history)
 	if err != nil {
 		logger.Warnf("搜索异常:%v", err.Error())
 		return
 	}
-	if result == "" {
-		result, err = cs.rc.Get(ctx, consts.ChatSearchPrefix+strconv.FormatInt(chatId, 10)).Result()
-		if err == nil {
-			return
-		} else {
+	if res.Context == "" {
+		cached, err := cs.rc.Get(ctx, consts.ChatSearchPrefix+strconv.FormatInt(chatId, 10)).Bytes()
+		if err != nil {
 			if err != redis.Nil {
 				logger.Errorf("Redis连接异常:%v", err.Error())
 				return
@@ -698,14 +1007,33 @@ func (cs *chatService) ChatSearchExtension(ctx *gin.Context, question string) (r
 			logger.Debugf(" 缓存不存在:%v", err.Error())
 			return
 		}
-
+		if err = json.Unmarshal(cached, &res); err != nil {
+			// 兼容旧版本缓存的纯文本搜索结果
+			return string(cached), nil
+		}
+	} else {
+		// 追问无需搜索时复用本会话上一次的搜索结果
+		chatTTL := time.Duration(config.AppConfig.SearchConfig.ChatTTL) * time.Minute
+		if chatTTL <= 0 {
+			chatTTL = time.Hour
+		}
+		data, err := json.Marshal(res)
+		if err == nil {
+			err = cs.rc.Set(ctx, consts.ChatSearchPrefix+strconv.FormatInt(chatId, 10), data, chatTTL).Err()
+		}
+		if err != nil {
+			logger.Errorf("Redis连接异常:%v", err.Error())
+		}
 	}
-	// err = cs.rc.Set(ctx, consts.ChatSearchPrefix+security.Md5(question), result, 30*time.Minute).Err()
-	err = cs.rc.Set(ctx, consts.ChatSearchPrefix+strconv.FormatInt(chatId, 10), result, 0).Err()
-	if err != nil {
-		logger.Errorf("Redis连接异常:%v", err.Error())
+	result = res.Context
+	for _, v := range res.Sources {
+		citations = append(citations, model.Citation{
+			Source:  "web",
+			Title:   v.Title,
+			URL:     v.Link,
+			Snippet: v.Snippet,
+		})
 	}
-
 	return
 }
 
@@ -0,0 +1,333 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-27 10:12:46
+ * @LastEditTime: 2023-06-27 10:12:46
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/chat_test.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/openai"
+	"chatserver-api/pkg/usage"
+	"chatserver-api/utils/uuid"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// fakeChatDao 仅实现测试用到的方法，其余方法调用时 panic
+type fakeChatDao struct {
+	dao.ChatDao
+	records []model.RecordOne
+	saved   []entity.Record
+}
+
+func (f *fakeChatDao) ChatRecordIdGet(ctx context.Context, chatId int64) ([]int64, error) {
+	return nil, nil
+}
+
+func (f *fakeChatDao) ChatRecordSave(ctx context.Context, record *entity.Record) error {
+	f.saved = append(f.saved, *record)
+	return nil
+}
+
+func (f *fakeChatDao) ChatRecordGet(ctx context.Context, chatId int64, memory int16) ([]model.RecordOne, error) {
+	return f.records, nil
+}
+
+// fakeUserService 记录余额变动
+type fakeUserService struct {
+	UserService
+	amount  float64
+	comment string
+}
+
+func (f *fakeUserService) UserBalanceChange(ctx context.Context, userId int64, amount float64, comment string) error {
+	f.amount = amount
+	f.comment = comment
+	return nil
+}
+
+// fakeReportService 记录报表统计
+type fakeReportService struct {
+	ReportService
+	usages []entity.ReportUsageDaily
+}
+
+func (f *fakeReportService) ReportUsageAdd(ctx *gin.Context, source string, tokens int, charge float64) {
+	f.usages = append(f.usages, entity.ReportUsageDaily{Source: source, Tokens: int64(tokens), Charge: charge})
+}
+
+func (f *fakeReportService) ReportUsageAuxAdd(ctx *gin.Context, records []usage.Record) {
+	for _, r := range records {
+		f.usages = append(f.usages, entity.ReportUsageDaily{Source: r.Source, Model: r.Model, Tokens: int64(r.Tokens)})
+	}
+}
+
+// sseRecorder 为 httptest.ResponseRecorder 补充 gin 流式输出所需的 CloseNotify
+type sseRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (sseRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+// testRedisClient 返回一个无法连接的客户端，服务在 Redis 异常时应回退到数据库
+func testRedisClient() *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 50 * time.Millisecond, MaxRetries: -1})
+}
+
+func testChatContext() (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(sseRecorder{w})
+	ctx.Request = httptest.NewRequest("GET", "/", nil)
+	ctx.Set(consts.ChatID, int64(1001))
+	return ctx, w
+}
+
+var testCitations = []model.Citation{
+	{Source: "kb", DocId: "42", Title: "用户手册", Page: 3, Snippet: "第三页内容"},
+	{Source: "web", Title: "官网", URL: "https://example.com", Snippet: "网页摘要"},
+}
+
+func Test_chatService_ChatMessageSave(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	tests := []struct {
+		name      string
+		role      string
+		citations []model.Citation
+		want      string
+	}{
+		{
+			name:      "assistant with citations",
+			role:      openai.ChatMessageRoleAssistant,
+			citations: testCitations,
+			want:      mustJSON(t, testCitations),
+		},
+		{
+			name: "assistant without citations",
+			role: openai.ChatMessageRoleAssistant,
+			want: "[]",
+		},
+		{
+			name:      "user message",
+			role:      openai.ChatMessageRoleUser,
+			citations: testCitations,
+			want:      "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cd := &fakeChatDao{}
+			cs := &chatService{cd: cd, rc: testRedisClient()}
+			ctx, _ := testChatContext()
+			if tt.citations != nil {
+				ctx.Set(consts.CitationCtx, tt.citations)
+			}
+			if err := cs.ChatMessageSave(ctx, tt.role, "回答内容", 2001); err != nil {
+				t.Fatalf("ChatMessageSave() error = %v", err)
+			}
+			if len(cd.saved) != 1 {
+				t.Fatalf("ChatMessageSave() saved %d records, want 1", len(cd.saved))
+			}
+			if got := string(cd.saved[0].Citations); got != tt.want {
+				t.Errorf("ChatMessageSave() citations = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_chatService_ChatRecordGet(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	tests := []struct {
+		name    string
+		records []model.RecordOne
+		want    [][]model.Citation
+	}{
+		{
+			name: "stored citations",
+			records: []model.RecordOne{
+				{Id: 1, Sender: openai.ChatMessageRoleUser, Message: "问题"},
+				{Id: 2, Sender: openai.ChatMessageRoleAssistant, Message: "回答", Citations: []byte(mustJSON(t, testCitations))},
+			},
+			want: [][]model.Citation{nil, testCitations},
+		},
+		{
+			name: "empty and malformed citations",
+			records: []model.RecordOne{
+				{Id: 3, Sender: openai.ChatMessageRoleAssistant, Message: "回答", Citations: []byte("[]")},
+				{Id: 4, Sender: openai.ChatMessageRoleAssistant, Message: "回答", Citations: []byte("{")},
+			},
+			want: [][]model.Citation{{}, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := &chatService{cd: &fakeChatDao{records: tt.records}, rc: testRedisClient()}
+			ctx, _ := testChatContext()
+			res, err := cs.ChatRecordGet(ctx)
+			if err != nil {
+				t.Fatalf("ChatRecordGet() error = %v", err)
+			}
+			if len(res.Records) != len(tt.want) {
+				t.Fatalf("ChatRecordGet() got %d records, want %d", len(res.Records), len(tt.want))
+			}
+			for i, r := range res.Records {
+				if len(r.Citations) == 0 && len(tt.want[i]) == 0 {
+					continue
+				}
+				if !reflect.DeepEqual(r.Citations, tt.want[i]) {
+					t.Errorf("ChatRecordGet() record %d citations = %v, want %v", i, r.Citations, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_chatService_ChatStreamResProcess(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	tests := []struct {
+		name      string
+		citations []model.Citation
+		want      []model.Citation
+	}{
+		{
+			name:      "final event carries citations",
+			citations: testCitations,
+			want:      testCitations,
+		},
+		{
+			name: "final event without citations",
+			want: []model.Citation{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := &chatService{iSrv: *uuid.NewNode(1)}
+			ctx, w := testChatContext()
+			if tt.citations != nil {
+				ctx.Set(consts.CitationCtx, tt.citations)
+			}
+			stream := make(chan string, 2)
+			stream <- "你好"
+			stream <- "，世界"
+			close(stream)
+			_, messages := cs.ChatStreamResProcess(ctx, stream, 1, 2)
+			if messages != "你好，世界" {
+				t.Errorf("ChatStreamResProcess() messages = %s", messages)
+			}
+			var final struct {
+				Text      string           `json:"text"`
+				Citations []model.Citation `json:"citations"`
+			}
+			events := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+			last := events[len(events)-1]
+			data := last[strings.Index(last, "data:")+len("data:"):]
+			if err := json.Unmarshal([]byte(data), &final); err != nil {
+				t.Fatalf("final event %q is not json: %v", data, err)
+			}
+			if final.Text != messages {
+				t.Errorf("final event text = %s, want %s", final.Text, messages)
+			}
+			if !reflect.DeepEqual(final.Citations, tt.want) {
+				t.Errorf("final event citations = %v, want %v", final.Citations, tt.want)
+			}
+		})
+	}
+}
+
+func Test_chatService_ChatBalanceUpdate(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	tests := []struct {
+		name       string
+		token      int
+		ratio      int
+		aux        []usage.Record
+		wantCost   float64
+		wantCharge float64
+	}{
+		{
+			name:       "completion only",
+			token:      1000,
+			ratio:      1,
+			wantCost:   1000 * consts.TokenPrice,
+			wantCharge: 1000 * consts.TokenPrice,
+		},
+		{
+			name:  "rewrite and planner billed at base price",
+			token: 1000,
+			ratio: 5,
+			aux: []usage.Record{
+				{Source: usage.SourceRewrite, Model: "gpt-3.5-turbo", Tokens: 200},
+				{Source: usage.SourcePlanner, Model: "gpt-3.5-turbo", Tokens: 100},
+			},
+			wantCost:   1000*5*consts.TokenPrice + 300*consts.TokenPrice,
+			wantCharge: 1000 * 5 * consts.TokenPrice,
+		},
+		{
+			name:  "rerank and summary billed at base price",
+			token: 1000,
+			ratio: 1,
+			aux: []usage.Record{
+				{Source: usage.SourceRerank, Model: "gpt-3.5-turbo", Tokens: 150},
+				{Source: usage.SourceSummary, Model: "gpt-3.5-turbo", Tokens: 400},
+				{Source: usage.SourceSummary, Model: "gpt-3.5-turbo", Tokens: 350},
+			},
+			wantCost:   1000*consts.TokenPrice + 900*consts.TokenPrice,
+			wantCharge: 1000 * consts.TokenPrice,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			us := &fakeUserService{}
+			rs := &fakeReportService{}
+			cs := &chatService{uSrv: us, rSrv: rs}
+			ctx, _ := testChatContext()
+			ctx.Set(consts.CostTokenCtx, tt.token)
+			ctx.Set(consts.PriceRatioCtx, tt.ratio)
+			m := &usage.Meter{}
+			ctx.Set(usage.MeterCtx, m)
+			for _, r := range tt.aux {
+				usage.Add(ctx, r.Source, r.Model, openai.Usage{TotalTokens: r.Tokens})
+			}
+			if err := cs.ChatBalanceUpdate(ctx); err != nil {
+				t.Fatalf("ChatBalanceUpdate() error = %v", err)
+			}
+			if math.Abs(-us.amount-tt.wantCost) > 1e-9 {
+				t.Errorf("ChatBalanceUpdate() charged %v, want %v", -us.amount, tt.wantCost)
+			}
+			if len(rs.usages) == 0 || rs.usages[0].Source != consts.ReportSourceChat || math.Abs(rs.usages[0].Charge-tt.wantCharge) > 1e-9 {
+				t.Errorf("ChatBalanceUpdate() chat report = %+v, want charge %v", rs.usages, tt.wantCharge)
+			}
+			if len(rs.usages) != 1+len(tt.aux) {
+				t.Errorf("ChatBalanceUpdate() reports = %+v, want aux calls reported by source", rs.usages)
+			}
+		})
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,208 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 14:32:48
+ * @LastEditTime: 2023-06-24 14:32:48
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/gateway.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/model"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/openai"
+	"chatserver-api/pkg/tiktoken"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var _ GatewayService = (*gatewayService)(nil)
+
+var (
+	ErrGatewayModel   = errors.New("模型不存在")
+	ErrGatewayContext = errors.New("请求超出模型最大长度")
+	ErrGatewayBalance = errors.New("用户余额不足")
+	ErrGatewayParam   = errors.New("请求参数错误")
+	ErrGatewayFlagged = errors.New("请求内容未通过审核")
+)
+
+// gatewayModerate 审核对话输入，返回是否命中
+var gatewayModerate = func(input string) (bool, error) {
+	client, err := openai.NewClient()
+	if err != nil {
+		return false, err
+	}
+	res, err := client.Moderations(openai.ModerationRequest{Input: input})
+	if err != nil {
+		return false, err
+	}
+	for _, r := range res.Results {
+		if r.Flagged {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GatewayService OpenAI 兼容接口，计费与会话接口一致：按令牌数 * TokenPrice 扣费，消费记录关联调用的 API Key
+type GatewayService interface {
+	GatewayModels() model.GatewayModelsRes
+	GatewayChatVerify(ctx *gin.Context, req *openai.ChatCompletionRequest) (promptTokens int, err error)
+	GatewayChat(ctx *gin.Context, req openai.ChatCompletionRequest) (res openai.ChatCompletionResponse, err error)
+	GatewayChatStream(ctx *gin.Context, req openai.ChatCompletionRequest) (stream *openai.ChatCompletionStream, err error)
+	GatewayEmbeddingVerify(ctx *gin.Context, modelName string, input []string) (tokens int, err error)
+	GatewayEmbeddings(ctx *gin.Context, input []string) (res openai.EmbeddingResponse, err error)
+	GatewayBill(ctx *gin.Context, tokens int) error
+}
+
+type gatewayService struct {
+	uSrv UserService
+	cSrv ChatService
+	rSrv ReportService
+}
+
+func NewGatewayService(_uSrv UserService, _cSrv ChatService, _rSrv ReportService) *gatewayService {
+	return &gatewayService{
+		uSrv: _uSrv,
+		cSrv: _cSrv,
+		rSrv: _rSrv,
+	}
+}
+
+// GatewayModels 返回可用的对话模型和向量模型
+func (gs *gatewayService) GatewayModels() (res model.GatewayModelsRes) {
+	res.Object = "list"
+	names := make([]string, 0, len(consts.ModelMaxToken)+1)
+	for name := range consts.ModelMaxToken {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	names = append(names, openai.AdaEmbeddingV2.String())
+	created := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC).Unix()
+	for _, name := range names {
+		res.Data = append(res.Data, openai.Model{
+			ID:         name,
+			Object:     "model",
+			OwnedBy:    "chatserver",
+			CreatedAt:  created,
+			Root:       name,
+			Permission: []openai.Permission{},
+		})
+	}
+	return
+}
+
+// GatewayChatVerify 校验模型、请求长度、余额和输入内容，返回提示词令牌数
+// 未指定 max_tokens 时回复最多可用满模型剩余长度，按此预估费用
+func (gs *gatewayService) GatewayChatVerify(ctx *gin.Context, req *openai.ChatCompletionRequest) (promptTokens int, err error) {
+	maxToken, ok := consts.ModelMaxToken[req.Model]
+	if !ok {
+		return 0, ErrGatewayModel
+	}
+	if len(req.Messages) == 0 || req.N > 1 || req.MaxTokens < 0 {
+		return 0, ErrGatewayParam
+	}
+	ctx.Set(consts.ModelCtx, req.Model)
+	promptTokens = tiktoken.NumTokensFromMessages(req.Messages, req.Model)
+	completionTokens := req.MaxTokens
+	if completionTokens == 0 {
+		completionTokens = maxToken - promptTokens
+	}
+	if promptTokens >= maxToken || promptTokens+completionTokens > maxToken {
+		return 0, ErrGatewayContext
+	}
+	if err = gs.gatewayBalanceVerify(ctx, promptTokens+completionTokens); err != nil {
+		return 0, err
+	}
+	if config.AppConfig.GatewayConfig.Moderation {
+		input := make([]string, 0, len(req.Messages))
+		for _, m := range req.Messages {
+			input = append(input, m.Content)
+		}
+		flagged, err := gatewayModerate(strings.Join(input, "\n"))
+		if err != nil {
+			return 0, err
+		}
+		if flagged {
+			return 0, ErrGatewayFlagged
+		}
+	}
+	return promptTokens, nil
+}
+
+func (gs *gatewayService) GatewayChat(ctx *gin.Context, req openai.ChatCompletionRequest) (res openai.ChatCompletionResponse, err error) {
+	client, err := openai.NewClient()
+	if err != nil {
+		return
+	}
+	req.Stream = false
+	return client.CreateChatCompletion(req)
+}
+
+func (gs *gatewayService) GatewayChatStream(ctx *gin.Context, req openai.ChatCompletionRequest) (stream *openai.ChatCompletionStream, err error) {
+	client, err := openai.NewClient()
+	if err != nil {
+		return
+	}
+	return client.CreateChatCompletionStream(req)
+}
+
+// GatewayEmbeddingVerify 校验向量模型和余额，返回输入令牌数
+func (gs *gatewayService) GatewayEmbeddingVerify(ctx *gin.Context, modelName string, input []string) (tokens int, err error) {
+	if modelName != openai.AdaEmbeddingV2.String() {
+		return 0, ErrGatewayModel
+	}
+	ctx.Set(consts.ModelCtx, modelName)
+	if len(input) == 0 {
+		return 0, ErrGatewayParam
+	}
+	for _, s := range input {
+		if s == "" {
+			return 0, ErrGatewayParam
+		}
+		tokens += tiktoken.NumTokensSingleString(s)
+	}
+	return tokens, gs.gatewayBalanceVerify(ctx, tokens)
+}
+
+// GatewayEmbeddings 生成文本向量，与知识库共用向量缓存
+func (gs *gatewayService) GatewayEmbeddings(ctx *gin.Context, input []string) (res openai.EmbeddingResponse, err error) {
+	res.Data, err = gs.cSrv.ChatEmbeddingGenerate(ctx, input)
+	if err != nil {
+		return
+	}
+	res.Object = "list"
+	res.Model = openai.AdaEmbeddingV2
+	return
+}
+
+// GatewayBill 按实际令牌数扣费
+func (gs *gatewayService) GatewayBill(ctx *gin.Context, tokens int) error {
+	userId := ctx.GetInt64(consts.UserID)
+	cost := float64(tokens) * consts.TokenPrice
+	comment := fmt.Sprintf("消费-API调用消耗令牌数:%d", tokens)
+	if err := gs.uSrv.UserBalanceChange(ctx, userId, -cost, comment); err != nil {
+		return err
+	}
+	gs.rSrv.ReportUsageAdd(ctx, consts.ReportSourceApi, tokens, cost)
+	return nil
+}
+
+func (gs *gatewayService) gatewayBalanceVerify(ctx *gin.Context, preToken int) error {
+	userId := ctx.GetInt64(consts.UserID)
+	balance, err := gs.uSrv.UserGetBalance(ctx, userId)
+	if err != nil {
+		return err
+	}
+	ctx.Set(consts.BalanceCtx, balance)
+	if balance < float64(preToken)*consts.TokenPrice {
+		return ErrGatewayBalance
+	}
+	return nil
+}
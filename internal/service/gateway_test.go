@@ -0,0 +1,78 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-29 15:20:09
+ * @LastEditTime: 2023-06-29 15:20:09
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/gateway_test.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/openai"
+	"chatserver-api/pkg/tiktoken"
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeGatewayUserService 只提供余额查询
+type fakeGatewayUserService struct {
+	UserService
+	balance float64
+}
+
+func (f *fakeGatewayUserService) UserGetBalance(ctx context.Context, userId int64) (float64, error) {
+	return f.balance, nil
+}
+
+func Test_gatewayService_GatewayChatVerify(t *testing.T) {
+	old, oldModerate := config.AppConfig, gatewayModerate
+	defer func() { config.AppConfig, gatewayModerate = old, oldModerate }()
+	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "你好"}}
+	promptTokens := tiktoken.NumTokensFromMessages(messages, "gpt-3.5-turbo")
+	maxToken := consts.ModelMaxToken["gpt-3.5-turbo"]
+	full := float64(maxToken) * consts.TokenPrice
+	tests := []struct {
+		name       string
+		maxTokens  int
+		balance    float64
+		moderation bool
+		flagged    bool
+		wantErr    error
+	}{
+		{"max tokens set", 100, float64(promptTokens+100) * consts.TokenPrice, false, false, nil},
+		{"max tokens unset estimates remaining context", 0, float64(promptTokens+100) * consts.TokenPrice, false, false, ErrGatewayBalance},
+		{"max tokens unset with enough balance", 0, full, false, false, nil},
+		{"max tokens over context", maxToken, full, false, false, ErrGatewayContext},
+		{"negative max tokens", -1, full, false, false, ErrGatewayParam},
+		{"moderation passed", 100, full, true, false, nil},
+		{"moderation flagged", 100, full, true, true, ErrGatewayFlagged},
+		{"moderation disabled", 100, full, false, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfig = &config.Config{GatewayConfig: config.GatewayConfig{Moderation: tt.moderation}}
+			moderated := false
+			gatewayModerate = func(input string) (bool, error) {
+				moderated = true
+				return tt.flagged, nil
+			}
+			gs := &gatewayService{uSrv: &fakeGatewayUserService{balance: tt.balance}}
+			ctx, _ := testChatContext()
+			req := openai.ChatCompletionRequest{Model: "gpt-3.5-turbo", Messages: messages, MaxTokens: tt.maxTokens}
+			got, err := gs.GatewayChatVerify(ctx, &req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GatewayChatVerify() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != promptTokens {
+				t.Errorf("GatewayChatVerify() = %d, want %d", got, promptTokens)
+			}
+			// 审核在长度和余额校验通过后进行
+			if want := tt.moderation && (err == nil || err == ErrGatewayFlagged); moderated != want {
+				t.Errorf("moderation called = %v, want %v", moderated, want)
+			}
+		})
+	}
+}
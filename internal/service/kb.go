@@ -0,0 +1,448 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-14 13:48:09
+ * @LastEditTime: 2023-06-14 17:32:10
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/kb.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/utils/uuid"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+var _ KbService = (*kbService)(nil)
+
+type KbService interface {
+	KbCreateNew(ctx *gin.Context, req model.KbCreateNewReq) (res model.KbCreateNewRes, err error)
+	KbUpdate(ctx *gin.Context, req model.KbUpdateReq) error
+	KbDelete(ctx *gin.Context, kbId int64) error
+	KbListGet(ctx *gin.Context) (res model.KbListRes, err error)
+	KbMemberSave(ctx *gin.Context, req model.KbMemberReq) error
+	KbMemberDelete(ctx *gin.Context, req model.KbMemberReq) error
+	KbSubscribe(ctx *gin.Context, kbId int64) error
+	KbUsageGet(ctx *gin.Context) (res model.KbUsageRes, err error)
+	KbPermissionGet(ctx context.Context, userId, kbId int64) (perm int, err error)
+	KbQuotaAcquire(ctx context.Context, kbId int64, tokens int) (release func(), err error)
+	KbReadableIds(ctx context.Context, userId int64) ([]int64, error)
+	TeamCreateNew(ctx *gin.Context, req model.TeamCreateNewReq) (res model.TeamCreateNewRes, err error)
+	TeamListGet(ctx *gin.Context) (res model.TeamListRes, err error)
+	TeamMemberAdd(ctx *gin.Context, req model.TeamMemberReq) error
+	TeamMemberDelete(ctx *gin.Context, req model.TeamMemberReq) error
+}
+
+// kbService 实现KbService接口
+type kbService struct {
+	kd   dao.KbDao
+	ud   dao.UserDao
+	iSrv uuid.SnowNode
+	rc   *redis.Client
+}
+
+func NewKbService(_kd dao.KbDao, _ud dao.UserDao) *kbService {
+	return &kbService{
+		kd:   _kd,
+		ud:   _ud,
+		iSrv: *uuid.NewNode(6),
+		rc:   cache.GetRedisClient(),
+	}
+}
+
+func (ks *kbService) KbCreateNew(ctx *gin.Context, req model.KbCreateNewReq) (res model.KbCreateNewRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	kb := entity.KnowledgeBase{}
+	kb.Id = ks.iSrv.GenSnowID()
+	kb.KbName = req.KbName
+	kb.Description = req.Description
+	kb.Visibility = req.Visibility
+	if kb.Visibility < consts.KbPrivate || kb.Visibility > consts.KbPublic {
+		kb.Visibility = consts.KbPrivate
+	}
+	kb.OwnerType = consts.KbOwnerUser
+	kb.OwnerId = userId
+	if req.TeamId != "" {
+		teamId, err := strconv.ParseInt(req.TeamId, 10, 64)
+		if err != nil {
+			return res, err
+		}
+		isMember, err := ks.kd.TeamMemberIs(ctx, teamId, userId)
+		if err != nil {
+			return res, err
+		}
+		if !isMember {
+			return res, errors.New("不是该团队成员")
+		}
+		kb.OwnerType = consts.KbOwnerTeam
+		kb.OwnerId = teamId
+	}
+	err = ks.kd.KbCreateNew(ctx, &kb)
+	if err != nil {
+		return
+	}
+	res.KbId = strconv.FormatInt(kb.Id, 10)
+	return
+}
+
+func (ks *kbService) KbUpdate(ctx *gin.Context, req model.KbUpdateReq) error {
+	kbId, err := strconv.ParseInt(req.KbId, 10, 64)
+	if err != nil {
+		return err
+	}
+	if err = ks.kbPermissionVerify(ctx, kbId, consts.KbPermManage); err != nil {
+		return err
+	}
+	kb := entity.KnowledgeBase{}
+	kb.Id = kbId
+	kb.KbName = req.KbName
+	kb.Description = req.Description
+	if req.Visibility >= consts.KbPrivate && req.Visibility <= consts.KbPublic {
+		kb.Visibility = req.Visibility
+	}
+	return ks.kd.KbUpdate(ctx, &kb)
+}
+
+func (ks *kbService) KbDelete(ctx *gin.Context, kbId int64) error {
+	if err := ks.kbPermissionVerify(ctx, kbId, consts.KbPermManage); err != nil {
+		return err
+	}
+	return ks.kd.KbDelete(ctx, kbId)
+}
+
+func (ks *kbService) KbListGet(ctx *gin.Context) (res model.KbListRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	kblist, err := ks.kd.KbListGet(ctx, userId)
+	if err != nil {
+		return
+	}
+	var kbOne model.KbOneRes
+	var kbListRes []model.KbOneRes
+	for _, v := range kblist {
+		kbOne.KbId = strconv.FormatInt(v.KbId, 10)
+		kbOne.KbName = v.KbName
+		kbOne.Description = v.Description
+		kbOne.OwnerType = v.OwnerType
+		kbOne.Visibility = v.Visibility
+		kbOne.Permission, err = ks.KbPermissionGet(ctx, userId, v.KbId)
+		if err != nil {
+			return
+		}
+		kbOne.CreatedAt = v.CreatedAt
+		kbListRes = append(kbListRes, kbOne)
+	}
+	res.KbList = kbListRes
+	return
+}
+
+// KbMemberSave 将知识库共享给指定用户，私有知识库需先修改为共享或公开
+func (ks *kbService) KbMemberSave(ctx *gin.Context, req model.KbMemberReq) error {
+	kbId, err := strconv.ParseInt(req.KbId, 10, 64)
+	if err != nil {
+		return err
+	}
+	if err = ks.kbPermissionVerify(ctx, kbId, consts.KbPermManage); err != nil {
+		return err
+	}
+	kb, err := ks.kd.KbGet(ctx, kbId)
+	if err != nil {
+		return err
+	}
+	if kb.Visibility == consts.KbPrivate {
+		return errors.New("私有知识库不能共享")
+	}
+	user, err := ks.ud.UserGetByName(ctx, req.UserName)
+	if err != nil {
+		return err
+	}
+	if user.Id == 0 {
+		return errors.New("用户不存在")
+	}
+	member := entity.KbMember{}
+	member.Id = ks.iSrv.GenSnowID()
+	member.KbId = kbId
+	member.UserId = user.Id
+	member.Permission = consts.KbPermRead
+	if req.Permission == consts.KbPermWrite {
+		member.Permission = consts.KbPermWrite
+	}
+	return ks.kd.KbMemberSave(ctx, &member)
+}
+
+func (ks *kbService) KbMemberDelete(ctx *gin.Context, req model.KbMemberReq) error {
+	kbId, err := strconv.ParseInt(req.KbId, 10, 64)
+	if err != nil {
+		return err
+	}
+	user, err := ks.ud.UserGetByName(ctx, req.UserName)
+	if err != nil {
+		return err
+	}
+	// 成员可以自行退出共享
+	if user.Id != ctx.GetInt64(consts.UserID) {
+		if err = ks.kbPermissionVerify(ctx, kbId, consts.KbPermManage); err != nil {
+			return err
+		}
+	}
+	return ks.kd.KbMemberDelete(ctx, kbId, user.Id)
+}
+
+// KbSubscribe 订阅公开知识库，订阅后参与该用户会话的检索
+func (ks *kbService) KbSubscribe(ctx *gin.Context, kbId int64) error {
+	userId := ctx.GetInt64(consts.UserID)
+	kb, err := ks.kd.KbGet(ctx, kbId)
+	if err != nil {
+		return err
+	}
+	if kb.Visibility != consts.KbPublic {
+		return errors.New("知识库未公开")
+	}
+	perm, err := ks.KbPermissionGet(ctx, userId, kbId)
+	if err != nil || perm > consts.KbPermRead {
+		return err
+	}
+	member := entity.KbMember{}
+	member.Id = ks.iSrv.GenSnowID()
+	member.KbId = kbId
+	member.UserId = userId
+	member.Permission = consts.KbPermRead
+	return ks.kd.KbMemberSave(ctx, &member)
+}
+
+func (ks *kbService) KbUsageGet(ctx *gin.Context) (res model.KbUsageRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	res.Used, err = ks.kd.KbTokenUsageByUser(ctx, userId)
+	if err != nil {
+		return
+	}
+	res.Quota, err = ks.kbQuotaGet(ctx, userId)
+	return
+}
+
+// KbPermissionGet 计算用户对知识库的权限
+func (ks *kbService) KbPermissionGet(ctx context.Context, userId, kbId int64) (perm int, err error) {
+	role, err := ks.ud.UserGetRole(ctx, userId)
+	if err != nil {
+		return
+	}
+	if role == consts.Administrator {
+		return consts.KbPermManage, nil
+	}
+	if kbId == consts.KbGlobalId {
+		return consts.KbPermRead, nil
+	}
+	kb, err := ks.kd.KbGet(ctx, kbId)
+	if err != nil {
+		return
+	}
+	switch kb.OwnerType {
+	case consts.KbOwnerUser:
+		if kb.OwnerId == userId {
+			return consts.KbPermManage, nil
+		}
+	case consts.KbOwnerTeam:
+		team, err := ks.kd.TeamGet(ctx, kb.OwnerId)
+		if err != nil {
+			return perm, err
+		}
+		if team.OwnerId == userId {
+			return consts.KbPermManage, nil
+		}
+		isMember, err := ks.kd.TeamMemberIs(ctx, kb.OwnerId, userId)
+		if err != nil {
+			return perm, err
+		}
+		if isMember {
+			return consts.KbPermWrite, nil
+		}
+	}
+	if kb.Visibility != consts.KbPrivate {
+		member, err := ks.kd.KbMemberGet(ctx, kbId, userId)
+		if err != nil {
+			return perm, err
+		}
+		perm = member.Permission
+	}
+	if perm == consts.KbPermNone && kb.Visibility == consts.KbPublic {
+		perm = consts.KbPermRead
+	}
+	return perm, nil
+}
+
+// kbQuotaLockTTL 写入锁的最长持有时间，覆盖一次批量写入生成向量的耗时
+const kbQuotaLockTTL = 10 * time.Minute
+
+// kbUnlockScript 仅在锁仍由自己持有时释放，避免锁过期后误删其他请求的锁
+var kbUnlockScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) end return 0`)
+
+// KbQuotaAcquire 校验写入tokens后是否超出配额所有者的存储配额，团队知识库计入团队所有者。
+// 通过时持有该所有者的写入锁，写入完成后调用 release 释放，同一所有者的并发写入不会同时通过校验
+func (ks *kbService) KbQuotaAcquire(ctx context.Context, kbId int64, tokens int) (release func(), err error) {
+	release = func() {}
+	if kbId == consts.KbGlobalId {
+		return
+	}
+	kb, err := ks.kd.KbGet(ctx, kbId)
+	if err != nil {
+		return
+	}
+	userId := kb.OwnerId
+	if kb.OwnerType == consts.KbOwnerTeam {
+		team, err := ks.kd.TeamGet(ctx, kb.OwnerId)
+		if err != nil {
+			return release, err
+		}
+		userId = team.OwnerId
+	}
+	quota, err := ks.kbQuotaGet(ctx, userId)
+	if err != nil || quota < 0 {
+		return
+	}
+	key := consts.KbQuotaLockPrefix + strconv.FormatInt(userId, 10)
+	token := strconv.FormatInt(ks.iSrv.GenSnowID(), 10)
+	locked, err := ks.rc.SetNX(ctx, key, token, kbQuotaLockTTL).Result()
+	if err != nil {
+		return
+	}
+	if !locked {
+		return release, errors.New("知识库正在写入，请稍后重试")
+	}
+	unlock := func() {
+		if err := kbUnlockScript.Run(context.Background(), ks.rc, []string{key}, token).Err(); err != nil {
+			logger.Errorf("知识库写入锁释放失败:%v", err.Error())
+		}
+	}
+	used, err := ks.kd.KbTokenUsageByUser(ctx, userId)
+	if err != nil {
+		unlock()
+		return
+	}
+	if used+int64(tokens) > quota {
+		unlock()
+		return release, errors.New("知识库存储空间不足")
+	}
+	return unlock, nil
+}
+
+// KbReadableIds 用户会话检索范围内的知识库，包含全局知识库
+func (ks *kbService) KbReadableIds(ctx context.Context, userId int64) ([]int64, error) {
+	ids, err := ks.kd.KbReadableIds(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return append(ids, consts.KbGlobalId), nil
+}
+
+func (ks *kbService) TeamCreateNew(ctx *gin.Context, req model.TeamCreateNewReq) (res model.TeamCreateNewRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	team := entity.Team{}
+	team.Id = ks.iSrv.GenSnowID()
+	team.TeamName = req.TeamName
+	team.OwnerId = userId
+	owner := entity.TeamMember{}
+	owner.Id = ks.iSrv.GenSnowID()
+	owner.TeamId = team.Id
+	owner.UserId = userId
+	err = ks.kd.TeamCreateNew(ctx, &team, &owner)
+	if err != nil {
+		return
+	}
+	res.TeamId = strconv.FormatInt(team.Id, 10)
+	return
+}
+
+func (ks *kbService) TeamListGet(ctx *gin.Context) (res model.TeamListRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	teams, err := ks.kd.TeamListGet(ctx, userId)
+	if err != nil {
+		return
+	}
+	var teamOne model.TeamOneRes
+	var teamListRes []model.TeamOneRes
+	for _, v := range teams {
+		teamOne.TeamId = strconv.FormatInt(v.Id, 10)
+		teamOne.TeamName = v.TeamName
+		teamOne.IsOwner = v.OwnerId == userId
+		teamListRes = append(teamListRes, teamOne)
+	}
+	res.TeamList = teamListRes
+	return
+}
+
+func (ks *kbService) TeamMemberAdd(ctx *gin.Context, req model.TeamMemberReq) error {
+	teamId, user, err := ks.teamMemberParse(ctx, req)
+	if err != nil {
+		return err
+	}
+	member := entity.TeamMember{}
+	member.Id = ks.iSrv.GenSnowID()
+	member.TeamId = teamId
+	member.UserId = user.Id
+	return ks.kd.TeamMemberAdd(ctx, &member)
+}
+
+func (ks *kbService) TeamMemberDelete(ctx *gin.Context, req model.TeamMemberReq) error {
+	teamId, user, err := ks.teamMemberParse(ctx, req)
+	if err != nil {
+		return err
+	}
+	return ks.kd.TeamMemberDelete(ctx, teamId, user.Id)
+}
+
+// teamMemberParse 解析团队成员请求，仅团队所有者可以管理成员，且所有者不能被移出
+func (ks *kbService) teamMemberParse(ctx *gin.Context, req model.TeamMemberReq) (teamId int64, user entity.User, err error) {
+	teamId, err = strconv.ParseInt(req.TeamId, 10, 64)
+	if err != nil {
+		return
+	}
+	team, err := ks.kd.TeamGet(ctx, teamId)
+	if err != nil {
+		return
+	}
+	if team.OwnerId != ctx.GetInt64(consts.UserID) {
+		err = errors.New("仅团队所有者可以管理成员")
+		return
+	}
+	user, err = ks.ud.UserGetByName(ctx, req.UserName)
+	if err != nil {
+		return
+	}
+	if user.Id == 0 || user.Id == team.OwnerId {
+		err = errors.New("用户不存在或为团队所有者")
+	}
+	return
+}
+
+func (ks *kbService) kbPermissionVerify(ctx *gin.Context, kbId int64, need int) error {
+	perm, err := ks.KbPermissionGet(ctx, ctx.GetInt64(consts.UserID), kbId)
+	if err != nil {
+		return err
+	}
+	if perm < need {
+		return errors.New("知识库权限不足")
+	}
+	return nil
+}
+
+func (ks *kbService) kbQuotaGet(ctx context.Context, userId int64) (int64, error) {
+	role, err := ks.ud.UserGetRole(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	quota, ok := consts.KbTokenQuota[role]
+	if !ok {
+		quota = consts.KbTokenQuota[consts.StandardUser]
+	}
+	return quota, nil
+}
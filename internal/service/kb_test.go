@@ -0,0 +1,282 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-27 16:05:12
+ * @LastEditTime: 2023-06-27 16:05:12
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/kb_test.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/utils/uuid"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// fakeKbDao 以内存数据模拟知识库、团队和共享成员
+type fakeKbDao struct {
+	dao.KbDao
+	kbs     map[int64]entity.KnowledgeBase
+	teams   map[int64]entity.Team
+	members map[[2]int64]bool // 团队ID, 用户ID
+	shares  map[[2]int64]int  // 知识库ID, 用户ID -> 权限
+	used    map[string]int64  // 所有者类型:所有者ID -> 已用token
+}
+
+func (f *fakeKbDao) KbGet(ctx context.Context, kbId int64) (entity.KnowledgeBase, error) {
+	kb, ok := f.kbs[kbId]
+	if !ok {
+		return kb, gorm.ErrRecordNotFound
+	}
+	return kb, nil
+}
+
+func (f *fakeKbDao) TeamGet(ctx context.Context, teamId int64) (entity.Team, error) {
+	team, ok := f.teams[teamId]
+	if !ok {
+		return team, gorm.ErrRecordNotFound
+	}
+	return team, nil
+}
+
+func (f *fakeKbDao) TeamMemberIs(ctx context.Context, teamId, userId int64) (bool, error) {
+	return f.members[[2]int64{teamId, userId}], nil
+}
+
+func (f *fakeKbDao) KbMemberGet(ctx context.Context, kbId, userId int64) (entity.KbMember, error) {
+	return entity.KbMember{KbId: kbId, UserId: userId, Permission: f.shares[[2]int64{kbId, userId}]}, nil
+}
+
+func (f *fakeKbDao) KbTokenUsageByUser(ctx context.Context, userId int64) (int64, error) {
+	used := f.used[kbUsageKey(consts.KbOwnerUser, userId)]
+	for _, team := range f.teams {
+		if team.OwnerId == userId {
+			used += f.used[kbUsageKey(consts.KbOwnerTeam, team.Id)]
+		}
+	}
+	return used, nil
+}
+
+func kbUsageKey(ownerType string, ownerId int64) string {
+	return ownerType + ":" + strconv.FormatInt(ownerId, 10)
+}
+
+// fakeUserRoleDao 仅提供用户等级
+type fakeUserRoleDao struct {
+	dao.UserDao
+	roles map[int64]int
+}
+
+func (f *fakeUserRoleDao) UserGetRole(ctx context.Context, userId int64) (int, error) {
+	role, ok := f.roles[userId]
+	if !ok {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return role, nil
+}
+
+const (
+	kbOwner    = 1
+	kbTeamLead = 2
+	kbTeammate = 3
+	kbStranger = 4
+	kbSharedRO = 5
+	kbSharedRW = 6
+	kbAdmin    = 7
+)
+
+const (
+	kbPrivateUser = 11
+	kbSharedUser  = 12
+	kbPublicUser  = 13
+	kbPrivateTeam = 14
+	kbMissing     = 99
+)
+
+const kbTeam = 21
+
+func testKbService() *kbService {
+	return &kbService{
+		kd: &fakeKbDao{
+			kbs: map[int64]entity.KnowledgeBase{
+				kbPrivateUser: {Id: kbPrivateUser, OwnerType: consts.KbOwnerUser, OwnerId: kbOwner, Visibility: consts.KbPrivate},
+				kbSharedUser:  {Id: kbSharedUser, OwnerType: consts.KbOwnerUser, OwnerId: kbOwner, Visibility: consts.KbShared},
+				kbPublicUser:  {Id: kbPublicUser, OwnerType: consts.KbOwnerUser, OwnerId: kbOwner, Visibility: consts.KbPublic},
+				kbPrivateTeam: {Id: kbPrivateTeam, OwnerType: consts.KbOwnerTeam, OwnerId: kbTeam, Visibility: consts.KbPrivate},
+			},
+			teams: map[int64]entity.Team{
+				kbTeam: {Id: kbTeam, OwnerId: kbTeamLead},
+			},
+			members: map[[2]int64]bool{
+				{kbTeam, kbTeamLead}: true,
+				{kbTeam, kbTeammate}: true,
+			},
+			shares: map[[2]int64]int{
+				{kbSharedUser, kbSharedRO}:  consts.KbPermRead,
+				{kbSharedUser, kbSharedRW}:  consts.KbPermWrite,
+				{kbPublicUser, kbSharedRW}:  consts.KbPermWrite,
+				{kbPrivateUser, kbSharedRW}: consts.KbPermWrite,
+			},
+			used: map[string]int64{},
+		},
+		ud: &fakeUserRoleDao{roles: map[int64]int{
+			kbOwner:    consts.StandardUser,
+			kbTeamLead: consts.SeniorMember,
+			kbTeammate: consts.StandardUser,
+			kbStranger: consts.StandardUser,
+			kbSharedRO: consts.StandardUser,
+			kbSharedRW: consts.StandardUser,
+			kbAdmin:    consts.Administrator,
+		}},
+	}
+}
+
+func Test_kbService_KbPermissionGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		userId  int64
+		kbId    int64
+		want    int
+		wantErr bool
+	}{
+		{"administrator manages any kb", kbAdmin, kbPrivateTeam, consts.KbPermManage, false},
+		{"global kb is readable", kbStranger, consts.KbGlobalId, consts.KbPermRead, false},
+		{"owner manages own kb", kbOwner, kbPrivateUser, consts.KbPermManage, false},
+		{"stranger has no access to private kb", kbStranger, kbPrivateUser, consts.KbPermNone, false},
+		{"share ignored on private kb", kbSharedRW, kbPrivateUser, consts.KbPermNone, false},
+		{"team owner manages team kb", kbTeamLead, kbPrivateTeam, consts.KbPermManage, false},
+		{"team member writes team kb", kbTeammate, kbPrivateTeam, consts.KbPermWrite, false},
+		{"stranger has no access to team kb", kbStranger, kbPrivateTeam, consts.KbPermNone, false},
+		{"read-only share", kbSharedRO, kbSharedUser, consts.KbPermRead, false},
+		{"read-write share", kbSharedRW, kbSharedUser, consts.KbPermWrite, false},
+		{"stranger has no access to shared kb", kbStranger, kbSharedUser, consts.KbPermNone, false},
+		{"public kb is readable", kbStranger, kbPublicUser, consts.KbPermRead, false},
+		{"share upgrades public kb", kbSharedRW, kbPublicUser, consts.KbPermWrite, false},
+		{"missing kb", kbOwner, kbMissing, consts.KbPermNone, true},
+		{"unknown user", 404, kbPublicUser, consts.KbPermNone, true},
+	}
+	ks := testKbService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ks.KbPermissionGet(context.Background(), tt.userId, tt.kbId)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("KbPermissionGet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("KbPermissionGet() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// testKbQuotaService 在 testKbService 基础上接入内存 Redis，用于写入锁
+func testKbQuotaService(t *testing.T) (*kbService, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	ks := testKbService()
+	ks.iSrv = *uuid.NewNode(6)
+	ks.rc = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	return ks, mr
+}
+
+func Test_kbService_KbQuotaAcquire(t *testing.T) {
+	standard := consts.KbTokenQuota[consts.StandardUser]
+	senior := consts.KbTokenQuota[consts.SeniorMember]
+	tests := []struct {
+		name    string
+		kbId    int64
+		used    map[string]int64
+		role    int // 覆盖知识库所有者等级，0 表示不覆盖
+		tokens  int
+		wantErr bool
+	}{
+		{"global kb has no quota", consts.KbGlobalId, nil, 0, 1 << 30, false},
+		{"user kb within quota", kbPrivateUser, map[string]int64{kbUsageKey(consts.KbOwnerUser, kbOwner): standard - 100}, 0, 100, false},
+		{"user kb over quota", kbPrivateUser, map[string]int64{kbUsageKey(consts.KbOwnerUser, kbOwner): standard - 100}, 0, 101, true},
+		{"team kb uses team owner quota", kbPrivateTeam, map[string]int64{kbUsageKey(consts.KbOwnerTeam, kbTeam): standard}, 0, 1000, false},
+		{"team kb over team owner quota", kbPrivateTeam, map[string]int64{kbUsageKey(consts.KbOwnerTeam, kbTeam): senior}, 0, 1, true},
+		{"personal and team usage share one quota", kbPrivateTeam, map[string]int64{kbUsageKey(consts.KbOwnerUser, kbTeamLead): senior - 500, kbUsageKey(consts.KbOwnerTeam, kbTeam): 400}, 0, 101, true},
+		{"unlimited role", kbPrivateUser, map[string]int64{kbUsageKey(consts.KbOwnerUser, kbOwner): 1 << 40}, consts.Administrator, 1, false},
+		{"unknown role falls back to standard", kbPrivateUser, map[string]int64{kbUsageKey(consts.KbOwnerUser, kbOwner): standard}, 1000, 1, true},
+		{"missing kb", kbMissing, nil, 0, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, mr := testKbQuotaService(t)
+			if tt.used != nil {
+				ks.kd.(*fakeKbDao).used = tt.used
+			}
+			if tt.role != 0 {
+				ks.ud.(*fakeUserRoleDao).roles[kbOwner] = tt.role
+			}
+			release, err := ks.KbQuotaAcquire(context.Background(), tt.kbId, tt.tokens)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("KbQuotaAcquire() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			release()
+			if keys := mr.Keys(); len(keys) != 0 {
+				t.Errorf("KbQuotaAcquire() left locks %v", keys)
+			}
+		})
+	}
+}
+
+func Test_kbService_KbQuotaAcquire_concurrent(t *testing.T) {
+	ks, _ := testKbQuotaService(t)
+	ctx := context.Background()
+	release, err := ks.KbQuotaAcquire(ctx, kbPrivateTeam, 100)
+	if err != nil {
+		t.Fatalf("KbQuotaAcquire() error = %v", err)
+	}
+	// 团队知识库与团队所有者的个人知识库共用一把锁
+	ks.kd.(*fakeKbDao).kbs[kbPrivateUser] = entity.KnowledgeBase{Id: kbPrivateUser, OwnerType: consts.KbOwnerUser, OwnerId: kbTeamLead}
+	if _, err := ks.KbQuotaAcquire(ctx, kbPrivateUser, 100); err == nil {
+		t.Errorf("KbQuotaAcquire() while another write holds the lock error = nil")
+	}
+	release()
+	release2, err := ks.KbQuotaAcquire(ctx, kbPrivateUser, 100)
+	if err != nil {
+		t.Errorf("KbQuotaAcquire() after release error = %v", err)
+	}
+	release2()
+}
+
+func Test_kbService_KbReadableIds(t *testing.T) {
+	ks := &kbService{kd: &readableKbDao{ids: []int64{kbPrivateUser, kbPrivateTeam}}}
+	got, err := ks.KbReadableIds(context.Background(), kbOwner)
+	if err != nil {
+		t.Fatalf("KbReadableIds() error = %v", err)
+	}
+	want := []int64{kbPrivateUser, kbPrivateTeam, consts.KbGlobalId}
+	if len(got) != len(want) {
+		t.Fatalf("KbReadableIds() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("KbReadableIds() = %v, want %v", got, want)
+		}
+	}
+	ks.kd = &readableKbDao{err: errors.New("db down")}
+	if _, err := ks.KbReadableIds(context.Background(), kbOwner); err == nil {
+		t.Errorf("KbReadableIds() should return dao error")
+	}
+}
+
+type readableKbDao struct {
+	dao.KbDao
+	ids []int64
+	err error
+}
+
+func (f *readableKbDao) KbReadableIds(ctx context.Context, userId int64) ([]int64, error) {
+	return f.ids, f.err
+}
@@ -0,0 +1,224 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 14:40:27
+ * @LastEditTime: 2023-06-25 14:40:27
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/loginguard.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/mail"
+	"chatserver-api/utils/uuid"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+var _ LoginGuardService = (*loginGuardService)(nil)
+
+// loginHistoryLimit 登录记录返回条数
+const loginHistoryLimit = 50
+
+// ErrLoginLocked 登录失败次数过多，账户或IP被临时锁定
+var ErrLoginLocked = errors.New("登录失败次数过多")
+
+// IsLoginLocked 判断错误是否由登录锁定引起
+func IsLoginLocked(err error) bool {
+	return errors.Is(err, ErrLoginLocked)
+}
+
+// LoginGuardService 登录保护：按账户和IP统计连续失败次数，超过上限后锁定，
+// 24 小时内再次锁定时锁定时间翻倍；登录结果写入 userlog，新设备登录时发送邮件提醒
+type LoginGuardService interface {
+	LoginCheck(ctx *gin.Context, userId int64, method string) error
+	LoginFailed(ctx *gin.Context, userId int64, method string)
+	LoginSucceeded(ctx *gin.Context, userId int64, method string)
+	LoginRisky(ctx *gin.Context, userId int64) bool
+	LoginHistory(ctx *gin.Context) (res model.UserLoginHistoryRes, err error)
+}
+
+type loginGuardService struct {
+	ud   dao.UserDao
+	iSrv uuid.SnowNode
+	rc   *redis.Client
+}
+
+func NewLoginGuardService(_ud dao.UserDao) *loginGuardService {
+	return &loginGuardService{
+		ud:   _ud,
+		iSrv: *uuid.NewNode(9),
+		rc:   cache.GetRedisClient(),
+	}
+}
+
+// LoginCheck 检查IP和账户是否处于锁定中，userId 为 0 时只检查IP
+func (ls *loginGuardService) LoginCheck(ctx *gin.Context, userId int64, method string) error {
+	for _, subject := range loginSubjects(ctx, userId) {
+		ttl, err := ls.rc.TTL(ctx, consts.LoginLockPrefix+subject).Result()
+		if err != nil {
+			logger.Errorf("Redis连接异常:%v", err.Error())
+			continue
+		}
+		if ttl > 0 {
+			if userId != 0 {
+				ls.loginLog(ctx, userId, method, consts.LoginLocked)
+			}
+			return fmt.Errorf("%w，请%d分钟后再试", ErrLoginLocked, int(math.Ceil(ttl.Minutes())))
+		}
+	}
+	return nil
+}
+
+// LoginFailed 记录失败，达到上限后锁定；userId 为 0(用户不存在)时只计入IP
+func (ls *loginGuardService) LoginFailed(ctx *gin.Context, userId int64, method string) {
+	cfg := config.AppConfig.LoginConfig
+	limits := []int{loginDefault(cfg.MaxIPAttempts, 20), loginDefault(cfg.MaxAttempts, 5)}
+	window := time.Duration(loginDefault(cfg.Window, 15)) * time.Minute
+	for i, subject := range loginSubjects(ctx, userId) {
+		failKey := consts.LoginFailPrefix + subject
+		n, err := ls.rc.Incr(ctx, failKey).Result()
+		if err != nil {
+			logger.Errorf("Redis连接异常:%v", err.Error())
+			continue
+		}
+		if n == 1 {
+			ls.rc.Expire(ctx, failKey, window)
+		}
+		if n < int64(limits[i]) {
+			continue
+		}
+		lock := ls.loginLockDuration(ctx, subject)
+		ls.rc.Set(ctx, consts.LoginLockPrefix+subject, 1, lock)
+		ls.rc.Del(ctx, failKey)
+		logger.Warnf("登录失败次数过多，%s锁定%v", subject, lock)
+	}
+	if userId != 0 {
+		ls.loginLog(ctx, userId, method, consts.LoginFailure)
+	}
+}
+
+// LoginSucceeded 清除账户失败计数并记录日志，新设备登录时发送邮件提醒
+func (ls *loginGuardService) LoginSucceeded(ctx *gin.Context, userId int64, method string) {
+	ls.rc.Del(ctx, consts.LoginFailPrefix+"user:"+strconv.FormatInt(userId, 10))
+	device := sessionDevice(ctx.Request.UserAgent())
+	total, seen, err := ls.ud.UserLogDeviceCount(ctx, userId, device)
+	if err != nil {
+		logger.Errorf("登录设备查询失败:%v", err.Error())
+	}
+	ls.loginLog(ctx, userId, method, consts.LoginSuccess)
+	// 首次登录不提醒
+	if err != nil || total == 0 || seen > 0 || !config.AppConfig.LoginConfig.NewDeviceMail {
+		return
+	}
+	userInfo, err := ls.ud.UserGetById(ctx, userId)
+	if err != nil || userInfo.Email == "" {
+		return
+	}
+	ip, now := ctx.ClientIP(), time.Now().Format(consts.TimeLayout)
+	go func() {
+		if err := mail.SendLoginAlert(userInfo.Email, userInfo.Nickname, ip, device, now); err != nil {
+			logger.Errorf("新设备登录提醒发送失败:%v", err.Error())
+		}
+	}()
+}
+
+// LoginRisky IP或账户近期有登录失败或锁定记录，userId 为 0 时只检查IP
+func (ls *loginGuardService) LoginRisky(ctx *gin.Context, userId int64) bool {
+	var keys []string
+	for _, subject := range loginSubjects(ctx, userId) {
+		keys = append(keys, consts.LoginFailPrefix+subject, consts.LoginLockCountPrefix+subject)
+	}
+	n, err := ls.rc.Exists(ctx, keys...).Result()
+	if err != nil {
+		logger.Errorf("Redis连接异常:%v", err.Error())
+		return true
+	}
+	return n > 0
+}
+
+func (ls *loginGuardService) LoginHistory(ctx *gin.Context) (res model.UserLoginHistoryRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	logs, err := ls.ud.UserLogList(ctx, userId, consts.LogBusinessLogin, loginHistoryLimit)
+	if err != nil {
+		return
+	}
+	res.History = make([]model.UserLoginLogRes, 0, len(logs))
+	for _, l := range logs {
+		res.History = append(res.History, model.UserLoginLogRes{
+			Ip:        l.UserIP,
+			Device:    l.Device,
+			UserAgent: l.UserAgent,
+			Method:    l.Operation,
+			Result:    l.Result,
+			CreatedAt: l.CreatedAt,
+		})
+	}
+	return
+}
+
+// loginLockDuration 24 小时内第 n 次锁定的时长为 lockbase * 2^(n-1)，不超过 lockmax
+func (ls *loginGuardService) loginLockDuration(ctx *gin.Context, subject string) time.Duration {
+	cfg := config.AppConfig.LoginConfig
+	countKey := consts.LoginLockCountPrefix + subject
+	n, err := ls.rc.Incr(ctx, countKey).Result()
+	if err != nil {
+		n = 1
+	}
+	ls.rc.Expire(ctx, countKey, 24*time.Hour)
+	base := time.Duration(loginDefault(cfg.LockBase, 5)) * time.Minute
+	max := time.Duration(loginDefault(cfg.LockMax, 1440)) * time.Minute
+	lock := base
+	for i := int64(1); i < n && lock < max; i++ {
+		lock *= 2
+	}
+	if lock > max {
+		lock = max
+	}
+	return lock
+}
+
+func (ls *loginGuardService) loginLog(ctx *gin.Context, userId int64, method, result string) {
+	ua := ctx.Request.UserAgent()
+	log := entity.UserLog{
+		Id:        ls.iSrv.GenSnowID(),
+		UserId:    userId,
+		UserIP:    ctx.ClientIP(),
+		Business:  consts.LogBusinessLogin,
+		Operation: method,
+		UserAgent: ua,
+		Device:    sessionDevice(ua),
+		Result:    result,
+	}
+	if err := ls.ud.UserLogCreate(ctx, &log); err != nil {
+		logger.Errorf("登录日志写入失败:%v", err.Error())
+	}
+}
+
+// loginSubjects 计数对象，IP 在前，账户在后
+func loginSubjects(ctx *gin.Context, userId int64) []string {
+	subjects := []string{"ip:" + ctx.ClientIP()}
+	if userId != 0 {
+		subjects = append(subjects, "user:"+strconv.FormatInt(userId, 10))
+	}
+	return subjects
+}
+
+func loginDefault(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
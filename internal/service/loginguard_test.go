@@ -0,0 +1,141 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-29 16:10:52
+ * @LastEditTime: 2023-06-29 16:10:52
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/loginguard_test.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/utils/uuid"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// fakeLoginUserDao 记录写入的登录日志结果
+type fakeLoginUserDao struct {
+	dao.UserDao
+	results []string
+}
+
+func (f *fakeLoginUserDao) UserLogCreate(ctx context.Context, log *entity.UserLog) error {
+	f.results = append(f.results, log.Result)
+	return nil
+}
+
+func testLoginGuardService(t *testing.T, cfg config.LoginConfig) (*loginGuardService, *fakeLoginUserDao, *miniredis.Miniredis) {
+	t.Helper()
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	old := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = old })
+	config.AppConfig = &config.Config{LoginConfig: cfg}
+	mr := miniredis.RunT(t)
+	ud := &fakeLoginUserDao{}
+	ls := &loginGuardService{ud: ud, iSrv: *uuid.NewNode(9), rc: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+	return ls, ud, mr
+}
+
+func testLoginContext(ip string) *gin.Context {
+	ctx, _ := testChatContext()
+	ctx.Request.RemoteAddr = ip + ":40000"
+	return ctx
+}
+
+func Test_loginGuardService_LoginFailed(t *testing.T) {
+	cfg := config.LoginConfig{MaxAttempts: 3, MaxIPAttempts: 5, Window: 15, LockBase: 5, LockMax: 60}
+	t.Run("account limit", func(t *testing.T) {
+		ls, ud, mr := testLoginGuardService(t, cfg)
+		for i := 0; i < 3; i++ {
+			if err := ls.LoginCheck(testLoginContext("198.51.100.1"), 100, consts.LoginPassword); err != nil {
+				t.Fatalf("LoginCheck() before attempt %d error = %v", i, err)
+			}
+			ls.LoginFailed(testLoginContext("198.51.100.1"), 100, consts.LoginPassword)
+		}
+		// 账户在其他IP上也被锁定，失败的IP未达到上限
+		if err := ls.LoginCheck(testLoginContext("203.0.113.9"), 100, consts.LoginPassword); !IsLoginLocked(err) {
+			t.Errorf("LoginCheck() account error = %v, want locked", err)
+		}
+		if err := ls.LoginCheck(testLoginContext("198.51.100.1"), 0, consts.LoginPassword); err != nil {
+			t.Errorf("LoginCheck() ip error = %v, want nil", err)
+		}
+		if ttl := mr.TTL(consts.LoginLockPrefix + "user:100"); ttl != 5*time.Minute {
+			t.Errorf("account lock ttl = %v, want %v", ttl, 5*time.Minute)
+		}
+		if mr.Exists(consts.LoginFailPrefix + "user:100") {
+			t.Errorf("fail counter should be reset after locking")
+		}
+		if want := []string{consts.LoginFailure, consts.LoginFailure, consts.LoginFailure, consts.LoginLocked}; !reflect.DeepEqual(ud.results, want) {
+			t.Errorf("login logs = %v, want %v", ud.results, want)
+		}
+	})
+	t.Run("ip limit", func(t *testing.T) {
+		ls, ud, _ := testLoginGuardService(t, cfg)
+		// 不存在的用户只计入IP，不写登录日志
+		for i := 0; i < 4; i++ {
+			ls.LoginFailed(testLoginContext("198.51.100.2"), 0, consts.LoginPassword)
+		}
+		if err := ls.LoginCheck(testLoginContext("198.51.100.2"), 0, consts.LoginPassword); err != nil {
+			t.Fatalf("LoginCheck() below ip limit error = %v", err)
+		}
+		ls.LoginFailed(testLoginContext("198.51.100.2"), 0, consts.LoginPassword)
+		if err := ls.LoginCheck(testLoginContext("198.51.100.2"), 200, consts.LoginPassword); !IsLoginLocked(err) {
+			t.Errorf("LoginCheck() ip error = %v, want locked", err)
+		}
+		if err := ls.LoginCheck(testLoginContext("198.51.100.3"), 200, consts.LoginPassword); err != nil {
+			t.Errorf("LoginCheck() other ip error = %v, want nil", err)
+		}
+		if len(ud.results) != 1 || ud.results[0] != consts.LoginLocked {
+			t.Errorf("login logs = %v, want only the locked attempt", ud.results)
+		}
+	})
+	t.Run("window expires", func(t *testing.T) {
+		ls, _, mr := testLoginGuardService(t, cfg)
+		for i := 0; i < 2; i++ {
+			ls.LoginFailed(testLoginContext("198.51.100.4"), 300, consts.LoginPassword)
+		}
+		mr.FastForward(16 * time.Minute)
+		ls.LoginFailed(testLoginContext("198.51.100.4"), 300, consts.LoginPassword)
+		if err := ls.LoginCheck(testLoginContext("198.51.100.4"), 300, consts.LoginPassword); err != nil {
+			t.Errorf("LoginCheck() after window error = %v, want nil", err)
+		}
+	})
+}
+
+func Test_loginGuardService_loginLockDuration(t *testing.T) {
+	ls, _, mr := testLoginGuardService(t, config.LoginConfig{LockBase: 5, LockMax: 30})
+	ctx := testLoginContext("198.51.100.5")
+	// 24 小时内每次锁定翻倍，不超过 lockmax
+	for i, want := range []time.Duration{5 * time.Minute, 10 * time.Minute, 20 * time.Minute, 30 * time.Minute, 30 * time.Minute} {
+		if got := ls.loginLockDuration(ctx, "user:100"); got != want {
+			t.Errorf("loginLockDuration() lock %d = %v, want %v", i+1, got, want)
+		}
+	}
+	if got := ls.loginLockDuration(ctx, "ip:198.51.100.5"); got != 5*time.Minute {
+		t.Errorf("loginLockDuration() other subject = %v, want %v", got, 5*time.Minute)
+	}
+	mr.FastForward(24*time.Hour + time.Second)
+	if got := ls.loginLockDuration(ctx, "user:100"); got != 5*time.Minute {
+		t.Errorf("loginLockDuration() after 24h = %v, want %v", got, 5*time.Minute)
+	}
+
+	// 未配置时使用默认值 5 分钟和 24 小时
+	config.AppConfig = &config.Config{}
+	for i := 0; i < 10; i++ {
+		ls.loginLockDuration(ctx, "user:200")
+	}
+	if got := ls.loginLockDuration(ctx, "user:200"); got != 24*time.Hour {
+		t.Errorf("loginLockDuration() default cap = %v, want %v", got, 24*time.Hour)
+	}
+}
@@ -0,0 +1,272 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-22 13:40:26
+ * @LastEditTime: 2023-06-22 18:21:05
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/oidc.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/avatar"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/oidc"
+	"chatserver-api/utils/security"
+	"chatserver-api/utils/uuid"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+var _ OidcService = (*oidcService)(nil)
+
+const (
+	// oidcStateTTL 授权请求的有效期
+	oidcStateTTL = 10 * time.Minute
+	// oidcStateCookie 保存 state 的 cookie，登录时要求与回调中的 state 一致，防止授权结果被注入其他浏览器
+	oidcStateCookie = "oidc_state"
+)
+
+// usernameRe 用户名中不允许的字符，用户名也不能包含 admin
+var (
+	usernameRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	adminRe    = regexp.MustCompile(`(?i)admin`)
+)
+
+type OidcService interface {
+	OidcAuthURL(ctx *gin.Context) (res model.OidcAuthURLRes, err error)
+	OidcLogin(ctx *gin.Context, code, state string) (res model.UserLoginRes, err error)
+}
+
+type oidcService struct {
+	ud   dao.UserDao
+	tSrv TwoFAService
+	lSrv LoginGuardService
+	iSrv uuid.SnowNode
+	rc   *redis.Client
+	op   *oidc.Provider
+}
+
+// oidcState 授权请求的 nonce 和 PKCE code_verifier，以 state 为键保存在 redis
+type oidcState struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+func NewOidcService(_ud dao.UserDao, _tSrv TwoFAService, _lSrv LoginGuardService) *oidcService {
+	cfg := config.AppConfig.OIDCConfig
+	return &oidcService{
+		ud:   _ud,
+		tSrv: _tSrv,
+		lSrv: _lSrv,
+		iSrv: *uuid.NewNode(3),
+		rc:   cache.GetRedisClient(),
+		op: oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.Issuer,
+			ClientId:     cfg.ClientId,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+		}),
+	}
+}
+
+// OidcAuthURL 生成身份提供方授权地址
+func (oc *oidcService) OidcAuthURL(ctx *gin.Context) (res model.OidcAuthURLRes, err error) {
+	if !oc.op.Enabled() {
+		return res, errors.New("未启用单点登录")
+	}
+	state := oidc.NewState()
+	st := oidcState{Nonce: oidc.NewState(), Verifier: oidc.NewVerifier()}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return
+	}
+	if err = oc.rc.Set(ctx, consts.OidcStatePrefix+state, data, oidcStateTTL).Err(); err != nil {
+		return
+	}
+	res.URL, err = oc.op.AuthCodeURL(ctx, state, st.Nonce, st.Verifier)
+	if err != nil {
+		return
+	}
+	res.Name = config.AppConfig.OIDCConfig.Name
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcStateCookie, state, int(oidcStateTTL.Seconds()), "/", "", requestSecure(ctx), true)
+	return
+}
+
+// oidcStateBound 回调中的 state 必须与发起授权的浏览器 cookie 一致，校验后清除 cookie
+func oidcStateBound(ctx *gin.Context, state string) bool {
+	bound, err := ctx.Cookie(oidcStateCookie)
+	if err != nil || bound == "" {
+		return false
+	}
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcStateCookie, "", -1, "/", "", requestSecure(ctx), true)
+	return subtle.ConstantTimeCompare([]byte(bound), []byte(state)) == 1
+}
+
+// OidcLogin 校验授权结果并登录，按 issuer + subject 查找已关联的用户，未关联时按已验证邮箱关联或自动创建用户
+func (oc *oidcService) OidcLogin(ctx *gin.Context, code, state string) (res model.UserLoginRes, err error) {
+	if !oidcStateBound(ctx, state) {
+		return res, errors.New("登录请求无效，请重新发起登录")
+	}
+	key := consts.OidcStatePrefix + state
+	data, err := oc.rc.Get(ctx, key).Bytes()
+	if err != nil {
+		return res, errors.New("登录请求已过期")
+	}
+	// state 只能使用一次
+	oc.rc.Del(ctx, key)
+	var st oidcState
+	if err = json.Unmarshal(data, &st); err != nil {
+		return
+	}
+	claims, err := oc.op.Exchange(ctx, code, st.Verifier, st.Nonce)
+	if err != nil {
+		logger.Warnf("单点登录校验失败:%v", err)
+		return res, errors.New("身份校验失败")
+	}
+
+	identity, err := oc.ud.UserIdentityGet(ctx, claims.Issuer, claims.Subject)
+	var user entity.User
+	switch {
+	case err == nil:
+		info, err := oc.ud.UserGetById(ctx, identity.UserId)
+		if err != nil {
+			return res, err
+		}
+		if info.Username == "" {
+			return res, errors.New("用户不存在")
+		}
+		user.Id, user.Role, user.IsActive, user.IsBanned = identity.UserId, info.Role, info.IsActive, info.IsBanned
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if user, err = oc.oidcUserLink(ctx, claims); err != nil {
+			return res, err
+		}
+	default:
+		return res, err
+	}
+	if user.IsBanned {
+		return res, errUserBanned
+	}
+	if !user.IsActive {
+		// 邮箱已由身份提供方验证，直接激活
+		if err = oc.ud.UserUpdate(ctx, &entity.User{Id: user.Id, IsActive: true}); err != nil {
+			return res, err
+		}
+	}
+	res, err = oc.tSrv.TwoFALoginGate(ctx, user.Id, user.Role)
+	if err == nil && res.MfaToken == "" {
+		oc.lSrv.LoginSucceeded(ctx, user.Id, consts.LoginOidc)
+	}
+	return
+}
+
+// oidcUserLink 开启按邮箱关联时关联已验证邮箱的已有用户，邮箱未注册且开启自动创建时创建新用户
+func (oc *oidcService) oidcUserLink(ctx *gin.Context, claims oidc.Claims) (user entity.User, err error) {
+	if claims.Email == "" || !claims.EmailVerified {
+		return user, errors.New("身份提供方未提供已验证的邮箱")
+	}
+	identity := entity.UserIdentity{
+		Id:      oc.iSrv.GenSnowID(),
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}
+	cfg := config.AppConfig.OIDCConfig
+	user, err = oc.ud.UserGetByEmail(ctx, claims.Email)
+	if err != nil {
+		return
+	}
+	if user.Id != 0 {
+		// 身份提供方的邮箱可能由用户自行填写，未开启时不能仅凭邮箱接管已有账号
+		if !cfg.LinkByEmail {
+			return entity.User{}, errors.New("该邮箱已注册，请使用密码登录")
+		}
+		identity.UserId = user.Id
+		if err = oc.ud.UserIdentityCreate(ctx, &identity); err == nil {
+			logger.Infof("单点登录关联用户%d", user.Id)
+		}
+		return
+	}
+	if !cfg.AutoProvision {
+		return user, errors.New("用户未注册")
+	}
+	user.Id = oc.iSrv.GenSnowID()
+	user.Username, err = oc.oidcUsername(ctx, claims)
+	if err != nil {
+		return
+	}
+	user.Nickname = claims.Name
+	if user.Nickname == "" {
+		user.Nickname = user.Username
+	}
+	user.Email = claims.Email
+	user.RegisteredIp = ctx.ClientIP()
+	user.IsActive = true
+	user.Role = consts.StandardUser
+	if _, ok := consts.RoleToString[cfg.DefaultRole]; ok && cfg.DefaultRole != consts.Administrator {
+		user.Role = cfg.DefaultRole
+	}
+	user.AvatarUrl, err = avatar.GenNewAvatar(security.Md5WithSalt(user.Username, user.Email))
+	if err != nil {
+		return
+	}
+	// 单点登录用户没有可用密码，可通过忘记密码设置，注销账户时仅凭邮件确认
+	user.Password, err = passwordHash(oidc.NewVerifier())
+	if err != nil {
+		return
+	}
+	identity.UserId = user.Id
+	if err = oc.ud.UserCreateWithIdentity(ctx, &user, &identity); err == nil {
+		logger.Infof("单点登录创建用户%d", user.Id)
+	}
+	return
+}
+
+// oidcUsername 由 preferred_username 或邮箱前缀生成不重复的用户名
+func (oc *oidcService) oidcUsername(ctx *gin.Context, claims oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if i := strings.IndexByte(base, '@'); i >= 0 {
+		base = base[:i]
+	}
+	if base == "" {
+		base = claims.Email[:strings.IndexByte(claims.Email+"@", '@')]
+	}
+	base = adminRe.ReplaceAllString(usernameRe.ReplaceAllString(base, ""), "")
+	if len(base) < 4 {
+		base = "user" + base
+	}
+	if len(base) > 16 {
+		base = base[:16]
+	}
+	name := base
+	for i := 0; i < 5; i++ {
+		count, err := oc.ud.UserVerifyUserName(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s%04d", base, rand.Intn(10000))
+	}
+	return "", errors.New("用户名生成失败")
+}
@@ -0,0 +1,115 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-28 11:02:37
+ * @LastEditTime: 2023-06-28 11:02:37
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/oidc_test.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/oidc"
+	"chatserver-api/utils/uuid"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeOidcUserDao 按邮箱查找用户并记录新建的身份
+type fakeOidcUserDao struct {
+	dao.UserDao
+	users      map[string]entity.User
+	identities []entity.UserIdentity
+}
+
+func (f *fakeOidcUserDao) UserGetByEmail(ctx context.Context, email string) (entity.User, error) {
+	return f.users[email], nil
+}
+
+func (f *fakeOidcUserDao) UserIdentityCreate(ctx context.Context, identity *entity.UserIdentity) error {
+	f.identities = append(f.identities, *identity)
+	return nil
+}
+
+func Test_oidcService_oidcUserLink(t *testing.T) {
+	old := config.AppConfig
+	defer func() { config.AppConfig = old }()
+	tests := []struct {
+		name        string
+		linkByEmail bool
+		claims      oidc.Claims
+		wantUser    int64
+		wantErr     bool
+	}{
+		{"link disabled", false, oidc.Claims{Issuer: "idp", Subject: "s1", Email: "alice@example.com", EmailVerified: true}, 0, true},
+		{"link enabled", true, oidc.Claims{Issuer: "idp", Subject: "s1", Email: "alice@example.com", EmailVerified: true}, 101, false},
+		{"unverified email", true, oidc.Claims{Issuer: "idp", Subject: "s1", Email: "alice@example.com"}, 0, true},
+		{"unknown email without provisioning", true, oidc.Claims{Issuer: "idp", Subject: "s2", Email: "bob@example.com", EmailVerified: true}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfig = &config.Config{OIDCConfig: config.OIDCConfig{LinkByEmail: tt.linkByEmail}}
+			ud := &fakeOidcUserDao{users: map[string]entity.User{"alice@example.com": {Id: 101, Email: "alice@example.com"}}}
+			oc := &oidcService{ud: ud, iSrv: *uuid.NewNode(3)}
+			ctx, _ := testChatContext()
+			user, err := oc.oidcUserLink(ctx, tt.claims)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("oidcUserLink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if user.Id != tt.wantUser {
+				t.Errorf("oidcUserLink() user = %d, want %d", user.Id, tt.wantUser)
+			}
+			if linked := len(ud.identities) > 0; linked != (tt.wantUser != 0) {
+				t.Errorf("oidcUserLink() identities = %+v", ud.identities)
+			}
+		})
+	}
+}
+
+func Test_oidcStateBound(t *testing.T) {
+	old := config.AppConfig
+	defer func() { config.AppConfig = old }()
+	config.AppConfig = &config.Config{}
+	tests := []struct {
+		name   string
+		cookie string
+		state  string
+		want   bool
+	}{
+		{"match", "s1", "s1", true},
+		{"no cookie", "", "s1", false},
+		{"other browser", "s2", "s1", false},
+		{"empty state", "s1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, w := testChatContext()
+			if tt.cookie != "" {
+				ctx.Request.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			if got := oidcStateBound(ctx, tt.state); got != tt.want {
+				t.Errorf("oidcStateBound() = %v, want %v", got, tt.want)
+			}
+			if set := w.Header().Get("Set-Cookie"); tt.cookie != "" && !strings.Contains(set, "Max-Age=0") {
+				t.Errorf("oidcStateBound() Set-Cookie = %q, want cleared", set)
+			}
+		})
+	}
+}
+
+func Test_oidcService_OidcLogin_unboundState(t *testing.T) {
+	old := config.AppConfig
+	defer func() { config.AppConfig = old }()
+	config.AppConfig = &config.Config{}
+	// 未绑定浏览器的 state 在读取 redis 前即被拒绝
+	oc := &oidcService{}
+	ctx, _ := testChatContext()
+	ctx.Request.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: "victim"})
+	if _, err := oc.OidcLogin(ctx, "code", "attacker"); err == nil {
+		t.Errorf("OidcLogin() with foreign state should fail")
+	}
+}
@@ -0,0 +1,308 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 11:48:26
+ * @LastEditTime: 2023-06-26 11:48:26
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/order.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/payment"
+	"chatserver-api/utils/uuid"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+var _ OrderService = (*orderService)(nil)
+
+var errPaymentDisabled = errors.New("未开启在线支付")
+
+// IsPaymentSignature 判断错误是否由支付通知验签失败引起
+func IsPaymentSignature(err error) bool {
+	return errors.Is(err, payment.ErrSignature)
+}
+
+// OrderService 在线支付订单：下单跳转支付平台，支付通知验签后入账，管理员可退款
+type OrderService interface {
+	OrderCreate(ctx *gin.Context, req model.OrderCreateReq) (res model.OrderCreateRes, err error)
+	OrderGet(ctx *gin.Context, userId, orderId int64) (res model.OrderOneRes, err error)
+	OrderList(ctx *gin.Context, userId int64, req model.OrderListReq) (res model.OrderListRes, err error)
+	OrderNotify(ctx *gin.Context, header http.Header, body []byte) error
+	OrderRefund(ctx *gin.Context, orderId int64, reason string) error
+}
+
+type orderService struct {
+	od   dao.OrderDao
+	kd   dao.CDkeyDao
+	iSrv uuid.SnowNode
+	rc   *redis.Client
+	pay  payment.Provider
+}
+
+func NewOrderService(_od dao.OrderDao, _kd dao.CDkeyDao) *orderService {
+	return &orderService{
+		od:   _od,
+		kd:   _kd,
+		iSrv: *uuid.NewNode(10),
+		rc:   cache.GetRedisClient(),
+		pay:  payment.NewProvider(config.AppConfig.PaymentConfig),
+	}
+}
+
+// OrderCreate 按礼品卡面额下单，礼品卡折扣在 0 到 1 之间时按折后价支付
+func (ods *orderService) OrderCreate(ctx *gin.Context, req model.OrderCreateReq) (res model.OrderCreateRes, err error) {
+	if ods.pay == nil {
+		return res, errPaymentDisabled
+	}
+	if req.ItemType != consts.OrderItemGiftCard {
+		return res, errors.New("不支持的商品类型")
+	}
+	itemId, err := strconv.ParseInt(req.ItemId, 10, 64)
+	if err != nil {
+		return res, errors.New("礼品卡不存在")
+	}
+	card, err := ods.kd.GiftCardGet(ctx, itemId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return res, errors.New("礼品卡不存在")
+	}
+	if err != nil {
+		return
+	}
+	amount := card.CardAmount
+	if card.CardDiscount > 0 && card.CardDiscount < 1 {
+		amount = math.Round(card.CardAmount*card.CardDiscount*100) / 100
+	}
+	if amount <= 0 {
+		return res, errors.New("礼品卡价格错误")
+	}
+	order := entity.Order{
+		Id:       ods.iSrv.GenSnowID(),
+		UserId:   ctx.GetInt64(consts.UserID),
+		ItemType: req.ItemType,
+		ItemId:   itemId,
+		Subject:  card.CardName,
+		Amount:   amount,
+		Credit:   card.CardAmount,
+		Provider: ods.pay.Name(),
+		Status:   consts.OrderPending,
+	}
+	orderNo := strconv.FormatInt(order.Id, 10)
+	returnURL := config.AppConfig.PaymentConfig.ReturnURL
+	if returnURL == "" {
+		returnURL = config.AppConfig.ExternalURL
+	}
+	checkout, err := ods.pay.Checkout(ctx, payment.Order{
+		OrderNo:   orderNo,
+		Subject:   order.Subject,
+		Amount:    orderCents(amount),
+		ReturnURL: returnURL,
+	})
+	if err != nil {
+		logger.Errorf("订单%s创建支付失败:%v", orderNo, err.Error())
+		return res, errors.New("创建支付失败")
+	}
+	order.TradeNo = checkout.TradeNo
+	order.PayURL = checkout.PayURL
+	if err = ods.od.OrderCreate(ctx, &order); err != nil {
+		return
+	}
+	res.OrderId = orderNo
+	res.Amount = amount
+	res.PayURL = checkout.PayURL
+	return
+}
+
+// OrderGet 查询订单，userId 为 0 时不校验订单归属
+func (ods *orderService) OrderGet(ctx *gin.Context, userId, orderId int64) (res model.OrderOneRes, err error) {
+	order, err := ods.od.OrderGet(ctx, orderId)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && userId != 0 && order.UserId != userId) {
+		return res, errors.New("订单不存在")
+	}
+	if err != nil {
+		return
+	}
+	return orderRes(order), nil
+}
+
+// OrderList 分页查询订单，userId 为 0 时查询全部用户
+func (ods *orderService) OrderList(ctx *gin.Context, userId int64, req model.OrderListReq) (res model.OrderListRes, err error) {
+	page, pagesize := adminPage(req.Page, req.PageSize)
+	orders, total, err := ods.od.OrderList(ctx, userId, req.Status, page, pagesize)
+	if err != nil {
+		return
+	}
+	res.Total = total
+	res.OrderList = make([]model.OrderOneRes, 0, len(orders))
+	for _, o := range orders {
+		res.OrderList = append(res.OrderList, orderRes(o))
+	}
+	return
+}
+
+// OrderNotify 处理支付平台异步通知。同一订单的重复通知直接返回成功，不会重复入账
+func (ods *orderService) OrderNotify(ctx *gin.Context, header http.Header, body []byte) error {
+	if ods.pay == nil {
+		return errPaymentDisabled
+	}
+	ev, err := ods.pay.ParseNotify(header, body)
+	if err != nil {
+		return err
+	}
+	if ev.Type != payment.EventPaid {
+		return nil
+	}
+	orderId, err := strconv.ParseInt(ev.OrderNo, 10, 64)
+	if err != nil {
+		return errors.New("订单不存在")
+	}
+	order, err := ods.od.OrderGet(ctx, orderId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("订单不存在")
+	}
+	if err != nil {
+		return err
+	}
+	if orderCents(order.Amount) != ev.Amount {
+		logger.Errorf("订单%d支付金额不一致:应付%v实付%d分", order.Id, order.Amount, ev.Amount)
+		return errors.New("支付金额不一致")
+	}
+	if ev.TradeNo != "" {
+		order.TradeNo = ev.TradeNo
+	}
+	bill := entity.Bill{
+		Id:          ods.iSrv.GenSnowID(),
+		CostComment: "充值-在线支付订单" + ev.OrderNo,
+	}
+	err = ods.od.OrderPaid(ctx, &order, &bill)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Infof("订单%d重复的支付通知", order.Id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ods.balanceCacheSet(ctx, order.UserId, bill.Balance)
+	return nil
+}
+
+// OrderRefund 管理员退款：先扣回到账余额并将订单置为退款中，提交后再调用支付平台原路退款，
+// 余额不足时不允许退款；支付平台明确拒绝时返还余额并恢复已支付，结果未知时保持退款中，
+// 再次调用时直接重试支付平台
+func (ods *orderService) OrderRefund(ctx *gin.Context, orderId int64, reason string) error {
+	if ods.pay == nil {
+		return errPaymentDisabled
+	}
+	order, err := ods.od.OrderGet(ctx, orderId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("订单不存在")
+	}
+	if err != nil {
+		return err
+	}
+	if order.Status != consts.OrderPaid && order.Status != consts.OrderRefunding {
+		return errors.New("订单未支付或已退款")
+	}
+	if order.Provider != ods.pay.Name() {
+		return errors.New("订单支付方式与当前配置不一致")
+	}
+	operatorId := ctx.GetInt64(consts.UserID)
+	orderNo := strconv.FormatInt(order.Id, 10)
+	if order.Status == consts.OrderPaid {
+		bill := entity.Bill{
+			Id:          ods.iSrv.GenSnowID(),
+			CostComment: "退款-在线支付订单" + orderNo,
+			OperatorId:  operatorId,
+		}
+		err = ods.od.OrderRefundBegin(ctx, &order, &bill)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("订单未支付或已退款")
+		}
+		if errors.Is(err, dao.ErrBalanceInsufficient) {
+			return errors.New("用户余额不足，无法退款")
+		}
+		if err != nil {
+			return err
+		}
+		ods.balanceCacheSet(ctx, order.UserId, bill.Balance)
+	}
+	err = ods.pay.Refund(ctx, payment.Refund{
+		OrderNo: orderNo,
+		TradeNo: order.TradeNo,
+		Amount:  orderCents(order.Amount),
+		Reason:  reason,
+	})
+	if err != nil && !errors.Is(err, payment.ErrRefundRejected) {
+		// 结果未知时保持退款中，重试时支付平台按订单号幂等处理
+		logger.Errorf("订单%d退款结果未知，保持退款中:%v", order.Id, err.Error())
+		return errors.New("退款结果未知，请稍后重试")
+	}
+	if err != nil {
+		logger.Errorf("订单%d退款被支付平台拒绝:%v", order.Id, err.Error())
+		bill := entity.Bill{
+			Id:          ods.iSrv.GenSnowID(),
+			CostComment: "退款失败返还-在线支付订单" + orderNo,
+			OperatorId:  operatorId,
+		}
+		if cerr := ods.od.OrderRefundCancel(ctx, &order, &bill); cerr != nil {
+			logger.Errorf("订单%d退款失败后恢复已支付状态失败:%v", order.Id, cerr.Error())
+		} else {
+			ods.balanceCacheSet(ctx, order.UserId, bill.Balance)
+		}
+		return errors.New("退款失败")
+	}
+	if err = ods.od.OrderRefundFinish(ctx, &order); err != nil {
+		logger.Errorf("订单%d已在支付平台退款，更新订单状态失败:%v", order.Id, err.Error())
+		return err
+	}
+	logger.Infof("管理员%d退款订单%d:%s", operatorId, order.Id, reason)
+	return nil
+}
+
+func (ods *orderService) balanceCacheSet(ctx *gin.Context, userId int64, balance float64) {
+	err := ods.rc.SetXX(ctx, consts.UserBalancePrefix+strconv.FormatInt(userId, 10), balance, 0).Err()
+	if err != nil {
+		logger.Errorf("UserBalance更新存储Cache失败:%v", err.Error())
+	}
+}
+
+// orderCents 元转换为分
+func orderCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func orderRes(o entity.Order) model.OrderOneRes {
+	res := model.OrderOneRes{
+		OrderId:    strconv.FormatInt(o.Id, 10),
+		UserId:     strconv.FormatInt(o.UserId, 10),
+		ItemType:   o.ItemType,
+		ItemId:     strconv.FormatInt(o.ItemId, 10),
+		Subject:    o.Subject,
+		Amount:     o.Amount,
+		Credit:     o.Credit,
+		Provider:   o.Provider,
+		Status:     o.Status,
+		StatusName: consts.OrderStatusToString[o.Status],
+		PaidAt:     o.PaidAt,
+		RefundedAt: o.RefundedAt,
+		CreatedAt:  o.CreatedAt,
+	}
+	// 仅待支付订单返回支付链接，便于继续支付
+	if o.Status == consts.OrderPending {
+		res.PayURL = o.PayURL
+	}
+	return res
+}
@@ -0,0 +1,105 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-29 10:18:42
+ * @LastEditTime: 2023-06-29 10:18:42
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/order_test.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/payment"
+	"chatserver-api/utils/uuid"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// fakeOrderDao 返回固定订单并按顺序记录退款各阶段的调用
+type fakeOrderDao struct {
+	dao.OrderDao
+	order    entity.Order
+	beginErr error
+	calls    *[]string
+}
+
+func (f *fakeOrderDao) OrderGet(ctx context.Context, orderId int64) (entity.Order, error) {
+	return f.order, nil
+}
+
+func (f *fakeOrderDao) OrderRefundBegin(ctx context.Context, order *entity.Order, bill *entity.Bill) error {
+	*f.calls = append(*f.calls, "begin")
+	return f.beginErr
+}
+
+func (f *fakeOrderDao) OrderRefundFinish(ctx context.Context, order *entity.Order) error {
+	*f.calls = append(*f.calls, "finish")
+	return nil
+}
+
+func (f *fakeOrderDao) OrderRefundCancel(ctx context.Context, order *entity.Order, bill *entity.Bill) error {
+	*f.calls = append(*f.calls, "cancel")
+	return nil
+}
+
+// fakeRefundProvider 记录退款调用，err 不为空时退款失败
+type fakeRefundProvider struct {
+	payment.Provider
+	err   error
+	calls *[]string
+}
+
+func (f *fakeRefundProvider) Name() string {
+	return "fake"
+}
+
+func (f *fakeRefundProvider) Refund(ctx context.Context, refund payment.Refund) error {
+	*f.calls = append(*f.calls, "refund")
+	return f.err
+}
+
+func Test_orderService_OrderRefund(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	tests := []struct {
+		name      string
+		status    int
+		beginErr  error
+		refundErr error
+		wantCalls []string
+		wantErr   string
+	}{
+		{"refund", consts.OrderPaid, nil, nil, []string{"begin", "refund", "finish"}, ""},
+		{"provider rejected", consts.OrderPaid, nil, fmt.Errorf("%w: no such payment", payment.ErrRefundRejected), []string{"begin", "refund", "cancel"}, "退款失败"},
+		{"provider result unknown", consts.OrderPaid, nil, errors.New("timeout"), []string{"begin", "refund"}, "退款结果未知，请稍后重试"},
+		{"retry result unknown", consts.OrderRefunding, nil, errors.New("status 503"), []string{"refund"}, "退款结果未知，请稍后重试"},
+		{"insufficient balance", consts.OrderPaid, dao.ErrBalanceInsufficient, nil, []string{"begin"}, "用户余额不足，无法退款"},
+		{"retry refunding order", consts.OrderRefunding, nil, nil, []string{"refund", "finish"}, ""},
+		{"already refunded", consts.OrderRefunded, nil, nil, nil, "订单未支付或已退款"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			ods := &orderService{
+				od:   &fakeOrderDao{order: entity.Order{Id: 1, UserId: 2, Amount: 10, Credit: 10, Provider: "fake", Status: tt.status}, beginErr: tt.beginErr, calls: &calls},
+				iSrv: *uuid.NewNode(3),
+				rc:   testRedisClient(),
+				pay:  &fakeRefundProvider{err: tt.refundErr, calls: &calls},
+			}
+			ctx, _ := testChatContext()
+			err := ods.OrderRefund(ctx, 1, "test")
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("OrderRefund() error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("OrderRefund() calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
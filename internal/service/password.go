@@ -0,0 +1,86 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 16:37:52
+ * @LastEditTime: 2023-06-25 16:37:52
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/password.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/pkg/config"
+	"chatserver-api/utils/security"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errPasswordTLS    = errors.New("请通过 HTTPS 提交密码")
+	errPasswordLegacy = errors.New("密码格式错误")
+)
+
+// passwordPlain 取出前端提交的明文密码。携带 X-Password-Transport: plain 的请求为明文，
+// 否则按旧版前端的 AES 传输解密，配置 plainonly 后不再接受旧版传输
+func passwordPlain(ctx *gin.Context, password string) (string, error) {
+	cfg := config.AppConfig.PasswordConfig
+	if cfg.PlainOnly || strings.EqualFold(ctx.GetHeader(consts.PasswordTransportHeader), consts.PasswordTransportPlain) {
+		if cfg.RequireTLS && !requestSecure(ctx) {
+			return "", errPasswordTLS
+		}
+		return password, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(password)
+	if err != nil {
+		return "", errPasswordLegacy
+	}
+	plain, err := security.AesDecrypt(data, []byte(consts.CBCKEY))
+	if err != nil {
+		return "", errPasswordLegacy
+	}
+	return string(plain), nil
+}
+
+// requestSecure 判断请求是否通过 HTTPS 提交；X-Forwarded-Proto 只采信来自可信代理的请求，与 gin 的 ClientIP 一致
+func requestSecure(ctx *gin.Context) bool {
+	if ctx.Request.TLS != nil {
+		return true
+	}
+	return strings.EqualFold(ctx.GetHeader("X-Forwarded-Proto"), "https") &&
+		ipAllowed(ctx.RemoteIP(), config.AppConfig.TrustedProxies)
+}
+
+// passwordHash 按配置的算法生成密码哈希
+func passwordHash(plain string) (string, error) {
+	return security.PasswordHash(plain, passwordParams())
+}
+
+func passwordParams() security.PasswordParams {
+	cfg := config.AppConfig.PasswordConfig
+	p := security.PasswordParams{
+		Algorithm:  security.PasswordArgon2id,
+		BcryptCost: cfg.BcryptCost,
+		Time:       cfg.Argon2Time,
+		Memory:     cfg.Argon2Memory,
+		Threads:    cfg.Argon2Threads,
+	}
+	if cfg.Algorithm == security.PasswordBcrypt {
+		p.Algorithm = security.PasswordBcrypt
+	}
+	if p.BcryptCost <= 0 {
+		p.BcryptCost = 10
+	}
+	if p.Time == 0 {
+		p.Time = 3
+	}
+	if p.Memory == 0 {
+		p.Memory = 64 * 1024
+	}
+	if p.Threads == 0 {
+		p.Threads = 2
+	}
+	return p
+}
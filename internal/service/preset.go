@@ -15,6 +15,7 @@ import (
 	"chatserver-api/pkg/cache"
 	"chatserver-api/pkg/logger"
 	"chatserver-api/pkg/openai"
+	"chatserver-api/pkg/rewrite"
 	"chatserver-api/utils/tools"
 	"chatserver-api/utils/uuid"
 	"context"
@@ -72,6 +73,8 @@ func (ps *presetService) PresetUpdate(ctx context.Context, req model.PresetUpdat
 	preset.TopP = req.TopP
 	preset.Presence = req.Presence
 	preset.Extension = req.Extension
+	preset.QueryStrategy = req.QueryStrategy
+	preset.SearchProviders = req.SearchProviders
 	preset.Privilege = req.Privilege
 	err = ps.pd.PresetUpdate(ctx, &preset)
 	if err != nil {
@@ -99,6 +102,8 @@ func (ps *presetService) PresetCreateNew(ctx context.Context, req model.PresetCr
 	preset.WithEmbedding = tools.DefaultValue(req.WithEmbedding, false).(bool)
 	preset.Classify = tools.DefaultValue(req.Classify, "").(string)
 	preset.Extension = tools.DefaultValue(req.Extension, 0).(int)
+	preset.QueryStrategy = tools.DefaultValue(req.QueryStrategy, rewrite.StrategyKeyword).(string)
+	preset.SearchProviders = req.SearchProviders
 	preset.Privilege = tools.DefaultValue(req.Privilege, 1).(int)
 	err = ps.pd.PresetCreateNew(ctx, &preset)
 	if err != nil {
@@ -0,0 +1,293 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 16:30:27
+ * @LastEditTime: 2023-06-26 16:30:27
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/report.go
+ */
+package service
+
+import (
+	"bytes"
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/usage"
+	"encoding/csv"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var _ ReportService = (*reportService)(nil)
+
+const (
+	reportDefaultDays = 30
+	reportMaxDays     = 366
+	reportTopLimit    = 10
+)
+
+// ReportService 运营报表：消费和收入在扣费、入账时累加到按天汇总的表，查询只读汇总表
+type ReportService interface {
+	ReportUsageAdd(ctx *gin.Context, source string, tokens int, charge float64)
+	ReportUsageAuxAdd(ctx *gin.Context, records []usage.Record)
+	ReportUsage(ctx *gin.Context, req model.ReportReq) (res model.ReportUsageRes, err error)
+	ReportTopUsers(ctx *gin.Context, req model.ReportReq) (res model.ReportUsageRes, err error)
+	ReportRevenue(ctx *gin.Context, req model.ReportReq) (res model.ReportRevenueRes, err error)
+	ReportExport(ctx *gin.Context, req model.ReportReq) (data []byte, err error)
+}
+
+type reportService struct {
+	rd dao.ReportDao
+}
+
+func NewReportService(_rd dao.ReportDao) *reportService {
+	return &reportService{
+		rd: _rd,
+	}
+}
+
+// ReportUsageAdd 记录一次扣费，模型和预设取自请求上下文，统计失败不影响扣费
+func (rs *reportService) ReportUsageAdd(ctx *gin.Context, source string, tokens int, charge float64) {
+	modelName := ctx.GetString(consts.ModelCtx)
+	usage := entity.ReportUsageDaily{
+		UserId:   ctx.GetInt64(consts.UserID),
+		PresetId: ctx.GetInt64(consts.PresetIDCtx),
+		Model:    modelName,
+		Source:   source,
+		Requests: 1,
+		Tokens:   int64(tokens),
+		Charge:   charge,
+		Cost:     float64(tokens) / 1000 * reportModelPrice(modelName),
+	}
+	if err := rs.rd.ReportUsageAdd(ctx, &usage); err != nil {
+		logger.Errorf("消费报表统计失败:%v", err.Error())
+	}
+}
+
+// ReportUsageAuxAdd 记录一次对话中的辅助模型调用，按来源和模型各累加一行，收费按基础单价计算
+func (rs *reportService) ReportUsageAuxAdd(ctx *gin.Context, records []usage.Record) {
+	rows := make(map[[2]string]*entity.ReportUsageDaily)
+	var keys [][2]string
+	for _, r := range records {
+		key := [2]string{r.Source, r.Model}
+		row, ok := rows[key]
+		if !ok {
+			row = &entity.ReportUsageDaily{
+				UserId:   ctx.GetInt64(consts.UserID),
+				PresetId: ctx.GetInt64(consts.PresetIDCtx),
+				Model:    r.Model,
+				Source:   r.Source,
+			}
+			rows[key] = row
+			keys = append(keys, key)
+		}
+		row.Requests++
+		row.Tokens += int64(r.Tokens)
+	}
+	for _, key := range keys {
+		row := rows[key]
+		row.Charge = float64(row.Tokens) * consts.TokenPrice
+		row.Cost = float64(row.Tokens) / 1000 * reportModelPrice(row.Model)
+		if err := rs.rd.ReportUsageAdd(ctx, row); err != nil {
+			logger.Errorf("消费报表统计失败:%v", err.Error())
+		}
+	}
+}
+
+func (rs *reportService) ReportUsage(ctx *gin.Context, req model.ReportReq) (res model.ReportUsageRes, err error) {
+	start, end, err := reportRange(req)
+	if err != nil {
+		return
+	}
+	group := req.Group
+	if group == "" {
+		group = "day"
+	}
+	rows, err := rs.rd.ReportUsageGroup(ctx, group, start, end, 0)
+	if err != nil {
+		return
+	}
+	return reportUsageRes(start, end, group, rows), nil
+}
+
+// ReportTopUsers 按收费从高到低返回消费最多的用户，默认 10 个
+func (rs *reportService) ReportTopUsers(ctx *gin.Context, req model.ReportReq) (res model.ReportUsageRes, err error) {
+	start, end, err := reportRange(req)
+	if err != nil {
+		return
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = reportTopLimit
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	rows, err := rs.rd.ReportUsageGroup(ctx, "user", start, end, limit)
+	if err != nil {
+		return
+	}
+	return reportUsageRes(start, end, "user", rows), nil
+}
+
+// ReportRevenue 每日收入与用户消费、上游成本对照
+func (rs *reportService) ReportRevenue(ctx *gin.Context, req model.ReportReq) (res model.ReportRevenueRes, err error) {
+	start, end, err := reportRange(req)
+	if err != nil {
+		return
+	}
+	items, err := rs.rd.ReportRevenueGet(ctx, start, end)
+	if err != nil {
+		return
+	}
+	usage, err := rs.rd.ReportUsageGroup(ctx, "day", start, end, 0)
+	if err != nil {
+		return
+	}
+	days := make(map[string]*model.ReportRevenueRow)
+	dayRow := func(day string) *model.ReportRevenueRow {
+		if r, ok := days[day]; ok {
+			return r
+		}
+		days[day] = &model.ReportRevenueRow{Day: day}
+		return days[day]
+	}
+	for _, it := range items {
+		r := dayRow(it.Day)
+		switch it.Source {
+		case consts.ReportSourceCdKey:
+			r.CdKey += it.Amount
+		case consts.ReportSourceOrder:
+			r.Order += it.Amount
+		case consts.ReportSourceRefund:
+			r.Refund += it.Amount
+		}
+	}
+	for _, u := range usage {
+		r := dayRow(u.Key)
+		r.Charge = u.Charge
+		r.Cost = u.Cost
+	}
+	res.Start = start.Format(consts.DateLayout)
+	res.End = end.Format(consts.DateLayout)
+	res.Rows = make([]model.ReportRevenueRow, 0, len(days))
+	res.Total.Day = "合计"
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		r, ok := days[d.Format(consts.DateLayout)]
+		if !ok {
+			continue
+		}
+		r.Revenue = r.CdKey + r.Order - r.Refund
+		r.Margin = r.Revenue - r.Cost
+		res.Rows = append(res.Rows, *r)
+		res.Total.CdKey += r.CdKey
+		res.Total.Order += r.Order
+		res.Total.Refund += r.Refund
+		res.Total.Revenue += r.Revenue
+		res.Total.Charge += r.Charge
+		res.Total.Cost += r.Cost
+		res.Total.Margin += r.Margin
+	}
+	return
+}
+
+// ReportExport 导出报表为 CSV，Type 为 usage 时按 Group 分组导出消费，为 revenue 时导出收入对照
+func (rs *reportService) ReportExport(ctx *gin.Context, req model.ReportReq) (data []byte, err error) {
+	var records [][]string
+	switch req.Type {
+	case "usage":
+		res, err := rs.ReportUsage(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, []string{"维度", "名称", "请求数", "令牌数", "收费", "估算成本", "毛利"})
+		for _, r := range append(res.Rows, res.Total) {
+			records = append(records, []string{r.Key, r.Name, strconv.FormatInt(r.Requests, 10), strconv.FormatInt(r.Tokens, 10),
+				reportMoney(r.Charge), reportMoney(r.Cost), reportMoney(r.Profit)})
+		}
+	case "revenue":
+		res, err := rs.ReportRevenue(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, []string{"日期", "卡密充值", "在线支付", "退款", "收入", "消费", "估算成本", "毛利"})
+		for _, r := range append(res.Rows, res.Total) {
+			records = append(records, []string{r.Day, reportMoney(r.CdKey), reportMoney(r.Order), reportMoney(r.Refund),
+				reportMoney(r.Revenue), reportMoney(r.Charge), reportMoney(r.Cost), reportMoney(r.Margin)})
+		}
+	default:
+		return nil, errors.New("报表类型错误")
+	}
+	var buf bytes.Buffer
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	w.WriteAll(records)
+	return buf.Bytes(), w.Error()
+}
+
+// reportRange 解析查询日期，结束日期包含在内
+func reportRange(req model.ReportReq) (start, end time.Time, err error) {
+	end = time.Now()
+	if req.End != "" {
+		if end, err = time.ParseInLocation(consts.DateLayout, req.End, time.Local); err != nil {
+			return start, end, errors.New("结束日期格式错误")
+		}
+	}
+	y, m, d := end.Date()
+	end = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	start = end.AddDate(0, 0, 1-reportDefaultDays)
+	if req.Start != "" {
+		if start, err = time.ParseInLocation(consts.DateLayout, req.Start, time.Local); err != nil {
+			return start, end, errors.New("开始日期格式错误")
+		}
+	}
+	if start.After(end) {
+		return start, end, errors.New("开始日期不能晚于结束日期")
+	}
+	if end.Sub(start) >= reportMaxDays*24*time.Hour {
+		return start, end, errors.New("查询范围不能超过一年")
+	}
+	return
+}
+
+func reportUsageRes(start, end time.Time, group string, rows []model.ReportUsageRow) (res model.ReportUsageRes) {
+	res.Start = start.Format(consts.DateLayout)
+	res.End = end.Format(consts.DateLayout)
+	res.Group = group
+	res.Rows = rows
+	if res.Rows == nil {
+		res.Rows = []model.ReportUsageRow{}
+	}
+	res.Total.Key = "合计"
+	for i := range res.Rows {
+		r := &res.Rows[i]
+		r.Profit = r.Charge - r.Cost
+		res.Total.Requests += r.Requests
+		res.Total.Tokens += r.Tokens
+		res.Total.Charge += r.Charge
+		res.Total.Cost += r.Cost
+	}
+	res.Total.Profit = res.Total.Charge - res.Total.Cost
+	return
+}
+
+// reportModelPrice 上游模型价格，配置优先于内置价格表
+func reportModelPrice(modelName string) float64 {
+	name := strings.ToLower(modelName)
+	if p, ok := config.AppConfig.ReportConfig.Pricing[name]; ok {
+		return p
+	}
+	return consts.ModelUpstreamPrice[name]
+}
+
+func reportMoney(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10000)/10000, 'f', -1, 64)
+}
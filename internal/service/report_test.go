@@ -0,0 +1,64 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-29 14:05:16
+ * @LastEditTime: 2023-06-29 14:05:16
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/report_test.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/usage"
+	"context"
+	"math"
+	"testing"
+)
+
+// fakeReportDao 记录累加的消费汇总
+type fakeReportDao struct {
+	dao.ReportDao
+	usages []entity.ReportUsageDaily
+}
+
+func (f *fakeReportDao) ReportUsageAdd(ctx context.Context, usage *entity.ReportUsageDaily) error {
+	f.usages = append(f.usages, *usage)
+	return nil
+}
+
+func Test_reportService_ReportUsageAuxAdd(t *testing.T) {
+	old := config.AppConfig
+	defer func() { config.AppConfig = old }()
+	config.AppConfig = &config.Config{}
+	rd := &fakeReportDao{}
+	rs := &reportService{rd: rd}
+	ctx, _ := testChatContext()
+	ctx.Set(consts.UserID, int64(7))
+	ctx.Set(consts.PresetIDCtx, int64(3))
+	rs.ReportUsageAuxAdd(ctx, []usage.Record{
+		{Source: usage.SourceSummary, Model: "gpt-3.5-turbo", Tokens: 400},
+		{Source: usage.SourceRerank, Model: "gpt-3.5-turbo", Tokens: 150},
+		{Source: usage.SourceSummary, Model: "gpt-3.5-turbo", Tokens: 350},
+		{Source: usage.SourceSummary, Model: "gpt-4", Tokens: 100},
+	})
+	want := []entity.ReportUsageDaily{
+		{UserId: 7, PresetId: 3, Model: "gpt-3.5-turbo", Source: usage.SourceSummary, Requests: 2, Tokens: 750},
+		{UserId: 7, PresetId: 3, Model: "gpt-3.5-turbo", Source: usage.SourceRerank, Requests: 1, Tokens: 150},
+		{UserId: 7, PresetId: 3, Model: "gpt-4", Source: usage.SourceSummary, Requests: 1, Tokens: 100},
+	}
+	if len(rd.usages) != len(want) {
+		t.Fatalf("ReportUsageAuxAdd() rows = %+v, want %d rows", rd.usages, len(want))
+	}
+	for i, w := range want {
+		got := rd.usages[i]
+		if got.UserId != w.UserId || got.PresetId != w.PresetId || got.Model != w.Model || got.Source != w.Source || got.Requests != w.Requests || got.Tokens != w.Tokens {
+			t.Errorf("ReportUsageAuxAdd() row %d = %+v, want %+v", i, got, w)
+		}
+		if math.Abs(got.Charge-float64(w.Tokens)*consts.TokenPrice) > 1e-9 {
+			t.Errorf("ReportUsageAuxAdd() row %d charge = %v", i, got.Charge)
+		}
+	}
+}
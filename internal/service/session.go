@@ -0,0 +1,289 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-23 10:05:42
+ * @LastEditTime: 2023-06-23 10:05:42
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/session.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/jtime"
+	"chatserver-api/pkg/jwt"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/utils/uuid"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+var _ SessionService = (*sessionService)(nil)
+
+var errRefreshInvalid = errors.New("刷新令牌已失效")
+
+type SessionService interface {
+	SessionCreate(ctx *gin.Context, userId int64, role int) (res model.UserLoginRes, err error)
+	SessionRefresh(ctx *gin.Context, refreshToken string) (res model.UserLoginRes, err error)
+	SessionList(ctx *gin.Context) (res model.UserSessionListRes, err error)
+	SessionRevoke(ctx *gin.Context, sessionId int64) error
+	SessionRevokeAll(ctx context.Context, userId int64) error
+}
+
+// sessionService 登录会话管理，访问 token 有效期较短，刷新 token 每次使用后更换，
+// 已更换的刷新 token 再次出现时视为泄露并注销整个会话
+type sessionService struct {
+	ud   dao.UserDao
+	iSrv uuid.SnowNode
+	rc   *redis.Client
+}
+
+func NewSessionService(_ud dao.UserDao) *sessionService {
+	return &sessionService{
+		ud:   _ud,
+		iSrv: *uuid.NewNode(4),
+		rc:   cache.GetRedisClient(),
+	}
+}
+
+// SessionCreate 登录成功后创建会话并签发 token
+func (ss *sessionService) SessionCreate(ctx *gin.Context, userId int64, role int) (res model.UserLoginRes, err error) {
+	refreshToken, hash := refreshTokenGen()
+	now := time.Now()
+	session := entity.UserSession{
+		Id:          ss.iSrv.GenSnowID(),
+		UserId:      userId,
+		RefreshHash: hash,
+		Device:      sessionDevice(ctx.Request.UserAgent()),
+		Ip:          ctx.ClientIP(),
+		UserAgent:   ctx.Request.UserAgent(),
+		ExpiredAt:   jtime.JsonTime(now.Add(refreshTtl())),
+		LastUsedAt:  jtime.JsonTime(now),
+	}
+	if err = ss.ud.UserSessionCreate(ctx, &session); err != nil {
+		return
+	}
+	res, err = accessTokenGen(userId, role, session.Id)
+	res.RefreshToken = refreshToken
+	return
+}
+
+// SessionRefresh 使用刷新 token 换取新的访问 token 和刷新 token
+func (ss *sessionService) SessionRefresh(ctx *gin.Context, refreshToken string) (res model.UserLoginRes, err error) {
+	oldHash := refreshTokenHash(refreshToken)
+	session, err := ss.ud.UserSessionGetByHash(ctx, oldHash)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ss.sessionReuse(ctx, oldHash)
+		return res, errRefreshInvalid
+	}
+	if err != nil {
+		return
+	}
+	if session.IsRevoked || time.Now().After(time.Time(session.ExpiredAt)) {
+		return res, errRefreshInvalid
+	}
+	userInfo, err := ss.ud.UserGetById(ctx, session.UserId)
+	if err != nil {
+		return
+	}
+	if !userInfo.IsActive {
+		return res, errors.New("用户未激活")
+	}
+	if userInfo.IsBanned {
+		return res, errUserBanned
+	}
+
+	newToken, newHash := refreshTokenGen()
+	now := time.Now()
+	session.RefreshHash = newHash
+	session.Ip = ctx.ClientIP()
+	session.UserAgent = ctx.Request.UserAgent()
+	session.Device = sessionDevice(session.UserAgent)
+	session.LastUsedAt = jtime.JsonTime(now)
+	session.ExpiredAt = jtime.JsonTime(now.Add(refreshTtl()))
+	ok, err := ss.ud.UserSessionRotate(ctx, &session, oldHash)
+	if err != nil {
+		return
+	}
+	if !ok {
+		// 同一个刷新 token 被并发使用
+		logger.Warnf("会话%d刷新令牌重复使用，注销会话", session.Id)
+		ss.sessionRevoke(ctx, session.UserId, []int64{session.Id})
+		return res, errRefreshInvalid
+	}
+	used := fmt.Sprintf("%d:%d", session.UserId, session.Id)
+	if err := ss.rc.Set(ctx, consts.RefreshUsedPrefix+oldHash, used, refreshTtl()).Err(); err != nil {
+		logger.Errorf("Redis连接异常:%v", err.Error())
+	}
+	res, err = accessTokenGen(session.UserId, userInfo.Role, session.Id)
+	res.RefreshToken = newToken
+	return
+}
+
+// sessionReuse 已更换的刷新 token 被再次使用，说明刷新 token 可能泄露，注销其所属会话
+func (ss *sessionService) sessionReuse(ctx context.Context, hash string) {
+	used, err := ss.rc.Get(ctx, consts.RefreshUsedPrefix+hash).Result()
+	if err != nil {
+		if err != redis.Nil {
+			logger.Errorf("Redis连接异常:%v", err.Error())
+		}
+		return
+	}
+	var userId, sessionId int64
+	if _, err := fmt.Sscanf(used, "%d:%d", &userId, &sessionId); err != nil {
+		return
+	}
+	logger.Warnf("会话%d使用了已更换的刷新令牌，注销会话", sessionId)
+	ss.sessionRevoke(ctx, userId, []int64{sessionId})
+}
+
+// SessionList 返回当前用户的有效会话
+func (ss *sessionService) SessionList(ctx *gin.Context) (res model.UserSessionListRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	current := ctx.GetInt64(consts.SessionIDCtx)
+	sessions, err := ss.ud.UserSessionList(ctx, userId)
+	if err != nil {
+		return
+	}
+	res.Sessions = make([]model.UserSessionRes, 0, len(sessions))
+	for _, s := range sessions {
+		res.Sessions = append(res.Sessions, model.UserSessionRes{
+			SessionId:  strconv.FormatInt(s.Id, 10),
+			Device:     s.Device,
+			Ip:         s.Ip,
+			UserAgent:  s.UserAgent,
+			Current:    s.Id == current,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+		})
+	}
+	return
+}
+
+// SessionRevoke 注销当前用户的指定会话，sessionId 为 -1 时注销全部会话
+func (ss *sessionService) SessionRevoke(ctx *gin.Context, sessionId int64) error {
+	userId := ctx.GetInt64(consts.UserID)
+	if sessionId == -1 {
+		return ss.SessionRevokeAll(ctx, userId)
+	}
+	return ss.sessionRevoke(ctx, userId, []int64{sessionId})
+}
+
+// SessionRevokeAll 注销用户的全部会话，同时使未绑定会话的旧 token 失效
+func (ss *sessionService) SessionRevokeAll(ctx context.Context, userId int64) error {
+	sessions, err := ss.ud.UserSessionList(ctx, userId)
+	if err != nil {
+		return err
+	}
+	ttl := time.Duration(config.AppConfig.JwtConfig.JwtTtl)*time.Second + time.Minute
+	if err := jwt.RevokeUser(ctx, userId, ttl); err != nil {
+		logger.Errorf("Redis连接异常:%v", err.Error())
+		return err
+	}
+	ids := make([]int64, 0, len(sessions))
+	for _, s := range sessions {
+		ids = append(ids, s.Id)
+	}
+	return ss.sessionRevoke(ctx, userId, ids)
+}
+
+// sessionRevoke 注销会话并标记其访问 token 失效，只标记实际属于该用户的会话
+func (ss *sessionService) sessionRevoke(ctx context.Context, userId int64, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	revoked, err := ss.ud.UserSessionRevoke(ctx, userId, ids)
+	if err != nil {
+		return err
+	}
+	ttl := time.Duration(config.AppConfig.JwtConfig.JwtTtl)*time.Second + time.Minute
+	for _, id := range revoked {
+		if err := jwt.RevokeSession(ctx, id, ttl); err != nil {
+			logger.Errorf("Redis连接异常:%v", err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// accessTokenGen 签发绑定会话的访问 token
+func accessTokenGen(userId int64, role int, sessionId int64) (res model.UserLoginRes, err error) {
+	ttl := config.AppConfig.JwtConfig.JwtTtl
+	claims := jwt.BuildClaims(time.Now().Add(time.Duration(ttl)*time.Second), userId, role, sessionId)
+	res.Token, err = jwt.GenToken(claims, config.AppConfig.JwtConfig.Secret)
+	res.TimeOut = int(ttl) * 1000
+	return
+}
+
+func refreshTtl() time.Duration {
+	return time.Duration(config.AppConfig.JwtConfig.RefreshTtl) * time.Second
+}
+
+// refreshTokenGen 生成刷新 token，数据库中只保存其哈希
+func refreshTokenGen() (token, hash string) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, refreshTokenHash(token)
+}
+
+func refreshTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionDevice 由 User-Agent 粗略识别浏览器和操作系统
+func sessionDevice(ua string) string {
+	var browser, system string
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(ua, "MicroMessenger"):
+		browser = "WeChat"
+	case strings.Contains(ua, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	}
+	switch {
+	case strings.Contains(ua, "Windows"):
+		system = "Windows"
+	case strings.Contains(ua, "Android"):
+		system = "Android"
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		system = "iOS"
+	case strings.Contains(ua, "Mac OS X"):
+		system = "macOS"
+	case strings.Contains(ua, "Linux"):
+		system = "Linux"
+	}
+	switch {
+	case browser != "" && system != "":
+		return browser + " / " + system
+	case browser != "" || system != "":
+		return browser + system
+	}
+	return "未知设备"
+}
@@ -0,0 +1,60 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-29 10:12:46
+ * @LastEditTime: 2023-06-29 10:12:46
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/session_test.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/dao"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/jwt"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// fakeSessionUserDao 只注销 owned 中属于该用户的会话
+type fakeSessionUserDao struct {
+	dao.UserDao
+	owned map[int64]int64
+}
+
+func (f *fakeSessionUserDao) UserSessionRevoke(ctx context.Context, userId int64, sessionIds []int64) ([]int64, error) {
+	var revoked []int64
+	for _, id := range sessionIds {
+		if f.owned[id] == userId {
+			revoked = append(revoked, id)
+		}
+	}
+	return revoked, nil
+}
+
+func Test_sessionService_sessionRevoke(t *testing.T) {
+	old := config.AppConfig
+	defer func() { config.AppConfig = old }()
+	config.AppConfig = &config.Config{JwtConfig: config.JwtConfig{JwtTtl: 60}}
+	mr := miniredis.RunT(t)
+	cache.InitRedis(config.RedisConfig{Addr: mr.Addr()})
+	defer cache.CloseRedis()
+
+	ss := &sessionService{ud: &fakeSessionUserDao{owned: map[int64]int64{1: 100, 2: 100, 3: 200}}}
+	if err := ss.sessionRevoke(context.Background(), 100, []int64{1, 3, 4}); err != nil {
+		t.Fatalf("sessionRevoke() error = %v", err)
+	}
+	var got []int64
+	for _, id := range []int64{1, 2, 3, 4} {
+		if jwt.IsSessionRevoked(context.Background(), id) {
+			got = append(got, id)
+		}
+	}
+	// 其他用户的会话和不存在的会话不应写入 redis
+	if want := []int64{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("revoked sessions = %v, want %v", got, want)
+	}
+}
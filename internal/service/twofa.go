@@ -0,0 +1,362 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-23 15:40:26
+ * @LastEditTime: 2023-06-23 15:40:26
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/twofa.go
+ */
+package service
+
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/internal/dao"
+	"chatserver-api/internal/model"
+	"chatserver-api/internal/model/entity"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/totp"
+	"chatserver-api/utils/security"
+	"chatserver-api/utils/uuid"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+var _ TwoFAService = (*twoFAService)(nil)
+
+const (
+	// twoFALoginTTL 密码校验通过后输入验证码的时限
+	twoFALoginTTL = 5 * time.Minute
+	// twoFAPendingTTL 绑定身份验证器的时限
+	twoFAPendingTTL = 10 * time.Minute
+	// twoFAMaxAttempts 每个登录凭证允许的验证码错误次数
+	twoFAMaxAttempts    = 5
+	recoveryCodesNumber = 10
+
+	twoFAVerify = "verify"
+	twoFAEnroll = "enroll"
+)
+
+var errTwoFACode = errors.New("验证码错误")
+
+type TwoFAService interface {
+	TwoFAStatus(ctx *gin.Context) (res model.TwoFAStatusRes, err error)
+	TwoFAEnroll(ctx *gin.Context) (res model.TwoFAEnrollRes, err error)
+	TwoFAEnable(ctx *gin.Context, code string) (res model.TwoFARecoveryRes, err error)
+	TwoFADisable(ctx *gin.Context, code string) error
+	TwoFARecoveryReset(ctx *gin.Context, code string) (res model.TwoFARecoveryRes, err error)
+
+	TwoFALoginGate(ctx *gin.Context, userId int64, role int) (res model.UserLoginRes, err error)
+	TwoFALoginEnroll(ctx *gin.Context, mfaToken string) (res model.TwoFAEnrollRes, err error)
+	TwoFALogin(ctx *gin.Context, mfaToken, code string) (res model.UserLoginRes, err error)
+}
+
+type twoFAService struct {
+	ud   dao.UserDao
+	sSrv SessionService
+	lSrv LoginGuardService
+	iSrv uuid.SnowNode
+	rc   *redis.Client
+}
+
+func NewTwoFAService(_ud dao.UserDao, _sSrv SessionService, _lSrv LoginGuardService) *twoFAService {
+	return &twoFAService{
+		ud:   _ud,
+		sSrv: _sSrv,
+		lSrv: _lSrv,
+		iSrv: *uuid.NewNode(7),
+		rc:   cache.GetRedisClient(),
+	}
+}
+
+func (ts *twoFAService) TwoFAStatus(ctx *gin.Context) (res model.TwoFAStatusRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	res.Required = twoFARequired(ctx.GetInt(consts.RoleID))
+	_, err = ts.ud.UserTotpGet(ctx, userId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return res, nil
+	}
+	if err != nil {
+		return
+	}
+	res.Enabled = true
+	res.RecoveryRemaining, err = ts.ud.UserRecoveryCodeCount(ctx, userId)
+	return
+}
+
+// TwoFAEnroll 生成待绑定的密钥和二维码，输入验证码后才会开启
+func (ts *twoFAService) TwoFAEnroll(ctx *gin.Context) (res model.TwoFAEnrollRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	_, err = ts.ud.UserTotpGet(ctx, userId)
+	if err == nil {
+		return res, errors.New("已开启两步验证")
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return
+	}
+	return ts.twoFAPending(ctx, userId)
+}
+
+// TwoFAEnable 校验待绑定密钥的验证码并开启两步验证，返回恢复码
+func (ts *twoFAService) TwoFAEnable(ctx *gin.Context, code string) (res model.TwoFARecoveryRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	res.RecoveryCodes, err = ts.twoFAActivate(ctx, userId, code)
+	return
+}
+
+func (ts *twoFAService) TwoFADisable(ctx *gin.Context, code string) error {
+	userId := ctx.GetInt64(consts.UserID)
+	if twoFARequired(ctx.GetInt(consts.RoleID)) {
+		return errors.New("当前角色必须开启两步验证")
+	}
+	ok, err := ts.twoFAVerify(ctx, userId, code, true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errTwoFACode
+	}
+	return ts.ud.UserTotpDelete(ctx, userId)
+}
+
+// TwoFARecoveryReset 重新生成恢复码，需要身份验证器的验证码，原恢复码全部作废
+func (ts *twoFAService) TwoFARecoveryReset(ctx *gin.Context, code string) (res model.TwoFARecoveryRes, err error) {
+	userId := ctx.GetInt64(consts.UserID)
+	ok, err := ts.twoFAVerify(ctx, userId, code, false)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return res, errTwoFACode
+	}
+	codes, records := ts.recoveryCodesGen(userId)
+	if err = ts.ud.UserRecoveryCodeReset(ctx, userId, records); err != nil {
+		return
+	}
+	res.RecoveryCodes = codes
+	return
+}
+
+// TwoFALoginGate 密码或单点登录校验通过后调用，未开启且角色不要求两步验证时直接创建会话，
+// 否则返回登录凭证，由 TwoFALogin 完成第二步
+func (ts *twoFAService) TwoFALoginGate(ctx *gin.Context, userId int64, role int) (res model.UserLoginRes, err error) {
+	mode := twoFAVerify
+	_, err = ts.ud.UserTotpGet(ctx, userId)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if !twoFARequired(role) {
+			return ts.sSrv.SessionCreate(ctx, userId, role)
+		}
+		mode = twoFAEnroll
+	case err != nil:
+		return
+	}
+	res.MfaToken = totp.GenerateSecret()
+	key := consts.TwoFALoginPrefix + res.MfaToken
+	pipe := ts.rc.TxPipeline()
+	pipe.HSet(ctx, key, "user_id", userId, "mode", mode, "attempts", 0)
+	pipe.Expire(ctx, key, twoFALoginTTL)
+	if _, err = pipe.Exec(ctx); err != nil {
+		return res, err
+	}
+	res.TwoFactor = mode
+	return res, nil
+}
+
+// TwoFALoginEnroll 角色要求两步验证但尚未开启时，登录过程中绑定身份验证器
+func (ts *twoFAService) TwoFALoginEnroll(ctx *gin.Context, mfaToken string) (res model.TwoFAEnrollRes, err error) {
+	userId, mode, err := ts.twoFAChallenge(ctx, mfaToken)
+	if err != nil {
+		return
+	}
+	if mode != twoFAEnroll {
+		return res, errors.New("已开启两步验证")
+	}
+	return ts.twoFAPending(ctx, userId)
+}
+
+// TwoFALogin 登录第二步，校验验证码或恢复码后创建会话；绑定模式下同时开启两步验证并返回恢复码
+func (ts *twoFAService) TwoFALogin(ctx *gin.Context, mfaToken, code string) (res model.UserLoginRes, err error) {
+	userId, mode, err := ts.twoFAChallenge(ctx, mfaToken)
+	if err != nil {
+		return
+	}
+	if err = ts.lSrv.LoginCheck(ctx, userId, consts.Login2FA); err != nil {
+		return
+	}
+	key := consts.TwoFALoginPrefix + mfaToken
+	var codes []string
+	if mode == twoFAEnroll {
+		codes, err = ts.twoFAActivate(ctx, userId, code)
+	} else {
+		var ok bool
+		if ok, err = ts.twoFAVerify(ctx, userId, code, true); err == nil && !ok {
+			err = errTwoFACode
+		}
+	}
+	if err != nil {
+		if errors.Is(err, errTwoFACode) {
+			ts.lSrv.LoginFailed(ctx, userId, consts.Login2FA)
+			if n, _ := ts.rc.HIncrBy(ctx, key, "attempts", 1).Result(); n >= twoFAMaxAttempts {
+				logger.Warnf("用户%d两步验证错误次数过多", userId)
+				ts.rc.Del(ctx, key)
+			}
+		}
+		return
+	}
+	ts.rc.Del(ctx, key)
+	userInfo, err := ts.ud.UserGetById(ctx, userId)
+	if err != nil {
+		return
+	}
+	res, err = ts.sSrv.SessionCreate(ctx, userId, userInfo.Role)
+	if err != nil {
+		return
+	}
+	ts.lSrv.LoginSucceeded(ctx, userId, consts.Login2FA)
+	res.RecoveryCodes = codes
+	return
+}
+
+// twoFAChallenge 读取登录凭证对应的用户和模式
+func (ts *twoFAService) twoFAChallenge(ctx context.Context, mfaToken string) (userId int64, mode string, err error) {
+	data, err := ts.rc.HGetAll(ctx, consts.TwoFALoginPrefix+mfaToken).Result()
+	if err != nil {
+		return
+	}
+	if len(data) == 0 {
+		return 0, "", errors.New("登录已过期，请重新登录")
+	}
+	userId, err = strconv.ParseInt(data["user_id"], 10, 64)
+	return userId, data["mode"], err
+}
+
+// twoFAPending 生成密钥并暂存，等待用户输入验证码确认绑定
+func (ts *twoFAService) twoFAPending(ctx context.Context, userId int64) (res model.TwoFAEnrollRes, err error) {
+	userInfo, err := ts.ud.UserGetById(ctx, userId)
+	if err != nil {
+		return
+	}
+	res.Secret = totp.GenerateSecret()
+	res.URL = totp.KeyURI(config.AppConfig.TwoFAConfig.Issuer, userInfo.Username, res.Secret)
+	if res.QRCode, err = totp.QRCode(res.URL); err != nil {
+		return
+	}
+	err = ts.rc.Set(ctx, consts.TwoFAPendingPrefix+strconv.FormatInt(userId, 10), res.Secret, twoFAPendingTTL).Err()
+	return
+}
+
+// twoFAActivate 校验待绑定密钥的验证码，保存加密后的密钥和恢复码
+func (ts *twoFAService) twoFAActivate(ctx context.Context, userId int64, code string) (codes []string, err error) {
+	pendingKey := consts.TwoFAPendingPrefix + strconv.FormatInt(userId, 10)
+	secret, err := ts.rc.Get(ctx, pendingKey).Result()
+	if err == redis.Nil {
+		return nil, errors.New("请先获取绑定二维码")
+	}
+	if err != nil {
+		return
+	}
+	counter, ok := totp.Verify(secret, code, time.Now())
+	if !ok {
+		return nil, errTwoFACode
+	}
+	encrypted, err := twoFASecretEncrypt(secret)
+	if err != nil {
+		return
+	}
+	codes, records := ts.recoveryCodesGen(userId)
+	record := entity.UserTotp{UserId: userId, Secret: encrypted, LastCounter: counter}
+	if err = ts.ud.UserTotpCreate(ctx, &record, records); err != nil {
+		return nil, err
+	}
+	ts.rc.Del(ctx, pendingKey)
+	logger.Infof("用户%d开启两步验证", userId)
+	return codes, nil
+}
+
+// twoFAVerify 校验身份验证器的验证码，allowRecovery 为 true 时也接受恢复码
+func (ts *twoFAService) twoFAVerify(ctx context.Context, userId int64, code string, allowRecovery bool) (bool, error) {
+	record, err := ts.ud.UserTotpGet(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	secret, err := twoFASecretDecrypt(record.Secret)
+	if err != nil {
+		return false, err
+	}
+	if counter, ok := totp.Verify(secret, code, time.Now()); ok {
+		// 同一时间步的验证码只能使用一次
+		return ts.ud.UserTotpUse(ctx, userId, counter)
+	}
+	if !allowRecovery {
+		return false, nil
+	}
+	ok, err := ts.ud.UserRecoveryCodeUse(ctx, userId, totp.HashRecoveryCode(code))
+	if ok {
+		logger.Infof("用户%d使用恢复码登录", userId)
+	}
+	return ok, err
+}
+
+func (ts *twoFAService) recoveryCodesGen(userId int64) ([]string, []entity.UserRecoveryCode) {
+	codes := totp.GenerateRecoveryCodes(recoveryCodesNumber)
+	records := make([]entity.UserRecoveryCode, len(codes))
+	for i, c := range codes {
+		records[i] = entity.UserRecoveryCode{
+			Id:       ts.iSrv.GenSnowID(),
+			UserId:   userId,
+			CodeHash: totp.HashRecoveryCode(c),
+		}
+	}
+	return codes, records
+}
+
+func twoFARequired(role int) bool {
+	for _, r := range config.AppConfig.TwoFAConfig.RequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// twoFASecretKey 密钥使用由 jwt 密钥派生的 AES-256 密钥加密保存
+func twoFASecretKey() []byte {
+	sum := sha256.Sum256([]byte("totp:" + config.AppConfig.JwtConfig.Secret))
+	return sum[:]
+}
+
+// twoFAGcmPrefix AES-GCM 加密的密钥前缀，没有前缀的是早期以 AES-CBC 加密保存的密钥
+const twoFAGcmPrefix = "gcm:"
+
+func twoFASecretEncrypt(secret string) (string, error) {
+	data, err := security.AesGcmEncrypt([]byte(secret), twoFASecretKey())
+	if err != nil {
+		return "", err
+	}
+	return twoFAGcmPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func twoFASecretDecrypt(secret string) (string, error) {
+	legacy := !strings.HasPrefix(secret, twoFAGcmPrefix)
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, twoFAGcmPrefix))
+	if err != nil {
+		return "", err
+	}
+	var plain []byte
+	if legacy {
+		plain, err = security.AesDecrypt(data, twoFASecretKey())
+	} else {
+		plain, err = security.AesGcmDecrypt(data, twoFASecretKey())
+	}
+	return string(plain), err
+}
@@ -0,0 +1,46 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-29 11:05:18
+ * @LastEditTime: 2023-06-29 11:05:18
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/internal/service/twofa_test.go
+ */
+package service
+
+import (
+	"chatserver-api/pkg/config"
+	"chatserver-api/utils/security"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func Test_twoFASecretEncrypt(t *testing.T) {
+	old := config.AppConfig
+	defer func() { config.AppConfig = old }()
+	config.AppConfig = &config.Config{JwtConfig: config.JwtConfig{Secret: "secret"}}
+	const secret = "JBSWY3DPEHPK3PXP"
+
+	a, err := twoFASecretEncrypt(secret)
+	if err != nil {
+		t.Fatalf("twoFASecretEncrypt() error = %v", err)
+	}
+	b, _ := twoFASecretEncrypt(secret)
+	if !strings.HasPrefix(a, twoFAGcmPrefix) || a == b {
+		t.Errorf("twoFASecretEncrypt() = %q, %q, want distinct gcm ciphertexts", a, b)
+	}
+	if got, err := twoFASecretDecrypt(a); err != nil || got != secret {
+		t.Errorf("twoFASecretDecrypt() = %q, %v, want %q", got, err, secret)
+	}
+
+	// 早期以 AES-CBC 保存的密钥仍可解密
+	data, _ := security.AesEncrypt([]byte(secret), twoFASecretKey())
+	if got, err := twoFASecretDecrypt(base64.StdEncoding.EncodeToString(data)); err != nil || got != secret {
+		t.Errorf("twoFASecretDecrypt() legacy = %q, %v, want %q", got, err, secret)
+	}
+
+	config.AppConfig = &config.Config{JwtConfig: config.JwtConfig{Secret: "other"}}
+	if _, err := twoFASecretDecrypt(a); err == nil {
+		t.Errorf("twoFASecretDecrypt() with another key should fail")
+	}
+}
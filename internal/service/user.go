@@ -26,7 +26,6 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"math/rand"
 	"os"
 	"regexp"
 	"strconv"
@@ -35,24 +34,31 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
 )
 
 var _ UserService = (*userService)(nil)
 
+var errUserBanned = errors.New("账户已被封禁")
+
+// IsUserBanned 判断错误是否由账户被封禁引起
+func IsUserBanned(err error) bool {
+	return errors.Is(err, errUserBanned)
+}
+
 type UserService interface {
 	// UserGetByID(ctx context.Context, uid int64) (user entity.User, err error)
 	UserRegister(ctx *gin.Context, req model.UserRegisterReq) (res model.UserRegisterRes, err error)
 	UserDelete(ctx *gin.Context) error
-	UserLogin(ctx context.Context, username, password string) (res model.UserLoginRes, err error)
-	UserLogout(ctx context.Context, tokenstr string) error
-	UserRefresh(ctx *gin.Context) (res model.UserLoginRes, err error)
+	UserLogin(ctx *gin.Context, username, password string) (res model.UserLoginRes, err error)
+	UserLogout(ctx *gin.Context, tokenstr string) error
 
 	UserGetInfo(ctx context.Context, userId int64) (res model.UserGetInfoRes, err error)
 	UserGetAvatar(ctx *gin.Context) (res model.UserAvatarRes, err error)
 	UserBillGet(ctx *gin.Context, req model.UserBillGetReq) (res model.UserBillListRes, err error)
 
 	UserGetBalance(ctx context.Context, userId int64) (balance float64, err error)
-	UserBalanceChange(ctx context.Context, userId int64, oldbalance, amount float64, comment string) (err error)
+	UserBalanceChange(ctx context.Context, userId int64, amount float64, comment string) (err error)
 
 	UserVerifyEmail(ctx *gin.Context, email string) (res model.UserVerifyEmailRes, err error)
 	UserVerifyUserName(ctx context.Context, username string) (res model.UserVerifyUserNameRes, err error)
@@ -63,6 +69,7 @@ type UserService interface {
 	UserPasswordForget(ctx *gin.Context) (err error)
 
 	UserActiveGen(ctx *gin.Context) (err error)
+	UserActiveResend(ctx *gin.Context, userId int64) error
 	UserActiveChange(ctx *gin.Context) (err error)
 	UserActiveVerify(ctx *gin.Context) bool
 	UserTempCodeVerify(ctx *gin.Context, tempcode string) (Isvalid bool)
@@ -77,23 +84,32 @@ type UserService interface {
 	UserCDkeyPay(ctx *gin.Context, codekey string) error
 
 	CaptchaGen(ctx *gin.Context) (res model.CaptchaRes, err error)
-	CaptchaVerify(ctx *gin.Context, code string) bool
+	CaptchaVerify(ctx *gin.Context, captchaId, code string) bool
+	CaptchaRequired(ctx *gin.Context, username string) bool
 }
 
 // userService 实现UserService接口
 type userService struct {
 	ud   dao.UserDao
 	kd   dao.CDkeyDao
+	sSrv SessionService
+	tSrv TwoFAService
+	lSrv LoginGuardService
 	iSrv uuid.SnowNode
 	rc   *redis.Client
+	cp   verification.Provider
 }
 
-func NewUserService(_ud dao.UserDao, _kd dao.CDkeyDao) *userService {
+func NewUserService(_ud dao.UserDao, _kd dao.CDkeyDao, _sSrv SessionService, _tSrv TwoFAService, _lSrv LoginGuardService) *userService {
 	return &userService{
 		ud:   _ud,
 		kd:   _kd,
+		sSrv: _sSrv,
+		tSrv: _tSrv,
+		lSrv: _lSrv,
 		iSrv: *uuid.NewNode(3),
 		rc:   cache.GetRedisClient(),
+		cp:   verification.NewProvider(config.AppConfig.CaptchaConfig),
 	}
 }
 
@@ -110,67 +126,44 @@ func (us *userService) UserActiveVerify(ctx *gin.Context) bool {
 	return true
 }
 
-func (us *userService) UserLogin(ctx context.Context, username, password string) (res model.UserLoginRes, err error) {
+func (us *userService) UserLogin(ctx *gin.Context, username, password string) (res model.UserLoginRes, err error) {
+	if err = us.lSrv.LoginCheck(ctx, 0, consts.LoginPassword); err != nil {
+		return
+	}
 	userInfo, err := us.ud.UserGetByName(ctx, username)
 	if err != nil {
 		logger.Infof("查询用户失败%s", err)
 		return res, err
 	}
-	if userInfo.IsActive != true {
-		err = errors.New("用户未激活")
-		return res, err
-	}
-
-	if !security.ValidatePassword(security.PasswordDecryption(password, consts.CBCKEY), userInfo.Password) {
-		err = errors.New("Password Error")
-		logger.Infof("密码错误%s", username)
-		return res, err
+	// 用户不存在时 Id 为 0，只计入IP失败次数
+	if err = us.lSrv.LoginCheck(ctx, userInfo.Id, consts.LoginPassword); err != nil {
+		return
 	}
-	r := rand.New(rand.NewSource(time.Now().Unix()))
-	num := r.Intn(100)
-	settime := config.AppConfig.JwtConfig.JwtTtl + int64(num*9)
-	timeOut := time.Duration(settime) * time.Second
-	expireAt := time.Now().Add(timeOut)
-	claims := jwt.BuildClaims(expireAt, userInfo.Id, userInfo.Role)
-	token, err := jwt.GenToken(claims, config.AppConfig.JwtConfig.Secret)
+	plain, err := passwordPlain(ctx, password)
 	if err != nil {
-		logger.Infof("JWTTOKEN生成错误%s", username)
-		return res, err
+		return
 	}
-	res.Token = token
-	res.TimeOut = int(settime) * 1000
-	return res, err
-}
-
-func (us *userService) UserRefresh(ctx *gin.Context) (res model.UserLoginRes, err error) {
-	userId := ctx.GetInt64(consts.UserID)
-	tokenStr := ctx.GetString(consts.JWTTokenCtx)
-	userInfo, err := us.ud.UserGetById(ctx, userId)
-	if err != nil {
-		logger.Infof("查询用户失败%s", err)
+	if !security.PasswordVerify(plain, userInfo.Password) {
+		us.lSrv.LoginFailed(ctx, userInfo.Id, consts.LoginPassword)
+		err = errors.New("Password Error")
+		logger.Infof("密码错误%s", username)
 		return res, err
 	}
 	if userInfo.IsActive != true {
 		err = errors.New("用户未激活")
 		return res, err
 	}
-	r := rand.New(rand.NewSource(time.Now().Unix()))
-	num := r.Intn(100)
-	settime := config.AppConfig.JwtConfig.JwtTtl + int64(num*9)
-	timeOut := time.Duration(settime) * time.Second
-	expireAt := time.Now().Add(timeOut)
-	claims := jwt.BuildClaims(expireAt, userId, userInfo.Role)
-	token, err := jwt.GenToken(claims, config.AppConfig.JwtConfig.Secret)
-	if err != nil {
-		logger.Infof("JWTTOKEN生成错误%s", userInfo.Username)
-
-		return res, err
+	if userInfo.IsBanned {
+		return res, errUserBanned
 	}
-	res.Token = token
-	res.TimeOut = int(settime) * 1000
-	err = jwt.JoinBlackList(ctx, tokenStr, config.AppConfig.JwtConfig.Secret)
+	us.userPasswordRehash(ctx, userInfo.Id, plain, userInfo.Password)
+	res, err = us.tSrv.TwoFALoginGate(ctx, userInfo.Id, userInfo.Role)
 	if err != nil {
-		logger.Infof("加入黑名单失败%s", userInfo.Username)
+		logger.Infof("JWTTOKEN生成错误%s", username)
+		return
+	}
+	if res.MfaToken == "" {
+		us.lSrv.LoginSucceeded(ctx, userInfo.Id, consts.LoginPassword)
 	}
 	return res, err
 }
@@ -220,27 +213,25 @@ func (us *userService) UserGetBalance(ctx context.Context, userId int64) (balanc
 	return balance, nil
 }
 
-func (us *userService) UserBalanceChange(ctx context.Context, userId int64, oldbalance, amount float64, comment string) (err error) {
-
-	newbalance := oldbalance + amount
-	user := entity.User{}
-	user.Id = userId
-	user.Balance = newbalance
-	err = us.ud.UserUpdate(ctx, &user)
-	if err != nil {
-		return err
-	}
+// UserBalanceChange 原子增减余额并写入账单，并发扣费不会互相覆盖
+func (us *userService) UserBalanceChange(ctx context.Context, userId int64, amount float64, comment string) (err error) {
 	bill := entity.Bill{}
 	bill.Id = us.iSrv.GenSnowID()
 	bill.UserId = userId
 	bill.CostChange = amount
-	bill.Balance = newbalance
 	bill.CostComment = comment
-	err = us.ud.UserBillCreate(ctx, &bill)
-	if err != nil {
-		logger.Errorf("UserBillCreate失败:%v", err.Error())
+	// 通过 API Key 调用时记录消费来源
+	if keyId, ok := ctx.Value(consts.ApiKeyIDCtx).(int64); ok {
+		bill.ApiKeyId = keyId
+	}
+	// 管理员手动调整余额时记录操作人
+	if operatorId, ok := ctx.Value(consts.OperatorIDCtx).(int64); ok {
+		bill.OperatorId = operatorId
+	}
+	if err = us.ud.UserBalanceChange(ctx, &bill); err != nil {
+		return err
 	}
-	err = us.rc.SetXX(ctx, consts.UserBalancePrefix+strconv.FormatInt(userId, 10), newbalance, 0).Err()
+	err = us.rc.SetXX(ctx, consts.UserBalancePrefix+strconv.FormatInt(userId, 10), bill.Balance, 0).Err()
 	if err != nil {
 		logger.Errorf("UserBalance更新存储Cache失败:%v", err.Error())
 	}
@@ -276,6 +267,7 @@ func (us *userService) UserGetInfo(ctx context.Context, userId int64) (res model
 	res.Username = user.Username
 	res.Phone = user.Phone
 	res.Role = consts.RoleToString[user.Role]
+	res.DeleteAt = user.DeleteAt
 	// res.ExpiredAt = jtime.JsonTime(user.ExpiredAt)
 	jsonbyte, err = json.Marshal(res)
 	if err != nil {
@@ -307,7 +299,11 @@ func (us *userService) UserRegister(ctx *gin.Context, req model.UserRegisterReq)
 	if err != nil {
 		return res, err
 	}
-	user.Password, err = security.Encrypt(security.PasswordDecryption(req.Password, consts.CBCKEY))
+	plain, err := passwordPlain(ctx, req.Password)
+	if err != nil {
+		return res, err
+	}
+	user.Password, err = passwordHash(plain)
 	if err != nil {
 		return res, err
 	}
@@ -327,7 +323,8 @@ func (us *userService) UserPasswordVerify(ctx *gin.Context, password string) (Is
 		logger.Infof("查询用户失败%s", err)
 		return
 	}
-	if !security.ValidatePassword(security.PasswordDecryption(password, consts.CBCKEY), userInfo.Password) {
+	plain, err := passwordPlain(ctx, password)
+	if err != nil || !security.PasswordVerify(plain, userInfo.Password) {
 		// err = errors.New("Password Error")
 		logger.Infof("密码错误%s", userInfo.Username)
 		return
@@ -339,12 +336,34 @@ func (us *userService) UserPasswordModify(ctx *gin.Context, password string) (er
 	user := entity.User{}
 	userId := ctx.GetInt64(consts.UserID)
 	user.Id = userId
-	user.Password, err = security.Encrypt(security.PasswordDecryption(password, consts.CBCKEY))
+	plain, err := passwordPlain(ctx, password)
 	if err != nil {
 		return err
 	}
-	err = us.ud.UserUpdate(ctx, &user)
-	return err
+	user.Password, err = passwordHash(plain)
+	if err != nil {
+		return err
+	}
+	if err = us.ud.UserUpdate(ctx, &user); err != nil {
+		return err
+	}
+	// 修改密码后注销全部登录会话
+	return us.sSrv.SessionRevokeAll(ctx, userId)
+}
+
+// userPasswordRehash 登录成功后将旧算法或旧参数的密码哈希升级为当前配置
+func (us *userService) userPasswordRehash(ctx *gin.Context, userId int64, plain, hash string) {
+	if !security.PasswordNeedsRehash(hash, passwordParams()) {
+		return
+	}
+	newHash, err := passwordHash(plain)
+	if err != nil {
+		logger.Errorf("密码哈希升级失败:%v", err.Error())
+		return
+	}
+	if err := us.ud.UserUpdate(ctx, &entity.User{Id: userId, Password: newHash}); err != nil {
+		logger.Errorf("密码哈希升级失败:%v", err.Error())
+	}
 }
 
 func (us *userService) UserPasswordForget(ctx *gin.Context) (err error) {
@@ -401,7 +420,11 @@ func (us *userService) UserUpdateNickName(ctx context.Context, userId int64, nic
 	return
 }
 
-func (us *userService) UserLogout(ctx context.Context, tokenstr string) error {
+// UserLogout 注销当前会话，未绑定会话的旧 token 加入黑名单
+func (us *userService) UserLogout(ctx *gin.Context, tokenstr string) error {
+	if sessionId := ctx.GetInt64(consts.SessionIDCtx); sessionId != 0 {
+		return us.sSrv.SessionRevoke(ctx, sessionId)
+	}
 	return jwt.JoinBlackList(ctx, tokenstr, config.AppConfig.JwtConfig.Secret)
 }
 
@@ -460,6 +483,26 @@ func (us *userService) UserActiveGen(ctx *gin.Context) (err error) {
 	return
 }
 
+// UserActiveResend 管理员为未激活的用户重新发送激活邮件
+func (us *userService) UserActiveResend(ctx *gin.Context, userId int64) error {
+	userInfo, err := us.ud.UserGetById(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if userInfo.Username == "" {
+		return errors.New("用户不存在")
+	}
+	if userInfo.IsActive {
+		return errors.New("用户已激活")
+	}
+	code, err := active.ActiveCodeGen(ctx, userId)
+	if err != nil {
+		return err
+	}
+	tempcode := base64.StdEncoding.EncodeToString([]byte(code + "|" + userInfo.Username))
+	return mail.SendActiceCode(userInfo.Email, userInfo.Nickname, tempcode)
+}
+
 func (us *userService) UserActiveChange(ctx *gin.Context) (err error) {
 	userId := ctx.GetInt64(consts.UserID)
 	user := entity.User{}
@@ -469,7 +512,7 @@ func (us *userService) UserActiveChange(ctx *gin.Context) (err error) {
 	if err != nil {
 		return err
 	}
-	us.UserBalanceChange(ctx, userId, 0, consts.RegisterReward, "奖励-新用户注册")
+	us.UserBalanceChange(ctx, userId, consts.RegisterReward, "奖励-新用户注册")
 	us.UserInviteReward(ctx)
 	for i := 1; i <= 3; i++ {
 		_, err = us.UserInviteGen(ctx)
@@ -488,26 +531,46 @@ func (us *userService) UserCDkeyPay(ctx *gin.Context, key string) error {
 	userId := ctx.GetInt64(consts.UserID)
 	keyId := uuid.CodeToId(key)
 	if keyId == 0 {
-		return errors.New("CDKEY ERROR")
+		return errors.New("卡密错误")
+	}
+	cdkey, err := us.kd.CdKeyGet(ctx, keyId)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && cdkey.CodeKey != key) {
+		return errors.New("卡密错误")
 	}
-	keyAmount, err := us.kd.CdKeyQuery(ctx, keyId)
 	if err != nil {
 		return err
 	}
-	if keyAmount.CodeKey != key {
-		return errors.New("CDKEY ERROR")
+	switch {
+	case cdkey.Status == consts.CdKeyRedeemed:
+		return errors.New("卡密已被使用")
+	case cdkey.Status == consts.CdKeyRevoked:
+		return errors.New("卡密已作废")
+	case cdkey.ExpiredAt != nil && time.Now().After(time.Time(*cdkey.ExpiredAt)):
+		return errors.New("卡密已过期")
 	}
-	balance, err := us.UserGetBalance(ctx, userId)
-	if err != nil {
-		return err
+	redemption := entity.CdKeyRedemption{
+		Id:         us.iSrv.GenSnowID(),
+		CdKeyId:    keyId,
+		CodeKey:    key,
+		GiftCardId: cdkey.GiftCardId,
+		UserId:     userId,
+	}
+	bill := entity.Bill{
+		Id:          us.iSrv.GenSnowID(),
+		UserId:      userId,
+		CostComment: "充值-积分充值卡核销",
+	}
+	// 核销与加余额在同一事务中完成，并发兑换时只有一个请求成功
+	err = us.kd.CdKeyRedeem(ctx, &redemption, &bill)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("卡密已被使用")
 	}
-	err = us.UserBalanceChange(ctx, userId, balance, keyAmount.CardAmount, "充值-积分充值卡核销")
 	if err != nil {
 		return err
 	}
-	err = us.kd.CdKeyDelete(ctx, keyId)
+	err = us.rc.SetXX(ctx, consts.UserBalancePrefix+strconv.FormatInt(userId, 10), bill.Balance, 0).Err()
 	if err != nil {
-		logger.Errorf("CDKEY删除异常：%v", err)
+		logger.Errorf("UserBalance更新存储Cache失败:%v", err.Error())
 	}
 	return nil
 }
@@ -606,22 +669,12 @@ func (us *userService) UserInviteReward(ctx *gin.Context) {
 		logger.Errorf("invite_userId:%v 序列化失败", invite_str)
 		return
 	}
-	inviteuser_banlance, err := us.UserGetBalance(ctx, invite_userId)
-	if err != nil {
-		logger.Errorf("invite_userId:%v 获取用户余额失败", invite_userId)
-		return
-	}
-	err = us.UserBalanceChange(ctx, invite_userId, inviteuser_banlance, consts.InviteReward, "奖励-邀请新用户成功")
+	err = us.UserBalanceChange(ctx, invite_userId, consts.InviteReward, "奖励-邀请新用户成功")
 	if err != nil {
 		logger.Errorf("UserID：%v 获取奖励失败", invite_userId)
 		return
 	}
-	currentuser_banlance, err := us.UserGetBalance(ctx, current_userId)
-	if err != nil {
-		logger.Errorf("invite_userId:%v 获取用户余额失败", current_userId)
-		return
-	}
-	err = us.UserBalanceChange(ctx, current_userId, currentuser_banlance, consts.InviteReward, "奖励-受邀请注册")
+	err = us.UserBalanceChange(ctx, current_userId, consts.InviteReward, "奖励-受邀请注册")
 	if err != nil {
 		logger.Errorf("current_userId:%v 获取奖励失败", current_userId)
 		return
@@ -705,11 +758,33 @@ func (us *userService) UserGiftCardListGet(ctx *gin.Context) (res model.GiftCard
 }
 
 func (us *userService) CaptchaGen(ctx *gin.Context) (res model.CaptchaRes, err error) {
-	image, err := verification.GenerateCaptcha(ctx)
-	res.Image = image
+	ch, err := us.cp.Challenge(ctx)
+	if err != nil {
+		return
+	}
+	res.Provider = ch.Provider
+	res.CaptchaId = ch.Id
+	res.Image = ch.Image
+	res.SiteKey = ch.SiteKey
 	return
 }
 
-func (us *userService) CaptchaVerify(ctx *gin.Context, code string) bool {
-	return verification.VerifyCaptcha(ctx, code)
+func (us *userService) CaptchaVerify(ctx *gin.Context, captchaId, code string) bool {
+	ok, err := us.cp.Verify(ctx, captchaId, code, ctx.ClientIP())
+	if err != nil {
+		logger.Errorf("验证码校验失败:%v", err.Error())
+	}
+	return ok
+}
+
+// CaptchaRequired 登录时仅在该IP或账户近期有登录失败记录后才需要验证码
+func (us *userService) CaptchaRequired(ctx *gin.Context, username string) bool {
+	if config.AppConfig.CaptchaConfig.Always {
+		return true
+	}
+	userInfo, err := us.ud.UserGetByName(ctx, username)
+	if err != nil {
+		return true
+	}
+	return us.lSrv.LoginRisky(ctx, userInfo.Id)
 }
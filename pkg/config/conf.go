@@ -8,27 +8,42 @@
 package config
 
 type Config struct {
-	Mode          string        `mapstructure:"mode"`           // gin启动模式
-	Port          string        `mapstructure:"port"`           // 启动端口
-	AppName       string        `mapstructure:"app-name"`       //应用名称
-	Url           string        `mapstructure:"url"`            // 应用地址,用于自检 eg. http://127.0.0.1
-	MaxPingCount  int           `mapstructure:"max-ping-count"` // 最大自检次数，用户健康检查
-	Language      string        `mapstructure:"language"`       // 项目语言
-	ExternalURL   string        `mapstructure:"externalurl"`
-	JwtConfig     JwtConfig     `mapstructure:"jwt"`
-	OpenAIConfig  OpenAIConfig  `mapstructure:"openai"`
-	EmailCofig    EmailCofig    `mapstructure:"email"`
-	DBConfig      DBConfig      `mapstructure:"database"` // 数据库信息
-	RedisConfig   RedisConfig   `mapstructure:"redis"`    // redis
-	LogConfig     LogConfig     `mapstructure:"log"`      // uber z
-	CustomConfig  CustomConfig  `mapstructure:"custom"`
-	TencentConfig TencentConfig `mapstructure:"tencent"`
-	GoogelConfig  GoogelConfig  `mapstructure:"google"`
+	Mode           string         `mapstructure:"mode"`           // gin启动模式
+	Port           string         `mapstructure:"port"`           // 启动端口
+	AppName        string         `mapstructure:"app-name"`       //应用名称
+	Url            string         `mapstructure:"url"`            // 应用地址,用于自检 eg. http://127.0.0.1
+	MaxPingCount   int            `mapstructure:"max-ping-count"` // 最大自检次数，用户健康检查
+	Language       string         `mapstructure:"language"`       // 项目语言
+	ExternalURL    string         `mapstructure:"externalurl"`
+	TrustedProxies []string       `mapstructure:"trustedproxies"` // 可信反向代理的 IP 或网段，只有来自这些地址的 X-Forwarded-For/Proto 才被采信
+	JwtConfig      JwtConfig      `mapstructure:"jwt"`
+	OpenAIConfig   OpenAIConfig   `mapstructure:"openai"`
+	EmailCofig     EmailCofig     `mapstructure:"email"`
+	DBConfig       DBConfig       `mapstructure:"database"` // 数据库信息
+	RedisConfig    RedisConfig    `mapstructure:"redis"`    // redis
+	LogConfig      LogConfig      `mapstructure:"log"`      // uber z
+	CustomConfig   CustomConfig   `mapstructure:"custom"`
+	TencentConfig  TencentConfig  `mapstructure:"tencent"`
+	GoogelConfig   GoogelConfig   `mapstructure:"google"`
+	SearchConfig   SearchConfig   `mapstructure:"search"`
+	CrawlConfig    CrawlConfig    `mapstructure:"crawl"`
+	RerankConfig   RerankConfig   `mapstructure:"rerank"`
+	RewriteConfig  RewriteConfig  `mapstructure:"rewrite"`
+	OIDCConfig     OIDCConfig     `mapstructure:"oidc"`
+	TwoFAConfig    TwoFAConfig    `mapstructure:"twofa"`
+	AccountConfig  AccountConfig  `mapstructure:"account"`
+	LoginConfig    LoginConfig    `mapstructure:"login"`
+	PasswordConfig PasswordConfig `mapstructure:"password"`
+	CaptchaConfig  CaptchaConfig  `mapstructure:"captcha"`
+	PaymentConfig  PaymentConfig  `mapstructure:"payment"`
+	ReportConfig   ReportConfig   `mapstructure:"report"`
+	GatewayConfig  GatewayConfig  `mapstructure:"gateway"`
 }
 
 type JwtConfig struct {
 	Secret                  string `mapstructure:"secret"`
-	JwtTtl                  int64  `mapstructure:"ttl"`             // token 有效期（秒）
+	JwtTtl                  int64  `mapstructure:"ttl"`             // 访问 token 有效期（秒）
+	RefreshTtl              int64  `mapstructure:"refreshttl"`      // 刷新 token 有效期（秒）
 	JwtBlacklistGracePeriod int64  `mapstructure:"blacklistperiod"` // 黑名单宽限时间（秒）
 }
 
@@ -40,6 +55,134 @@ type GoogelConfig struct {
 	ApiKey string `mapstructure:"apikey"`
 	CxId   string `mapstructure:"cxid"`
 }
+
+// SearchConfig 联网搜索配置
+type SearchConfig struct {
+	Providers        []string `mapstructure:"providers"`        // 默认搜索引擎及回退顺序 google, bing, searxng, duckduckgo, wikipedia
+	Region           string   `mapstructure:"region"`           // 搜索地区，如 CN，空表示不限制
+	Language         string   `mapstructure:"language"`         // 搜索语言，如 zh-CN，空表示不限制
+	Timeout          int      `mapstructure:"timeout"`          // 单个搜索引擎超时时间(秒)
+	BingKey          string   `mapstructure:"bingkey"`          // Bing Web Search API 密钥
+	BingURL          string   `mapstructure:"bingurl"`          // Bing Web Search API 地址
+	SearxngURL       string   `mapstructure:"searxngurl"`       // SearXNG 实例地址，需开启 json 输出格式
+	WikiLang         string   `mapstructure:"wikilang"`         // Wikipedia 语言站点，如 zh
+	Ner              string   `mapstructure:"ner"`              // 实体检测方式 local 本地 jieba, tencent 腾讯云NLP
+	Planner          bool     `mapstructure:"planner"`          // 是否使用模型规划搜索
+	PlannerModel     string   `mapstructure:"plannermodel"`     // 搜索规划模型
+	SummaryModel     string   `mapstructure:"summarymodel"`     // 网页摘要模型
+	SummaryLanguage  string   `mapstructure:"summarylanguage"`  // 网页摘要语言
+	SummaryWords     int      `mapstructure:"summarywords"`     // 网页摘要字数
+	SummaryMaxTokens int      `mapstructure:"summarymaxtokens"` // 网页摘要最大token数
+	SummarySources   int      `mapstructure:"summarysources"`   // 抓取汇总的网页数量
+	SummaryDeadline  int      `mapstructure:"summarydeadline"`  // 抓取汇总截止时间(秒)，超时的网页被丢弃
+	NewsTTL          int      `mapstructure:"newsttl"`          // 时效性检索结果缓存时间(分钟)
+	EvergreenTTL     int      `mapstructure:"evergreenttl"`     // 常识性检索结果缓存时间(分钟)
+	ChatTTL          int      `mapstructure:"chatttl"`          // 会话内复用上一次搜索结果的时间(分钟)
+}
+
+// CrawlConfig 搜索结果网页抓取配置
+type CrawlConfig struct {
+	Workers      int   `mapstructure:"workers"`      // 并发抓取数
+	Timeout      int   `mapstructure:"timeout"`      // 单个网页超时时间(秒)
+	MaxBytes     int64 `mapstructure:"maxbytes"`     // 响应体最大字节数
+	MaxChars     int   `mapstructure:"maxchars"`     // 正文最大字符数
+	HostInterval int   `mapstructure:"hostinterval"` // 同一站点两次请求的最小间隔(毫秒)
+	CacheTTL     int   `mapstructure:"cachettl"`     // 网页缓存时间(分钟)
+	IgnoreRobots bool  `mapstructure:"ignorerobots"` // 是否忽略 robots.txt
+	AllowPrivate bool  `mapstructure:"allowprivate"` // 是否允许抓取回环、内网和链路本地地址
+}
+
+// RerankConfig 知识库召回结果重排配置
+type RerankConfig struct {
+	Mode        string  `mapstructure:"mode"`        // 重排方式 none, cross, llm, mmr
+	URL         string  `mapstructure:"url"`         // cross-encoder 服务地址
+	ApiKey      string  `mapstructure:"apikey"`      // cross-encoder 服务密钥
+	Model       string  `mapstructure:"model"`       // cross-encoder 或 LLM 打分使用的模型
+	Candidates  int     `mapstructure:"candidates"`  // 向量召回候选数量
+	TopN        int     `mapstructure:"topn"`        // 重排后保留数量
+	Lambda      float64 `mapstructure:"lambda"`      // MMR 相关性与多样性权衡系数
+	Dedup       float64 `mapstructure:"dedup"`       // 近似重复判定的余弦相似度阈值
+	TokenBudget int     `mapstructure:"tokenbudget"` // 注入上下文的最大token数
+}
+
+// RewriteConfig 多轮对话检索问题改写配置
+type RewriteConfig struct {
+	Model     string `mapstructure:"model"`     // 改写使用的模型，默认 gpt-3.5-turbo
+	MaxTokens int    `mapstructure:"maxtokens"` // 改写结果的最大token数
+}
+
+// OIDCConfig OpenID Connect 单点登录配置
+type OIDCConfig struct {
+	Name          string   `mapstructure:"name"`          // 登录按钮显示的身份提供方名称
+	Issuer        string   `mapstructure:"issuer"`        // 身份提供方地址，为空时不启用
+	ClientId      string   `mapstructure:"clientid"`      // 客户端ID
+	ClientSecret  string   `mapstructure:"clientsecret"`  // 客户端密钥，公开客户端可为空
+	RedirectURL   string   `mapstructure:"redirecturl"`   // 授权回调地址(前端页面)
+	Scopes        []string `mapstructure:"scopes"`        // 授权范围，默认 openid email profile
+	AutoProvision bool     `mapstructure:"autoprovision"` // 邮箱未注册时是否自动创建用户
+	LinkByEmail   bool     `mapstructure:"linkbyemail"`   // 是否按已验证邮箱关联已注册用户，需确认身份提供方的邮箱可信
+	DefaultRole   int      `mapstructure:"defaultrole"`   // 自动创建用户的角色
+}
+
+type TwoFAConfig struct {
+	Issuer        string `mapstructure:"issuer"`        // 身份验证器 App 中显示的名称
+	RequiredRoles []int  `mapstructure:"requiredroles"` // 必须开启两步验证的角色
+}
+
+type AccountConfig struct {
+	DeleteGrace   int `mapstructure:"deletegrace"`   // 注销冷静期(天)，期间可撤销注销
+	Retention     int `mapstructure:"retention"`     // 已删除数据的保留时间(天)，之后彻底清除
+	PurgeInterval int `mapstructure:"purgeinterval"` // 清理任务执行间隔(分钟)
+}
+
+type LoginConfig struct {
+	MaxAttempts   int  `mapstructure:"maxattempts"`   // 单个账户连续失败次数上限
+	MaxIPAttempts int  `mapstructure:"maxipattempts"` // 单个IP连续失败次数上限
+	Window        int  `mapstructure:"window"`        // 失败次数统计窗口(分钟)
+	LockBase      int  `mapstructure:"lockbase"`      // 首次锁定时间(分钟)，再次锁定时翻倍
+	LockMax       int  `mapstructure:"lockmax"`       // 最长锁定时间(分钟)
+	NewDeviceMail bool `mapstructure:"newdevicemail"` // 新设备登录时是否发送邮件提醒
+}
+
+type PasswordConfig struct {
+	Algorithm     string `mapstructure:"algorithm"`     // 密码哈希算法 argon2id 或 bcrypt，旧哈希在登录时自动升级
+	BcryptCost    int    `mapstructure:"bcryptcost"`    // bcrypt cost
+	Argon2Time    uint32 `mapstructure:"argon2time"`    // argon2id 迭代次数
+	Argon2Memory  uint32 `mapstructure:"argon2memory"`  // argon2id 内存(KiB)
+	Argon2Threads uint8  `mapstructure:"argon2threads"` // argon2id 并行度
+	PlainOnly     bool   `mapstructure:"plainonly"`     // 只接受明文密码，前端全部升级后开启以停用旧版 AES 传输
+	RequireTLS    bool   `mapstructure:"requiretls"`    // 明文密码是否只允许通过 HTTPS 提交
+}
+
+type CaptchaConfig struct {
+	Provider  string `mapstructure:"provider"`  // 验证方式 image, hcaptcha, turnstile
+	Length    int    `mapstructure:"length"`    // 图片验证码长度
+	Charset   string `mapstructure:"charset"`   // 图片验证码字符集 num, lower, upper, all, clear
+	TTL       int    `mapstructure:"ttl"`       // 图片验证码有效期(秒)
+	SiteKey   string `mapstructure:"sitekey"`   // hCaptcha/Turnstile 站点密钥，返回给前端
+	Secret    string `mapstructure:"secret"`    // hCaptcha/Turnstile 服务端密钥
+	VerifyURL string `mapstructure:"verifyurl"` // 服务端校验地址，为空时使用官方地址，本地调试可指向模拟服务
+	Always    bool   `mapstructure:"always"`    // 登录是否始终需要验证码，否则仅在出现登录失败后需要
+}
+
+type PaymentConfig struct {
+	Provider      string `mapstructure:"provider"`      // 支付方式 stripe, fake(本地模拟，仅用于测试)，为空不开启在线支付
+	APIKey        string `mapstructure:"apikey"`        // 支付平台 API 密钥
+	WebhookSecret string `mapstructure:"webhooksecret"` // 异步通知签名密钥
+	APIURL        string `mapstructure:"apiurl"`        // 支付平台接口地址，为空时使用官方地址
+	Currency      string `mapstructure:"currency"`      // 结算币种，默认 cny
+	ReturnURL     string `mapstructure:"returnurl"`     // 支付完成后返回的前端页面
+}
+
+type ReportConfig struct {
+	Pricing map[string]float64 `mapstructure:"pricing"` // 上游模型价格(元/千令牌)，覆盖内置价格表
+}
+
+type GatewayConfig struct {
+	RateLimit  int  `mapstructure:"ratelimit"`  // 每个用户每分钟请求次数上限，0 不限制
+	Moderation bool `mapstructure:"moderation"` // 是否审核对话输入，命中时拒绝请求
+}
+
 type OpenAIConfig struct {
 	APIType    string `mapstructure:"apitype"`
 	APIURL     string `mapstructure:"apiurl"`
@@ -0,0 +1,50 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-15 09:36:50
+ * @LastEditTime: 2023-06-15 14:12:27
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/embedhash/embedhash.go
+ */
+package embedhash
+
+// 文本内容哈希及向量编解码，用于Embedding去重和缓存
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"strings"
+)
+
+// Normalize 去除首尾空白并将连续空白合并为单个空格
+func Normalize(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// Hash 计算 模型+规范化文本 的内容哈希，不同模型生成的向量不能复用
+func Hash(model, text string) string {
+	sum := sha256.Sum256([]byte(model + "\n" + Normalize(text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Encode 将向量编码为小端序二进制，比JSON存储体积更小
+func Encode(vec []float32) []byte {
+	buf := make([]byte, 4*len(vec))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// Decode 解码 Encode 生成的二进制向量，空数据不是有效向量
+func Decode(buf []byte) ([]float32, error) {
+	if len(buf) == 0 || len(buf)%4 != 0 {
+		return nil, errors.New("embedhash: invalid vector length")
+	}
+	vec := make([]float32, len(buf)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return vec, nil
+}
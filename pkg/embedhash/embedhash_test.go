@@ -0,0 +1,51 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-15 10:02:13
+ * @LastEditTime: 2023-06-15 14:12:27
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/embedhash/embedhash_test.go
+ */
+package embedhash
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  string
+		model string
+		same  bool
+	}{
+		{name: "whitespace", a: " 南京  市\n简介 ", b: "南京 市 简介", model: "m1", same: true},
+		{name: "different text", a: "南京", b: "上海", model: "m1", same: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Hash(tt.model, tt.a) == Hash(tt.model, tt.b); got != tt.same {
+				t.Errorf("Hash() equal = %v, want %v", got, tt.same)
+			}
+		})
+	}
+	if Hash("m1", "南京") == Hash("m2", "南京") {
+		t.Errorf("Hash() should differ between models")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	vec := []float32{0, -1.5, 3.25, 1e-7}
+	got, err := Decode(Encode(vec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, vec) {
+		t.Errorf("Decode(Encode()) = %v, want %v", got, vec)
+	}
+	for _, buf := range [][]byte{{1, 2, 3}, {}, nil} {
+		if _, err := Decode(buf); err == nil {
+			t.Errorf("Decode(%v) expected error for invalid length", buf)
+		}
+	}
+}
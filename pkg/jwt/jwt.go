@@ -21,17 +21,19 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 )
 
-// CustomClaims 在标准声明中加入用户id
+// CustomClaims 在标准声明中加入用户id和登录会话id
 type CustomClaims struct {
-	UserId int64 `json:"user_id"`
-	RoleId int   `json:"role_id"`
+	UserId    int64 `json:"user_id"`
+	RoleId    int   `json:"role_id"`
+	SessionId int64 `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func BuildClaims(exp time.Time, uid int64, rid int) *CustomClaims {
+func BuildClaims(exp time.Time, uid int64, rid int, sid int64) *CustomClaims {
 	return &CustomClaims{
-		UserId: uid,
-		RoleId: rid,
+		UserId:    uid,
+		RoleId:    rid,
+		SessionId: sid,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(exp),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -94,3 +96,46 @@ func IsInBlackList(ctx context.Context, token string) bool {
 	}
 	return true
 }
+
+func getSessionRevokedKey(sid int64) string {
+	return "jwt_session_revoked:" + strconv.FormatInt(sid, 10)
+}
+
+// RevokeSession 标记会话已注销，标记保留到该会话签发的 token 全部过期
+func RevokeSession(ctx context.Context, sid int64, ttl time.Duration) error {
+	rc := cache.GetRedisClient()
+	return rc.Set(ctx, getSessionRevokedKey(sid), time.Now().Unix(), ttl).Err()
+}
+
+func IsSessionRevoked(ctx context.Context, sid int64) bool {
+	rc := cache.GetRedisClient()
+	n, err := rc.Exists(ctx, getSessionRevokedKey(sid)).Result()
+	if err != nil {
+		logger.Errorf("Redis连接异常:%v", err.Error())
+		return false
+	}
+	return n > 0
+}
+
+func getUserRevokedKey(uid int64) string {
+	return "jwt_user_revoked:" + strconv.FormatInt(uid, 10)
+}
+
+// RevokeUser 记录注销用户全部会话的时间，用于拒绝此前签发的未绑定会话的旧 token
+func RevokeUser(ctx context.Context, uid int64, ttl time.Duration) error {
+	rc := cache.GetRedisClient()
+	return rc.Set(ctx, getUserRevokedKey(uid), time.Now().Unix(), ttl).Err()
+}
+
+// IsUserRevoked 判断 token 是否签发于用户全部会话被注销之前
+func IsUserRevoked(ctx context.Context, uid int64, issuedAt *jwt.NumericDate) bool {
+	rc := cache.GetRedisClient()
+	revokedUnix, err := rc.Get(ctx, getUserRevokedKey(uid)).Int64()
+	if err != nil {
+		if err != redis.Nil {
+			logger.Errorf("Redis连接异常:%v", err.Error())
+		}
+		return false
+	}
+	return issuedAt == nil || issuedAt.Unix() <= revokedUnix
+}
@@ -0,0 +1,118 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 10:14:36
+ * @LastEditTime: 2023-06-25 10:14:36
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/mail/deletemail.go
+ */
+package mail
+
+import (
+	"bytes"
+	"chatserver-api/pkg/config"
+	"text/template"
+)
+
+func SendDeleteCode(email string, nickname string, deleteCode string) error {
+	// 发送账户注销确认邮件
+	var deleteTemplate = `
+<html lang="en" xmlns:th="http://www.thymeleaf.org">
+    <head>
+        <meta charset="UTF-8">
+        <title>注销确认</title>
+        <style type="text/css">
+            * {
+                margin: 0;
+                padding: 0;
+                box-sizing: border-box;
+                font-family: Arial, Helvetica, sans-serif;
+            }
+
+            body {
+                background-color: #ECECEC;
+            }
+
+            .container {
+                width: 800px;
+                margin: 50px auto;
+            }
+
+            .header {
+                height: 80px;
+                background-color: #49bcff;
+                border-top-left-radius: 5px;
+                border-top-right-radius: 5px;
+                padding-left: 30px;
+            }
+
+            .header h2 {
+                padding-top: 25px;
+                color: white;
+            }
+
+            .content {
+                background-color: #fff;
+                padding-left: 30px;
+                padding-bottom: 30px;
+                border-bottom: 1px solid #ccc;
+            }
+
+            .content h2 {
+                padding-top: 20px;
+                padding-bottom: 20px;
+            }
+
+            .content p {
+                padding-top: 10px;
+            }
+
+            .footer {
+                background-color: #fff;
+                border-bottom-left-radius: 5px;
+                border-bottom-right-radius: 5px;
+                padding: 35px;
+            }
+
+            .footer p {
+                color: #747474;
+                padding-top: 10px;
+            }
+        </style>
+    </head>
+
+    <body>
+        <div class="container">
+            <div class="header">
+                <h2>ChatServer账户注销</h2>
+            </div>
+            <div class="content">
+                <h2>亲爱的{{ .NickName }}: 您好!</h2>
+                <p>我们收到了注销您账户的申请，确认注销请点击链接：<b><a href="{{ .CodeLinK }}">{{ .CodeLinK }}<a></b></p>
+                <p><strong>如果链接无法点击，请复制链接到浏览器打开</strong></p>
+                <p>确认后账户将在冷静期结束后删除，冷静期内登录即可撤销注销。如果不是您本人操作，请忽略此邮件并及时修改密码。</p>
+                <p>如果后续使用有任何问题可以联系管理员，Email: <b>cloudyi@wooveep.net</b></p>
+            </div>
+            <div class="footer">
+                <p>此为系统邮件，请勿回复</p>
+                <p>请保管好您的信息，避免被他人盗用</p>
+                <p>©wooveep.net</p>
+            </div>
+        </div>
+    </body>
+
+</html> 
+`
+	var bodyBytes bytes.Buffer
+	CodeLink := config.AppConfig.ExternalURL + "#/deleteaccount/" + deleteCode
+	tpl := template.Must(template.New("").Parse(deleteTemplate))
+	err := tpl.Execute(&bodyBytes, map[string]interface{}{"CodeLinK": CodeLink, "NickName": nickname})
+	if err != nil {
+		return err
+	}
+	body := bodyBytes.String()
+	err = send([]string{email}, "Chatserver账户注销确认", body)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 15:12:08
+ * @LastEditTime: 2023-06-25 15:12:08
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/mail/loginmail.go
+ */
+package mail
+
+import (
+	"bytes"
+	"text/template"
+)
+
+func SendLoginAlert(email, nickname, ip, device, loginTime string) error {
+	// 发送新设备登录提醒邮件
+	var loginTemplate = `
+<html lang="en" xmlns:th="http://www.thymeleaf.org">
+    <head>
+        <meta charset="UTF-8">
+        <title>登录提醒</title>
+        <style type="text/css">
+            * {
+                margin: 0;
+                padding: 0;
+                box-sizing: border-box;
+                font-family: Arial, Helvetica, sans-serif;
+            }
+
+            body {
+                background-color: #ECECEC;
+            }
+
+            .container {
+                width: 800px;
+                margin: 50px auto;
+            }
+
+            .header {
+                height: 80px;
+                background-color: #49bcff;
+                border-top-left-radius: 5px;
+                border-top-right-radius: 5px;
+                padding-left: 30px;
+            }
+
+            .header h2 {
+                padding-top: 25px;
+                color: white;
+            }
+
+            .content {
+                background-color: #fff;
+                padding-left: 30px;
+                padding-bottom: 30px;
+                border-bottom: 1px solid #ccc;
+            }
+
+            .content h2 {
+                padding-top: 20px;
+                padding-bottom: 20px;
+            }
+
+            .content p {
+                padding-top: 10px;
+            }
+
+            .footer {
+                background-color: #fff;
+                border-bottom-left-radius: 5px;
+                border-bottom-right-radius: 5px;
+                padding: 35px;
+            }
+
+            .footer p {
+                color: #747474;
+                padding-top: 10px;
+            }
+        </style>
+    </head>
+
+    <body>
+        <div class="container">
+            <div class="header">
+                <h2>ChatServer登录提醒</h2>
+            </div>
+            <div class="content">
+                <h2>亲爱的{{ .NickName }}: 您好!</h2>
+                <p>您的账户于 <b>{{ .Time }}</b> 在新设备上登录。</p>
+                <p>设备：<b>{{ .Device }}</b></p>
+                <p>IP地址：<b>{{ .IP }}</b></p>
+                <p><strong>如果不是您本人操作，请立即修改密码，并在登录设备管理中注销该设备。</strong></p>
+                <p>如果后续使用有任何问题可以联系管理员，Email: <b>cloudyi@wooveep.net</b></p>
+            </div>
+            <div class="footer">
+                <p>此为系统邮件，请勿回复</p>
+                <p>请保管好您的信息，避免被他人盗用</p>
+                <p>©wooveep.net</p>
+            </div>
+        </div>
+    </body>
+
+</html> 
+`
+	var bodyBytes bytes.Buffer
+	tpl := template.Must(template.New("").Parse(loginTemplate))
+	err := tpl.Execute(&bodyBytes, map[string]interface{}{"NickName": nickname, "Time": loginTime, "Device": device, "IP": ip})
+	if err != nil {
+		return err
+	}
+	body := bodyBytes.String()
+	err = send([]string{email}, "Chatserver新设备登录提醒", body)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-22 09:18:33
+ * @LastEditTime: 2023-06-22 18:21:05
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/oidc/oidc.go
+ */
+package oidc
+
+// 通用 OpenID Connect 客户端：服务发现、授权码 + PKCE、基于 JWKS 的 ID Token 校验
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrNotConfigured = errors.New("oidc: provider not configured")
+	ErrInvalidToken  = errors.New("oidc: invalid id token")
+)
+
+// jwksTTL JWKS 缓存时间，遇到未知 kid 时会提前刷新
+const jwksTTL = time.Hour
+
+// Config OIDC 客户端配置
+type Config struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// discovery /.well-known/openid-configuration 中使用的字段
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// Claims ID Token 中的用户信息
+type Claims struct {
+	Issuer            string `json:"iss"`
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"-"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+}
+
+// Provider OIDC 身份提供方，服务发现结果和签名公钥在首次使用时获取并缓存
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu       sync.Mutex
+	meta     *discovery
+	keys     map[string]interface{}
+	keysAt   time.Time
+	oauthCfg *oauth2.Config
+}
+
+func NewProvider(cfg Config) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	return &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Enabled 是否已配置身份提供方
+func (p *Provider) Enabled() bool {
+	return p != nil && p.cfg.Issuer != "" && p.cfg.ClientId != ""
+}
+
+// NewVerifier 生成 PKCE code_verifier
+func NewVerifier() string {
+	return randomString(32)
+}
+
+// NewState 生成 state 或 nonce
+func NewState() string {
+	return randomString(16)
+}
+
+// Challenge 计算 PKCE S256 code_challenge
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// AuthCodeURL 生成授权地址
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	oc, err := p.oauth(ctx)
+	if err != nil {
+		return "", err
+	}
+	return oc.AuthCodeURL(state,
+		oauth2.SetAuthURLParam("nonce", nonce),
+		oauth2.SetAuthURLParam("code_challenge", Challenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+// Exchange 用授权码换取并校验 ID Token
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (claims Claims, err error) {
+	oc, err := p.oauth(ctx)
+	if err != nil {
+		return claims, err
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := oc.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return claims, err
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok || raw == "" {
+		return claims, errors.New("oidc: token response without id_token")
+	}
+	return p.Verify(ctx, raw, nonce)
+}
+
+// Verify 校验 ID Token 的签名、签发方、受众、有效期和 nonce
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (claims Claims, err error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return claims, err
+	}
+	mc := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(raw, mc, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+			kid, _ := t.Header["kid"].(string)
+			return p.key(ctx, meta.JwksURI, kid)
+		case *jwt.SigningMethodHMAC:
+			// 规范允许使用 client_secret 作为 HS256 密钥；公开客户端没有密钥，不接受 HMAC 签名
+			if p.cfg.ClientSecret == "" {
+				return nil, fmt.Errorf("oidc: %v requires a client secret", t.Header["alg"])
+			}
+			return []byte(p.cfg.ClientSecret), nil
+		}
+		return nil, fmt.Errorf("oidc: unexpected signing method %v", t.Header["alg"])
+	})
+	if err != nil {
+		return claims, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !mc.VerifyIssuer(meta.Issuer, true) {
+		return claims, fmt.Errorf("%w: issuer mismatch", ErrInvalidToken)
+	}
+	if !mc.VerifyAudience(p.cfg.ClientId, true) {
+		return claims, fmt.Errorf("%w: audience mismatch", ErrInvalidToken)
+	}
+	if _, ok := mc["exp"]; !ok {
+		return claims, fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	data, err := json.Marshal(mc)
+	if err != nil {
+		return claims, err
+	}
+	if err = json.Unmarshal(data, &claims); err != nil {
+		return claims, err
+	}
+	if nonce != "" && claims.Nonce != nonce {
+		return claims, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	if claims.Subject == "" {
+		return claims, fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+	// 部分身份提供方以字符串返回 email_verified
+	switch v := mc["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = v
+	case string:
+		claims.EmailVerified = strings.EqualFold(v, "true")
+	}
+	claims.Email = strings.ToLower(strings.TrimSpace(claims.Email))
+	return claims, nil
+}
+
+func (p *Provider) oauth(ctx context.Context) (*oauth2.Config, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauthCfg == nil {
+		p.oauthCfg = &oauth2.Config{
+			ClientID:     p.cfg.ClientId,
+			ClientSecret: p.cfg.ClientSecret,
+			RedirectURL:  p.cfg.RedirectURL,
+			Scopes:       p.cfg.Scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  meta.AuthorizationEndpoint,
+				TokenURL: meta.TokenEndpoint,
+			},
+		}
+	}
+	return p.oauthCfg, nil
+}
+
+// discover 获取服务发现文档，成功后缓存
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	if !p.Enabled() {
+		return nil, ErrNotConfigured
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	meta := &discovery{}
+	if err := p.getJSON(ctx, p.cfg.Issuer+"/.well-known/openid-configuration", meta); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(meta.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: issuer mismatch %q", meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JwksURI == "" {
+		return nil, errors.New("oidc: incomplete discovery document")
+	}
+	p.meta = meta
+	return meta, nil
+}
+
+// key 按 kid 获取签名公钥，kid 未知时刷新 JWKS
+func (p *Provider) key(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.lookup(kid); ok && time.Since(p.keysAt) < jwksTTL {
+		return k, nil
+	}
+	var set jwkSet
+	if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, err
+	}
+	p.keys = set.parse()
+	p.keysAt = time.Now()
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("oidc: unknown key id %q", kid)
+}
+
+// lookup kid 为空且只有一个公钥时使用该公钥
+func (p *Provider) lookup(kid string) (interface{}, bool) {
+	if k, ok := p.keys[kid]; ok {
+		return k, true
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,181 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-22 16:12:44
+ * @LastEditTime: 2023-06-22 18:21:05
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/oidc/oidc_test.go
+ */
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// testIdP 本地测试身份提供方，记录授权请求的 code_challenge 和 nonce
+type testIdP struct {
+	srv       *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key}
+	mux := http.NewServeMux()
+	idp.srv = httptest.NewServer(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("code") != "code1" || Challenge(r.PostForm.Get("code_verifier")) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+		token.Header["kid"] = "k1"
+		raw, _ := token.SignedString(key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "at",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     raw,
+		})
+	})
+	return idp
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	idp := newTestIdP(t)
+	defer idp.srv.Close()
+	p := NewProvider(Config{Issuer: idp.srv.URL, ClientId: "chatserver", RedirectURL: "http://localhost/cb"})
+	ctx := context.Background()
+
+	baseClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            idp.srv.URL,
+			"sub":            "u-1",
+			"aud":            "chatserver",
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"nonce":          "n1",
+			"email":          "Alice@Example.com",
+			"email_verified": "true",
+		}
+	}
+	tests := []struct {
+		name     string
+		modify   func(jwt.MapClaims)
+		verifier string
+		wantErr  bool
+	}{
+		{name: "ok", verifier: "v1"},
+		{name: "wrong verifier", verifier: "v2", wantErr: true},
+		{name: "wrong nonce", verifier: "v1", modify: func(c jwt.MapClaims) { c["nonce"] = "n2" }, wantErr: true},
+		{name: "wrong audience", verifier: "v1", modify: func(c jwt.MapClaims) { c["aud"] = "other" }, wantErr: true},
+		{name: "wrong issuer", verifier: "v1", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil" }, wantErr: true},
+		{name: "expired", verifier: "v1", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authURL, err := p.AuthCodeURL(ctx, "s1", "n1", "v1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, _ := url.Parse(authURL)
+			if u.Query().Get("code_challenge_method") != "S256" || u.Query().Get("nonce") != "n1" {
+				t.Fatalf("AuthCodeURL() = %s", authURL)
+			}
+			idp.challenge = u.Query().Get("code_challenge")
+			idp.claims = baseClaims()
+			if tt.modify != nil {
+				tt.modify(idp.claims)
+			}
+			claims, err := p.Exchange(ctx, "code1", tt.verifier, "n1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Exchange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if claims.Subject != "u-1" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+				t.Errorf("Exchange() = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestProvider_Verify_hmac(t *testing.T) {
+	idp := newTestIdP(t)
+	defer idp.srv.Close()
+	claims := jwt.MapClaims{
+		"iss":   idp.srv.URL,
+		"sub":   "u-1",
+		"aud":   "chatserver",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": "n1",
+	}
+	tests := []struct {
+		name    string
+		secret  string
+		signKey string
+		wantErr bool
+	}{
+		{name: "signed with client secret", secret: "s3cret", signKey: "s3cret"},
+		{name: "wrong secret", secret: "s3cret", signKey: "other", wantErr: true},
+		{name: "public client", secret: "", signKey: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProvider(Config{Issuer: idp.srv.URL, ClientId: "chatserver", ClientSecret: tt.secret})
+			raw, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(tt.signKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = p.Verify(context.Background(), raw, "n1"); (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProvider_NotConfigured(t *testing.T) {
+	p := NewProvider(Config{})
+	if p.Enabled() {
+		t.Fatal("Enabled() = true, want false")
+	}
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "v"); err != ErrNotConfigured {
+		t.Errorf("AuthCodeURL() error = %v, want %v", err, ErrNotConfigured)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 10:58:30
+ * @LastEditTime: 2023-06-26 10:58:30
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/payment/payment_test.go
+ */
+package payment
+
+import (
+	"chatserver-api/pkg/config"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFakeProviderParseNotify(t *testing.T) {
+	p := NewProvider(config.PaymentConfig{Provider: "fake", WebhookSecret: "secret"})
+	paid := []byte(`{"event":"paid","order_no":"1001","trade_no":"t1","amount":990}`)
+	other := []byte(`{"event":"closed","order_no":"1001"}`)
+	tests := []struct {
+		name    string
+		body    []byte
+		sign    string
+		want    string
+		wantErr error
+	}{
+		{name: "paid", body: paid, sign: FakeSign("secret", paid), want: EventPaid},
+		{name: "ignore", body: other, sign: FakeSign("secret", other), want: EventIgnore},
+		{name: "wrong secret", body: paid, sign: FakeSign("other", paid), wantErr: ErrSignature},
+		{name: "no sign", body: paid, sign: "", wantErr: ErrSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set(FakeSignatureHeader, tt.sign)
+			ev, err := p.ParseNotify(h, tt.body)
+			if err != tt.wantErr {
+				t.Fatalf("ParseNotify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && ev.Type != tt.want {
+				t.Errorf("ParseNotify() = %+v, want %v", ev, tt.want)
+			}
+		})
+	}
+	ev, _ := p.ParseNotify(http.Header{FakeSignatureHeader: {FakeSign("secret", paid)}}, paid)
+	if ev.OrderNo != "1001" || ev.TradeNo != "t1" || ev.Amount != 990 {
+		t.Errorf("ParseNotify() = %+v", ev)
+	}
+}
+
+func stripeSign(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s", ts, body)
+	return fmt.Sprintf("t=%d,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestStripeProviderParseNotify(t *testing.T) {
+	now := time.Unix(1687750000, 0)
+	sp := newStripeProvider(config.PaymentConfig{WebhookSecret: "whsec"}, http.DefaultClient)
+	sp.now = func() time.Time { return now }
+	paid := []byte(`{"type":"checkout.session.completed","data":{"object":{"client_reference_id":"1001","payment_intent":"pi_1","payment_status":"paid","amount_total":990}}}`)
+	unpaid := []byte(`{"type":"checkout.session.completed","data":{"object":{"client_reference_id":"1001","payment_status":"unpaid"}}}`)
+	tests := []struct {
+		name    string
+		body    []byte
+		sig     string
+		want    string
+		wantErr error
+	}{
+		{name: "paid", body: paid, sig: stripeSign("whsec", now.Unix(), paid), want: EventPaid},
+		{name: "unpaid", body: unpaid, sig: stripeSign("whsec", now.Unix(), unpaid), want: EventIgnore},
+		{name: "wrong secret", body: paid, sig: stripeSign("other", now.Unix(), paid), wantErr: ErrSignature},
+		{name: "expired", body: paid, sig: stripeSign("whsec", now.Add(-time.Hour).Unix(), paid), wantErr: ErrSignature},
+		{name: "malformed", body: paid, sig: "v1=abc", wantErr: ErrSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set(stripeSignatureHeader, tt.sig)
+			ev, err := sp.ParseNotify(h, tt.body)
+			if err != tt.wantErr {
+				t.Fatalf("ParseNotify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && ev.Type != tt.want {
+				t.Errorf("ParseNotify() = %+v, want %v", ev, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripeProviderCheckoutRefund(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk_test" || r.ParseForm() != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"message":"invalid api key"}}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/checkout/sessions":
+			amount, _ := strconv.ParseInt(r.PostForm.Get("line_items[0][price_data][unit_amount]"), 10, 64)
+			fmt.Fprintf(w, `{"id":"cs_%s_%d","url":"https://pay.example/cs"}`, r.PostForm.Get("client_reference_id"), amount)
+		case "/v1/refunds":
+			if r.Header.Get("Idempotency-Key") != "refund-"+r.PostForm.Get("metadata[order_no]") {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":{"message":"missing idempotency key"}}`)
+				return
+			}
+			switch r.PostForm.Get("payment_intent") {
+			case "pi_1":
+				fmt.Fprint(w, `{"id":"re_1","status":"succeeded"}`)
+			case "pi_refunded":
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":{"code":"charge_already_refunded","message":"already refunded"}}`)
+			case "pi_busy":
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"error":{"type":"idempotency_error","message":"request in progress"}}`)
+			case "pi_down":
+				w.WriteHeader(http.StatusServiceUnavailable)
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":{"code":"resource_missing","message":"no such payment_intent"}}`)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	p := NewProvider(config.PaymentConfig{Provider: "stripe", APIKey: "sk_test", APIURL: srv.URL})
+	co, err := p.Checkout(context.Background(), Order{OrderNo: "1001", Subject: "card", Amount: 990, ReturnURL: "https://app.example"})
+	if err != nil || co.TradeNo != "cs_1001_990" || co.PayURL != "https://pay.example/cs" {
+		t.Fatalf("Checkout() = %+v, %v", co, err)
+	}
+	tests := []struct {
+		name         string
+		tradeNo      string
+		wantErr      bool
+		wantRejected bool
+	}{
+		{name: "ok", tradeNo: "pi_1"},
+		{name: "already refunded", tradeNo: "pi_refunded"},
+		{name: "unknown", tradeNo: "pi_2", wantErr: true, wantRejected: true},
+		{name: "idempotency conflict", tradeNo: "pi_busy", wantErr: true},
+		{name: "server error", tradeNo: "pi_down", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Refund(context.Background(), Refund{OrderNo: "1001", TradeNo: tt.tradeNo, Amount: 990})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Refund() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrRefundRejected) != tt.wantRejected {
+				t.Errorf("Refund() error = %v, want rejected %v", err, tt.wantRejected)
+			}
+		})
+	}
+	// 网络错误时结果未知
+	down := NewProvider(config.PaymentConfig{Provider: "stripe", APIKey: "sk_test", APIURL: "http://127.0.0.1:1"})
+	if err := down.Refund(context.Background(), Refund{OrderNo: "1001", TradeNo: "pi_1"}); err == nil || errors.Is(err, ErrRefundRejected) {
+		t.Errorf("Refund() transport error = %v, want unknown result", err)
+	}
+	if NewProvider(config.PaymentConfig{}) != nil {
+		t.Errorf("NewProvider() without provider should be nil")
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 10:05:21
+ * @LastEditTime: 2023-06-26 10:05:21
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/payment/provider.go
+ */
+package payment
+
+// 在线支付：下单后跳转到支付平台，支付结果通过带签名的异步通知回传
+import (
+	"chatserver-api/pkg/config"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSignature 异步通知签名校验失败
+	ErrSignature = errors.New("payment: invalid signature")
+	// ErrRefundRejected 支付平台明确拒绝退款，款项未退回；其他错误(网络错误、超时、平台故障)时退款结果未知
+	ErrRefundRejected = errors.New("payment: refund rejected")
+)
+
+const (
+	EventPaid   = "paid"   // 支付成功
+	EventIgnore = "ignore" // 无需处理的通知
+)
+
+// Order 下单参数，金额单位为分
+type Order struct {
+	OrderNo   string
+	Subject   string
+	Amount    int64
+	ReturnURL string
+}
+
+// Checkout 下单结果，前端跳转 PayURL 完成支付
+type Checkout struct {
+	PayURL  string
+	TradeNo string
+}
+
+// Event 解析并验签后的异步通知
+type Event struct {
+	Type    string
+	OrderNo string
+	TradeNo string
+	Amount  int64
+}
+
+// Refund 退款参数，TradeNo 为支付成功通知中的平台交易号
+type Refund struct {
+	OrderNo string
+	TradeNo string
+	Amount  int64
+	Reason  string
+}
+
+type Provider interface {
+	Name() string
+	Checkout(ctx context.Context, order Order) (Checkout, error)
+	// ParseNotify 校验异步通知签名并解析，签名错误返回 ErrSignature
+	ParseNotify(header http.Header, body []byte) (Event, error)
+	// Refund 按订单号幂等退款，重复调用不会重复退款；明确被拒绝时返回 ErrRefundRejected
+	Refund(ctx context.Context, refund Refund) error
+}
+
+// NewProvider 根据配置创建支付方式，未配置时返回 nil 表示未开启在线支付
+func NewProvider(cfg config.PaymentConfig) Provider {
+	client := &http.Client{Timeout: 10 * time.Second}
+	switch strings.ToLower(cfg.Provider) {
+	case "stripe":
+		return newStripeProvider(cfg, client)
+	case "fake":
+		return newFakeProvider(cfg)
+	default:
+		return nil
+	}
+}
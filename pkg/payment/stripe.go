@@ -0,0 +1,217 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-26 10:36:12
+ * @LastEditTime: 2023-06-26 10:36:12
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/payment/stripe.go
+ */
+package payment
+
+import (
+	"chatserver-api/pkg/config"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	stripeAPIURL          = "https://api.stripe.com"
+	stripeSignatureHeader = "Stripe-Signature"
+	// stripeTolerance 通知时间戳允许的偏差，防止重放
+	stripeTolerance = 5 * time.Minute
+)
+
+// stripeProvider 使用 Stripe Checkout 收款，通知按 Stripe-Signature 头校验
+type stripeProvider struct {
+	apiURL        string
+	apiKey        string
+	webhookSecret string
+	currency      string
+	client        *http.Client
+	now           func() time.Time
+}
+
+func newStripeProvider(cfg config.PaymentConfig, client *http.Client) *stripeProvider {
+	sp := &stripeProvider{
+		apiURL:        strings.TrimRight(cfg.APIURL, "/"),
+		apiKey:        cfg.APIKey,
+		webhookSecret: cfg.WebhookSecret,
+		currency:      strings.ToLower(cfg.Currency),
+		client:        client,
+		now:           time.Now,
+	}
+	if sp.apiURL == "" {
+		sp.apiURL = stripeAPIURL
+	}
+	if sp.currency == "" {
+		sp.currency = "cny"
+	}
+	return sp
+}
+
+func (sp *stripeProvider) Name() string {
+	return "stripe"
+}
+
+func (sp *stripeProvider) Checkout(ctx context.Context, order Order) (Checkout, error) {
+	form := url.Values{
+		"mode":                                   {"payment"},
+		"success_url":                            {order.ReturnURL},
+		"cancel_url":                             {order.ReturnURL},
+		"client_reference_id":                    {order.OrderNo},
+		"metadata[order_no]":                     {order.OrderNo},
+		"line_items[0][quantity]":                {"1"},
+		"line_items[0][price_data][currency]":    {sp.currency},
+		"line_items[0][price_data][unit_amount]": {strconv.FormatInt(order.Amount, 10)},
+		"line_items[0][price_data][product_data][name]": {order.Subject},
+	}
+	var session struct {
+		Id  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := sp.post(ctx, "/v1/checkout/sessions", form, "", &session); err != nil {
+		return Checkout{}, err
+	}
+	return Checkout{PayURL: session.URL, TradeNo: session.Id}, nil
+}
+
+func (sp *stripeProvider) ParseNotify(header http.Header, body []byte) (Event, error) {
+	if err := sp.verify(header.Get(stripeSignatureHeader), body); err != nil {
+		return Event{}, err
+	}
+	var ev struct {
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ClientReferenceId string `json:"client_reference_id"`
+				PaymentIntent     string `json:"payment_intent"`
+				PaymentStatus     string `json:"payment_status"`
+				AmountTotal       int64  `json:"amount_total"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return Event{}, err
+	}
+	obj := ev.Data.Object
+	res := Event{Type: EventIgnore, OrderNo: obj.ClientReferenceId, TradeNo: obj.PaymentIntent, Amount: obj.AmountTotal}
+	if ev.Type == "checkout.session.completed" && obj.PaymentStatus == "paid" {
+		res.Type = EventPaid
+	}
+	return res, nil
+}
+
+// verify 签名头格式为 t=时间戳,v1=签名，签名内容为 "时间戳.请求体"
+func (sp *stripeProvider) verify(sigHeader string, body []byte) error {
+	if sp.webhookSecret == "" {
+		return ErrSignature
+	}
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(sigHeader, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrSignature
+	}
+	if d := sp.now().Sub(time.Unix(t, 0)); d > stripeTolerance || d < -stripeTolerance {
+		return ErrSignature
+	}
+	mac := hmac.New(sha256.New, []byte(sp.webhookSecret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	want := mac.Sum(nil)
+	for _, s := range sigs {
+		if sig, err := hex.DecodeString(s); err == nil && hmac.Equal(sig, want) {
+			return nil
+		}
+	}
+	return ErrSignature
+}
+
+func (sp *stripeProvider) Refund(ctx context.Context, refund Refund) error {
+	form := url.Values{
+		"payment_intent":     {refund.TradeNo},
+		"amount":             {strconv.FormatInt(refund.Amount, 10)},
+		"metadata[order_no]": {refund.OrderNo},
+		"metadata[reason]":   {refund.Reason},
+	}
+	// 同一订单的重试使用相同的幂等键，Stripe 返回首次请求的结果
+	err := sp.post(ctx, "/v1/refunds", form, "refund-"+refund.OrderNo, nil)
+	var se *stripeError
+	if !errors.As(err, &se) {
+		return err
+	}
+	switch {
+	case se.Code == "charge_already_refunded":
+		// 幂等键过期后重试，款项已经退回
+		return nil
+	case se.Status == http.StatusConflict || se.Status == http.StatusTooManyRequests || se.Status >= 500:
+		// 并发请求、限流或平台故障，结果未知
+		return err
+	default:
+		return fmt.Errorf("%w: %v", ErrRefundRejected, err)
+	}
+}
+
+// stripeError Stripe 接口返回的错误
+type stripeError struct {
+	Path    string
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *stripeError) Error() string {
+	return fmt.Sprintf("payment: stripe %s status %d %s", e.Path, e.Status, e.Message)
+}
+
+func (sp *stripeProvider) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sp.apiURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+sp.apiKey)
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	resp, err := sp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return &stripeError{Path: path, Status: resp.StatusCode, Code: e.Error.Code, Message: e.Error.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,25 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 16:02:19
+ * @LastEditTime: 2023-06-24 16:02:19
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/rbac/rbac.go
+ */
+package rbac
+
+import "chatserver-api/internal/consts"
+
+// HasPermission 判断用户等级是否拥有指定权限，未知等级没有任何权限
+func HasPermission(role int, perm string) bool {
+	for _, p := range consts.RolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// PresetAllowed 会话预设的 privilege 为可使用的最低用户等级，管理员不受限制
+func PresetAllowed(role, privilege int) bool {
+	return role == consts.Administrator || role >= privilege
+}
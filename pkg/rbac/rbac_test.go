@@ -0,0 +1,60 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-24 16:15:42
+ * @LastEditTime: 2023-06-24 16:15:42
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/rbac/rbac_test.go
+ */
+package rbac
+
+import (
+	"chatserver-api/internal/consts"
+	"testing"
+)
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name string
+		role int
+		perm string
+		want bool
+	}{
+		{"admin cdkey", consts.Administrator, consts.PermAdminCdkey, true},
+		{"admin preset", consts.Administrator, consts.PermPresetWrite, true},
+		{"user kb", consts.StandardUser, consts.PermKbWrite, true},
+		{"user preset", consts.StandardUser, consts.PermPresetWrite, false},
+		{"enterprise user manage", consts.Enterprise, consts.PermUserManage, false},
+		{"admin order", consts.Administrator, consts.PermAdminOrder, true},
+		{"user order", consts.StandardUser, consts.PermAdminOrder, false},
+		{"admin report", consts.Administrator, consts.PermAdminReport, true},
+		{"unknown role", 0, consts.PermKbWrite, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasPermission(tt.role, tt.perm); got != tt.want {
+				t.Errorf("HasPermission() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPresetAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		role      int
+		privilege int
+		want      bool
+	}{
+		{"same level", consts.SeniorMember, consts.SeniorMember, true},
+		{"higher level", consts.Enterprise, consts.RegularMembers, true},
+		{"lower level", consts.StandardUser, consts.SeniorMember, false},
+		{"admin", consts.Administrator, 1000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PresetAllowed(tt.role, tt.privilege); got != tt.want {
+				t.Errorf("PresetAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-12 13:40:26
+ * @LastEditTime: 2023-06-12 16:48:02
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/rerank/cross.go
+ */
+package rerank
+
+import (
+	"bytes"
+	"chatserver-api/pkg/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// crossEncoder 调用外部 cross-encoder 服务打分，接口格式兼容常见的 /rerank 服务
+type crossEncoder struct {
+	url    string
+	apiKey string
+	model  string
+	client *http.Client
+}
+
+type crossRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+}
+
+type crossResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+func newCrossEncoder(cfg config.RerankConfig) *crossEncoder {
+	return &crossEncoder{
+		url:    cfg.URL,
+		apiKey: cfg.ApiKey,
+		model:  cfg.Model,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *crossEncoder) Rerank(ctx context.Context, query string, queryVec []float32, docs []Document) ([]Document, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+	body := crossRequest{Model: c.model, Query: query}
+	for _, d := range docs {
+		body.Documents = append(body.Documents, d.Body)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return docs, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		return docs, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return docs, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return docs, fmt.Errorf("rerank service status %d", resp.StatusCode)
+	}
+	var res crossResponse
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return docs, err
+	}
+	// 服务只返回部分结果时，未返回的片段排在最后
+	for i := range docs {
+		docs[i].Score = -1
+	}
+	for _, r := range res.Results {
+		if r.Index >= 0 && r.Index < len(docs) {
+			docs[r.Index].Score = r.RelevanceScore
+		}
+	}
+	sortByScore(docs)
+	return docs, nil
+}
@@ -0,0 +1,82 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-12 14:52:49
+ * @LastEditTime: 2023-06-12 16:48:02
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/rerank/llm.go
+ */
+package rerank
+
+import (
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/openai"
+	"chatserver-api/pkg/usage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const llmRerankPrompt = `You are a relevance grader. For each numbered passage, rate how useful it is for answering the question on a scale from 0 to 10.
+Respond with a JSON array of numbers only, one score per passage in the given order, e.g. [7,0,3].`
+
+var scoreArrayRe = regexp.MustCompile(`\[[^\[\]]*\]`)
+
+// llmReranker 使用对话模型为每个片段打分
+type llmReranker struct {
+	model string
+}
+
+func newLLMReranker(cfg config.RerankConfig) *llmReranker {
+	model := cfg.Model
+	if model == "" {
+		model = openai.GPT3Dot5Turbo
+	}
+	return &llmReranker{model: model}
+}
+
+func (l *llmReranker) Rerank(ctx context.Context, query string, queryVec []float32, docs []Document) ([]Document, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+	var passages strings.Builder
+	fmt.Fprintf(&passages, "Question:\n%s\n\n", query)
+	for i, d := range docs {
+		fmt.Fprintf(&passages, "Passage %d:\n%s\n\n", i+1, d.Body)
+	}
+	var req openai.ChatCompletionRequest
+	req.Model = l.model
+	req.MaxTokens = 8 * len(docs)
+	req.Messages = []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: llmRerankPrompt},
+		{Role: openai.ChatMessageRoleUser, Content: passages.String()},
+	}
+	client, err := openai.NewClient()
+	if err != nil {
+		return docs, err
+	}
+	resp, err := client.CreateChatCompletion(req)
+	if err != nil {
+		return docs, err
+	}
+	// 打分调用的用量计入本轮对话的费用
+	usage.Add(ctx, usage.SourceRerank, req.Model, resp.Usage)
+	if len(resp.Choices) == 0 {
+		return docs, fmt.Errorf("rerank: empty completion")
+	}
+	var scores []float64
+	raw := scoreArrayRe.FindString(resp.Choices[0].Message.Content)
+	if err = json.Unmarshal([]byte(raw), &scores); err != nil {
+		return docs, fmt.Errorf("rerank: invalid scores %q", resp.Choices[0].Message.Content)
+	}
+	for i := range docs {
+		if i < len(scores) {
+			docs[i].Score = scores[i]
+		} else {
+			docs[i].Score = -1
+		}
+	}
+	sortByScore(docs)
+	return docs, nil
+}
@@ -0,0 +1,57 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-12 11:05:12
+ * @LastEditTime: 2023-06-12 16:48:02
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/rerank/mmr.go
+ */
+package rerank
+
+import (
+	"chatserver-api/pkg/config"
+	"context"
+	"math"
+)
+
+// mmrReranker 最大边际相关性重排，在相关性与结果多样性之间取舍
+type mmrReranker struct {
+	lambda float64
+}
+
+func newMMRReranker(cfg config.RerankConfig) *mmrReranker {
+	lambda := cfg.Lambda
+	if lambda <= 0 || lambda > 1 {
+		lambda = defaultLambda
+	}
+	return &mmrReranker{lambda: lambda}
+}
+
+func (m *mmrReranker) Rerank(ctx context.Context, query string, queryVec []float32, docs []Document) ([]Document, error) {
+	if len(queryVec) > 0 {
+		for i := range docs {
+			if len(docs[i].Embedding) > 0 {
+				docs[i].Score = cosine(queryVec, docs[i].Embedding)
+			}
+		}
+	}
+	selected := make([]Document, 0, len(docs))
+	remain := append([]Document(nil), docs...)
+	for len(remain) > 0 {
+		best, bestVal := 0, math.Inf(-1)
+		for i, d := range remain {
+			var maxSim float64
+			for _, s := range selected {
+				if sim := cosine(d.Embedding, s.Embedding); sim > maxSim {
+					maxSim = sim
+				}
+			}
+			val := m.lambda*d.Score - (1-m.lambda)*maxSim
+			if val > bestVal {
+				best, bestVal = i, val
+			}
+		}
+		selected = append(selected, remain[best])
+		remain = append(remain[:best], remain[best+1:]...)
+	}
+	return selected, nil
+}
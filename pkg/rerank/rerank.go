@@ -0,0 +1,149 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-12 10:21:37
+ * @LastEditTime: 2023-06-12 16:48:02
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/rerank/rerank.go
+ */
+package rerank
+
+// 知识库向量召回结果的重排：按相关性排序、剔除近似重复片段并按token预算截断
+import (
+	"chatserver-api/pkg/config"
+	"context"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultCandidates  = 20
+	defaultTopN        = 5
+	defaultLambda      = 0.7
+	defaultDedup       = 0.95
+	defaultTokenBudget = 1500
+)
+
+// Document 待重排的召回片段
+type Document struct {
+	Id        int64
+	Title     string
+	Body      string
+	Tokens    int
+	Embedding []float32
+	Score     float64 // 相关性得分，越大越相关
+}
+
+type Reranker interface {
+	Rerank(ctx context.Context, query string, queryVec []float32, docs []Document) ([]Document, error)
+}
+
+// NewReranker 根据配置创建重排器，未配置时仅按向量相似度排序
+func NewReranker(cfg config.RerankConfig) Reranker {
+	switch cfg.Mode {
+	case "cross":
+		return newCrossEncoder(cfg)
+	case "llm":
+		return newLLMReranker(cfg)
+	case "mmr":
+		return newMMRReranker(cfg)
+	default:
+		return scoreReranker{}
+	}
+}
+
+// Candidates 向量召回阶段应取回的候选数量
+func Candidates(cfg config.RerankConfig) int {
+	if cfg.Candidates <= 0 {
+		return defaultCandidates
+	}
+	return cfg.Candidates
+}
+
+// Select 对重排结果去重后按数量和token预算截断
+func Select(cfg config.RerankConfig, docs []Document) []Document {
+	threshold := cfg.Dedup
+	if threshold <= 0 {
+		threshold = defaultDedup
+	}
+	topN := cfg.TopN
+	if topN <= 0 {
+		topN = defaultTopN
+	}
+	budget := cfg.TokenBudget
+	if budget <= 0 {
+		budget = defaultTokenBudget
+	}
+	docs = Dedup(docs, threshold)
+	if len(docs) > topN {
+		docs = docs[:topN]
+	}
+	return Budget(docs, budget)
+}
+
+// scoreReranker 仅按已有得分排序
+type scoreReranker struct{}
+
+func (scoreReranker) Rerank(ctx context.Context, query string, queryVec []float32, docs []Document) ([]Document, error) {
+	sortByScore(docs)
+	return docs, nil
+}
+
+// Dedup 剔除正文相同或与已保留片段余弦相似度不低于threshold的片段，保持原有顺序
+func Dedup(docs []Document, threshold float64) []Document {
+	var kept []Document
+	seen := make(map[string]struct{}, len(docs))
+	for _, d := range docs {
+		body := strings.TrimSpace(d.Body)
+		if _, ok := seen[body]; ok {
+			continue
+		}
+		duplicate := false
+		for _, k := range kept {
+			if len(d.Embedding) > 0 && cosine(d.Embedding, k.Embedding) >= threshold {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		seen[body] = struct{}{}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+// Budget 按顺序累加片段直到超过token预算，至少保留一个片段
+func Budget(docs []Document, budget int) []Document {
+	var total int
+	for i, d := range docs {
+		total += d.Tokens
+		if total > budget && i > 0 {
+			return docs[:i]
+		}
+	}
+	return docs
+}
+
+func sortByScore(docs []Document) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		return docs[i].Score > docs[j].Score
+	})
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
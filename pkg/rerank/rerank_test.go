@@ -0,0 +1,103 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-12 15:30:11
+ * @LastEditTime: 2023-06-12 16:48:02
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/rerank/rerank_test.go
+ */
+package rerank
+
+import (
+	"chatserver-api/pkg/config"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func ids(docs []Document) []int64 {
+	var res []int64
+	for _, d := range docs {
+		res = append(res, d.Id)
+	}
+	return res
+}
+
+func TestDedup(t *testing.T) {
+	tests := []struct {
+		name string
+		docs []Document
+		want []int64
+	}{
+		{
+			name: "same body",
+			docs: []Document{{Id: 1, Body: "南京"}, {Id: 2, Body: " 南京 "}, {Id: 3, Body: "上海"}},
+			want: []int64{1, 3},
+		},
+		{
+			name: "near duplicate embedding",
+			docs: []Document{
+				{Id: 1, Body: "a", Embedding: []float32{1, 0}},
+				{Id: 2, Body: "b", Embedding: []float32{0.99, 0.01}},
+				{Id: 3, Body: "c", Embedding: []float32{0, 1}},
+			},
+			want: []int64{1, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(Dedup(tt.docs, 0.95))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Dedup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBudget(t *testing.T) {
+	docs := []Document{{Id: 1, Tokens: 600}, {Id: 2, Tokens: 600}, {Id: 3, Tokens: 600}}
+	tests := []struct {
+		name   string
+		budget int
+		want   []int64
+	}{
+		{name: "cut", budget: 1500, want: []int64{1, 2}},
+		{name: "keep first", budget: 100, want: []int64{1}},
+		{name: "all", budget: 2000, want: []int64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(Budget(docs, tt.budget))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Budget() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMMRRerank(t *testing.T) {
+	docs := []Document{
+		{Id: 1, Embedding: []float32{1, 0.1}},
+		{Id: 2, Embedding: []float32{1, 0.12}},
+		{Id: 3, Embedding: []float32{0.6, 0.8}},
+	}
+	tests := []struct {
+		name   string
+		lambda float64
+		want   []int64
+	}{
+		{name: "relevance", lambda: 1, want: []int64{2, 1, 3}},
+		{name: "diversity", lambda: 0.3, want: []int64{2, 3, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMMRReranker(config.RerankConfig{Lambda: tt.lambda})
+			got, err := r.Rerank(context.Background(), "", []float32{1, 0.12}, append([]Document(nil), docs...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ids(got), tt.want) {
+				t.Errorf("Rerank() = %v, want %v", ids(got), tt.want)
+			}
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"chatserver-api/pkg/errors"
 	"chatserver-api/pkg/errors/ecode"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -41,6 +42,16 @@ func JSON(c *gin.Context, err error, data interface{}) {
 	errCode, message := errors.DecodeErr(err)
 	// 如果code != 0, 失败的话 返回http状态码400（一般也可以全部返回200）
 	// 返回400 更严谨一些，个人接触的项目中大部分都是400。
+	// 已推送过 SSE 事件(如搜索进度)时无法再修改状态码，以 error 事件返回
+	if c.Writer.Written() && strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream") {
+		c.SSEvent("error", ApiResponse{
+			RequestId: c.GetString(consts.RequestId),
+			ErrCode:   errCode,
+			Message:   message,
+			Data:      data,
+		})
+		return
+	}
 	var httpStatus int
 	if errCode != ecode.Success {
 		httpStatus = http.StatusBadRequest
@@ -0,0 +1,121 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-13 09:42:18
+ * @LastEditTime: 2023-06-13 15:20:44
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/rewrite/rewrite.go
+ */
+package rewrite
+
+// 多轮对话检索问题改写：将对话历史与最后的问题改写为独立的检索语句，或生成假设性回答(HyDE)用于向量检索
+import (
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/openai"
+	"chatserver-api/pkg/usage"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+const (
+	// StrategyKeyword 历史问题关键词提取 + 最后的问题
+	StrategyKeyword = "keyword"
+	// StrategyRewrite 使用模型改写为独立检索语句
+	StrategyRewrite = "rewrite"
+	// StrategyHyde 使用模型生成假设性回答后参与向量检索
+	StrategyHyde = "hyde"
+)
+
+const (
+	historyLimit    = 6
+	messageRuneCap  = 500
+	defaultMaxToken = 300
+)
+
+const rewritePrompt = `Given the conversation history and the user's last question, rewrite the last question into a single standalone search query that can be understood without the history.
+Resolve pronouns and references, keep key entities, dates and numbers, and use the same language as the user.
+Respond with the query only.`
+
+const hydePrompt = `Write a short passage (under 150 words) that would plausibly answer the user's last question, as if it came from a reference document.
+Use the conversation history only to resolve what the question refers to, and use the same language as the user.
+Respond with the passage only.`
+
+var prefixRe = regexp.MustCompile(`^(?i)(standalone\s+)?(search\s+)?(query|question|检索语句|问题)\s*[:：]\s*`)
+
+// Rewrite 将对话历史和最后的问题改写为独立检索语句
+func Rewrite(ctx context.Context, history []openai.ChatCompletionMessage, question string) (string, error) {
+	query, err := complete(ctx, usage.SourceRewrite, rewritePrompt, history, question)
+	if err != nil {
+		return "", err
+	}
+	return cleanQuery(query), nil
+}
+
+// Hyde 生成假设性回答，返回的文本与原问题一起用于计算检索向量
+func Hyde(ctx context.Context, history []openai.ChatCompletionMessage, question string) (string, error) {
+	passage, err := complete(ctx, usage.SourceHyde, hydePrompt, history, question)
+	if err != nil {
+		return "", err
+	}
+	return question + "\n" + strings.TrimSpace(passage), nil
+}
+
+// complete 调用模型并将用量记入 ctx 中的记录器，由调用方计入本轮对话的费用
+func complete(ctx context.Context, source, prompt string, history []openai.ChatCompletionMessage, question string) (string, error) {
+	cfg := config.AppConfig.RewriteConfig
+	var req openai.ChatCompletionRequest
+	req.Model = cfg.Model
+	if req.Model == "" {
+		req.Model = openai.GPT3Dot5Turbo
+	}
+	req.MaxTokens = cfg.MaxTokens
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = defaultMaxToken
+	}
+	req.Messages = []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: prompt},
+		{Role: openai.ChatMessageRoleUser, Content: buildConversation(history, question)},
+	}
+	client, err := openai.NewClient()
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.CreateChatCompletion(req)
+	if err != nil {
+		return "", err
+	}
+	usage.Add(ctx, source, req.Model, resp.Usage)
+	if len(resp.Choices) == 0 {
+		return "", errors.New("rewrite: empty completion")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// buildConversation 仅保留最近几轮对话，并截断过长的消息以控制调用成本
+func buildConversation(history []openai.ChatCompletionMessage, question string) string {
+	if len(history) > historyLimit {
+		history = history[len(history)-historyLimit:]
+	}
+	var b strings.Builder
+	b.WriteString("Conversation history:\n")
+	for _, m := range history {
+		content := []rune(m.Content)
+		if len(content) > messageRuneCap {
+			content = content[:messageRuneCap]
+		}
+		b.WriteString(m.Role + ": " + string(content) + "\n")
+	}
+	b.WriteString("\nLast question:\n" + question)
+	return b.String()
+}
+
+// cleanQuery 去掉模型输出中多余的前缀、引号和换行
+func cleanQuery(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	s = prefixRe.ReplaceAllString(s, "")
+	return strings.Trim(strings.TrimSpace(s), "\"'“”「」")
+}
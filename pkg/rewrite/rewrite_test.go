@@ -0,0 +1,50 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-13 14:11:05
+ * @LastEditTime: 2023-06-13 15:20:44
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/rewrite/rewrite_test.go
+ */
+package rewrite
+
+import (
+	"chatserver-api/pkg/openai"
+	"strings"
+	"testing"
+)
+
+func Test_cleanQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{name: "plain", s: "南京 2022年 GDP", want: "南京 2022年 GDP"},
+		{name: "prefix", s: "Standalone query: \"Nanjing GDP 2022\"", want: "Nanjing GDP 2022"},
+		{name: "chinese prefix", s: "检索语句：“南京去年的GDP是多少”\n解释...", want: "南京去年的GDP是多少"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanQuery(tt.s); got != tt.want {
+				t.Errorf("cleanQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_buildConversation(t *testing.T) {
+	var history []openai.ChatCompletionMessage
+	for i := 0; i < 10; i++ {
+		history = append(history, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: strings.Repeat("字", 600)})
+	}
+	got := buildConversation(history, "那去年呢？")
+	if n := strings.Count(got, "user: "); n != historyLimit {
+		t.Errorf("buildConversation() keeps %d messages, want %d", n, historyLimit)
+	}
+	if strings.Contains(got, strings.Repeat("字", messageRuneCap+1)) {
+		t.Errorf("buildConversation() did not truncate long message")
+	}
+	if !strings.HasSuffix(got, "那去年呢？") {
+		t.Errorf("buildConversation() missing last question")
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-16 10:15:02
+ * @LastEditTime: 2023-06-16 18:05:31
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/bing.go
+ */
+package search
+
+// Bing Web Search API v7
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const defaultBingURL = "https://api.bing.microsoft.com/v7.0/search"
+
+type bingProvider struct {
+	client   *http.Client
+	endpoint string
+	apiKey   string
+}
+
+type bingResponse struct {
+	WebPages struct {
+		Value []struct {
+			Name    string `json:"name"`
+			URL     string `json:"url"`
+			Snippet string `json:"snippet"`
+		} `json:"value"`
+	} `json:"webPages"`
+}
+
+func newBingProvider(client *http.Client, endpoint, apiKey string) *bingProvider {
+	if endpoint == "" {
+		endpoint = defaultBingURL
+	}
+	return &bingProvider{client: client, endpoint: endpoint, apiKey: apiKey}
+}
+
+func (b *bingProvider) Name() string {
+	return "bing"
+}
+
+func (b *bingProvider) Search(ctx context.Context, query string, opt Options) ([]Source, error) {
+	if b.apiKey == "" {
+		return nil, errors.New("bing: api key not configured")
+	}
+	q := query
+	if opt.Keyword != "" {
+		q = fmt.Sprintf("%s \"%s\"", query, opt.Keyword)
+	}
+	params := url.Values{}
+	params.Set("q", q)
+	params.Set("count", strconv.Itoa(numOrDefault(opt.Num)))
+	if opt.Language != "" {
+		params.Set("mkt", opt.Language)
+	}
+	switch opt.TimeRange {
+	case RangeDay:
+		params.Set("freshness", "Day")
+	case RangeWeek:
+		params.Set("freshness", "Week")
+	case RangeMonth:
+		params.Set("freshness", "Month")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", b.apiKey)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bing: status %d", resp.StatusCode)
+	}
+	var res bingResponse
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	var sources []Source
+	for _, v := range res.WebPages.Value {
+		sources = append(sources, Source{Title: v.Name, Link: v.URL, Snippet: v.Snippet})
+	}
+	return sources, nil
+}
@@ -0,0 +1,162 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-21 09:25:47
+ * @LastEditTime: 2023-06-21 16:58:12
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/cache.go
+ */
+package search
+
+// 搜索结果缓存：按规范化的检索语句缓存，时效性问题和常识性问题使用不同的过期时间
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/tokenize"
+	"chatserver-api/utils/security"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ResultCache 搜索结果缓存
+type ResultCache struct {
+	rc           *redis.Client
+	tk           tokenize.Tokenizer
+	newsTTL      time.Duration
+	evergreenTTL time.Duration
+}
+
+// NewResultCache 创建搜索结果缓存，tk 为 nil 时仅按空白切分检索语句
+func NewResultCache(rc *redis.Client, tk tokenize.Tokenizer) *ResultCache {
+	cfg := config.AppConfig.SearchConfig
+	c := &ResultCache{
+		rc:           rc,
+		tk:           tk,
+		newsTTL:      time.Duration(cfg.NewsTTL) * time.Minute,
+		evergreenTTL: time.Duration(cfg.EvergreenTTL) * time.Minute,
+	}
+	if c.newsTTL <= 0 {
+		c.newsTTL = 30 * time.Minute
+	}
+	if c.evergreenTTL <= 0 {
+		c.evergreenTTL = 24 * time.Hour
+	}
+	return c
+}
+
+// NormalizeQuery 规范化检索语句：分词、去除停用词和标点、去重并排序，与词序无关
+func (c *ResultCache) NormalizeQuery(q string) string {
+	var terms []string
+	if c.tk != nil {
+		terms = c.tk.Terms(q)
+	}
+	if len(terms) == 0 {
+		terms = strings.Fields(strings.ToLower(q))
+	}
+	seen := make(map[string]bool)
+	var uniq []string
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			uniq = append(uniq, t)
+		}
+	}
+	sort.Strings(uniq)
+	return strings.Join(uniq, " ")
+}
+
+// key 缓存键，与检索语句的顺序无关
+func (c *ResultCache) key(providers string, queries []PlanQuery) string {
+	parts := make([]string, len(queries))
+	for i, q := range queries {
+		parts[i] = c.NormalizeQuery(q.Query) + "@" + q.TimeRange
+	}
+	sort.Strings(parts)
+	return consts.QuerySearchPrefix + security.Md5(providers+"|"+strings.Join(parts, "\n"))
+}
+
+// ttl 限定时间范围的检索视为时效性问题
+func (c *ResultCache) ttl(queries []PlanQuery) time.Duration {
+	for _, q := range queries {
+		if q.TimeRange != "" {
+			return c.newsTTL
+		}
+	}
+	return c.evergreenTTL
+}
+
+func (c *ResultCache) Get(ctx context.Context, providers string, queries []PlanQuery) (res SearchResult, ok bool) {
+	if c.rc == nil {
+		return res, false
+	}
+	data, err := c.rc.Get(ctx, c.key(providers, queries)).Bytes()
+	if err != nil {
+		return res, false
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, false
+	}
+	return res, true
+}
+
+// Set 保存搜索结果，并按每个检索语句建立索引用于按问题失效
+func (c *ResultCache) Set(ctx context.Context, providers string, queries []PlanQuery, res SearchResult) error {
+	if c.rc == nil {
+		return nil
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	key := c.key(providers, queries)
+	ttl := c.ttl(queries)
+	pipe := c.rc.TxPipeline()
+	pipe.Set(ctx, key, data, ttl)
+	for _, q := range queries {
+		index := consts.QuerySearchIndexPrefix + security.Md5(c.NormalizeQuery(q.Query))
+		pipe.SAdd(ctx, index, key)
+		pipe.Expire(ctx, index, c.evergreenTTL)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Invalidate 删除与问题相关的缓存，query 为空时清空全部搜索缓存，返回删除的缓存数量
+func (c *ResultCache) Invalidate(ctx context.Context, query string) (n int64, err error) {
+	if c.rc == nil {
+		return 0, nil
+	}
+	if strings.TrimSpace(query) == "" {
+		for _, prefix := range []string{consts.QuerySearchPrefix, consts.QuerySearchIndexPrefix} {
+			iter := c.rc.Scan(ctx, 0, prefix+"*", 200).Iterator()
+			for iter.Next(ctx) {
+				deleted, err := c.rc.Del(ctx, iter.Val()).Result()
+				if err != nil {
+					return n, err
+				}
+				if prefix == consts.QuerySearchPrefix {
+					n += deleted
+				}
+			}
+			if err = iter.Err(); err != nil {
+				return n, err
+			}
+		}
+		return n, nil
+	}
+	index := consts.QuerySearchIndexPrefix + security.Md5(c.NormalizeQuery(query))
+	keys, err := c.rc.SMembers(ctx, index).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(keys) > 0 {
+		if n, err = c.rc.Del(ctx, keys...).Result(); err != nil {
+			return n, err
+		}
+	}
+	return n, c.rc.Del(ctx, index).Err()
+}
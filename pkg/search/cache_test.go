@@ -0,0 +1,79 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-21 15:12:09
+ * @LastEditTime: 2023-06-21 16:58:12
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/cache_test.go
+ */
+package search
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResultCache_key(t *testing.T) {
+	c := &ResultCache{
+		tk: stubTokenizer{
+			"今年高考作文题目是什么":   tags("今年/t 高考/n 作文/n 题目/n 是/v 什么/r"),
+			"今年的高考作文题目是什么？": tags("今年/t 的/uj 高考/n 作文/n 题目/n 是/v 什么/r ？/x"),
+			"南京天气":  tags("南京/ns 天气/n"),
+			"北京 天气": tags("北京/ns 天气/n"),
+			"天气 北京": tags("天气/n 北京/ns"),
+		},
+		newsTTL:      time.Minute,
+		evergreenTTL: time.Hour,
+	}
+	tests := []struct {
+		name string
+		a, b []PlanQuery
+		same bool
+	}{
+		{
+			name: "stop words",
+			a:    []PlanQuery{{Query: "今年高考作文题目是什么"}},
+			b:    []PlanQuery{{Query: "今年的高考作文题目是什么？"}},
+			same: true,
+		},
+		{
+			name: "query order",
+			a:    []PlanQuery{{Query: "南京天气"}, {Query: "今年高考作文题目是什么"}},
+			b:    []PlanQuery{{Query: "今年的高考作文题目是什么？"}, {Query: "南京天气"}},
+			same: true,
+		},
+		{
+			name: "term order",
+			a:    []PlanQuery{{Query: "北京 天气"}},
+			b:    []PlanQuery{{Query: "天气 北京"}},
+			same: true,
+		},
+		{
+			name: "time range",
+			a:    []PlanQuery{{Query: "南京天气", TimeRange: RangeDay}},
+			b:    []PlanQuery{{Query: "南京天气"}},
+			same: false,
+		},
+		{
+			name: "english case",
+			a:    []PlanQuery{{Query: "Go  Generics"}},
+			b:    []PlanQuery{{Query: "go generics"}},
+			same: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.key("google", tt.a) == c.key("google", tt.b); got != tt.same {
+				t.Errorf("key equal = %v, want %v", got, tt.same)
+			}
+		})
+	}
+	if c.key("google", tests[0].a) == c.key("bing", tests[0].a) {
+		t.Errorf("key should depend on providers")
+	}
+	if got := c.ttl([]PlanQuery{{Query: "a"}, {Query: "b", TimeRange: RangeWeek}}); got != time.Minute {
+		t.Errorf("ttl = %v, want news ttl", got)
+	}
+	if got := c.ttl([]PlanQuery{{Query: "a"}}); got != time.Hour {
+		t.Errorf("ttl = %v, want evergreen ttl", got)
+	}
+}
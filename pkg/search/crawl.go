@@ -1,77 +1,510 @@
 /*
  * @Author: cloudyi.li
  * @Date: 2023-06-07 09:50:35
- * @LastEditTime: 2023-06-08 22:36:53
+ * @LastEditTime: 2023-06-19 17:40:08
  * @LastEditors: cloudyi.li
  * @FilePath: /chatserver-api/pkg/search/crawl.go
  */
 package search
 
+// 网页抓取：有界并发、按站点限速、遵守 robots.txt、限制响应大小，支持 HTML、纯文本和 PDF
 import (
+	"bytes"
+	"chatserver-api/internal/consts"
+	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
 	"chatserver-api/pkg/logger"
-	"crypto/tls"
+	"chatserver-api/pkg/tika"
+	"chatserver-api/utils/security"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
+	"github.com/go-redis/redis/v8"
 	readability "github.com/go-shiori/go-readability"
+	"golang.org/x/net/html/charset"
 )
 
-// var (
-// 	urls = []string{
-// 		"https://zh.wikipedia.org/wiki/%E5%8D%97%E4%BA%AC%E5%B8%82",
-// 	}
-// )
+// crawlerAgent robots.txt 中匹配的抓取器名称，抓取网页和 robots.txt 时以此表明身份
+const crawlerAgent = "chatserver-bot"
 
-func delete_extra_space(s string) string {
-	//删除字符串中的多余空格，有多个空格时，仅保留一个空格
-	s1 := strings.Replace(s, "	", " ", -1)       //替换tab为空格
-	regstr := "\\s{2,}"                          //两个及两个以上空格的正则表达式
-	reg, _ := regexp.Compile(regstr)             //编译正则表达式
-	s2 := make([]byte, len(s1))                  //定义字符数组切片
-	copy(s2, s1)                                 //将字符串复制到切片
-	spc_index := reg.FindStringIndex(string(s2)) //在字符串中搜索
-	for len(spc_index) > 0 {                     //找到适配项
-		s2 = append(s2[:spc_index[0]+1], s2[spc_index[1]:]...) //删除多余空格
-		spc_index = reg.FindStringIndex(string(s2))            //继续在字符串中搜索
+// crawlerUserAgent 抓取请求的 User-Agent，产品名与 crawlerAgent 一致，站点按同一名称匹配规则
+const crawlerUserAgent = crawlerAgent + "/1.0 (+https://github.com/wooveep/chatserver-api)"
+
+const (
+	robotsTTL      = 24 * time.Hour
+	robotsMaxBytes = 512 << 10
+	// robots.txt 返回 5xx 时视为全部禁止，robotsRetry 后重新获取
+	robotsRetry   = 10 * time.Minute
+	maxCrawlDelay = 10 * time.Second
+	maxRedirects  = 5
+	// 站点闲置超过 hostIdleTTL 后回收其限速和 robots 状态，每隔 hostSweepEvery 检查一次
+	hostIdleTTL    = 30 * time.Minute
+	hostSweepEvery = time.Minute
+)
+
+var (
+	ErrRobotsDisallow  = errors.New("crawl: disallowed by robots.txt")
+	ErrUnsupportedType = errors.New("crawl: unsupported content type")
+	ErrTooLarge        = errors.New("crawl: response too large")
+	ErrPrivateAddress  = errors.New("crawl: private address")
+	errInvalidRedirect = errors.New("crawl: invalid redirect")
+)
+
+// reservedPrefixes netip 未归类但同样不应从公网抓取的地址段
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// Page 抓取到的网页正文
+type Page struct {
+	URL     string `json:"url"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	ETag    string `json:"etag"`
+}
+
+// hostGate 单个站点的请求间隔和 robots.txt 规则
+type hostGate struct {
+	mu   sync.Mutex
+	next time.Time
+
+	robotsMu  sync.Mutex
+	robots    *robotsRules
+	robotsExp time.Time
+
+	used time.Time // 最近一次使用时间，由 Crawler.mu 保护
+}
+
+// wait 预约下一次请求时间，同一站点的请求至少间隔 interval
+func (g *hostGate) wait(ctx context.Context, interval time.Duration) error {
+	g.mu.Lock()
+	now := time.Now()
+	at := g.next
+	if at.Before(now) {
+		at = now
+	}
+	g.next = at.Add(interval)
+	g.mu.Unlock()
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
 	}
-	return string(s2)
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Crawler 网页抓取器
+type Crawler struct {
+	cfg    config.CrawlConfig
+	client *http.Client
+	// robotsClient 获取 robots.txt，跳转时不再校验 robots.txt
+	robotsClient *http.Client
+	rc           *redis.Client
+
+	mu    sync.Mutex
+	hosts map[string]*hostGate
+	swept time.Time
 }
 
-func crawlPage(u string) string {
+var (
+	defaultCrawler *Crawler
+	crawlerOnce    sync.Once
+)
+
+// DefaultCrawler 全局共享的抓取器，站点限速和 robots.txt 规则在所有搜索请求间共享
+func DefaultCrawler() *Crawler {
+	crawlerOnce.Do(func() {
+		defaultCrawler = NewCrawler(config.AppConfig.CrawlConfig, cache.GetRedisClient())
+	})
+	return defaultCrawler
+}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// NewCrawler 创建抓取器，rc 为 nil 时不缓存网页
+func NewCrawler(cfg config.CrawlConfig, rc *redis.Client) *Crawler {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
 	}
-	c := &http.Client{
-		Transport: tr,
-		Timeout:   20 * time.Second,
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 15
 	}
-	req, _ := http.NewRequest("GET", u, nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1")
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 2 << 20
+	}
+	if cfg.MaxChars <= 0 {
+		cfg.MaxChars = 3500
+	}
+	if cfg.HostInterval < 0 {
+		cfg.HostInterval = 0
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = 60
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if !cfg.AllowPrivate {
+		dialer.Control = dialControl
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// 经代理时拨号校验的只是代理地址，抓取器不使用环境变量中的代理
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	c := &Crawler{
+		cfg:   cfg,
+		rc:    rc,
+		hosts: make(map[string]*hostGate),
+	}
+	c.client = &http.Client{Timeout: timeout, Transport: transport, CheckRedirect: c.checkRedirect}
+	c.robotsClient = &http.Client{Timeout: timeout, Transport: transport, CheckRedirect: redirectVerify}
+	return c
+}
 
-	resp, err := c.Do(req)
+// dialControl 在域名解析后校验实际连接的地址，拒绝回环、内网和链路本地地址，
+// 网页或跳转指向内网服务(包括云主机元数据地址)时不会发出请求
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
 	if err != nil {
-		logger.Errorf("failed to download %s: %v\n", u, err)
-		return ""
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddr(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// publicAddr 是否为可从公网抓取的地址
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, p := range reservedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// redirectVerify 限制跳转次数，跳转地址只能是 http 或 https
+func redirectVerify(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("crawl: too many redirects")
+	}
+	if (req.URL.Scheme != "http" && req.URL.Scheme != "https") || req.URL.Host == "" {
+		return fmt.Errorf("%w %q", errInvalidRedirect, req.URL)
+	}
+	return nil
+}
+
+// checkRedirect 每次跳转都重新校验协议和目标站点的 robots.txt，目标地址在拨号时校验
+func (c *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if err := redirectVerify(req, via); err != nil {
+		return err
+	}
+	if c.cfg.IgnoreRobots {
+		return nil
+	}
+	interval := time.Duration(c.cfg.HostInterval) * time.Millisecond
+	rules := c.robots(req.Context(), c.gate(req.URL.Host), req.URL, interval)
+	if !rules.allowed(req.URL.RequestURI()) {
+		return ErrRobotsDisallow
+	}
+	return nil
+}
+
+// FetchAll 并发抓取多个网页，结果与 urls 一一对应，抓取失败的网页内容为空
+func (c *Crawler) FetchAll(ctx context.Context, urls []string) []Page {
+	pages := make([]Page, len(urls))
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	workers := c.cfg.Workers
+	if workers > len(urls) {
+		workers = len(urls)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				page, err := c.Fetch(ctx, urls[i])
+				if err != nil {
+					logger.Warnf("抓取网页失败 %s: %v", urls[i], err)
+				}
+				pages[i] = page
+			}
+		}()
+	}
+	for i := range urls {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return pages
+}
+
+// Fetch 抓取单个网页正文，有缓存时优先使用缓存，带 ETag 的缓存会向站点重新校验
+func (c *Crawler) Fetch(ctx context.Context, u string) (page Page, err error) {
+	pu, err := url.Parse(u)
+	if err != nil || (pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+		return page, fmt.Errorf("crawl: invalid url %q", u)
+	}
+	cached, hit := c.cacheGet(ctx, u)
+	if hit && cached.ETag == "" {
+		return cached, nil
+	}
+	gate := c.gate(pu.Host)
+	interval := time.Duration(c.cfg.HostInterval) * time.Millisecond
+	if !c.cfg.IgnoreRobots {
+		rules := c.robots(ctx, gate, pu, interval)
+		if !rules.allowed(pu.RequestURI()) {
+			return page, ErrRobotsDisallow
+		}
+		if rules != nil && rules.delay > interval {
+			interval = rules.delay
+			if interval > maxCrawlDelay {
+				interval = maxCrawlDelay
+			}
+		}
+	}
+	if err = gate.wait(ctx, interval); err != nil {
+		return page, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return page, err
+	}
+	req.Header.Set("User-Agent", crawlerUserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9,application/pdf;q=0.8,*/*;q=0.5")
+	if hit {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return page, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && hit {
+		return cached, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return page, fmt.Errorf("crawl: %s status %d", u, resp.StatusCode)
+	}
+
+	body, truncated, err := readLimited(resp.Body, c.cfg.MaxBytes)
+	if err != nil {
+		return page, err
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	var title, text string
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		r, err := charset.NewReader(bytes.NewReader(body), contentType)
+		if err != nil {
+			return page, err
+		}
+		article, err := readability.FromReader(r, pu)
+		if err != nil {
+			return page, err
+		}
+		title, text = article.Title, article.TextContent
+	case mediaType == "text/plain":
+		r, err := charset.NewReader(bytes.NewReader(body), contentType)
+		if err != nil {
+			return page, err
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return page, err
+		}
+		text = string(data)
+	case mediaType == "application/pdf":
+		// 截断的 PDF 无法解析
+		if truncated {
+			return page, ErrTooLarge
+		}
+		if text, err = tika.ReadPdfBytes(body); err != nil {
+			return page, err
+		}
+	default:
+		return page, ErrUnsupportedType
+	}
+
+	page = Page{
+		URL:     u,
+		Title:   strings.TrimSpace(title),
+		Content: truncateRunes(compactSpace(text), c.cfg.MaxChars),
+		ETag:    resp.Header.Get("ETag"),
+	}
+	if page.Content != "" {
+		c.cacheSet(ctx, page)
+	}
+	return page, nil
+}
+
+// gate 获取站点状态，顺带回收长时间未访问的站点，避免 hosts 无限增长
+func (c *Crawler) gate(host string) *hostGate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Sub(c.swept) >= hostSweepEvery {
+		c.swept = now
+		for h, g := range c.hosts {
+			if now.Sub(g.used) > hostIdleTTL {
+				delete(c.hosts, h)
+			}
+		}
+	}
+	g, ok := c.hosts[host]
+	if !ok {
+		g = &hostGate{}
+		c.hosts[host] = g
+	}
+	g.used = now
+	return g
+}
 
-	ur, _ := url.Parse(u)
-	article, err := readability.FromReader(resp.Body, ur)
+// robots 获取站点的 robots.txt 规则，获取失败时视为全部允许，站点返回 5xx 时视为全部禁止
+func (c *Crawler) robots(ctx context.Context, g *hostGate, pu *url.URL, interval time.Duration) *robotsRules {
+	g.robotsMu.Lock()
+	defer g.robotsMu.Unlock()
+	if time.Now().Before(g.robotsExp) {
+		return g.robots
+	}
+	g.robots, g.robotsExp = nil, time.Now().Add(robotsTTL)
+	if err := g.wait(ctx, interval); err != nil {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pu.Scheme+"://"+pu.Host+"/robots.txt", nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("User-Agent", crawlerUserAgent)
+	resp, err := c.robotsClient.Do(req)
 	if err != nil {
-		logger.Errorf("failed to parse %s: %v\n", u, err)
-		return ""
+		logger.Debugf("获取 robots.txt 失败 %s: %v", pu.Host, err)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		g.robots, g.robotsExp = parseRobots("User-agent: *\nDisallow: /\n", crawlerAgent), time.Now().Add(robotsRetry)
+		return g.robots
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil
 	}
-	textcontent := delete_extra_space(article.TextContent)
-	textlen := len(textcontent)
-	if textlen == 0 {
-		return ""
+	body, _, err := readLimited(resp.Body, robotsMaxBytes)
+	if err != nil {
+		return nil
+	}
+	g.robots = parseRobots(string(body), crawlerAgent)
+	return g.robots
+}
+
+// cacheGet 读取网页缓存，先按 URL 取 ETag，再按 URL 和 ETag 取网页
+func (c *Crawler) cacheGet(ctx context.Context, u string) (page Page, ok bool) {
+	if c.rc == nil {
+		return page, false
+	}
+	etag, err := c.rc.Get(ctx, consts.CrawlETagPrefix+security.Md5(u)).Result()
+	if err != nil {
+		return page, false
+	}
+	data, err := c.rc.Get(ctx, consts.CrawlPagePrefix+security.Md5(u+"\n"+etag)).Bytes()
+	if err != nil {
+		return page, false
+	}
+	if err = json.Unmarshal(data, &page); err != nil {
+		return page, false
+	}
+	return page, true
+}
+
+func (c *Crawler) cacheSet(ctx context.Context, page Page) {
+	if c.rc == nil {
+		return
+	}
+	data, err := json.Marshal(page)
+	if err != nil {
+		return
+	}
+	ttl := time.Duration(c.cfg.CacheTTL) * time.Minute
+	pipe := c.rc.TxPipeline()
+	pipe.Set(ctx, consts.CrawlPagePrefix+security.Md5(page.URL+"\n"+page.ETag), data, ttl)
+	pipe.Set(ctx, consts.CrawlETagPrefix+security.Md5(page.URL), page.ETag, ttl)
+	if _, err = pipe.Exec(ctx); err != nil {
+		logger.Warnf("网页缓存失败:%v", err)
+	}
+}
+
+// readLimited 最多读取 limit 字节，超出部分丢弃并返回 truncated
+func readLimited(r io.Reader, limit int64) (body []byte, truncated bool, err error) {
+	body, err = io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > limit {
+		return body[:limit], true, nil
+	}
+	return body, false, nil
+}
+
+var (
+	blankRe   = regexp.MustCompile(`[ \t\x{00a0}\x{3000}]+`)
+	newlineRe = regexp.MustCompile(`\s*\n\s*`)
+)
+
+// compactSpace 合并连续空白，保留单个换行
+func compactSpace(s string) string {
+	s = blankRe.ReplaceAllString(s, " ")
+	s = newlineRe.ReplaceAllString(s, "\n")
+	return strings.TrimSpace(s)
+}
+
+// truncateRunes 按字符截断，避免截断多字节字符
+func truncateRunes(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
 	}
-	if textlen > 3500 {
-		textlen = 3500
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos]
+		}
+		i++
 	}
-	return article.Title + "\n" + textcontent[:textlen-1]
+	return s
 }
@@ -1,31 +1,203 @@
 /*
  * @Author: cloudyi.li
  * @Date: 2023-06-07 09:50:35
- * @LastEditTime: 2023-06-07 17:04:42
+ * @LastEditTime: 2023-06-19 17:40:08
  * @LastEditors: cloudyi.li
  * @FilePath: /chatserver-api/pkg/search/crawl_test.go
  */
 package search
 
-import "testing"
+import (
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
 
-func Test_crawlpage(t *testing.T) {
-	type args struct {
-		u string
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestCrawler_Fetch(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().String("南京市是江苏省省会")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	})
+	mux.HandleFunc("/agent", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if strings.HasPrefix(r.UserAgent(), crawlerAgent+"/") {
+			w.Write([]byte("bot"))
+			return
+		}
+		w.Write([]byte("browser"))
+	})
+	mux.HandleFunc("/gbk", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=gbk")
+		w.Write([]byte(gbk))
+	})
+	mux.HandleFunc("/long", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(strings.Repeat("南京", 20)))
+	})
+	mux.HandleFunc("/private/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	})
+	mux.HandleFunc("/to-private", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/private/page", http.StatusFound)
+	})
+	mux.HandleFunc("/to-file", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	})
+	mux.HandleFunc("/pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(strings.Repeat("x", 100)))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := NewCrawler(config.CrawlConfig{MaxChars: 10, MaxBytes: 64, AllowPrivate: true}, nil)
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr error
+	}{
+		{name: "gbk charset", path: "/gbk", want: "南京市是江苏省省会"},
+		{name: "crawler user agent", path: "/agent", want: "bot"},
+		{name: "rune truncate", path: "/long", want: "南京南京南京南京南京"},
+		{name: "robots disallow", path: "/private/page", wantErr: ErrRobotsDisallow},
+		{name: "redirect rechecks robots", path: "/to-private", wantErr: ErrRobotsDisallow},
+		{name: "redirect to other scheme", path: "/to-file", wantErr: errInvalidRedirect},
+		{name: "unsupported type", path: "/image", wantErr: ErrUnsupportedType},
+		{name: "pdf too large", path: "/pdf", wantErr: ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Fetch(context.Background(), srv.URL+tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Content != tt.want {
+				t.Errorf("Fetch() = %q, want %q", got.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrawler_Fetch_privateAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer srv.Close()
+	c := NewCrawler(config.CrawlConfig{IgnoreRobots: true}, nil)
+	if _, err := c.Fetch(context.Background(), srv.URL+"/"); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Fetch() loopback error = %v, want %v", err, ErrPrivateAddress)
+	}
+	if _, err := c.Fetch(context.Background(), "http://localhost:"+srv.URL[strings.LastIndex(srv.URL, ":")+1:]+"/"); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Fetch() localhost error = %v, want %v", err, ErrPrivateAddress)
+	}
+}
+
+func Test_publicAddr(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := publicAddr(netip.MustParseAddr(tt.ip)); got != tt.want {
+				t.Errorf("publicAddr(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrawler_robots_serverError(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	fail := true
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("page"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	c := NewCrawler(config.CrawlConfig{AllowPrivate: true}, nil)
+	if _, err := c.Fetch(context.Background(), srv.URL+"/page"); err != ErrRobotsDisallow {
+		t.Fatalf("Fetch() with robots.txt 503 error = %v, want %v", err, ErrRobotsDisallow)
+	}
+	fail = false
+	c.gate(srv.URL[len("http://"):]).robotsExp = time.Time{}
+	if got, err := c.Fetch(context.Background(), srv.URL+"/page"); err != nil || got.Content != "page" {
+		t.Errorf("Fetch() after robots.txt recovered = %q, %v", got.Content, err)
 	}
+}
+
+func TestCrawler_gate(t *testing.T) {
+	c := NewCrawler(config.CrawlConfig{}, nil)
+	idle := c.gate("idle.example.com")
+	busy := c.gate("busy.example.com")
+	idle.used = time.Now().Add(-hostIdleTTL - time.Second)
+	c.swept = time.Time{}
+
+	if got := c.gate("busy.example.com"); got != busy {
+		t.Errorf("gate() should reuse active host")
+	}
+	if _, ok := c.hosts["idle.example.com"]; ok {
+		t.Errorf("gate() should evict idle host")
+	}
+	if got := c.gate("idle.example.com"); got == idle {
+		t.Errorf("gate() should recreate evicted host")
+	}
+}
+
+func Test_truncateRunes(t *testing.T) {
 	tests := []struct {
 		name string
-		args args
+		s    string
+		n    int
+		want string
 	}{
-		// TODO: Add test cases.
-		{
-			name: "test1",
-			args: args{u: "http://www.mafengwo.cn/gonglve/ziyouxing/2606.html"},
-		},
+		{name: "short", s: "南京", n: 3, want: "南京"},
+		{name: "cut", s: "南京市abc", n: 4, want: "南京市a"},
+		{name: "no limit", s: "南京", n: 0, want: "南京"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			crawlPage(tt.args.u)
+			if got := truncateRunes(tt.s, tt.n); got != tt.want {
+				t.Errorf("truncateRunes() = %q, want %q", got, tt.want)
+			}
 		})
 	}
 }
@@ -0,0 +1,150 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-16 11:20:55
+ * @LastEditTime: 2023-06-16 18:05:31
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/duckduckgo.go
+ */
+package search
+
+// DuckDuckGo HTML 版本，无需密钥
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const defaultDuckDuckGoURL = "https://html.duckduckgo.com/html/"
+
+type duckDuckGoProvider struct {
+	client   *http.Client
+	endpoint string
+}
+
+func newDuckDuckGoProvider(client *http.Client, endpoint string) *duckDuckGoProvider {
+	if endpoint == "" {
+		endpoint = defaultDuckDuckGoURL
+	}
+	return &duckDuckGoProvider{client: client, endpoint: endpoint}
+}
+
+func (d *duckDuckGoProvider) Name() string {
+	return "duckduckgo"
+}
+
+func (d *duckDuckGoProvider) Search(ctx context.Context, query string, opt Options) ([]Source, error) {
+	q := query
+	if opt.Keyword != "" {
+		q = fmt.Sprintf("%s \"%s\"", query, opt.Keyword)
+	}
+	form := url.Values{}
+	form.Set("q", q)
+	if opt.Region != "" {
+		form.Set("kl", strings.ToLower(opt.Region)+"-"+strings.ToLower(strings.Split(opt.Language, "-")[0]))
+	}
+	if opt.TimeRange != "" {
+		form.Set("df", opt.TimeRange[:1])
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("duckduckgo: status %d", resp.StatusCode)
+	}
+	sources, err := parseDuckDuckGo(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if n := numOrDefault(opt.Num); len(sources) > n {
+		sources = sources[:n]
+	}
+	return sources, nil
+}
+
+// parseDuckDuckGo 解析结果页中的 result__a 标题链接和 result__snippet 摘要
+func parseDuckDuckGo(r io.Reader) ([]Source, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	var sources []Source
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			switch {
+			case hasClass(n, "result__a"):
+				sources = append(sources, Source{Title: nodeText(n), Link: duckDuckGoLink(attr(n, "href"))})
+				return
+			case hasClass(n, "result__snippet") && len(sources) > 0:
+				sources[len(sources)-1].Snippet = nodeText(n)
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return sources, nil
+}
+
+// duckDuckGoLink 还原跳转链接 //duckduckgo.com/l/?uddg=<url> 中的真实地址
+func duckDuckGoLink(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	if target := u.Query().Get("uddg"); target != "" {
+		return target
+	}
+	if u.Scheme == "" {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,33 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-16 13:30:09
+ * @LastEditTime: 2023-06-16 18:05:31
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/fake.go
+ */
+package search
+
+import "context"
+
+// FakeProvider 本地测试用搜索引擎，返回固定结果
+type FakeProvider struct {
+	ProviderName string
+	Results      []Source
+	Err          error
+	Queries      []string
+}
+
+func (f *FakeProvider) Name() string {
+	if f.ProviderName == "" {
+		return "fake"
+	}
+	return f.ProviderName
+}
+
+func (f *FakeProvider) Search(ctx context.Context, query string, opt Options) ([]Source, error) {
+	f.Queries = append(f.Queries, query)
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return f.Results, nil
+}
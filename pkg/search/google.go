@@ -0,0 +1,75 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-16 09:40:18
+ * @LastEditTime: 2023-06-16 18:05:31
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/google.go
+ */
+package search
+
+// Google 自定义搜索
+import (
+	"chatserver-api/pkg/config"
+	"context"
+	"net/http"
+
+	customsearch "google.golang.org/api/customsearch/v1"
+	"google.golang.org/api/googleapi/transport"
+	"google.golang.org/api/option"
+)
+
+type googleProvider struct {
+	cfg config.GoogelConfig
+}
+
+func newGoogleProvider(cfg config.GoogelConfig) *googleProvider {
+	return &googleProvider{cfg: cfg}
+}
+
+func (g *googleProvider) Name() string {
+	return "google"
+}
+
+func (g *googleProvider) Search(ctx context.Context, query string, opt Options) ([]Source, error) {
+	client := &http.Client{Transport: &transport.APIKey{Key: g.cfg.ApiKey}}
+	svc, err := customsearch.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, err
+	}
+	// 自定义搜索单次最多返回10条
+	num := numOrDefault(opt.Num)
+	if num > 10 {
+		num = 10
+	}
+	call := svc.Cse.List().Cx(g.cfg.CxId).Num(int64(num)).Sort("date").Q(query)
+	switch opt.TimeRange {
+	case RangeDay:
+		call = call.DateRestrict("d[2]")
+	case RangeWeek:
+		call = call.DateRestrict("w[1]")
+	case RangeMonth:
+		call = call.DateRestrict("m[1]")
+	case RangeYear:
+		call = call.DateRestrict("y[1]")
+	default:
+		call = call.DateRestrict("y[3]")
+	}
+	if opt.Keyword != "" {
+		call = call.ExactTerms(opt.Keyword)
+	}
+	if opt.Region != "" {
+		call = call.Cr("country" + opt.Region)
+	}
+	if opt.Language != "" {
+		call = call.Hl(opt.Language)
+	}
+	resp, err := call.Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	var sources []Source
+	for _, item := range resp.Items {
+		sources = append(sources, Source{Title: item.Title, Link: item.Link, Snippet: item.Snippet})
+	}
+	return sources, nil
+}
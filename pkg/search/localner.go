@@ -0,0 +1,72 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-17 10:08:26
+ * @LastEditTime: 2023-06-17 16:44:51
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/localner.go
+ */
+package search
+
+// 基于 jieba 词性标注和时间表达式规则的本地实体检测
+import (
+	"chatserver-api/pkg/tokenize"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// entityPos 视为实体的词性：人名、地名、机构名、其他专名，用户词典中的词可标注为 nz
+var entityPos = map[string]bool{
+	"nr":   true,
+	"nrfg": true,
+	"nrt":  true,
+	"ns":   true,
+	"nsf":  true,
+	"nt":   true,
+	"nz":   true,
+	"eng":  true,
+}
+
+// timeRe 时间表达式：相对时间、具体日期、年份季度等
+var timeRe = regexp.MustCompile(`今天|今日|昨天|昨日|明天|前天|后天|今年|去年|明年|前年|本周|这周|上周|下周|本月|这个月|上个月|下个月|最近|最新|近期|近日|刚刚|目前|现在|当前|实时|\d{2,4}\s*年|\d{1,2}\s*月\s*\d{1,2}\s*[日号]|第[一二三四1-4]季度|[一二三四1-4]季度`)
+
+type localDetector struct {
+	tk tokenize.Tokenizer
+}
+
+func newLocalDetector(tk tokenize.Tokenizer) *localDetector {
+	return &localDetector{tk: tk}
+}
+
+func (d *localDetector) Detect(query string) (int, string) {
+	var entities []string
+	seen := make(map[string]bool)
+	hasTime := timeRe.MatchString(query)
+	for _, w := range d.tk.Tag(query) {
+		text := strings.TrimSpace(w.Text)
+		if text == "" {
+			continue
+		}
+		if w.Pos == "t" {
+			hasTime = true
+			continue
+		}
+		if !entityPos[w.Pos] || seen[text] {
+			continue
+		}
+		// 单字母或单字的英文/专名误判较多
+		if utf8.RuneCountInString(text) < 2 {
+			continue
+		}
+		seen[text] = true
+		entities = append(entities, text)
+	}
+	keyword := strings.Join(entities, " ")
+	if hasTime {
+		return NerRecent, keyword
+	}
+	if len(entities) == 0 {
+		return NerNone, ""
+	}
+	return NerSearch, keyword
+}
@@ -0,0 +1,69 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-17 14:20:37
+ * @LastEditTime: 2023-06-17 16:44:51
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/localner_test.go
+ */
+package search
+
+import (
+	"chatserver-api/pkg/tokenize"
+	"strings"
+	"testing"
+)
+
+// stubTokenizer 返回预设的词性标注结果，避免测试依赖词典文件
+type stubTokenizer map[string][]tokenize.Word
+
+func (s stubTokenizer) GetKeyword(q string) string { return "" }
+
+func (s stubTokenizer) Tag(q string) []tokenize.Word { return s[q] }
+
+func (s stubTokenizer) Terms(q string) (terms []string) {
+	for _, w := range s[q] {
+		if w.Pos != "x" && w.Pos != "uj" {
+			terms = append(terms, w.Text)
+		}
+	}
+	return
+}
+
+// tags 将 "词/词性" 以空格分隔的字符串转换为标注结果
+func tags(s string) (words []tokenize.Word) {
+	for _, v := range strings.Fields(s) {
+		i := strings.LastIndex(v, "/")
+		words = append(words, tokenize.Word{Text: v[:i], Pos: v[i+1:]})
+	}
+	return
+}
+
+func Test_localDetector_Detect(t *testing.T) {
+	tk := stubTokenizer{
+		"这个问题应该如何处理呢": tags("这个/r 问题/n 应该/v 如何/r 处理/v 呢/y"),
+		"今天有什么新闻？":    tags("今天/t 有/v 什么/r 新闻/n ？/x"),
+		"南京第一医院怎么样":   tags("南京/ns 第一/m 医院/n 怎么样/r"),
+		"2023年高考作文题目": tags("2023/m 年/m 高考/n 作文题目/n"),
+		"马云和马云的公司":    tags("马云/nr 和/c 马云/nr 的/uj 公司/n"),
+	}
+	tests := []struct {
+		query       string
+		wantLevel   int
+		wantKeyword string
+	}{
+		{query: "这个问题应该如何处理呢", wantLevel: NerNone},
+		{query: "今天有什么新闻？", wantLevel: NerRecent},
+		{query: "南京第一医院怎么样", wantLevel: NerSearch, wantKeyword: "南京"},
+		{query: "2023年高考作文题目", wantLevel: NerRecent},
+		{query: "马云和马云的公司", wantLevel: NerSearch, wantKeyword: "马云"},
+	}
+	d := newLocalDetector(tk)
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			level, keyword := d.Detect(tt.query)
+			if level != tt.wantLevel || keyword != tt.wantKeyword {
+				t.Errorf("Detect() = %v, %q, want %v, %q", level, keyword, tt.wantLevel, tt.wantKeyword)
+			}
+		})
+	}
+}
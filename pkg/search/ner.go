@@ -7,10 +7,11 @@
  */
 package search
 
-// 使用腾讯云API检测进行NER实体检测
+// NER实体检测：判断问题是否需要联网搜索以及结果必须包含的关键词
 import (
 	"chatserver-api/pkg/config"
 	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/tokenize"
 	"encoding/json"
 	"strings"
 
@@ -20,6 +21,29 @@ import (
 	nlp "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/nlp/v20190408"
 )
 
+// 实体检测结果等级
+const (
+	NerNone   = iota // 不需要搜索
+	NerSearch        // 需要搜索
+	NerRecent        // 时效性问题，搜索最近的结果
+)
+
+// EntityDetector 实体检测，返回检测等级及搜索结果必须包含的关键词
+type EntityDetector interface {
+	Detect(query string) (level int, keyword string)
+}
+
+// NewDetector 创建实体检测器，mode 为 tencent 时使用腾讯云NLP，默认使用本地 jieba 检测
+func NewDetector(mode string, tk tokenize.Tokenizer) EntityDetector {
+	if mode == "tencent" || tk == nil {
+		return &tencentDetector{}
+	}
+	return newLocalDetector(tk)
+}
+
+// tencentDetector 使用腾讯云API进行NER实体检测
+type tencentDetector struct{}
+
 type nlpResponse struct {
 	Response struct {
 		NormalText       string `json:"NormalText"`
@@ -56,7 +80,7 @@ func genin(target string, str_array []string) (count int) {
 	return
 }
 
-func nerDetec(query string) (int, string) {
+func (d *tencentDetector) Detect(query string) (int, string) {
 	var nlpres nlpResponse
 	var participles []string
 	tencentcfg := config.AppConfig.TencentConfig
@@ -80,11 +104,11 @@ func nerDetec(query string) (int, string) {
 	response, err := client.ParseWords(request)
 	if _, ok := err.(*errors.TencentCloudSDKError); ok {
 		logger.Errorf("An API error has returned: %s", err)
-		return 0, ""
+		return NerNone, ""
 	}
 	if err != nil {
 		logger.Errorf("%s", err)
-		return 0, ""
+		return NerNone, ""
 	}
 	// 输出json格式的字符串回包
 	json.Unmarshal([]byte(response.ToJsonString()), &nlpres)
@@ -102,14 +126,14 @@ func nerDetec(query string) (int, string) {
 			}
 		}
 	} else {
-		return 0, ""
+		return NerNone, ""
 	}
 
 	if len(nlpres.Response.Entities) == genin("quantity.generic", generic) {
-		return 0, ""
+		return NerNone, ""
 	}
 	if genin("time.generic", generic) > 0 {
-		return 2, strings.Join(participles, " ")
+		return NerRecent, strings.Join(participles, " ")
 	}
-	return 1, strings.Join(participles, " ")
+	return NerSearch, strings.Join(participles, " ")
 }
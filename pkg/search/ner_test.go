@@ -57,7 +57,7 @@ func Test_nerDetec(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, _ := nerDetec(tt.args.query)
+			got, _ := (&tencentDetector{}).Detect(tt.args.query)
 			if !reflect.DeepEqual(tt.want, got) {
 				t.Errorf("nerDetec() = %v, want %v", got, tt.want)
 			}
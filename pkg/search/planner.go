@@ -0,0 +1,132 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-18 09:30:14
+ * @LastEditTime: 2023-06-18 17:12:40
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/planner.go
+ */
+package search
+
+// 搜索规划：由模型结合对话历史判断是否需要搜索，并生成1~3个带时间范围的检索语句
+import (
+	"chatserver-api/internal/consts"
+	"chatserver-api/pkg/openai"
+	"chatserver-api/pkg/usage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxPlanQueries = 3
+
+const plannerPrompt = `You decide whether a web search is needed to answer the user's last question, and plan the searches.
+Current date: %s.
+Use the conversation history to resolve follow-up questions (e.g. "what about last year?") into complete, standalone queries with explicit entities and dates.
+Search is NOT needed for greetings, chit-chat, math, coding, translation, rewriting or questions answerable from general knowledge that does not change over time.
+Respond with JSON only, in this format:
+{"need_search": true, "queries": [{"query": "...", "time_range": "day|week|month|year|"}]}
+Give 1 to 3 focused queries in the user's language, and use time_range only when the answer depends on recent information.`
+
+var planJSONRe = regexp.MustCompile(`(?s)\{.*\}`)
+
+// PlanQuery 单个检索语句
+type PlanQuery struct {
+	Query     string `json:"query"`
+	TimeRange string `json:"time_range"`
+	Keyword   string `json:"-"`
+}
+
+// Plan 搜索计划
+type Plan struct {
+	NeedSearch bool        `json:"need_search"`
+	Queries    []PlanQuery `json:"queries"`
+}
+
+// Planner 搜索规划
+type Planner interface {
+	Plan(ctx context.Context, history []openai.ChatCompletionMessage, question string) (Plan, error)
+}
+
+type llmPlanner struct {
+	model string
+}
+
+// NewPlanner 创建基于对话模型的搜索规划，model 为空时使用 gpt-3.5-turbo
+func NewPlanner(model string) *llmPlanner {
+	if model == "" {
+		model = openai.GPT3Dot5Turbo
+	}
+	return &llmPlanner{model: model}
+}
+
+func (p *llmPlanner) Plan(ctx context.Context, history []openai.ChatCompletionMessage, question string) (Plan, error) {
+	var conversation strings.Builder
+	if len(history) > 6 {
+		history = history[len(history)-6:]
+	}
+	for _, m := range history {
+		content := m.Content
+		if utf8.RuneCountInString(content) > 300 {
+			content = string([]rune(content)[:300])
+		}
+		conversation.WriteString(m.Role + ": " + content + "\n")
+	}
+	conversation.WriteString("\nLast question:\n" + question)
+
+	var req openai.ChatCompletionRequest
+	req.Model = p.model
+	req.MaxTokens = 300
+	req.Messages = []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: fmt.Sprintf(plannerPrompt, time.Now().Format(consts.DateLayout))},
+		{Role: openai.ChatMessageRoleUser, Content: conversation.String()},
+	}
+	client, err := openai.NewClient()
+	if err != nil {
+		return Plan{}, err
+	}
+	resp, err := client.CreateChatCompletion(req)
+	if err != nil {
+		return Plan{}, err
+	}
+	// 规划调用的用量计入本轮对话的费用
+	usage.Add(ctx, usage.SourcePlanner, req.Model, resp.Usage)
+	if len(resp.Choices) == 0 {
+		return Plan{}, errors.New("planner: empty completion")
+	}
+	return parsePlan(resp.Choices[0].Message.Content)
+}
+
+// parsePlan 解析模型返回的搜索计划，去除空语句和重复语句，最多保留3个
+func parsePlan(content string) (plan Plan, err error) {
+	raw := planJSONRe.FindString(content)
+	if raw == "" {
+		return plan, fmt.Errorf("planner: invalid plan %q", content)
+	}
+	if err = json.Unmarshal([]byte(raw), &plan); err != nil {
+		return plan, fmt.Errorf("planner: invalid plan %q", content)
+	}
+	seen := make(map[string]bool)
+	queries := plan.Queries[:0]
+	for _, q := range plan.Queries {
+		q.Query = strings.TrimSpace(q.Query)
+		if q.Query == "" || seen[q.Query] {
+			continue
+		}
+		seen[q.Query] = true
+		q.TimeRange = normalizeRange(q.TimeRange)
+		queries = append(queries, q)
+		if len(queries) == maxPlanQueries {
+			break
+		}
+	}
+	plan.Queries = queries
+	if len(plan.Queries) == 0 {
+		plan.NeedSearch = false
+	}
+	return plan, nil
+}
@@ -0,0 +1,93 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-18 15:20:36
+ * @LastEditTime: 2023-06-18 17:12:40
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/planner_test.go
+ */
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parsePlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Plan
+		wantErr bool
+	}{
+		{
+			name:    "no search",
+			content: `{"need_search": false, "queries": []}`,
+			want:    Plan{NeedSearch: false, Queries: []PlanQuery{}},
+		},
+		{
+			name:    "code fence and range",
+			content: "```json\n{\"need_search\": true, \"queries\": [{\"query\": \"2023年高考作文题目\", \"time_range\": \"Month\"}]}\n```",
+			want:    Plan{NeedSearch: true, Queries: []PlanQuery{{Query: "2023年高考作文题目", TimeRange: RangeMonth}}},
+		},
+		{
+			name:    "dedup and cap",
+			content: `{"need_search": true, "queries": [{"query": "a"}, {"query": " a "}, {"query": ""}, {"query": "b", "time_range": "bad"}, {"query": "c"}, {"query": "d"}]}`,
+			want:    Plan{NeedSearch: true, Queries: []PlanQuery{{Query: "a"}, {Query: "b"}, {Query: "c"}}},
+		},
+		{
+			name:    "empty queries",
+			content: `{"need_search": true, "queries": [{"query": " "}]}`,
+			want:    Plan{NeedSearch: false, Queries: []PlanQuery{}},
+		},
+		{
+			name:    "invalid",
+			content: "需要搜索",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePlan(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePlan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePlan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mergeSources(t *testing.T) {
+	a := Source{Link: "https://a.com/1"}
+	b := Source{Link: "https://b.com/1"}
+	c := Source{Link: "https://c.com/1"}
+	tests := []struct {
+		name    string
+		results [][]Source
+		want    []Source
+	}{
+		{
+			name:    "empty",
+			results: [][]Source{nil, nil},
+			want:    nil,
+		},
+		{
+			name:    "round robin",
+			results: [][]Source{{a, c}, {b}},
+			want:    []Source{a, b, c},
+		},
+		{
+			name:    "dedup by link",
+			results: [][]Source{{a, b}, {{Link: "https://a.com/1/#top"}, c}},
+			want:    []Source{a, b, c},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeSources(tt.results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeSources() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
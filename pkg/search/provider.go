@@ -0,0 +1,179 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-16 09:12:40
+ * @LastEditTime: 2023-06-16 18:05:31
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/provider.go
+ */
+package search
+
+// 搜索引擎抽象，按顺序回退
+import (
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Options 单次搜索参数
+type Options struct {
+	Keyword   string // 结果中必须包含的关键词
+	TimeRange string // 时间范围 day, week, month, year，空表示不限制
+	Num       int    // 返回结果数量
+	Region    string // 搜索地区，空表示不限制
+	Language  string // 搜索语言，空表示不限制
+}
+
+// SearchProvider 搜索引擎
+type SearchProvider interface {
+	Name() string
+	Search(ctx context.Context, query string, opt Options) ([]Source, error)
+}
+
+var ErrNoResult = errors.New("search: no result")
+
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36"
+
+// NewProvider 按名称创建搜索引擎
+func NewProvider(name string) (SearchProvider, error) {
+	cfg := config.AppConfig.SearchConfig
+	client := &http.Client{Timeout: searchTimeout(cfg)}
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "google":
+		return newGoogleProvider(config.AppConfig.GoogelConfig), nil
+	case "bing":
+		return newBingProvider(client, cfg.BingURL, cfg.BingKey), nil
+	case "searxng":
+		if cfg.SearxngURL == "" {
+			return nil, errors.New("search: searxng url not configured")
+		}
+		return newSearxngProvider(client, cfg.SearxngURL), nil
+	case "duckduckgo", "ddg":
+		return newDuckDuckGoProvider(client, ""), nil
+	case "wikipedia", "wiki":
+		return newWikipediaProvider(client, "", cfg.WikiLang), nil
+	}
+	return nil, fmt.Errorf("search: unknown provider %q", name)
+}
+
+// Searcher 按顺序调用搜索引擎，出错或无结果时回退到下一个
+type Searcher struct {
+	providers []SearchProvider
+	detector  EntityDetector
+	planner   Planner
+	crawler   *Crawler
+	progress  *progressSink
+	cache     *ResultCache
+}
+
+func NewSearcher(providers ...SearchProvider) *Searcher {
+	return &Searcher{providers: providers}
+}
+
+// SetDetector 设置实体检测器，未设置时所有问题都会搜索
+func (s *Searcher) SetDetector(detector EntityDetector) {
+	s.detector = detector
+}
+
+// SetPlanner 设置搜索规划，未设置或规划失败时使用实体检测判断是否搜索
+func (s *Searcher) SetPlanner(planner Planner) {
+	s.planner = planner
+}
+
+// SetCrawler 设置网页抓取器，未设置时使用全局共享的抓取器
+func (s *Searcher) SetCrawler(crawler *Crawler) {
+	s.crawler = crawler
+}
+
+// SetProgress 设置搜索进度回调，CustomSearch 返回后不再回调
+func (s *Searcher) SetProgress(fn ProgressFunc) {
+	s.progress = &progressSink{fn: fn}
+}
+
+// SetCache 设置搜索结果缓存，未设置时不规范化分词
+func (s *Searcher) SetCache(c *ResultCache) {
+	s.cache = c
+}
+
+// NewSearcherByName 根据逗号分隔的搜索引擎名称创建，为空时使用配置的默认顺序
+func NewSearcherByName(names string) *Searcher {
+	list := config.AppConfig.SearchConfig.Providers
+	if strings.TrimSpace(names) != "" {
+		list = strings.Split(names, ",")
+	}
+	if len(list) == 0 {
+		list = []string{"google"}
+	}
+	var providers []SearchProvider
+	for _, name := range list {
+		p, err := NewProvider(name)
+		if err != nil {
+			logger.Warnf("%v", err)
+			continue
+		}
+		providers = append(providers, p)
+	}
+	return NewSearcher(providers...)
+}
+
+// Search 返回第一个有结果的搜索引擎的结果
+func (s *Searcher) Search(ctx context.Context, query string, opt Options) (sources []Source, provider string, err error) {
+	err = ErrNoResult
+	for _, p := range s.providers {
+		res, perr := p.Search(ctx, query, opt)
+		if perr != nil {
+			logger.Warnf("搜索引擎 %s 异常:%v", p.Name(), perr)
+			err = perr
+			continue
+		}
+		if len(res) == 0 {
+			continue
+		}
+		if opt.Num > 0 && len(res) > opt.Num {
+			res = res[:opt.Num]
+		}
+		return res, p.Name(), nil
+	}
+	return nil, "", err
+}
+
+func searchTimeout(cfg config.SearchConfig) time.Duration {
+	if cfg.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(cfg.Timeout) * time.Second
+}
+
+// 搜索时间范围
+const (
+	RangeDay   = "day"
+	RangeWeek  = "week"
+	RangeMonth = "month"
+	RangeYear  = "year"
+)
+
+// normalizeRange 规范化时间范围，无法识别时返回空
+func normalizeRange(r string) string {
+	switch strings.ToLower(strings.TrimSpace(r)) {
+	case "day", "d", "today", "recent":
+		return RangeDay
+	case "week", "w":
+		return RangeWeek
+	case "month", "m":
+		return RangeMonth
+	case "year", "y":
+		return RangeYear
+	}
+	return ""
+}
+
+func numOrDefault(n int) int {
+	if n <= 0 {
+		return 10
+	}
+	return n
+}
@@ -0,0 +1,130 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-16 15:02:44
+ * @LastEditTime: 2023-06-16 18:05:31
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/provider_test.go
+ */
+package search
+
+import (
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSearcher_Search(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	hit := []Source{{Title: "南京", Link: "https://example.com/nj"}}
+	tests := []struct {
+		name      string
+		providers []SearchProvider
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "first ok",
+			providers: []SearchProvider{&FakeProvider{ProviderName: "a", Results: hit}, &FakeProvider{ProviderName: "b", Results: hit}},
+			want:      "a",
+		},
+		{
+			name:      "fallback on error",
+			providers: []SearchProvider{&FakeProvider{ProviderName: "a", Err: errors.New("quota")}, &FakeProvider{ProviderName: "b", Results: hit}},
+			want:      "b",
+		},
+		{
+			name:      "fallback on empty",
+			providers: []SearchProvider{&FakeProvider{ProviderName: "a"}, &FakeProvider{ProviderName: "b", Results: hit}},
+			want:      "b",
+		},
+		{
+			name:      "all failed",
+			providers: []SearchProvider{&FakeProvider{ProviderName: "a", Err: errors.New("down")}},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, provider, err := NewSearcher(tt.providers...).Search(context.Background(), "南京", Options{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Search() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if provider != tt.want {
+				t.Errorf("Search() provider = %v, want %v", provider, tt.want)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, hit) {
+				t.Errorf("Search() = %v, want %v", got, hit)
+			}
+		})
+	}
+}
+
+func TestDuckDuckGoProvider(t *testing.T) {
+	page := `<html><body>
+<div class="result"><h2><a class="result__a" href="//duckduckgo.com/l/?uddg=https%3A%2F%2Fexample.com%2Fa&rut=x">Title <b>A</b></a></h2>
+<a class="result__snippet" href="#">Snippet   A</a></div>
+<div class="result"><h2><a class="result__a" href="https://example.com/b">Title B</a></h2></div>
+</body></html>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.FormValue("q") != "南京" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+	got, err := newDuckDuckGoProvider(srv.Client(), srv.URL).Search(context.Background(), "南京", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Source{
+		{Title: "Title A", Link: "https://example.com/a", Snippet: "Snippet A"},
+		{Title: "Title B", Link: "https://example.com/b"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() = %v, want %v", got, want)
+	}
+}
+
+func TestWikipediaProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/w/api.php" || r.URL.Query().Get("srsearch") != "南京" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"query":{"search":[{"title":"南京 市","snippet":"<span class=\"searchmatch\">南京</span>是江苏省会"}]}}`))
+	}))
+	defer srv.Close()
+	got, err := newWikipediaProvider(srv.Client(), srv.URL, "").Search(context.Background(), "南京", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Source{{Title: "南京 市", Link: srv.URL + "/wiki/%E5%8D%97%E4%BA%AC_%E5%B8%82", Snippet: "南京是江苏省会"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() = %v, want %v", got, want)
+	}
+}
+
+func TestSearxngProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "json" || r.URL.Query().Get("time_range") != "day" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"results":[{"title":"T","url":"https://example.com","content":"C"}]}`))
+	}))
+	defer srv.Close()
+	got, err := newSearxngProvider(srv.Client(), srv.URL+"/").Search(context.Background(), "q", Options{TimeRange: RangeDay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Source{{Title: "T", Link: "https://example.com", Snippet: "C"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() = %v, want %v", got, want)
+	}
+}
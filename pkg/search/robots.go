@@ -0,0 +1,131 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-19 09:16:52
+ * @LastEditTime: 2023-06-19 17:40:08
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/robots.go
+ */
+package search
+
+// robots.txt 解析，支持 Allow/Disallow 的 * 和 $ 通配符及 Crawl-delay
+import (
+	"bufio"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+	delay  time.Duration
+}
+
+// robotsRules 适用于本抓取器的规则，nil 表示全部允许
+type robotsRules struct {
+	rules []robotsRule
+	delay time.Duration
+}
+
+// parseRobots 解析 robots.txt，优先使用与 agent 匹配的分组，其次使用 * 分组
+func parseRobots(body, agent string) *robotsRules {
+	var groups []*robotsGroup
+	var cur *robotsGroup
+	inAgents := false
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				cur = &robotsGroup{}
+				groups = append(groups, cur)
+			}
+			cur.agents = append(cur.agents, strings.ToLower(value))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			if cur == nil || value == "" {
+				continue
+			}
+			cur.rules = append(cur.rules, robotsRule{allow: key == "allow", length: len(value), pattern: robotsPattern(value)})
+		case "crawl-delay":
+			inAgents = false
+			if cur == nil {
+				continue
+			}
+			if sec, err := strconv.ParseFloat(value, 64); err == nil && sec > 0 {
+				cur.delay = time.Duration(sec * float64(time.Second))
+			}
+		default:
+			inAgents = false
+		}
+	}
+	agent = strings.ToLower(agent)
+	var matched, wildcard *robotsGroup
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if a == "*" {
+				if wildcard == nil {
+					wildcard = g
+				}
+			} else if matched == nil && strings.Contains(agent, a) {
+				matched = g
+			}
+		}
+	}
+	if matched == nil {
+		matched = wildcard
+	}
+	if matched == nil {
+		return nil
+	}
+	return &robotsRules{rules: matched.rules, delay: matched.delay}
+}
+
+// robotsPattern 将路径规则转换为正则，* 匹配任意字符，结尾的 $ 表示完整匹配
+func robotsPattern(p string) *regexp.Regexp {
+	anchored := strings.HasSuffix(p, "$")
+	p = strings.TrimSuffix(p, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(p), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed 按最长匹配规则判断路径是否允许抓取，长度相同时 Allow 优先
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	if path == "" {
+		path = "/"
+	}
+	allow, best := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > best || (rule.length == best && rule.allow) {
+			allow, best = rule.allow, rule.length
+		}
+	}
+	return allow
+}
@@ -0,0 +1,60 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-19 15:03:27
+ * @LastEditTime: 2023-06-19 17:40:08
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/robots_test.go
+ */
+package search
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseRobots(t *testing.T) {
+	body := `# comment
+User-agent: Googlebot
+Disallow: /
+
+User-agent: *
+Crawl-delay: 2
+Disallow: /search
+Disallow: /*.pdf$
+Allow: /search/about
+
+User-agent: chatserver-bot
+Disallow: /bot-only
+`
+	rules := parseRobots(body, crawlerAgent)
+	if rules.delay != 0 {
+		t.Errorf("delay = %v, want 0", rules.delay)
+	}
+	tests := []struct {
+		name  string
+		agent string
+		path  string
+		want  bool
+	}{
+		{name: "specific group", agent: crawlerAgent, path: "/bot-only/a", want: false},
+		{name: "specific group ignores wildcard", agent: crawlerAgent, path: "/search", want: true},
+		{name: "wildcard disallow", agent: "other", path: "/search?q=1", want: false},
+		{name: "longest allow", agent: "other", path: "/search/about", want: true},
+		{name: "pdf suffix", agent: "other", path: "/files/a.pdf", want: false},
+		{name: "pdf with query", agent: "other", path: "/files/a.pdf?x=1", want: true},
+		{name: "root", agent: "other", path: "/", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRobots(body, tt.agent).allowed(tt.path); got != tt.want {
+				t.Errorf("allowed(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+	if d := parseRobots(body, "other").delay; d != 2*time.Second {
+		t.Errorf("delay = %v, want 2s", d)
+	}
+	if r := parseRobots("", crawlerAgent); !r.allowed("/any") {
+		t.Errorf("empty robots should allow all")
+	}
+}
@@ -7,52 +7,18 @@
  */
 package search
 
-// 对接Google API。通过query查询关键词
+// 联网搜索：通过搜索引擎查询关键词并汇总网页内容
 import (
-	"chatserver-api/internal/consts"
 	"chatserver-api/pkg/cache"
 	"chatserver-api/pkg/config"
 	"chatserver-api/pkg/logger"
 	"chatserver-api/pkg/openai"
-	"chatserver-api/utils/security"
 	"context"
-	"net/http"
+	"fmt"
+	"strings"
 	"sync"
-	"time"
-
-	customsearch "google.golang.org/api/customsearch/v1"
-	"google.golang.org/api/googleapi/transport"
 )
 
-func summaryContent(message string) string {
-	if message == "" {
-		return ""
-	}
-	var req openai.ChatCompletionRequest
-	var chatMessages []openai.ChatCompletionMessage
-	var systemPreset, userMessage openai.ChatCompletionMessage
-	systemPreset.Role = openai.ChatMessageRoleSystem
-	systemPreset.Content = `Summarize the content of the webpage based on its title, extract the main information and list the detailed data included,and keep it within 300 words.please respond in Chinese.`
-	userMessage.Role = openai.ChatMessageRoleUser
-	userMessage.Content = message
-	chatMessages = append(chatMessages, systemPreset, userMessage)
-	req.Model = "gpt-3.5-turbo"
-	req.MaxTokens = 700
-	req.Messages = chatMessages
-	client, err := openai.NewClient()
-	if err != nil {
-		logger.Errorf("%s", err)
-		return ""
-	}
-	resp, err := client.CreateChatCompletion(req)
-	if err != nil {
-		logger.Errorf("%s", err)
-		return ""
-	}
-	content := resp.Choices[0].Message.Content
-	return content
-}
-
 // Message拼装
 
 // 搜索
@@ -62,51 +28,48 @@ type searchOne struct {
 	Link    string
 }
 
-func CustomSearch(ctx context.Context, query string) (string, error) {
-	googlecfg := config.AppConfig.GoogelConfig
-	ner, keyword := nerDetec(query)
-	if ner == 0 {
-		logger.Debug("没有实体返回")
-		return "", nil
-	}
-	rc := cache.GetRedisClient()
-	cacheresult, err := rc.Get(ctx, consts.QuerySearchPrefix+security.Md5(query)).Result()
-	if err == nil {
+// Source 回答引用的网页来源
+type Source struct {
+	Title   string `json:"title"`
+	Link    string `json:"link"`
+	Snippet string `json:"snippet"`
+}
+
+// SearchResult 搜索摘要上下文及其来源
+type SearchResult struct {
+	Context string   `json:"context"`
+	Sources []Source `json:"sources"`
+}
+
+// CustomSearch 搜索并抓取、汇总前几个网页的内容，history 为此前的对话，用于规划检索语句
+func (s *Searcher) CustomSearch(ctx context.Context, query string, history []openai.ChatCompletionMessage) (res SearchResult, err error) {
+	defer s.progress.close()
+	queries := s.plan(ctx, query, history)
+	if len(queries) == 0 {
+		logger.Debug("无需搜索")
+		return res, nil
+	}
+	var qs []string
+	for _, q := range queries {
+		qs = append(qs, q.Query)
+	}
+	s.progress.emit(Progress{Stage: StageSearching, Queries: qs})
+	rcache := s.cacheOrDefault()
+	if cached, ok := rcache.Get(ctx, s.names(), queries); ok {
 		logger.Debug("获取缓存返回")
-		return cacheresult, nil
+		return cached, nil
 	}
 
-	var searchResult []searchOne
-	var textcontent string
-	client := &http.Client{Transport: &transport.APIKey{Key: googlecfg.ApiKey}}
-	svc, err := customsearch.New(client)
+	sources, err := s.multiSearch(ctx, queries)
 	if err != nil {
-		logger.Errorf("%s", err)
-		return "", err
-	}
-
-	var resp *customsearch.Search
-
-	switch ner {
-	case 2:
-		{
-			resp, err = svc.Cse.List().Cx(googlecfg.CxId).Num(10).Sort("date").Cr("zh-CN").DateRestrict("d[2]").ExactTerms(keyword).Q(query).Do()
-			if err != nil {
-				logger.Errorf("%s", err)
-				return "", err
-			}
-		}
-	default:
-		{
-			resp, err = svc.Cse.List().Cx(googlecfg.CxId).Num(10).Cr("zh-CN").DateRestrict("y[3]").ExactTerms(keyword).Sort("date").Q(query).Do()
-			if err != nil {
-				logger.Errorf("%s", err)
-				return "", err
-			}
+		if err == ErrNoResult {
+			return res, nil
 		}
+		logger.Errorf("%s", err)
+		return res, err
 	}
-
-	for _, result := range resp.Items {
+	var searchResult []searchOne
+	for _, result := range sources {
 		searchone := searchOne{}
 		searchone.Title = result.Title
 		searchone.Snippet = result.Snippet
@@ -114,35 +77,136 @@ func CustomSearch(ctx context.Context, query string) (string, error) {
 		searchResult = append(searchResult, searchone)
 	}
 
-	lenresult := len(searchResult)
-	if lenresult == 0 {
-		return "", nil
+	opt := newSummaryOptions(config.AppConfig.SearchConfig)
+	if len(searchResult) > opt.sources {
+		searchResult = searchResult[:opt.sources]
 	}
-	if lenresult > 6 {
-		lenresult = 6
+	picked := make([]Source, len(searchResult))
+	for i, v := range searchResult {
+		picked[i] = Source{Title: v.Title, Link: v.Link, Snippet: v.Snippet}
 	}
-	wg := sync.WaitGroup{}
+	summaries := s.summarizeSources(ctx, opt, picked)
+	s.progress.emit(Progress{Stage: StageDone, Total: len(summaries)})
+	s.progress.close()
+
+	// 按来源编号拼接，便于模型回答时引用 [n]；超时的来源被丢弃，全部超时时仅使用搜索摘要
+	n := 0
+	for i, v := range searchResult {
+		summary, ok := summaries[i]
+		if !ok && len(summaries) > 0 {
+			continue
+		}
+		n++
+		res.Context += fmt.Sprintf("[%d]\n", n) + "Title:\n" + v.Title + "\n" + "Snippet:\n" + v.Snippet + "\n" + "Content:\n" + summary + "\n" + "Web Link:\n" + v.Link + "\n"
+		res.Sources = append(res.Sources, picked[i])
+	}
+	return res, rcache.Set(ctx, s.names(), queries, res)
+}
 
-	var lock sync.Mutex
+// plan 生成检索语句，优先使用模型规划，规划失败时回退到实体检测
+func (s *Searcher) plan(ctx context.Context, query string, history []openai.ChatCompletionMessage) []PlanQuery {
+	if s.planner != nil {
+		plan, err := s.planner.Plan(ctx, history, query)
+		if err == nil {
+			if !plan.NeedSearch {
+				return nil
+			}
+			logger.Debugf("搜索规划: %+v", plan.Queries)
+			return plan.Queries
+		}
+		logger.Warnf("搜索规划失败，回退实体检测:%v", err)
+	}
+	ner, keyword := NerSearch, ""
+	if s.detector != nil {
+		ner, keyword = s.detector.Detect(query)
+	}
+	if ner == NerNone {
+		return nil
+	}
+	q := PlanQuery{Query: query, Keyword: keyword}
+	if ner == NerRecent {
+		q.TimeRange = RangeDay
+	}
+	return []PlanQuery{q}
+}
 
-	for _, v := range searchResult[:lenresult-1] {
+// multiSearch 并行执行多个检索语句并合并结果
+func (s *Searcher) multiSearch(ctx context.Context, queries []PlanQuery) ([]Source, error) {
+	searchcfg := config.AppConfig.SearchConfig
+	results := make([][]Source, len(queries))
+	errs := make([]error, len(queries))
+	wg := sync.WaitGroup{}
+	for i, q := range queries {
 		wg.Add(1)
-		go func(v searchOne) {
+		go func(i int, q PlanQuery) {
 			defer wg.Done()
-			content := crawlPage(v.Link)
-			var summary string
-			if content != "" {
-				summary = summaryContent("Title:" + v.Title + "\n" + "Link" + v.Link + "\n" + "Content:" + content)
+			opt := Options{
+				Keyword:   q.Keyword,
+				TimeRange: q.TimeRange,
+				Num:       10,
+				Region:    searchcfg.Region,
+				Language:  searchcfg.Language,
+			}
+			var provider string
+			results[i], provider, errs[i] = s.Search(ctx, q.Query, opt)
+			logger.Debugf("搜索引擎 %s 检索 %s 返回 %d 条结果", provider, q.Query, len(results[i]))
+		}(i, q)
+	}
+	wg.Wait()
+	merged := mergeSources(results)
+	if len(merged) == 0 {
+		for _, err := range errs {
+			if err != nil && err != ErrNoResult {
+				return nil, err
+			}
+		}
+		return nil, ErrNoResult
+	}
+	return merged, nil
+}
+
+// mergeSources 轮流取各检索语句的结果，按链接去重，保证每个检索语句的靠前结果都能入选
+func mergeSources(results [][]Source) []Source {
+	var merged []Source
+	seen := make(map[string]bool)
+	for i := 0; ; i++ {
+		added := false
+		for _, list := range results {
+			if i >= len(list) {
+				continue
 			}
-			lock.Lock()
-			textcontent += "Title:\n" + v.Title + "\n" + "Snippet:\n" + v.Snippet + "\n" + "Content:\n" + summary + "\n" + "Web Link:\n" + v.Link + "\n"
-			lock.Unlock()
-		}(v)
+			added = true
+			key := strings.TrimRight(strings.SplitN(list[i].Link, "#", 2)[0], "/")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, list[i])
+		}
+		if !added {
+			return merged
+		}
+	}
+}
 
+func (s *Searcher) crawlerOrDefault() *Crawler {
+	if s.crawler != nil {
+		return s.crawler
 	}
+	return DefaultCrawler()
+}
 
-	wg.Wait()
+func (s *Searcher) cacheOrDefault() *ResultCache {
+	if s.cache != nil {
+		return s.cache
+	}
+	return NewResultCache(cache.GetRedisClient(), nil)
+}
 
-	err = rc.Set(ctx, consts.QuerySearchPrefix+security.Md5(query), textcontent, 30*time.Minute).Err()
-	return textcontent, err
+func (s *Searcher) names() string {
+	var names []string
+	for _, p := range s.providers {
+		names = append(names, p.Name())
+	}
+	return strings.Join(names, ",")
 }
@@ -45,11 +45,13 @@ func Test_customSearch(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotResultstr, err := CustomSearch(context.Background(), tt.args.query)
+			s := NewSearcherByName("")
+			s.SetDetector(&tencentDetector{})
+			gotResultstr, err := s.CustomSearch(context.Background(), tt.args.query, nil)
 			if err != nil {
 				fmt.Println(err)
 			}
-			fmt.Println(gotResultstr)
+			fmt.Println(gotResultstr.Context)
 		})
 	}
 }
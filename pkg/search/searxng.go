@@ -0,0 +1,76 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-16 10:48:37
+ * @LastEditTime: 2023-06-16 18:05:31
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/searxng.go
+ */
+package search
+
+// 自建 SearXNG 元搜索引擎，需在 settings.yml 的 search.formats 中开启 json
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type searxngProvider struct {
+	client  *http.Client
+	baseURL string
+}
+
+type searxngResponse struct {
+	Results []struct {
+		Title   string `json:"title"`
+		URL     string `json:"url"`
+		Content string `json:"content"`
+	} `json:"results"`
+}
+
+func newSearxngProvider(client *http.Client, baseURL string) *searxngProvider {
+	return &searxngProvider{client: client, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (s *searxngProvider) Name() string {
+	return "searxng"
+}
+
+func (s *searxngProvider) Search(ctx context.Context, query string, opt Options) ([]Source, error) {
+	q := query
+	if opt.Keyword != "" {
+		q = fmt.Sprintf("%s \"%s\"", query, opt.Keyword)
+	}
+	params := url.Values{}
+	params.Set("q", q)
+	params.Set("format", "json")
+	if opt.Language != "" {
+		params.Set("language", opt.Language)
+	}
+	if opt.TimeRange != "" {
+		params.Set("time_range", opt.TimeRange)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("searxng: status %d", resp.StatusCode)
+	}
+	var res searxngResponse
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	var sources []Source
+	for _, v := range res.Results {
+		sources = append(sources, Source{Title: v.Title, Link: v.URL, Snippet: v.Content})
+	}
+	return sources, nil
+}
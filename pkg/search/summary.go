@@ -0,0 +1,209 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-20 09:42:18
+ * @LastEditTime: 2023-06-20 18:06:33
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/summary.go
+ */
+package search
+
+// 网页摘要与搜索进度：并行抓取、汇总，超过截止时间的网页被丢弃
+import (
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"chatserver-api/pkg/openai"
+	"chatserver-api/pkg/usage"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 搜索进度阶段
+const (
+	StageSearching   = "searching"
+	StageReading     = "reading"
+	StageSummarising = "summarising"
+	StageDone        = "done"
+	StageAnswering   = "answering"
+)
+
+// Progress 搜索进度事件，Index 为来源编号(从1开始)
+type Progress struct {
+	Stage   string   `json:"stage"`
+	Queries []string `json:"queries,omitempty"`
+	Index   int      `json:"index,omitempty"`
+	Total   int      `json:"total,omitempty"`
+	Title   string   `json:"title,omitempty"`
+	Link    string   `json:"link,omitempty"`
+}
+
+// ProgressFunc 接收搜索进度，调用是串行的
+type ProgressFunc func(Progress)
+
+// progressSink 串行转发进度事件，关闭后丢弃超时任务的事件
+type progressSink struct {
+	mu     sync.Mutex
+	fn     ProgressFunc
+	closed bool
+}
+
+func (p *progressSink) emit(ev Progress) {
+	if p == nil || p.fn == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.fn(ev)
+	}
+}
+
+func (p *progressSink) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+}
+
+// summaryOptions 网页摘要配置
+type summaryOptions struct {
+	model     string
+	language  string
+	words     int
+	maxTokens int
+	sources   int
+	deadline  time.Duration
+}
+
+func newSummaryOptions(cfg config.SearchConfig) summaryOptions {
+	opt := summaryOptions{
+		model:     cfg.SummaryModel,
+		language:  cfg.SummaryLanguage,
+		words:     cfg.SummaryWords,
+		maxTokens: cfg.SummaryMaxTokens,
+		sources:   cfg.SummarySources,
+		deadline:  time.Duration(cfg.SummaryDeadline) * time.Second,
+	}
+	if opt.model == "" {
+		opt.model = openai.GPT3Dot5Turbo
+	}
+	if opt.language == "" {
+		opt.language = "Chinese"
+	}
+	if opt.words <= 0 {
+		opt.words = 300
+	}
+	if opt.maxTokens <= 0 {
+		opt.maxTokens = 700
+	}
+	if opt.sources <= 0 {
+		opt.sources = 5
+	}
+	if opt.deadline <= 0 {
+		opt.deadline = 25 * time.Second
+	}
+	return opt
+}
+
+func summaryContent(ctx context.Context, opt summaryOptions, message string) (string, error) {
+	if message == "" {
+		return "", nil
+	}
+	var req openai.ChatCompletionRequest
+	req.Model = opt.model
+	req.MaxTokens = opt.maxTokens
+	req.Messages = []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: fmt.Sprintf("Summarize the content of the webpage based on its title, extract the main information and list the detailed data included, and keep it within %d words. Please respond in %s.", opt.words, opt.language),
+		},
+		{Role: openai.ChatMessageRoleUser, Content: message},
+	}
+	client, err := openai.NewClient()
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.CreateChatCompletion(req)
+	if err != nil {
+		return "", err
+	}
+	// 摘要调用的用量计入本轮对话的费用
+	usage.Add(ctx, usage.SourceSummary, req.Model, resp.Usage)
+	if len(resp.Choices) == 0 {
+		return "", errors.New("summary: empty completion")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// sourceSummary 单个来源的抓取和摘要结果
+type sourceSummary struct {
+	index   int
+	summary string
+}
+
+// summarize 生成网页摘要，测试时替换以避免请求模型
+var summarize = summaryContent
+
+// summarizeSources 并行抓取并汇总网页，返回截止时间前完成的摘要，未完成或失败的来源不在结果中
+func (s *Searcher) summarizeSources(ctx context.Context, opt summaryOptions, sources []Source) map[int]string {
+	ctx, cancel := context.WithTimeout(ctx, opt.deadline)
+	defer cancel()
+	crawler := s.crawlerOrDefault()
+	// 与 FetchAll 一样最多 Workers 个协程同时抓取，任务预先入队，缓冲区足够大，截止后仍在运行的任务不会阻塞
+	jobs := make(chan int, len(sources))
+	for i := range sources {
+		jobs <- i
+	}
+	close(jobs)
+	done := make(chan sourceSummary, len(sources))
+	workers := crawler.cfg.Workers
+	if workers > len(sources) {
+		workers = len(sources)
+	}
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range jobs {
+				if ctx.Err() != nil {
+					done <- sourceSummary{index: -1}
+					continue
+				}
+				done <- s.summarizeSource(ctx, opt, crawler, i, sources)
+			}
+		}()
+	}
+	summaries := make(map[int]string)
+	for range sources {
+		select {
+		case r := <-done:
+			if r.index >= 0 && r.summary != "" {
+				summaries[r.index] = r.summary
+			}
+		case <-ctx.Done():
+			logger.Debugf("网页摘要超时，完成 %d/%d", len(summaries), len(sources))
+			return summaries
+		}
+	}
+	return summaries
+}
+
+// summarizeSource 抓取并汇总第 i 个来源，失败时 index 为 -1
+func (s *Searcher) summarizeSource(ctx context.Context, opt summaryOptions, crawler *Crawler, i int, sources []Source) sourceSummary {
+	src := sources[i]
+	s.progress.emit(Progress{Stage: StageReading, Index: i + 1, Total: len(sources), Title: src.Title, Link: src.Link})
+	page, err := crawler.Fetch(ctx, src.Link)
+	if err != nil || page.Content == "" {
+		logger.Debugf("抓取网页失败 %s: %v", src.Link, err)
+		return sourceSummary{index: -1}
+	}
+	s.progress.emit(Progress{Stage: StageSummarising, Index: i + 1, Total: len(sources), Title: src.Title, Link: src.Link})
+	summary, err := summarize(ctx, opt, "Title:"+src.Title+"\nLink:"+src.Link+"\nContent:"+page.Title+"\n"+page.Content)
+	if err != nil {
+		logger.Warnf("网页摘要失败 %s: %v", src.Link, err)
+		return sourceSummary{index: -1}
+	}
+	return sourceSummary{index: i, summary: summary}
+}
@@ -0,0 +1,202 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-28 09:36:14
+ * @LastEditTime: 2023-06-28 09:36:14
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/search/summary_test.go
+ */
+package search
+
+import (
+	"chatserver-api/pkg/config"
+	"chatserver-api/pkg/logger"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubSummarize 以网页标题作为摘要，标题为 "bad" 时返回错误
+func stubSummarize(t *testing.T) {
+	t.Helper()
+	old := summarize
+	summarize = func(ctx context.Context, opt summaryOptions, message string) (string, error) {
+		title := strings.TrimPrefix(strings.SplitN(message, "\n", 2)[0], "Title:")
+		if title == "bad" {
+			return "", errors.New("summary failed")
+		}
+		return "摘要:" + title, nil
+	}
+	t.Cleanup(func() { summarize = old })
+}
+
+// progressLog 记录进度事件
+type progressLog struct {
+	mu     sync.Mutex
+	events []Progress
+}
+
+func (p *progressLog) add(ev Progress) {
+	p.mu.Lock()
+	p.events = append(p.events, ev)
+	p.mu.Unlock()
+}
+
+func (p *progressLog) count(stage string) (n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ev := range p.events {
+		if ev.Stage == stage {
+			n++
+		}
+	}
+	return
+}
+
+// summaryServer 返回网页正文，记录同时处理的最大请求数，/slow 延迟响应，/missing 返回 404
+func summaryServer(active, peak *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(active, 1)
+		defer atomic.AddInt32(active, -1)
+		for {
+			p := atomic.LoadInt32(peak)
+			if n <= p || atomic.CompareAndSwapInt32(peak, p, n) {
+				break
+			}
+		}
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+			return
+		case "/slow":
+			time.Sleep(300 * time.Millisecond)
+		default:
+			time.Sleep(20 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("正文" + r.URL.Path))
+	}))
+}
+
+func testSummaryOptions(deadline time.Duration) summaryOptions {
+	opt := newSummaryOptions(config.SearchConfig{})
+	opt.deadline = deadline
+	return opt
+}
+
+func TestSearcher_summarizeSources(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	stubSummarize(t)
+	var active, peak int32
+	srv := summaryServer(&active, &peak)
+	defer srv.Close()
+
+	var sources []Source
+	for _, title := range []string{"a", "b", "c", "d", "e", "f"} {
+		sources = append(sources, Source{Title: title, Link: srv.URL + "/" + title})
+	}
+	sources = append(sources,
+		Source{Title: "missing", Link: srv.URL + "/missing"},
+		Source{Title: "bad", Link: srv.URL + "/bad"},
+	)
+	s := NewSearcher()
+	s.SetCrawler(NewCrawler(config.CrawlConfig{Workers: 2, IgnoreRobots: true, AllowPrivate: true}, nil))
+	log := &progressLog{}
+	s.SetProgress(log.add)
+
+	got := s.summarizeSources(context.Background(), testSummaryOptions(5*time.Second), sources)
+	if len(got) != 6 {
+		t.Fatalf("summarizeSources() = %v, want 6 summaries", got)
+	}
+	for i := 0; i < 6; i++ {
+		if want := "摘要:" + sources[i].Title; got[i] != want {
+			t.Errorf("summarizeSources()[%d] = %q, want %q", i, got[i], want)
+		}
+	}
+	if peak > 2 {
+		t.Errorf("summarizeSources() fetched %d pages at once, want at most 2 workers", peak)
+	}
+	if n := log.count(StageReading); n != len(sources) {
+		t.Errorf("reading events = %d, want %d", n, len(sources))
+	}
+	if n := log.count(StageSummarising); n != 7 {
+		t.Errorf("summarising events = %d, want 7", n)
+	}
+}
+
+func TestSearcher_summarizeSources_deadline(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	stubSummarize(t)
+	var active, peak int32
+	srv := summaryServer(&active, &peak)
+	defer srv.Close()
+
+	s := NewSearcher()
+	s.SetCrawler(NewCrawler(config.CrawlConfig{Workers: 1, IgnoreRobots: true, AllowPrivate: true}, nil))
+	sources := []Source{
+		{Title: "fast", Link: srv.URL + "/fast"},
+		{Title: "slow", Link: srv.URL + "/slow"},
+		{Title: "late", Link: srv.URL + "/late"},
+	}
+	start := time.Now()
+	got := s.summarizeSources(context.Background(), testSummaryOptions(150*time.Millisecond), sources)
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("summarizeSources() returned after %v, want deadline", elapsed)
+	}
+	if len(got) != 1 || got[0] != "摘要:fast" {
+		t.Errorf("summarizeSources() = %v, want only fast source", got)
+	}
+}
+
+func TestSearcher_CustomSearch_progress(t *testing.T) {
+	logger.InitLogger(&config.LogConfig{Level: "fatal"}, "test")
+	if config.AppConfig == nil {
+		config.AppConfig = &config.Config{}
+	}
+	stubSummarize(t)
+	var active, peak int32
+	srv := summaryServer(&active, &peak)
+	defer srv.Close()
+
+	s := NewSearcher(&FakeProvider{Results: []Source{
+		{Title: "a", Link: srv.URL + "/a", Snippet: "片段a"},
+		{Title: "missing", Link: srv.URL + "/missing", Snippet: "片段m"},
+		{Title: "b", Link: srv.URL + "/b", Snippet: "片段b"},
+	}})
+	s.SetCrawler(NewCrawler(config.CrawlConfig{IgnoreRobots: true, AllowPrivate: true}, nil))
+	s.SetCache(NewResultCache(nil, nil))
+	log := &progressLog{}
+	s.SetProgress(log.add)
+
+	res, err := s.CustomSearch(context.Background(), "南京天气", nil)
+	if err != nil {
+		t.Fatalf("CustomSearch() error = %v", err)
+	}
+	if len(res.Sources) != 2 || res.Sources[0].Title != "a" || res.Sources[1].Title != "b" {
+		t.Errorf("CustomSearch() sources = %+v, want a and b", res.Sources)
+	}
+	if !strings.Contains(res.Context, "[1]\n") || !strings.Contains(res.Context, "[2]\n") || !strings.Contains(res.Context, "摘要:b") {
+		t.Errorf("CustomSearch() context = %q", res.Context)
+	}
+	log.mu.Lock()
+	events := append([]Progress(nil), log.events...)
+	log.mu.Unlock()
+	if len(events) == 0 || events[0].Stage != StageSearching || events[0].Queries[0] != "南京天气" {
+		t.Fatalf("first event = %+v, want searching", events)
+	}
+	if last := events[len(events)-1]; last.Stage != StageDone || last.Total != 2 {
+		t.Errorf("last event = %+v, want done with 2 sources", last)
+	}
+	if n := log.count(StageReading); n != 3 {
+		t.Errorf("reading events = %d, want 3", n)
+	}
+	s.progress.emit(Progress{Stage: StageReading})
+	if n := log.count(StageReading); n != 3 {
+		t.Errorf("events after CustomSearch returned should be dropped")
+	}
+}
@@ -1,8 +1,95 @@
 /*
  * @Author: cloudyi.li
  * @Date: 2023-06-06 11:23:44
- * @LastEditTime: 2023-06-07 09:29:02
+ * @LastEditTime: 2023-06-16 18:05:31
  * @LastEditors: cloudyi.li
  * @FilePath: /chatserver-api/pkg/search/wikipedia.go
  */
 package search
+
+// Wikipedia MediaWiki 搜索接口
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+type wikipediaProvider struct {
+	client  *http.Client
+	baseURL string
+}
+
+type wikipediaResponse struct {
+	Query struct {
+		Search []struct {
+			Title   string `json:"title"`
+			Snippet string `json:"snippet"`
+		} `json:"search"`
+	} `json:"query"`
+}
+
+// newWikipediaProvider baseURL 为空时使用 lang 对应的站点
+func newWikipediaProvider(client *http.Client, baseURL, lang string) *wikipediaProvider {
+	if baseURL == "" {
+		if lang == "" {
+			lang = "zh"
+		}
+		baseURL = "https://" + lang + ".wikipedia.org"
+	}
+	return &wikipediaProvider{client: client, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (w *wikipediaProvider) Name() string {
+	return "wikipedia"
+}
+
+func (w *wikipediaProvider) Search(ctx context.Context, query string, opt Options) ([]Source, error) {
+	params := url.Values{}
+	params.Set("action", "query")
+	params.Set("list", "search")
+	params.Set("format", "json")
+	params.Set("utf8", "1")
+	params.Set("srsearch", query)
+	params.Set("srlimit", strconv.Itoa(numOrDefault(opt.Num)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.baseURL+"/w/api.php?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("wikipedia: status %d", resp.StatusCode)
+	}
+	var res wikipediaResponse
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	var sources []Source
+	for _, v := range res.Query.Search {
+		sources = append(sources, Source{
+			Title:   v.Title,
+			Link:    w.baseURL + "/wiki/" + url.PathEscape(strings.ReplaceAll(v.Title, " ", "_")),
+			Snippet: stripTags(v.Snippet),
+		})
+	}
+	return sources, nil
+}
+
+// stripTags 去掉摘要中的 <span class="searchmatch"> 等高亮标签
+func stripTags(s string) string {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return s
+	}
+	return nodeText(doc)
+}
@@ -2,6 +2,7 @@ package tika
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -59,6 +60,27 @@ func readPdf(path string) (string, error) {
 	return buf.String(), nil
 }
 
+// ReadPdfBytes 解析内存中的 PDF 纯文本，用于抓取网页中的 PDF 链接
+func ReadPdfBytes(data []byte) (text string, err error) {
+	defer func() {
+		// 解析异常的 PDF 时 pdf 库可能 panic
+		if r := recover(); r != nil {
+			err = errors.New("pdf: malformed document")
+		}
+	}()
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	b, err := r.GetPlainText()
+	if err != nil {
+		return "", err
+	}
+	buf.ReadFrom(b)
+	return buf.String(), nil
+}
+
 type FieldRect struct {
 	rect       pdf.Rect
 	texts      []pdf.Text
@@ -66,14 +88,25 @@ type FieldRect struct {
 	resultText string
 }
 
-func ReadPd3f(title, filename string) ([]string, error) {
+// PdfChunk PDF 切分后的文本片段，Page 为片段起始内容所在页码
+type PdfChunk struct {
+	Page int
+	Body string
+}
+
+type pdfLine struct {
+	page int
+	text string
+}
+
+func ReadPd3f(title, filename string) ([]PdfChunk, error) {
 	f, r, err := pdf.Open("uploadfile/" + filename)
 	defer f.Close()
 	if err != nil {
 		return nil, err
 	}
 	totalPage := r.NumPage()
-	var posttext string
+	var lines []pdfLine
 
 	for pageIndex := 1; pageIndex <= totalPage; pageIndex++ {
 		p := r.Page(pageIndex)
@@ -116,18 +149,22 @@ func ReadPd3f(title, filename string) ([]string, error) {
 			lastpos = &pdf.Point{X: f.X, Y: f.Y}
 
 		}
-		posttext += resultText
+		for _, v := range strings.Split(resultText, "\n") {
+			lines = append(lines, pdfLine{page: pageIndex, text: v})
+		}
 	}
-	// fmt.Print(posttext)
 
-	list1 := strings.Split(posttext, "\n")
-	var textbodylist []string
+	var chunks []PdfChunk
 	var textbody string
+	var page int
 
-	for i, v := range list1 {
-		textbody += v
-		if len(textbody) > 900 || i == len(list1)-1 {
-			textbodylist = append(textbodylist, title+"\n"+textbody)
+	for i, v := range lines {
+		if textbody == "" {
+			page = v.page
+		}
+		textbody += v.text
+		if len(textbody) > 900 || i == len(lines)-1 {
+			chunks = append(chunks, PdfChunk{Page: page, Body: title + "\n" + textbody})
 			textbody = ""
 		}
 	}
@@ -140,11 +177,11 @@ func ReadPd3f(title, filename string) ([]string, error) {
 
 	// writer := bufio.NewWriter(file)
 
-	// for _, v := range list1 {
-	// 	writer.WriteString(v)
+	// for _, v := range lines {
+	// 	writer.WriteString(v.text)
 	// 	// writer.WriteString("\n------------------\n")
 	// }
 
 	// writer.Flush()
-	return textbodylist, nil
+	return chunks, nil
 }
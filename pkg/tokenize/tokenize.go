@@ -8,8 +8,11 @@
 package tokenize
 
 import (
+	"bufio"
+	"os"
 	"path"
 	"strings"
+	"unicode"
 
 	"github.com/yanyiwu/gojieba"
 )
@@ -18,10 +21,19 @@ var _ Tokenizer = (*tokenizer)(nil)
 
 type Tokenizer interface {
 	GetKeyword(s string) (keyword string)
+	Tag(s string) (words []Word)
+	Terms(s string) (terms []string)
+}
+
+// Word 分词结果及词性，词性标注沿用 jieba(ICTCLAS) 标记，如 nr 人名, ns 地名, nt 机构名, t 时间词
+type Word struct {
+	Text string
+	Pos  string
 }
 
 type tokenizer struct {
 	jieba *gojieba.Jieba
+	stop  map[string]bool
 }
 
 func NewTokenizer(dictDir string) *tokenizer {
@@ -34,9 +46,27 @@ func NewTokenizer(dictDir string) *tokenizer {
 
 	return &tokenizer{
 		jieba: tokenzier,
+		stop:  loadStopWords(stopPath),
 	}
 }
 
+// loadStopWords 读取停用词表，每行一个词，读取失败时不过滤停用词
+func loadStopWords(filename string) map[string]bool {
+	stop := make(map[string]bool)
+	f, err := os.Open(filename)
+	if err != nil {
+		return stop
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if w := strings.TrimSpace(scanner.Text()); w != "" {
+			stop[w] = true
+		}
+	}
+	return stop
+}
+
 func (t *tokenizer) GetKeyword(s string) (keyword string) {
 	// tokenzier.Free()
 	words := t.jieba.Extract(s, 35)
@@ -51,3 +81,28 @@ func (t *tokenizer) GetSearch(s string) (search string) {
 	search = strings.Join(strlist, "+")
 	return
 }
+
+// Tag 分词并标注词性，用户词典中的词使用词典中指定的词性
+func (t *tokenizer) Tag(s string) (words []Word) {
+	for _, v := range t.jieba.Tag(s) {
+		i := strings.LastIndex(v, "/")
+		if i < 0 {
+			words = append(words, Word{Text: v})
+			continue
+		}
+		words = append(words, Word{Text: v[:i], Pos: v[i+1:]})
+	}
+	return
+}
+
+// Terms 分词并去除停用词、标点和空白，英文统一为小写
+func (t *tokenizer) Terms(s string) (terms []string) {
+	for _, v := range t.jieba.Cut(strings.ToLower(s), true) {
+		v = strings.TrimSpace(v)
+		if v == "" || t.stop[v] || strings.IndexFunc(v, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) < 0 {
+			continue
+		}
+		terms = append(terms, v)
+	}
+	return
+}
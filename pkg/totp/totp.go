@@ -0,0 +1,136 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-23 14:16:50
+ * @LastEditTime: 2023-06-23 14:16:50
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/totp/totp.go
+ */
+package totp
+
+// 基于时间的一次性密码(RFC 6238)，HMAC-SHA1、6 位、30 秒步长，与常见身份验证器 App 兼容
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	period = 30
+	digits = 6
+	// skew 允许前后各一个步长的时钟误差
+	skew = 1
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret 生成 160 位随机密钥，返回 base32 编码
+func GenerateSecret() string {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b32.EncodeToString(b)
+}
+
+// Code 计算指定时间的验证码
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(t.Unix()/period)), nil
+}
+
+// Verify 校验验证码，成功时返回匹配的时间步，调用方据此拒绝重复使用同一验证码
+func Verify(secret, code string, t time.Time) (counter int64, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != digits {
+		return 0, false
+	}
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+	now := t.Unix() / period
+	for i := -skew; i <= skew; i++ {
+		c := now + int64(i)
+		if hmac.Equal([]byte(hotp(key, uint64(c))), []byte(code)) {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// KeyURI 生成身份验证器 App 使用的 otpauth:// 地址
+func KeyURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(digits))
+	v.Set("period", fmt.Sprint(period))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
+
+// QRCode 生成地址的二维码 PNG，返回 base64 编码
+func QRCode(content string) (string, error) {
+	png, err := qrcode.Encode(content, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(png), nil
+}
+
+// GenerateRecoveryCodes 生成 n 个 xxxxx-xxxxx 格式的恢复码
+func GenerateRecoveryCodes(n int) []string {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		s := strings.ToLower(b32.EncodeToString(b))[:10]
+		codes[i] = s[:5] + "-" + s[5:]
+	}
+	return codes
+}
+
+// HashRecoveryCode 恢复码只保存哈希，忽略大小写、空格和连字符
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return b32.DecodeString(strings.TrimRight(secret, "="))
+}
+
+func hotp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digits, value%1000000)
+}
@@ -0,0 +1,93 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-23 14:52:31
+ * @LastEditTime: 2023-06-23 14:52:31
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/totp/totp_test.go
+ */
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA1 测试密钥，取 8 位验证码的后 6 位
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	code, _ := Code(rfcSecret, now)
+	tests := []struct {
+		name string
+		code string
+		at   time.Time
+		want bool
+	}{
+		{name: "now", code: code, at: now, want: true},
+		{name: "previous step", code: code, at: now.Add(30 * time.Second), want: true},
+		{name: "next step", code: code, at: now.Add(-30 * time.Second), want: true},
+		{name: "too late", code: code, at: now.Add(90 * time.Second), want: false},
+		{name: "wrong code", code: "000000", at: now, want: false},
+		{name: "short code", code: "12345", at: now, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := Verify(rfcSecret, tt.code, tt.at)
+			if ok != tt.want {
+				t.Fatalf("Verify() = %v, want %v", ok, tt.want)
+			}
+			if ok && counter != now.Unix()/period {
+				t.Errorf("Verify() counter = %d, want %d", counter, now.Unix()/period)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes := GenerateRecoveryCodes(10)
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Fatalf("GenerateRecoveryCodes() code = %q", c)
+		}
+		if seen[c] {
+			t.Fatalf("GenerateRecoveryCodes() duplicate %q", c)
+		}
+		seen[c] = true
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))) {
+		t.Errorf("HashRecoveryCode() should ignore case, spaces and hyphens")
+	}
+}
+
+func TestKeyURI(t *testing.T) {
+	got := KeyURI("chatserver", "alice", "ABC")
+	if !strings.HasPrefix(got, "otpauth://totp/chatserver:alice?") || !strings.Contains(got, "secret=ABC") {
+		t.Errorf("KeyURI() = %s", got)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-27 14:20:31
+ * @LastEditTime: 2023-06-27 14:20:31
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/usage/usage.go
+ */
+package usage
+
+// 记录一次对话中辅助模型调用(检索改写、搜索规划、重排、网页摘要等)的令牌用量，由对话服务统一计费
+import (
+	"chatserver-api/pkg/openai"
+	"context"
+	"sync"
+)
+
+// MeterCtx 用量记录器在上下文中的键，使用字符串以便直接存入 gin.Context
+const MeterCtx = "usage_meter"
+
+const (
+	SourceRewrite = "rewrite"
+	SourceHyde    = "hyde"
+	SourcePlanner = "planner"
+	SourceRerank  = "rerank"
+	SourceSummary = "summary"
+)
+
+// Record 一次辅助模型调用的用量
+type Record struct {
+	Source string
+	Model  string
+	Tokens int
+}
+
+// Meter 并发安全的用量记录器
+type Meter struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+// FromContext 获取上下文中的用量记录器，未挂载时返回 nil
+func FromContext(ctx context.Context) *Meter {
+	if ctx == nil {
+		return nil
+	}
+	m, _ := ctx.Value(MeterCtx).(*Meter)
+	return m
+}
+
+// Add 将一次调用的用量记入上下文中的记录器，未挂载记录器时忽略
+func Add(ctx context.Context, source, model string, u openai.Usage) {
+	m := FromContext(ctx)
+	if m == nil || u.TotalTokens <= 0 {
+		return
+	}
+	m.mu.Lock()
+	m.records = append(m.records, Record{Source: source, Model: model, Tokens: u.TotalTokens})
+	m.mu.Unlock()
+}
+
+// Records 返回已记录的调用
+func (m *Meter) Records() []Record {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Record(nil), m.records...)
+}
+
+// Tokens 返回已记录调用的令牌总数
+func (m *Meter) Tokens() (total int) {
+	for _, r := range m.Records() {
+		total += r.Tokens
+	}
+	return
+}
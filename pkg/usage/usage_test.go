@@ -0,0 +1,90 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-27 14:20:31
+ * @LastEditTime: 2023-06-27 14:20:31
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/usage/usage_test.go
+ */
+package usage
+
+import (
+	"chatserver-api/pkg/openai"
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// meterCtx 模拟 gin.Context 以字符串键保存记录器
+type meterCtx struct {
+	context.Context
+	m *Meter
+}
+
+func (c meterCtx) Value(key interface{}) interface{} {
+	if key == MeterCtx {
+		return c.m
+	}
+	return c.Context.Value(key)
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name   string
+		calls  []Record
+		want   []Record
+		tokens int
+	}{
+		{
+			name:   "records every call",
+			calls:  []Record{{SourceRewrite, "gpt-3.5-turbo", 120}, {SourcePlanner, "gpt-3.5-turbo", 80}},
+			want:   []Record{{SourceRewrite, "gpt-3.5-turbo", 120}, {SourcePlanner, "gpt-3.5-turbo", 80}},
+			tokens: 200,
+		},
+		{
+			name:   "skips empty usage",
+			calls:  []Record{{SourceHyde, "gpt-3.5-turbo", 0}},
+			tokens: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Meter{}
+			ctx := meterCtx{Context: context.Background(), m: m}
+			for _, c := range tt.calls {
+				Add(ctx, c.Source, c.Model, openai.Usage{TotalTokens: c.Tokens})
+			}
+			if got := m.Records(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Records() = %v, want %v", got, tt.want)
+			}
+			if got := m.Tokens(); got != tt.tokens {
+				t.Errorf("Tokens() = %d, want %d", got, tt.tokens)
+			}
+		})
+	}
+}
+
+func TestAdd_withoutMeter(t *testing.T) {
+	Add(context.Background(), SourcePlanner, "gpt-3.5-turbo", openai.Usage{TotalTokens: 10})
+	var m *Meter
+	if m.Tokens() != 0 || m.Records() != nil {
+		t.Errorf("nil meter should be empty")
+	}
+}
+
+func TestAdd_concurrent(t *testing.T) {
+	m := &Meter{}
+	ctx := meterCtx{Context: context.Background(), m: m}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Add(ctx, SourcePlanner, "gpt-3.5-turbo", openai.Usage{TotalTokens: 2})
+		}()
+	}
+	wg.Wait()
+	if got := m.Tokens(); got != 100 {
+		t.Errorf("Tokens() = %d, want 100", got)
+	}
+}
@@ -1,7 +1,7 @@
 /*
  * @Author: cloudyi.li
  * @Date: 2023-05-24 09:52:31
- * @LastEditTime: 2023-05-27 21:12:48
+ * @LastEditTime: 2023-06-25 17:12:06
  * @LastEditors: cloudyi.li
  * @FilePath: /chatserver-api/pkg/verification/captcha.go
  */
@@ -11,63 +11,103 @@ import (
 	"bytes"
 	"chatserver-api/internal/consts"
 	"chatserver-api/pkg/cache"
+	"chatserver-api/pkg/config"
 	"chatserver-api/pkg/logger"
-	"chatserver-api/utils/security"
 	"context"
+	"crypto/rand"
 	"encoding/base64"
 	"image/color"
 	"image/png"
+	"strings"
 	"time"
 
 	afcap "github.com/afocus/captcha"
 	"github.com/go-redis/redis/v8"
 )
 
-func getCaptchaCodeKey(code string) string {
-	return consts.CaptchaPrefix + security.Md5(code)
+const (
+	defaultCaptchaLength = 5
+	defaultCaptchaTTL    = 300
+)
+
+var captchaCharsets = map[string]afcap.StrType{
+	"num":   afcap.NUM,
+	"lower": afcap.LOWER,
+	"upper": afcap.UPPER,
+	"all":   afcap.ALL,
+	"clear": afcap.CLEAR,
+}
+
+// imageProvider 内置图片验证码，答案以挑战 id 为键保存在 redis，只能校验一次
+type imageProvider struct {
+	length  int
+	charset afcap.StrType
+	ttl     time.Duration
+}
+
+func newImageProvider(cfg config.CaptchaConfig) *imageProvider {
+	ip := &imageProvider{
+		length:  cfg.Length,
+		charset: afcap.CLEAR,
+		ttl:     time.Duration(cfg.TTL) * time.Second,
+	}
+	if ip.length <= 0 {
+		ip.length = defaultCaptchaLength
+	}
+	if t, ok := captchaCharsets[strings.ToLower(cfg.Charset)]; ok {
+		ip.charset = t
+	}
+	if ip.ttl <= 0 {
+		ip.ttl = defaultCaptchaTTL * time.Second
+	}
+	return ip
 }
 
-func GenerateCaptcha(ctx context.Context) (imgbase string, err error) {
+func (ip *imageProvider) Name() string {
+	return "image"
+}
+
+func (ip *imageProvider) Challenge(ctx context.Context) (ch Challenge, err error) {
 	cap := afcap.New()
-	rc := cache.GetRedisClient()
-	timer := 1200 * time.Second
 	cap.SetFont("./fonts/comic.ttf")
 	// 设置验证码大小
-	cap.SetSize(128, 64)
+	cap.SetSize(32*ip.length, 64)
 	// 设置干扰强度
 	cap.SetDisturbance(afcap.MEDIUM)
 	// 设置前景色 可以多个 随机替换文字颜色 默认黑色
 	cap.SetFrontColor(color.RGBA{255, 255, 255, 255})
 	// 设置背景色 可以多个 随机替换背景色 默认白色
 	cap.SetBkgColor(color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}, color.RGBA{0, 153, 0, 255})
-	img, code := cap.Create(4, afcap.NUM)
+	img, code := cap.Create(ip.length, ip.charset)
 	buffer := new(bytes.Buffer)
-
-	err = png.Encode(buffer, img)
-	if err != nil {
+	if err = png.Encode(buffer, img); err != nil {
 		return
 	}
-	err = rc.SetNX(ctx, getCaptchaCodeKey(code), code, timer).Err()
-	if err != nil {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
 		return
 	}
-	imgbase = base64.StdEncoding.EncodeToString(buffer.Bytes())
+	ch.Provider = ip.Name()
+	ch.Id = base64.RawURLEncoding.EncodeToString(b)
+	if err = cache.GetRedisClient().Set(ctx, consts.CaptchaPrefix+ch.Id, code, ip.ttl).Err(); err != nil {
+		return
+	}
+	ch.Image = base64.StdEncoding.EncodeToString(buffer.Bytes())
 	return
 }
 
-func VerifyCaptcha(ctx context.Context, code string) bool {
-	rc := cache.GetRedisClient()
-	code_re, err := rc.Get(ctx, getCaptchaCodeKey(code)).Result()
-	if err != nil {
-		if err != redis.Nil {
-			logger.Errorf("Redis连接异常:%v", err.Error())
-		}
-		return false
+// Verify 无论对错都删除挑战，防止同一挑战被反复尝试
+func (ip *imageProvider) Verify(ctx context.Context, id, answer, remoteIP string) (bool, error) {
+	if id == "" || answer == "" {
+		return false, nil
 	}
-	rc.Del(ctx, getCaptchaCodeKey(code))
-	if code == code_re {
-		return true
-	} else {
-		return false
+	code, err := cache.GetRedisClient().GetDel(ctx, consts.CaptchaPrefix+id).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		logger.Errorf("Redis连接异常:%v", err.Error())
+		return false, err
 	}
+	return strings.EqualFold(code, answer), nil
 }
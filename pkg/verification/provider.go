@@ -0,0 +1,45 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 17:05:18
+ * @LastEditTime: 2023-06-25 17:05:18
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/verification/provider.go
+ */
+package verification
+
+// 人机验证：内置图片验证码，或 hCaptcha/Turnstile 这类由第三方服务端校验的验证方式
+import (
+	"chatserver-api/pkg/config"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Challenge 下发给前端的验证挑战，图片验证码返回 Id 和 Image，第三方验证返回 SiteKey
+type Challenge struct {
+	Provider string
+	Id       string
+	Image    string
+	SiteKey  string
+}
+
+type Provider interface {
+	Name() string
+	Challenge(ctx context.Context) (Challenge, error)
+	// Verify 校验前端提交的答案，图片验证码按 id 取出答案，第三方验证 id 为空
+	Verify(ctx context.Context, id, answer, remoteIP string) (bool, error)
+}
+
+// NewProvider 根据配置创建验证方式，未配置时使用图片验证码
+func NewProvider(cfg config.CaptchaConfig) Provider {
+	client := &http.Client{Timeout: 5 * time.Second}
+	switch strings.ToLower(cfg.Provider) {
+	case "hcaptcha":
+		return newRemoteProvider("hcaptcha", hcaptchaVerifyURL, cfg, client)
+	case "turnstile":
+		return newRemoteProvider("turnstile", turnstileVerifyURL, cfg, client)
+	default:
+		return newImageProvider(cfg)
+	}
+}
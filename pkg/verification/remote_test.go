@@ -0,0 +1,64 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 17:31:27
+ * @LastEditTime: 2023-06-25 17:31:27
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/pkg/verification/remote_test.go
+ */
+package verification
+
+import (
+	"chatserver-api/pkg/config"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRemoteProviderVerify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch {
+		case r.PostForm.Get("response") == "error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.PostForm.Get("secret") == "secret" && r.PostForm.Get("response") == "pass" &&
+			r.PostForm.Get("remoteip") == "10.0.0.1":
+			fmt.Fprint(w, `{"success": true}`)
+		default:
+			fmt.Fprint(w, `{"success": false, "error-codes": ["invalid-input-response"]}`)
+		}
+	}))
+	defer srv.Close()
+	cfg := config.CaptchaConfig{Provider: "turnstile", SiteKey: "site", Secret: "secret", VerifyURL: srv.URL}
+	p := NewProvider(cfg)
+	ch, err := p.Challenge(context.Background())
+	if err != nil || ch.Provider != "turnstile" || ch.SiteKey != "site" {
+		t.Fatalf("Challenge() = %+v, %v", ch, err)
+	}
+	tests := []struct {
+		name    string
+		answer  string
+		want    bool
+		wantErr bool
+	}{
+		{name: "pass", answer: "pass", want: true},
+		{name: "fail", answer: "wrong", want: false},
+		{name: "empty", answer: "", want: false},
+		{name: "server error", answer: "error", want: false, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Verify(context.Background(), "", tt.answer, "10.0.0.1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
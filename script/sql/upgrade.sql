@@ -0,0 +1,464 @@
+-- 旧版本数据库升级脚本
+-- 新部署直接执行 init.sql 即可；已有数据库按顺序执行本文件，所有语句均可重复执行
+
+-- 登录会话
+
+CREATE TABLE IF NOT EXISTS public.user_session (
+	id int8 NOT NULL, -- 会话ID，写入访问 token 的 sid
+	user_id int8 NOT NULL, -- 用户ID
+	refresh_hash varchar(64) NOT NULL, -- 当前刷新 token 的哈希，每次刷新都会更换
+	device varchar(255) NOT NULL DEFAULT '', -- 登录设备
+	ip varchar(255) NOT NULL DEFAULT '', -- 登录IP
+	user_agent text NOT NULL DEFAULT '', -- 客户端 User-Agent
+	is_revoked bool NOT NULL DEFAULT false, -- 是否已注销
+	expired_at timestamptz NOT NULL, -- 刷新 token 过期时间
+	last_used_at timestamptz NOT NULL DEFAULT now(), -- 最近一次刷新时间
+	created_at timestamptz NOT NULL DEFAULT now(), -- 记录的创建时间，默认为当前时间
+	updated_at timestamptz NOT NULL DEFAULT now(), -- 记录的更新时间，默认为当前时间
+	CONSTRAINT user_session_pkey PRIMARY KEY (id),
+	CONSTRAINT user_session_user_id_fkey FOREIGN KEY (user_id) REFERENCES public."user"(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_session_refresh_hash ON public.user_session USING btree (refresh_hash);
+CREATE INDEX IF NOT EXISTS user_session_user_id_idx ON public.user_session USING btree (user_id);
+COMMENT ON TABLE public.user_session IS '用户登录会话';
+
+-- Column comments
+
+COMMENT ON COLUMN public.user_session.id IS '会话ID，写入访问 token 的 sid';
+COMMENT ON COLUMN public.user_session.user_id IS '用户ID';
+COMMENT ON COLUMN public.user_session.refresh_hash IS '当前刷新 token 的哈希，每次刷新都会更换';
+COMMENT ON COLUMN public.user_session.device IS '登录设备';
+COMMENT ON COLUMN public.user_session.ip IS '登录IP';
+COMMENT ON COLUMN public.user_session.user_agent IS '客户端 User-Agent';
+COMMENT ON COLUMN public.user_session.is_revoked IS '是否已注销';
+COMMENT ON COLUMN public.user_session.expired_at IS '刷新 token 过期时间';
+COMMENT ON COLUMN public.user_session.last_used_at IS '最近一次刷新时间';
+COMMENT ON COLUMN public.user_session.created_at IS '记录的创建时间，默认为当前时间';
+COMMENT ON COLUMN public.user_session.updated_at IS '记录的更新时间，默认为当前时间';
+
+-- 两步验证
+
+CREATE TABLE IF NOT EXISTS public.user_totp (
+	user_id int8 NOT NULL, -- 用户ID
+	secret varchar(255) NOT NULL, -- 加密保存的 TOTP 密钥
+	last_counter int8 NOT NULL DEFAULT 0, -- 最近一次使用的时间步，防止验证码重复使用
+	created_at timestamptz NOT NULL DEFAULT now(), -- 记录的创建时间，默认为当前时间
+	updated_at timestamptz NOT NULL DEFAULT now(), -- 记录的更新时间，默认为当前时间
+	CONSTRAINT user_totp_pkey PRIMARY KEY (user_id),
+	CONSTRAINT user_totp_user_id_fkey FOREIGN KEY (user_id) REFERENCES public."user"(id) ON DELETE CASCADE
+);
+COMMENT ON TABLE public.user_totp IS '用户两步验证密钥';
+
+-- Column comments
+
+COMMENT ON COLUMN public.user_totp.user_id IS '用户ID';
+COMMENT ON COLUMN public.user_totp.secret IS '加密保存的 TOTP 密钥';
+COMMENT ON COLUMN public.user_totp.last_counter IS '最近一次使用的时间步，防止验证码重复使用';
+COMMENT ON COLUMN public.user_totp.created_at IS '记录的创建时间，默认为当前时间';
+COMMENT ON COLUMN public.user_totp.updated_at IS '记录的更新时间，默认为当前时间';
+
+
+CREATE TABLE IF NOT EXISTS public.user_recovery_code (
+	id int8 NOT NULL, -- 恢复码ID
+	user_id int8 NOT NULL, -- 用户ID
+	code_hash varchar(64) NOT NULL, -- 恢复码哈希
+	is_used bool NOT NULL DEFAULT false, -- 是否已使用
+	created_at timestamptz NOT NULL DEFAULT now(), -- 记录的创建时间，默认为当前时间
+	updated_at timestamptz NOT NULL DEFAULT now(), -- 记录的更新时间，默认为当前时间
+	CONSTRAINT user_recovery_code_pkey PRIMARY KEY (id),
+	CONSTRAINT user_recovery_code_user_id_fkey FOREIGN KEY (user_id) REFERENCES public."user"(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS user_recovery_code_user_id_idx ON public.user_recovery_code USING btree (user_id);
+COMMENT ON TABLE public.user_recovery_code IS '两步验证恢复码';
+
+-- Column comments
+
+COMMENT ON COLUMN public.user_recovery_code.id IS '恢复码ID';
+COMMENT ON COLUMN public.user_recovery_code.user_id IS '用户ID';
+COMMENT ON COLUMN public.user_recovery_code.code_hash IS '恢复码哈希';
+COMMENT ON COLUMN public.user_recovery_code.is_used IS '是否已使用';
+COMMENT ON COLUMN public.user_recovery_code.created_at IS '记录的创建时间，默认为当前时间';
+COMMENT ON COLUMN public.user_recovery_code.updated_at IS '记录的更新时间，默认为当前时间';
+
+-- API Key
+
+CREATE TABLE IF NOT EXISTS public.api_key (
+	id int8 NOT NULL, -- API Key ID
+	user_id int8 NOT NULL, -- 用户ID
+	"name" varchar(255) NOT NULL DEFAULT '', -- 名称
+	prefix varchar(32) NOT NULL, -- 明文前缀，用于展示和识别
+	key_hash varchar(64) NOT NULL, -- API Key 哈希
+	scopes varchar(255) NOT NULL DEFAULT '', -- 授权范围，逗号分隔
+	ip_allowlist text NOT NULL DEFAULT '', -- 允许访问的IP或网段，逗号分隔，为空不限制
+	expired_at timestamptz NULL, -- 过期时间，为空表示永不过期
+	last_used_at timestamptz NULL, -- 最近一次使用时间
+	is_revoked bool NOT NULL DEFAULT false, -- 是否已吊销
+	created_at timestamptz NOT NULL DEFAULT now(), -- 记录的创建时间，默认为当前时间
+	updated_at timestamptz NOT NULL DEFAULT now(), -- 记录的更新时间，默认为当前时间
+	CONSTRAINT api_key_pkey PRIMARY KEY (id),
+	CONSTRAINT api_key_user_id_fkey FOREIGN KEY (user_id) REFERENCES public."user"(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_key_key_hash ON public.api_key USING btree (key_hash);
+CREATE INDEX IF NOT EXISTS api_key_user_id_idx ON public.api_key USING btree (user_id);
+COMMENT ON TABLE public.api_key IS '用户 API Key';
+
+-- Column comments
+
+COMMENT ON COLUMN public.api_key.id IS 'API Key ID';
+COMMENT ON COLUMN public.api_key.user_id IS '用户ID';
+COMMENT ON COLUMN public.api_key."name" IS '名称';
+COMMENT ON COLUMN public.api_key.prefix IS '明文前缀，用于展示和识别';
+COMMENT ON COLUMN public.api_key.key_hash IS 'API Key 哈希';
+COMMENT ON COLUMN public.api_key.scopes IS '授权范围，逗号分隔';
+COMMENT ON COLUMN public.api_key.ip_allowlist IS '允许访问的IP或网段，逗号分隔，为空不限制';
+COMMENT ON COLUMN public.api_key.expired_at IS '过期时间，为空表示永不过期';
+COMMENT ON COLUMN public.api_key.last_used_at IS '最近一次使用时间';
+COMMENT ON COLUMN public.api_key.is_revoked IS '是否已吊销';
+COMMENT ON COLUMN public.api_key.created_at IS '记录的创建时间，默认为当前时间';
+COMMENT ON COLUMN public.api_key.updated_at IS '记录的更新时间，默认为当前时间';
+
+ALTER TABLE public.bill ADD COLUMN IF NOT EXISTS api_key_id int8 NOT NULL DEFAULT 0;
+COMMENT ON COLUMN public.bill.api_key_id IS '通过 API Key 调用产生的消费对应的 Key ID，0 表示网页端';
+
+-- 登录历史
+
+ALTER TABLE public.userlog ADD COLUMN IF NOT EXISTS user_agent text NOT NULL DEFAULT '';
+ALTER TABLE public.userlog ADD COLUMN IF NOT EXISTS device varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE public.userlog ADD COLUMN IF NOT EXISTS result varchar(32) NOT NULL DEFAULT '';
+COMMENT ON COLUMN public.userlog.user_agent IS '客户端 User-Agent';
+COMMENT ON COLUMN public.userlog.device IS '由 User-Agent 识别的浏览器和操作系统';
+COMMENT ON COLUMN public.userlog.result IS '登录结果：success 成功，failure 失败，locked 锁定中';
+
+-- 用户封禁与余额调整
+
+ALTER TABLE public."user" ADD COLUMN IF NOT EXISTS is_banned bool NOT NULL DEFAULT false;
+ALTER TABLE public."user" ADD COLUMN IF NOT EXISTS ban_reason varchar(255) NOT NULL DEFAULT '';
+COMMENT ON COLUMN public."user".is_banned IS '被管理员封禁，无法登录和调用接口';
+COMMENT ON COLUMN public."user".ban_reason IS '封禁原因';
+
+ALTER TABLE public.bill ADD COLUMN IF NOT EXISTS operator_id int8 NOT NULL DEFAULT 0;
+COMMENT ON COLUMN public.bill.operator_id IS '管理员手动调整余额时的操作人ID，其余为0';
+
+-- 回答引用来源
+
+ALTER TABLE public.record ADD COLUMN IF NOT EXISTS citations jsonb NULL;
+COMMENT ON COLUMN public.record.citations IS '回答引用的知识库片段或网页来源';
+
+ALTER TABLE embed.documents ADD COLUMN IF NOT EXISTS page int4 NOT NULL DEFAULT 0;
+COMMENT ON COLUMN embed.documents.page IS '片段所在页码，非PDF来源为0';
+
+-- 多轮对话检索改写
+
+ALTER TABLE public.preset ADD COLUMN IF NOT EXISTS query_strategy varchar(32) NOT NULL DEFAULT 'keyword';
+COMMENT ON COLUMN public.preset.query_strategy IS '检索语句生成策略：keyword 关键词，rewrite 改写，hyde 假设性回答';
+
+-- 团队
+
+CREATE TABLE IF NOT EXISTS public.team (
+	id int8 NOT NULL, -- 团队ID
+	team_name varchar(255) NOT NULL, -- 团队名称
+	owner_id int8 NOT NULL, -- 团队所有者用户ID
+	created_at timestamptz NOT NULL DEFAULT now(), -- 记录的创建时间，默认为当前时间
+	updated_at timestamptz NOT NULL DEFAULT now(), -- 记录的更新时间，默认为当前时间
+	deleted_at timestamptz NULL, -- 删除时间
+	is_del int4 NULL DEFAULT 0, -- 删除标志
+	CONSTRAINT team_pkey PRIMARY KEY (id),
+	CONSTRAINT team_owner_id_fkey FOREIGN KEY (owner_id) REFERENCES public."user"(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS team_owner_id_idx ON public.team USING btree (owner_id);
+COMMENT ON TABLE public.team IS '团队';
+
+-- Column comments
+
+COMMENT ON COLUMN public.team.id IS '团队ID';
+COMMENT ON COLUMN public.team.team_name IS '团队名称';
+COMMENT ON COLUMN public.team.owner_id IS '团队所有者用户ID';
+COMMENT ON COLUMN public.team.created_at IS '记录的创建时间，默认为当前时间';
+COMMENT ON COLUMN public.team.updated_at IS '记录的更新时间，默认为当前时间';
+COMMENT ON COLUMN public.team.deleted_at IS '删除时间';
+COMMENT ON COLUMN public.team.is_del IS '删除标志';
+
+
+CREATE TABLE IF NOT EXISTS public.team_member (
+	id int8 NOT NULL, -- 成员记录ID
+	team_id int8 NOT NULL, -- 团队ID
+	user_id int8 NOT NULL, -- 成员用户ID
+	created_at timestamptz NOT NULL DEFAULT now(), -- 加入时间
+	CONSTRAINT team_member_pkey PRIMARY KEY (id),
+	CONSTRAINT team_member_team_id_fkey FOREIGN KEY (team_id) REFERENCES public.team(id) ON DELETE CASCADE,
+	CONSTRAINT team_member_user_id_fkey FOREIGN KEY (user_id) REFERENCES public."user"(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_team_member ON public.team_member USING btree (team_id, user_id);
+CREATE INDEX IF NOT EXISTS team_member_user_id_idx ON public.team_member USING btree (user_id);
+COMMENT ON TABLE public.team_member IS '团队成员';
+
+-- Column comments
+
+COMMENT ON COLUMN public.team_member.id IS '成员记录ID';
+COMMENT ON COLUMN public.team_member.team_id IS '团队ID';
+COMMENT ON COLUMN public.team_member.user_id IS '成员用户ID';
+COMMENT ON COLUMN public.team_member.created_at IS '加入时间';
+
+-- 知识库
+
+CREATE TABLE IF NOT EXISTS embed.knowledge_base (
+	id int8 NOT NULL, -- 知识库ID，0 保留给全局知识库
+	kb_name varchar(255) NOT NULL, -- 知识库名称
+	description text NOT NULL DEFAULT '', -- 知识库描述
+	owner_type varchar(16) NOT NULL, -- 归属类型：user 个人，team 团队
+	owner_id int8 NOT NULL, -- 所有者用户ID或团队ID
+	visibility int4 NOT NULL DEFAULT 1, -- 可见性：1 私有，2 共享，3 公开
+	created_at timestamptz NOT NULL DEFAULT now(), -- 记录的创建时间，默认为当前时间
+	updated_at timestamptz NOT NULL DEFAULT now(), -- 记录的更新时间，默认为当前时间
+	deleted_at timestamptz NULL, -- 删除时间
+	is_del int4 NULL DEFAULT 0, -- 删除标志
+	CONSTRAINT knowledge_base_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS knowledge_base_owner_idx ON embed.knowledge_base USING btree (owner_type, owner_id);
+COMMENT ON TABLE embed.knowledge_base IS '知识库';
+
+-- Column comments
+
+COMMENT ON COLUMN embed.knowledge_base.id IS '知识库ID，0 保留给全局知识库';
+COMMENT ON COLUMN embed.knowledge_base.kb_name IS '知识库名称';
+COMMENT ON COLUMN embed.knowledge_base.description IS '知识库描述';
+COMMENT ON COLUMN embed.knowledge_base.owner_type IS '归属类型：user 个人，team 团队';
+COMMENT ON COLUMN embed.knowledge_base.owner_id IS '所有者用户ID或团队ID';
+COMMENT ON COLUMN embed.knowledge_base.visibility IS '可见性：1 私有，2 共享，3 公开';
+COMMENT ON COLUMN embed.knowledge_base.created_at IS '记录的创建时间，默认为当前时间';
+COMMENT ON COLUMN embed.knowledge_base.updated_at IS '记录的更新时间，默认为当前时间';
+COMMENT ON COLUMN embed.knowledge_base.deleted_at IS '删除时间';
+COMMENT ON COLUMN embed.knowledge_base.is_del IS '删除标志';
+
+
+CREATE TABLE IF NOT EXISTS embed.kb_member (
+	id int8 NOT NULL, -- 共享记录ID
+	kb_id int8 NOT NULL, -- 知识库ID
+	user_id int8 NOT NULL, -- 被共享或订阅的用户ID
+	permission int4 NOT NULL DEFAULT 1, -- 权限：1 只读，2 读写
+	created_at timestamptz NOT NULL DEFAULT now(), -- 记录的创建时间，默认为当前时间
+	updated_at timestamptz NOT NULL DEFAULT now(), -- 记录的更新时间，默认为当前时间
+	CONSTRAINT kb_member_pkey PRIMARY KEY (id),
+	CONSTRAINT kb_member_kb_id_fkey FOREIGN KEY (kb_id) REFERENCES embed.knowledge_base(id) ON DELETE CASCADE,
+	CONSTRAINT kb_member_user_id_fkey FOREIGN KEY (user_id) REFERENCES public."user"(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_kb_member ON embed.kb_member USING btree (kb_id, user_id);
+CREATE INDEX IF NOT EXISTS kb_member_user_id_idx ON embed.kb_member USING btree (user_id);
+COMMENT ON TABLE embed.kb_member IS '知识库共享成员';
+
+-- Column comments
+
+COMMENT ON COLUMN embed.kb_member.id IS '共享记录ID';
+COMMENT ON COLUMN embed.kb_member.kb_id IS '知识库ID';
+COMMENT ON COLUMN embed.kb_member.user_id IS '被共享或订阅的用户ID';
+COMMENT ON COLUMN embed.kb_member.permission IS '权限：1 只读，2 读写';
+COMMENT ON COLUMN embed.kb_member.created_at IS '记录的创建时间，默认为当前时间';
+COMMENT ON COLUMN embed.kb_member.updated_at IS '记录的更新时间，默认为当前时间';
+
+-- 历史文档归入全局知识库(kb_id = 0)，否则按知识库过滤检索时会被遗漏
+ALTER TABLE embed.documents ADD COLUMN IF NOT EXISTS kb_id int8 NULL;
+UPDATE embed.documents SET kb_id = 0 WHERE kb_id IS NULL;
+ALTER TABLE embed.documents ALTER COLUMN kb_id SET DEFAULT 0;
+ALTER TABLE embed.documents ALTER COLUMN kb_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS documents_kb_id_idx ON embed.documents USING btree (kb_id);
+COMMENT ON COLUMN embed.documents.kb_id IS '所属知识库ID，0 为全局知识库';
+
+-- 文档去重与向量缓存
+
+ALTER TABLE embed.documents ADD COLUMN IF NOT EXISTS content_hash varchar(64) NOT NULL DEFAULT '';
+-- 回填历史文档的内容哈希，算法与 embedhash.Hash 一致：sha256(模型 + 换行 + 合并空白后的正文)
+UPDATE embed.documents
+SET content_hash = encode(sha256(convert_to('text-embedding-ada-002' || E'\n' || btrim(regexp_replace(body, '[[:space:]]+', ' ', 'g')), 'UTF8')), 'hex')
+WHERE content_hash = '';
+CREATE INDEX IF NOT EXISTS documents_content_hash_idx ON embed.documents USING btree (kb_id, content_hash);
+COMMENT ON COLUMN embed.documents.content_hash IS '模型+规范化正文的sha256，用于去重';
+
+CREATE TABLE IF NOT EXISTS embed.embedding_cache (
+	content_hash varchar(64) NOT NULL, -- 模型+规范化文本的sha256
+	model varchar(64) NOT NULL, -- 生成向量的模型
+	embedding vector NOT NULL, -- 向量
+	created_at timestamptz NOT NULL DEFAULT now(), -- 记录的创建时间，默认为当前时间
+	CONSTRAINT embedding_cache_pkey PRIMARY KEY (content_hash)
+);
+COMMENT ON TABLE embed.embedding_cache IS 'Embedding向量缓存，Redis未命中时回查';
+
+-- Column comments
+
+COMMENT ON COLUMN embed.embedding_cache.content_hash IS '模型+规范化文本的sha256';
+COMMENT ON COLUMN embed.embedding_cache.model IS '生成向量的模型';
+COMMENT ON COLUMN embed.embedding_cache.embedding IS '向量';
+COMMENT ON COLUMN embed.embedding_cache.created_at IS '记录的创建时间，默认为当前时间';
+
+-- 历史文档的向量直接作为缓存，相同内容再次写入时无需请求接口
+INSERT INTO embed.embedding_cache (content_hash, model, embedding)
+SELECT DISTINCT ON (content_hash) content_hash, 'text-embedding-ada-002', embedding
+FROM embed.documents
+WHERE content_hash <> '' AND embedding IS NOT NULL
+ON CONFLICT (content_hash) DO NOTHING;
+
+-- 预设搜索源
+
+ALTER TABLE public.preset ADD COLUMN IF NOT EXISTS search_providers varchar(255) NOT NULL DEFAULT '';
+COMMENT ON COLUMN public.preset.search_providers IS '联网搜索使用的搜索源，逗号分隔，为空时使用配置文件中的默认搜索源';
+
+-- 单点登录身份
+
+CREATE TABLE IF NOT EXISTS public.user_identity (
+	id int8 NOT NULL, -- 身份记录ID
+	user_id int8 NOT NULL, -- 用户ID
+	issuer varchar(255) NOT NULL, -- 身份提供方(OIDC issuer)
+	subject varchar(255) NOT NULL, -- 用户在身份提供方的唯一标识(sub)
+	email varchar(255) NOT NULL DEFAULT '', -- 身份提供方返回的邮箱
+	created_at timestamptz NOT NULL DEFAULT now(), -- 记录的创建时间，默认为当前时间
+	updated_at timestamptz NOT NULL DEFAULT now(), -- 记录的更新时间，默认为当前时间
+	CONSTRAINT user_identity_pkey PRIMARY KEY (id),
+	CONSTRAINT user_identity_user_id_fkey FOREIGN KEY (user_id) REFERENCES public."user"(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identity_subject ON public.user_identity USING btree (issuer, subject);
+CREATE INDEX IF NOT EXISTS user_identity_user_id_idx ON public.user_identity USING btree (user_id);
+COMMENT ON TABLE public.user_identity IS '用户的外部身份(OIDC单点登录)';
+
+-- Column comments
+
+COMMENT ON COLUMN public.user_identity.id IS '身份记录ID';
+COMMENT ON COLUMN public.user_identity.user_id IS '用户ID';
+COMMENT ON COLUMN public.user_identity.issuer IS '身份提供方(OIDC issuer)';
+COMMENT ON COLUMN public.user_identity.subject IS '用户在身份提供方的唯一标识(sub)';
+COMMENT ON COLUMN public.user_identity.email IS '身份提供方返回的邮箱';
+COMMENT ON COLUMN public.user_identity.created_at IS '记录的创建时间，默认为当前时间';
+COMMENT ON COLUMN public.user_identity.updated_at IS '记录的更新时间，默认为当前时间';
+
+-- 账户注销
+
+ALTER TABLE public."user" ADD COLUMN IF NOT EXISTS delete_at timestamptz NULL;
+COMMENT ON COLUMN public."user".delete_at IS '计划注销时间，冷静期结束后删除账户';
+
+-- 卡密批次与兑换记录
+
+ALTER TABLE public.cdkey ADD COLUMN IF NOT EXISTS batch_id int8 NOT NULL DEFAULT 0;
+ALTER TABLE public.cdkey ADD COLUMN IF NOT EXISTS status int4 NOT NULL DEFAULT 0;
+ALTER TABLE public.cdkey ADD COLUMN IF NOT EXISTS expired_at timestamptz NULL;
+ALTER TABLE public.cdkey ADD COLUMN IF NOT EXISTS redeemed_by int8 NOT NULL DEFAULT 0;
+ALTER TABLE public.cdkey ADD COLUMN IF NOT EXISTS redeemed_at timestamptz NULL;
+COMMENT ON COLUMN public.cdkey.batch_id IS '生成批次ID，同一次生成的卡密属于同一批次';
+COMMENT ON COLUMN public.cdkey.status IS '卡密状态：0 未使用，1 已兑换，2 已作废';
+COMMENT ON COLUMN public.cdkey.expired_at IS '过期时间，为空表示永不过期';
+COMMENT ON COLUMN public.cdkey.redeemed_by IS '兑换用户ID';
+COMMENT ON COLUMN public.cdkey.redeemed_at IS '兑换时间';
+CREATE INDEX IF NOT EXISTS cdkey_batch_id_idx ON public.cdkey USING btree (batch_id);
+
+-- 旧版本兑换卡密时直接软删除：软删除的卡密标记为已兑换并恢复可见，兑换时间取删除时间；其余卡密保持默认的未使用
+UPDATE public.cdkey SET status = 1, redeemed_at = deleted_at, is_del = 0, deleted_at = NULL WHERE is_del = 1;
+
+CREATE TABLE IF NOT EXISTS public.cdkey_redemption (
+	id int8 NOT NULL, -- 兑换记录ID
+	cdkey_id int8 NOT NULL, -- 卡密ID
+	code_key varchar(255) NOT NULL, -- 卡密
+	giftcard_id int8 NOT NULL, -- 充值卡ID
+	user_id int8 NOT NULL, -- 兑换用户ID，用户注销后保留
+	amount numeric(10, 2) NOT NULL, -- 兑换金额
+	created_at timestamptz NOT NULL DEFAULT now(), -- 兑换时间
+	CONSTRAINT cdkey_redemption_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS cdkey_redemption_cdkey_id_idx ON public.cdkey_redemption USING btree (cdkey_id);
+CREATE INDEX IF NOT EXISTS cdkey_redemption_user_id_idx ON public.cdkey_redemption USING btree (user_id);
+COMMENT ON TABLE public.cdkey_redemption IS '卡密兑换记录';
+
+-- Column comments
+
+COMMENT ON COLUMN public.cdkey_redemption.id IS '兑换记录ID';
+COMMENT ON COLUMN public.cdkey_redemption.cdkey_id IS '卡密ID';
+COMMENT ON COLUMN public.cdkey_redemption.code_key IS '卡密';
+COMMENT ON COLUMN public.cdkey_redemption.giftcard_id IS '充值卡ID';
+COMMENT ON COLUMN public.cdkey_redemption.user_id IS '兑换用户ID，用户注销后保留';
+COMMENT ON COLUMN public.cdkey_redemption.amount IS '兑换金额';
+COMMENT ON COLUMN public.cdkey_redemption.created_at IS '兑换时间';
+
+-- 在线支付订单
+
+CREATE TABLE IF NOT EXISTS public.payment_order (
+	id int8 NOT NULL, -- 订单ID，即商户订单号
+	user_id int8 NOT NULL, -- 下单用户ID，用户注销后保留
+	item_type varchar(32) NOT NULL, -- 商品类型，目前仅有 giftcard
+	item_id int8 NOT NULL, -- 商品ID
+	subject varchar(255) NOT NULL DEFAULT '', -- 订单标题
+	amount numeric(10, 2) NOT NULL, -- 支付金额
+	credit numeric(10, 2) NOT NULL, -- 支付成功后到账余额
+	provider varchar(32) NOT NULL, -- 支付方式
+	trade_no varchar(255) NOT NULL DEFAULT '', -- 支付平台交易号
+	pay_url text NOT NULL DEFAULT '', -- 支付链接
+	status int2 NOT NULL DEFAULT 0, -- 订单状态 0 待支付 1 已支付 2 已退款 3 退款中
+	paid_at timestamptz NULL, -- 支付时间
+	refunded_at timestamptz NULL, -- 退款时间
+	created_at timestamptz NOT NULL DEFAULT now(), -- 记录的创建时间，默认为当前时间
+	updated_at timestamptz NOT NULL DEFAULT now(), -- 记录的更新时间，默认为当前时间
+	CONSTRAINT payment_order_pkey PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS payment_order_user_id_idx ON public.payment_order USING btree (user_id);
+CREATE INDEX IF NOT EXISTS payment_order_status_idx ON public.payment_order USING btree (status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_order_trade_no ON public.payment_order USING btree (provider, trade_no) WHERE trade_no <> '';
+COMMENT ON TABLE public.payment_order IS '在线支付订单';
+
+-- Column comments
+
+COMMENT ON COLUMN public.payment_order.id IS '订单ID，即商户订单号';
+COMMENT ON COLUMN public.payment_order.user_id IS '下单用户ID，用户注销后保留';
+COMMENT ON COLUMN public.payment_order.item_type IS '商品类型，目前仅有 giftcard';
+COMMENT ON COLUMN public.payment_order.item_id IS '商品ID';
+COMMENT ON COLUMN public.payment_order.subject IS '订单标题';
+COMMENT ON COLUMN public.payment_order.amount IS '支付金额';
+COMMENT ON COLUMN public.payment_order.credit IS '支付成功后到账余额';
+COMMENT ON COLUMN public.payment_order.provider IS '支付方式';
+COMMENT ON COLUMN public.payment_order.trade_no IS '支付平台交易号';
+COMMENT ON COLUMN public.payment_order.pay_url IS '支付链接';
+COMMENT ON COLUMN public.payment_order.status IS '订单状态 0 待支付 1 已支付 2 已退款 3 退款中';
+COMMENT ON COLUMN public.payment_order.paid_at IS '支付时间';
+COMMENT ON COLUMN public.payment_order.refunded_at IS '退款时间';
+COMMENT ON COLUMN public.payment_order.created_at IS '记录的创建时间，默认为当前时间';
+COMMENT ON COLUMN public.payment_order.updated_at IS '记录的更新时间，默认为当前时间';
+
+-- 运营报表汇总表
+
+CREATE TABLE IF NOT EXISTS public.report_usage_daily (
+	"day" date NOT NULL, -- 统计日期
+	user_id int8 NOT NULL, -- 用户ID，用户注销后保留
+	preset_id int8 NOT NULL DEFAULT 0, -- 预设ID，API 调用为 0
+	model varchar(64) NOT NULL DEFAULT '', -- 模型
+	"source" varchar(32) NOT NULL, -- 消费来源 chat, api，对话中的辅助调用为 rewrite, hyde, planner, rerank, summary
+	requests int8 NOT NULL DEFAULT 0, -- 请求次数
+	tokens int8 NOT NULL DEFAULT 0, -- 令牌数
+	charge numeric(14, 5) NOT NULL DEFAULT 0, -- 向用户收取的费用
+	"cost" numeric(14, 5) NOT NULL DEFAULT 0, -- 按上游价格估算的成本
+	CONSTRAINT report_usage_daily_pkey PRIMARY KEY ("day", user_id, preset_id, model, "source")
+);
+CREATE INDEX IF NOT EXISTS report_usage_daily_user_id_idx ON public.report_usage_daily USING btree (user_id);
+COMMENT ON TABLE public.report_usage_daily IS '按天汇总的消费报表';
+
+-- Column comments
+
+COMMENT ON COLUMN public.report_usage_daily."day" IS '统计日期';
+COMMENT ON COLUMN public.report_usage_daily.user_id IS '用户ID，用户注销后保留';
+COMMENT ON COLUMN public.report_usage_daily.preset_id IS '预设ID，API 调用为 0';
+COMMENT ON COLUMN public.report_usage_daily.model IS '模型';
+COMMENT ON COLUMN public.report_usage_daily."source" IS '消费来源 chat, api，对话中的辅助调用为 rewrite, hyde, planner, rerank, summary';
+COMMENT ON COLUMN public.report_usage_daily.requests IS '请求次数';
+COMMENT ON COLUMN public.report_usage_daily.tokens IS '令牌数';
+COMMENT ON COLUMN public.report_usage_daily.charge IS '向用户收取的费用';
+COMMENT ON COLUMN public.report_usage_daily."cost" IS '按上游价格估算的成本';
+
+
+CREATE TABLE IF NOT EXISTS public.report_revenue_daily (
+	"day" date NOT NULL, -- 统计日期
+	"source" varchar(32) NOT NULL, -- 收入来源 cdkey, order, refund
+	count int8 NOT NULL DEFAULT 0, -- 笔数
+	amount numeric(14, 2) NOT NULL DEFAULT 0, -- 金额
+	CONSTRAINT report_revenue_daily_pkey PRIMARY KEY ("day", "source")
+);
+COMMENT ON TABLE public.report_revenue_daily IS '按天汇总的收入报表';
+
+-- Column comments
+
+COMMENT ON COLUMN public.report_revenue_daily."day" IS '统计日期';
+COMMENT ON COLUMN public.report_revenue_daily."source" IS '收入来源 cdkey, order, refund';
+COMMENT ON COLUMN public.report_revenue_daily.count IS '笔数';
+COMMENT ON COLUMN public.report_revenue_daily.amount IS '金额';
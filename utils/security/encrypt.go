@@ -11,6 +11,7 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"encoding/base64"
 	"errors"
 
@@ -77,6 +78,9 @@ func AesDecrypt(data []byte, key []byte) ([]byte, error) {
 	}
 	//获取块的大小
 	blockSize := block.BlockSize()
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, errors.New("加密字符串错误！")
+	}
 	//使用cbc
 	blockMode := cipher.NewCBCDecrypter(block, key[:blockSize])
 	//初始化解密数据接收切片
@@ -91,6 +95,40 @@ func AesDecrypt(data []byte, key []byte) ([]byte, error) {
 	return crypted, nil
 }
 
+// AesGcmEncrypt 使用 AES-GCM 加密，随机 nonce 放在密文之前
+func AesGcmEncrypt(data []byte, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// AesGcmDecrypt 解密 AesGcmEncrypt 的结果，密文被篡改时返回错误
+func AesGcmDecrypt(data []byte, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("加密字符串错误！")
+	}
+	nonce, crypted := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, crypted, nil)
+}
+
 // pkcs7Padding 填充
 func pkcs7Padding(data []byte, blockSize int) []byte {
 	//判断缺少几位长度。最少1，最多 blockSize
@@ -108,5 +146,8 @@ func pkcs7UnPadding(data []byte) ([]byte, error) {
 	}
 	//获取填充的个数
 	unPadding := int(data[length-1])
+	if unPadding == 0 || unPadding > length {
+		return nil, errors.New("加密字符串错误！")
+	}
 	return data[:(length - unPadding)], nil
 }
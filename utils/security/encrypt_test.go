@@ -8,6 +8,7 @@
 package security
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -75,3 +76,26 @@ func TestPasswordDecryption(t *testing.T) {
 		})
 	}
 }
+
+func TestAesGcm(t *testing.T) {
+	key := []byte("ABCDABCDABCDABCDABCDABCDABCDABCD")
+	plain := []byte("JBSWY3DPEHPK3PXP")
+	a, err := AesGcmEncrypt(plain, key)
+	if err != nil {
+		t.Fatalf("AesGcmEncrypt() error = %v", err)
+	}
+	b, _ := AesGcmEncrypt(plain, key)
+	if bytes.Equal(a, b) {
+		t.Errorf("AesGcmEncrypt() should use a random nonce")
+	}
+	if got, err := AesGcmDecrypt(a, key); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("AesGcmDecrypt() = %q, %v, want %q", got, err, plain)
+	}
+	a[len(a)-1] ^= 1
+	if _, err := AesGcmDecrypt(a, key); err == nil {
+		t.Errorf("AesGcmDecrypt() tampered ciphertext should fail")
+	}
+	if _, err := AesGcmDecrypt(a[:4], key); err == nil {
+		t.Errorf("AesGcmDecrypt() short ciphertext should fail")
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 16:03:41
+ * @LastEditTime: 2023-06-25 16:03:41
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/utils/security/password.go
+ */
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordArgon2id = "argon2id"
+	PasswordBcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// PasswordParams 密码哈希算法及参数，Memory 单位为 KiB
+type PasswordParams struct {
+	Algorithm  string
+	BcryptCost int
+	Time       uint32
+	Memory     uint32
+	Threads    uint8
+}
+
+// PasswordHash 按参数生成密码哈希，argon2id 使用 PHC 字符串格式
+func PasswordHash(plain string, p PasswordParams) (string, error) {
+	if p.Algorithm == PasswordBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(plain), p.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(plain), salt, p.Time, p.Memory, p.Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// PasswordVerify 校验密码，同时支持 bcrypt 和 argon2id 哈希
+func PasswordVerify(plain, hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		p, salt, key, err := argon2Decode(hash)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(plain), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
+	return ValidatePassword(plain, hash)
+}
+
+// PasswordNeedsRehash 判断哈希的算法或参数是否与当前配置不一致
+func PasswordNeedsRehash(hash string, p PasswordParams) bool {
+	if p.Algorithm == PasswordBcrypt {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != p.BcryptCost
+	}
+	old, _, _, err := argon2Decode(hash)
+	return err != nil || old.Time != p.Time || old.Memory != p.Memory || old.Threads != p.Threads
+}
+
+func argon2Decode(hash string) (p PasswordParams, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != PasswordArgon2id {
+		return p, nil, nil, fmt.Errorf("argon2id 哈希格式错误")
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("不支持的 argon2 版本:%d", version)
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return
+	}
+	p.Algorithm = PasswordArgon2id
+	return
+}
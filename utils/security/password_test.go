@@ -0,0 +1,105 @@
+/*
+ * @Author: cloudyi.li
+ * @Date: 2023-06-25 16:21:15
+ * @LastEditTime: 2023-06-25 16:21:15
+ * @LastEditors: cloudyi.li
+ * @FilePath: /chatserver-api/utils/security/password_test.go
+ */
+package security
+
+import (
+	"testing"
+)
+
+func TestPasswordHash(t *testing.T) {
+	argon := PasswordParams{Algorithm: PasswordArgon2id, Time: 1, Memory: 1024, Threads: 1}
+	bcryptLow := PasswordParams{Algorithm: PasswordBcrypt, BcryptCost: 4}
+	tests := []struct {
+		name   string
+		hashBy PasswordParams
+		now    PasswordParams
+		plain  string
+		verify string
+		want   bool
+		rehash bool
+	}{
+		{
+			name:   "argon2id",
+			hashBy: argon,
+			now:    argon,
+			plain:  "abcde1234",
+			verify: "abcde1234",
+			want:   true,
+			rehash: false,
+		},
+		{
+			name:   "argon2id wrong password",
+			hashBy: argon,
+			now:    argon,
+			plain:  "abcde1234",
+			verify: "abcde12345",
+			want:   false,
+			rehash: false,
+		},
+		{
+			name:   "argon2id params changed",
+			hashBy: argon,
+			now:    PasswordParams{Algorithm: PasswordArgon2id, Time: 2, Memory: 1024, Threads: 1},
+			plain:  "abcde1234",
+			verify: "abcde1234",
+			want:   true,
+			rehash: true,
+		},
+		{
+			name:   "bcrypt to argon2id",
+			hashBy: bcryptLow,
+			now:    argon,
+			plain:  "abcde1234",
+			verify: "abcde1234",
+			want:   true,
+			rehash: true,
+		},
+		{
+			name:   "bcrypt cost changed",
+			hashBy: bcryptLow,
+			now:    PasswordParams{Algorithm: PasswordBcrypt, BcryptCost: 5},
+			plain:  "abcde1234",
+			verify: "abcde1234",
+			want:   true,
+			rehash: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := PasswordHash(tt.plain, tt.hashBy)
+			if err != nil {
+				t.Fatalf("PasswordHash() error = %v", err)
+			}
+			if got := PasswordVerify(tt.verify, hash); got != tt.want {
+				t.Errorf("PasswordVerify() = %v, want %v", got, tt.want)
+			}
+			if got := PasswordNeedsRehash(hash, tt.now); got != tt.rehash {
+				t.Errorf("PasswordNeedsRehash() = %v, want %v", got, tt.rehash)
+			}
+		})
+	}
+}
+
+func TestPasswordVerifyMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "empty", hash: ""},
+		{name: "truncated", hash: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA"},
+		{name: "bad version", hash: "$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHQ$a2V5"},
+		{name: "bad base64", hash: "$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if PasswordVerify("abcde1234", tt.hash) {
+				t.Errorf("PasswordVerify() = true, want false")
+			}
+		})
+	}
+}